@@ -32,7 +32,9 @@ func (srv *Server) initAPI(addr string) {
 	handleHTTPRequest(mux, "/", srv.unrecognizedCallHandler)
 
 	// Consensus API Calls
+	handleHTTPRequest(mux, "/consensus/blocks", srv.consensusBlocksHandler)
 	handleHTTPRequest(mux, "/consensus/status", srv.consensusStatusHandler)
+	handleHTTPRequest(mux, "/consensus/sync", srv.consensusSyncHandler)
 	handleHTTPRequest(mux, "/consensus/synchronize", srv.consensusSynchronizeHandler)
 
 	// Daemon API Calls
@@ -46,10 +48,22 @@ func (srv *Server) initAPI(addr string) {
 	handleHTTPRequest(mux, "/debug/constants", srv.debugConstantsHandler)
 	handleHTTPRequest(mux, "/debug/mutextest", srv.mutexTestHandler)
 
+	// Explorer API Calls. The explorer is optional.
+	if srv.explorer != nil {
+		handleHTTPRequest(mux, "/explorer/status", srv.explorerStatusHandler)
+		handleHTTPRequest(mux, "/explorer/block/", srv.explorerBlockHandler)
+		handleHTTPRequest(mux, "/explorer/transaction/", srv.explorerTransactionHandler)
+		handleHTTPRequest(mux, "/explorer/address/", srv.explorerAddressHandler)
+		handleHTTPRequest(mux, "/explorer/targets", srv.explorerTargetsHandler)
+	}
+
 	// Gateway API Calls
 	handleHTTPRequest(mux, "/gateway/status", srv.gatewayStatusHandler)
 	handleHTTPRequest(mux, "/gateway/peers/add", srv.gatewayPeersAddHandler)
 	handleHTTPRequest(mux, "/gateway/peers/remove", srv.gatewayPeersRemoveHandler)
+	handleHTTPRequest(mux, "/gateway/bans", srv.gatewayBansHandler)
+	handleHTTPRequest(mux, "/gateway/bans/add", srv.gatewayBansAddHandler)
+	handleHTTPRequest(mux, "/gateway/bans/remove", srv.gatewayBansRemoveHandler)
 	handleHTTPRequest(mux, "/gateway/peer/add", srv.gatewayPeersAddHandler)         // DEPRECATED
 	handleHTTPRequest(mux, "/gateway/peer/remove", srv.gatewayPeersRemoveHandler)   // DEPRECATED
 	handleHTTPRequest(mux, "/gateway/synchronize", srv.consensusSynchronizeHandler) // DEPRECATED
@@ -57,6 +71,10 @@ func (srv *Server) initAPI(addr string) {
 	// Host API Calls
 	handleHTTPRequest(mux, "/host/announce", srv.hostAnnounceHandler)
 	handleHTTPRequest(mux, "/host/configure", srv.hostConfigureHandler)
+	handleHTTPRequest(mux, "/host/limits", srv.hostLimitsHandler)
+	handleHTTPRequest(mux, "/host/limits/configure", srv.hostLimitsConfigureHandler)
+	handleHTTPRequest(mux, "/host/pricing", srv.hostPricingHandler)
+	handleHTTPRequest(mux, "/host/pricing/configure", srv.hostPricingConfigureHandler)
 	handleHTTPRequest(mux, "/host/status", srv.hostStatusHandler)
 	handleHTTPRequest(mux, "/host/config", srv.hostConfigureHandler) // DEPRECATED
 
@@ -1,26 +1,83 @@
 package api
 
 import (
+	"fmt"
+	"math/big"
 	"net/http"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+const (
+	// hashrateWindow is the number of blocks used to estimate the hashrate of
+	// the network.
+	hashrateWindow = 144
+
+	// recentBlocksWindow is the number of recent block times returned by
+	// /consensus/status.
+	recentBlocksWindow = 10
+)
+
+// ConsensusInfo contains information about the consensus set, for use in
+// dashboards and other tools that track the network.
 type ConsensusInfo struct {
 	Height       types.BlockHeight
 	CurrentBlock types.BlockID
 	Target       types.Target
+
+	Sync              modules.SyncStatus
+	EstimatedHashrate *big.Int
+	MedianTimestamp   types.Timestamp
+	RecentBlockTimes  []int64
+
+	SiafundPool         types.Currency
+	ActiveContractCount uint64
+	ActiveContractSize  uint64
 }
 
 // consensusStatusHandler handles the API call asking for the consensus status.
 func (srv *Server) consensusStatusHandler(w http.ResponseWriter, req *http.Request) {
+	status := srv.cs.Status(hashrateWindow, recentBlocksWindow)
 	writeJSON(w, ConsensusInfo{
-		srv.cs.Height(),
-		srv.cs.CurrentBlock().ID(),
-		srv.cs.CurrentTarget(),
+		Height:       status.Height,
+		CurrentBlock: status.CurrentBlock,
+		Target:       status.Target,
+
+		Sync:              status.SyncStatus,
+		EstimatedHashrate: status.EstimatedHashrate,
+		MedianTimestamp:   status.EarliestTimestamp,
+		RecentBlockTimes:  status.RecentBlockTimes,
+
+		SiafundPool:         status.SiafundPool,
+		ActiveContractCount: status.FileContractCount,
+		ActiveContractSize:  status.FileContractTotalSize,
 	})
 }
 
+// consensusBlocksHandler handles the API call asking for the headers of a
+// range of blocks in the current path.
+func (srv *Server) consensusBlocksHandler(w http.ResponseWriter, req *http.Request) {
+	var start, end types.BlockHeight
+	_, err := fmt.Sscan(req.FormValue("start"), &start)
+	if err != nil {
+		writeError(w, "Malformed start height", http.StatusBadRequest)
+		return
+	}
+	_, err = fmt.Sscan(req.FormValue("end"), &end)
+	if err != nil {
+		writeError(w, "Malformed end height", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, srv.cs.BlockHeaders(start, end))
+}
+
+// consensusSyncHandler handles the API call asking for the progress of the
+// most recent synchronization.
+func (srv *Server) consensusSyncHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, srv.cs.SyncStatus())
+}
+
 // consensusSynchronizeHandler handles the API call asking for the consensus to
 // synchronize with other peers.
 func (srv *Server) consensusSynchronizeHandler(w http.ResponseWriter, req *http.Request) {
@@ -1,9 +1,11 @@
 package api
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/NebulousLabs/Sia/modules/consensus"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // TestBlockBootstrap checks that consensus.Synchronize probably synchronizes
@@ -30,3 +32,29 @@ func TestBlockBootstrap(t *testing.T) {
 		t.Fatal("heights do not match after synchronize")
 	}
 }
+
+// TestConsensusStatus mines a block and checks that it is reported by
+// /consensus/status and /consensus/blocks.
+func TestConsensusStatus(t *testing.T) {
+	st := newServerTester("TestConsensusStatus", t)
+	b, _, err := st.miner.FindBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.csUpdateWait()
+
+	var info ConsensusInfo
+	st.getAPI("/consensus/status", &info)
+	if info.CurrentBlock != b.ID() {
+		t.Fatal("status does not report the mined block")
+	}
+	if len(info.RecentBlockTimes) == 0 || info.EstimatedHashrate.Sign() <= 0 {
+		t.Error("status does not report recent blocks")
+	}
+
+	var headers []types.BlockHeader
+	st.getAPI(fmt.Sprintf("/consensus/blocks?start=%v&end=%v", info.Height-1, info.Height), &headers)
+	if len(headers) != 2 || headers[1].ID() != b.ID() || headers[1].ParentID != headers[0].ID() {
+		t.Error("blocks does not return the headers of the current path")
+	}
+}
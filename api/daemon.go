@@ -9,6 +9,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/NebulousLabs/Sia/build"
+
 	"github.com/inconshreveable/go-update"
 )
 
@@ -17,7 +19,7 @@ type UpdateInfo struct {
 	Version   string
 }
 
-const VERSION = "0.3.1"
+const VERSION = build.Version
 
 // TODO: Updates need to be signed!
 // TODO: Updating on Windows may not work correctly.
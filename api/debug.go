@@ -18,6 +18,8 @@ type SiaConstants struct {
 	SiafundCount          uint64
 	SiafundPortion        float64
 
+	ExtremeFutureThreshold types.Timestamp
+
 	InitialCoinbase uint64
 	MinimumCoinbase uint64
 
@@ -63,6 +65,8 @@ func (srv *Server) debugConstantsHandler(w http.ResponseWriter, req *http.Reques
 		MaturityDelay:         types.MaturityDelay,
 		SiafundPortion:        types.SiafundPortion,
 
+		ExtremeFutureThreshold: types.ExtremeFutureThreshold,
+
 		InitialCoinbase: types.InitialCoinbase,
 		MinimumCoinbase: types.MinimumCoinbase,
 		CoinbaseAugment: types.CoinbaseAugment,
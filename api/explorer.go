@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// scanHash parses a hex-encoded hash from the end of a request path.
+func scanHash(req *http.Request, prefix string) (h crypto.Hash, err error) {
+	var hashBytes []byte
+	_, err = fmt.Sscanf(strings.TrimPrefix(req.URL.Path, prefix), "%x", &hashBytes)
+	if err != nil || len(hashBytes) != len(h) {
+		return h, errors.New("malformed hash")
+	}
+	copy(h[:], hashBytes)
+	return h, nil
+}
+
+// explorerStatusHandler handles the API call asking for statistics about the
+// current path.
+func (srv *Server) explorerStatusHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, srv.explorer.Statistics())
+}
+
+// explorerBlockHandler handles the API call asking for a block by its ID.
+func (srv *Server) explorerBlockHandler(w http.ResponseWriter, req *http.Request) {
+	id, err := scanHash(req, "/explorer/block/")
+	if err != nil {
+		writeError(w, "Malformed block id", http.StatusBadRequest)
+		return
+	}
+	block, exists := srv.explorer.Block(types.BlockID(id))
+	if !exists {
+		writeError(w, "Block not found in the current path", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, block)
+}
+
+// explorerTransactionHandler handles the API call asking for a transaction by
+// its ID.
+func (srv *Server) explorerTransactionHandler(w http.ResponseWriter, req *http.Request) {
+	id, err := scanHash(req, "/explorer/transaction/")
+	if err != nil {
+		writeError(w, "Malformed transaction id", http.StatusBadRequest)
+		return
+	}
+	txn, exists := srv.explorer.Transaction(id)
+	if !exists {
+		writeError(w, "Transaction not found in the current path", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, txn)
+}
+
+// explorerAddressHandler handles the API call asking for the activity of an
+// address.
+func (srv *Server) explorerAddressHandler(w http.ResponseWriter, req *http.Request) {
+	uh, err := scanHash(req, "/explorer/address/")
+	if err != nil {
+		writeError(w, "Malformed address", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, srv.explorer.Address(types.UnlockHash(uh)))
+}
+
+// explorerTargetsHandler handles the API call asking for the targets of a
+// range of blocks.
+func (srv *Server) explorerTargetsHandler(w http.ResponseWriter, req *http.Request) {
+	var start, end types.BlockHeight
+	_, err := fmt.Sscan(req.FormValue("start"), &start)
+	if err != nil {
+		writeError(w, "Malformed start height", http.StatusBadRequest)
+		return
+	}
+	_, err = fmt.Sscan(req.FormValue("end"), &end)
+	if err != nil {
+		writeError(w, "Malformed end height", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, srv.explorer.Targets(start, end))
+}
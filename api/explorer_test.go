@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestExplorerLookups mines a block and checks that it can be looked up
+// through the explorer API.
+func TestExplorerLookups(t *testing.T) {
+	st := newServerTester("TestExplorerLookups", t)
+	b, _, err := st.miner.FindBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.csUpdateWait()
+
+	// The explorer receives updates asynchronously, so wait for it to index
+	// the block.
+	var stats modules.ExplorerStatistics
+	for i := 0; stats.CurrentBlock != b.ID(); i++ {
+		if i == 100 {
+			t.Fatal("explorer did not index the mined block")
+		}
+		time.Sleep(10 * time.Millisecond)
+		st.getAPI("/explorer/status", &stats)
+	}
+
+	var eb modules.ExplorerBlock
+	st.getAPI(fmt.Sprintf("/explorer/block/%x", b.ID()), &eb)
+	if eb.ID != b.ID() || eb.Height != stats.Height {
+		t.Error("explorer returned the wrong block")
+	}
+	var ea modules.ExplorerAddress
+	st.getAPI(fmt.Sprintf("/explorer/address/%x", b.MinerPayouts[0].UnlockHash), &ea)
+	if len(ea.Blocks) == 0 || ea.Blocks[len(ea.Blocks)-1] != b.ID() {
+		t.Error("explorer did not index the miner payout address")
+	}
+	var targets []types.Target
+	st.getAPI(fmt.Sprintf("/explorer/targets?start=0&end=%v", stats.Height), &targets)
+	if len(targets) != int(stats.Height)+1 || targets[stats.Height] != eb.Target {
+		t.Error("explorer returned the wrong targets")
+	}
+
+	// An unknown block is not found.
+	resp, err := http.Get(fmt.Sprintf("http://localhost%v/explorer/block/%x", st.server.apiServer.Addr, types.BlockID{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Error("unknown block was found:", resp.StatusCode)
+	}
+}
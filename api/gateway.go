@@ -7,13 +7,14 @@ import (
 )
 
 type GatewayInfo struct {
-	Address modules.NetAddress
-	Peers   []modules.NetAddress
+	Address  modules.NetAddress
+	Peers    []modules.NetAddress
+	PeerInfo []modules.PeerInfo
 }
 
 // gatewayStatusHandler handles the API call asking for the gatway status.
 func (srv *Server) gatewayStatusHandler(w http.ResponseWriter, req *http.Request) {
-	writeJSON(w, GatewayInfo{srv.gateway.Address(), srv.gateway.Peers()})
+	writeJSON(w, GatewayInfo{srv.gateway.Address(), srv.gateway.Peers(), srv.gateway.PeerInfo()})
 }
 
 // gatewayPeersAddHandler handles the API call to add a peer to the gateway.
@@ -39,3 +40,32 @@ func (srv *Server) gatewayPeersRemoveHandler(w http.ResponseWriter, req *http.Re
 
 	writeSuccess(w)
 }
+
+// gatewayBansHandler handles the API call asking for the gateway's bans.
+func (srv *Server) gatewayBansHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, srv.gateway.Bans())
+}
+
+// gatewayBansAddHandler handles the API call to ban a peer.
+func (srv *Server) gatewayBansAddHandler(w http.ResponseWriter, req *http.Request) {
+	addr := modules.NetAddress(req.FormValue("address"))
+	err := srv.gateway.Ban(addr)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeSuccess(w)
+}
+
+// gatewayBansRemoveHandler handles the API call to unban a peer.
+func (srv *Server) gatewayBansRemoveHandler(w http.ResponseWriter, req *http.Request) {
+	addr := modules.NetAddress(req.FormValue("address"))
+	err := srv.gateway.Unban(addr)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeSuccess(w)
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/gateway"
 	"github.com/NebulousLabs/Sia/modules/tester"
 	"github.com/NebulousLabs/Sia/types"
@@ -45,7 +46,7 @@ func TestGatewayStatus(t *testing.T) {
 
 func TestGatewayPeerAdd(t *testing.T) {
 	st := newServerTester("TestGatewayPeerAdd", t)
-	peer, err := gateway.New(":0", tester.TempDir("api", "TestGatewayPeerAdd", "gateway"))
+	peer, err := gateway.New(":0", "", tester.TempDir("api", "TestGatewayPeerAdd", "gateway"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -60,7 +61,7 @@ func TestGatewayPeerAdd(t *testing.T) {
 
 func TestGatewayPeerRemove(t *testing.T) {
 	st := newServerTester("TestGatewayPeerRemove", t)
-	peer, err := gateway.New(":0", tester.TempDir("api", "TestGatewayPeerRemove", "gateway"))
+	peer, err := gateway.New(":0", "", tester.TempDir("api", "TestGatewayPeerRemove", "gateway"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -79,6 +80,34 @@ func TestGatewayPeerRemove(t *testing.T) {
 	}
 }
 
+func TestGatewayBans(t *testing.T) {
+	st := newServerTester("TestGatewayBans", t)
+	peer, err := gateway.New(":0", "", tester.TempDir("api", "TestGatewayBans", "gateway"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.callAPI("/gateway/peer/add?address=" + string(peer.Address()))
+
+	// Banning the peer should disconnect it.
+	st.callAPI("/gateway/bans/add?address=" + string(peer.Address()))
+	var bans []modules.PeerBan
+	st.getAPI("/gateway/bans", &bans)
+	if len(bans) != 1 || bans[0].Host != peer.Address().Host() {
+		t.Fatal("/gateway/bans/add did not ban peer", peer.Address())
+	}
+	var info GatewayInfo
+	st.getAPI("/gateway/status", &info)
+	if len(info.Peers) != 0 {
+		t.Fatal("/gateway/bans/add did not disconnect peer", peer.Address())
+	}
+
+	st.callAPI("/gateway/bans/remove?address=" + string(peer.Address()))
+	st.getAPI("/gateway/bans", &bans)
+	if len(bans) != 0 {
+		t.Fatal("/gateway/bans/remove did not unban peer", peer.Address())
+	}
+}
+
 // TestTransactionRelay checks that an unconfirmed transaction is relayed to
 // all peers.
 func TestTransactionRelay(t *testing.T) {
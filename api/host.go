@@ -3,12 +3,19 @@ package api
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/NebulousLabs/Sia/modules"
 )
 
 // hostAnnounceHandler handles the API call to get the host to announce itself
-// to the network.
+// to the network, optionally at a user-specified address.
 func (srv *Server) hostAnnounceHandler(w http.ResponseWriter, req *http.Request) {
-	err := srv.host.Announce()
+	var err error
+	if addr := req.FormValue("address"); addr != "" {
+		err = srv.host.AnnounceAddress(modules.NetAddress(addr))
+	} else {
+		err = srv.host.Announce()
+	}
 	if err != nil {
 		writeError(w, "Could not announce host:"+err.Error(), http.StatusBadRequest)
 		return
@@ -31,6 +38,8 @@ func (srv *Server) hostConfigureHandler(w http.ResponseWriter, req *http.Request
 		"windowSize":   &config.WindowSize,
 		"price":        &config.Price,
 		"collateral":   &config.Collateral,
+
+		"downloadPrice": &config.DownloadPrice,
 	}
 
 	any := false
@@ -59,6 +68,96 @@ func (srv *Server) hostConfigureHandler(w http.ResponseWriter, req *http.Request
 	writeSuccess(w)
 }
 
+// hostLimitsHandler handles the API call that queries the limits the host
+// places on its connections.
+func (srv *Server) hostLimitsHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, srv.host.Limits())
+}
+
+// hostLimitsConfigureHandler handles the API call to set the limits the host
+// places on its connections.
+func (srv *Server) hostLimitsConfigureHandler(w http.ResponseWriter, req *http.Request) {
+	// load current limits
+	limits := srv.host.Limits()
+
+	// map each query string to a field in the limits
+	qsVars := map[string]interface{}{
+		"maxConnections": &limits.MaxConnections,
+		"maxRPCsPerIP":   &limits.MaxRPCsPerIP,
+		"timeout":        &limits.Timeout,
+		"uploadLimit":    &limits.UploadLimit,
+		"downloadLimit":  &limits.DownloadLimit,
+	}
+
+	any := false
+	for qs := range qsVars {
+		// only modify supplied values
+		if req.FormValue(qs) != "" {
+			_, err := fmt.Sscan(req.FormValue(qs), qsVars[qs])
+			if err != nil {
+				writeError(w, "Malformed "+qs, http.StatusBadRequest)
+				return
+			}
+			any = true
+		}
+	}
+	if !any {
+		writeError(w, "No valid limit fields specified", http.StatusBadRequest)
+		return
+	}
+
+	srv.host.SetLimits(limits)
+	writeSuccess(w)
+}
+
+// hostPricingHandler handles the API call that queries the host's pricing
+// policy.
+func (srv *Server) hostPricingHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, srv.host.PricingPolicy())
+}
+
+// hostPricingConfigureHandler handles the API call to set the host's pricing
+// policy.
+func (srv *Server) hostPricingConfigureHandler(w http.ResponseWriter, req *http.Request) {
+	// load current policy
+	policy := srv.host.PricingPolicy()
+
+	// map each query string to a field in the pricing policy
+	qsVars := map[string]interface{}{
+		"enabled":            &policy.Enabled,
+		"basePrice":          &policy.BasePrice,
+		"targetPrice":        &policy.TargetPrice,
+		"referenceRate":      &policy.ReferenceRate,
+		"utilizationPremium": &policy.UtilizationPremium,
+		"minPrice":           &policy.MinPrice,
+		"maxPrice":           &policy.MaxPrice,
+	}
+
+	any := false
+	for qs := range qsVars {
+		// only modify supplied values
+		if req.FormValue(qs) != "" {
+			_, err := fmt.Sscan(req.FormValue(qs), qsVars[qs])
+			if err != nil {
+				writeError(w, "Malformed "+qs, http.StatusBadRequest)
+				return
+			}
+			any = true
+		}
+	}
+	if !any {
+		writeError(w, "No valid pricing fields specified", http.StatusBadRequest)
+		return
+	}
+
+	err := srv.host.SetPricingPolicy(policy)
+	if err != nil {
+		writeError(w, "Could not set pricing policy: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeSuccess(w)
+}
+
 // hostStatusHandler handles the API call that queries the host status.
 func (srv *Server) hostStatusHandler(w http.ResponseWriter, req *http.Request) {
 	writeJSON(w, srv.host.Info())
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/NebulousLabs/Sia/modules"
@@ -29,9 +30,26 @@ type FileInfo struct {
 	TimeRemaining types.BlockHeight
 }
 
-// renterFilesDownloadHandler handles the API call to download a file.
+// renterFilesDownloadHandler handles the API call to download a file. If an
+// offset or length is supplied, only that range of the file is downloaded.
 func (srv *Server) renterFilesDownloadHandler(w http.ResponseWriter, req *http.Request) {
-	err := srv.renter.Download(req.FormValue("nickname"), req.FormValue("destination"))
+	var err error
+	if req.FormValue("offset") == "" && req.FormValue("length") == "" {
+		err = srv.renter.Download(req.FormValue("nickname"), req.FormValue("destination"))
+	} else {
+		var offset, length uint64
+		_, err = fmt.Sscan(req.FormValue("offset"), &offset)
+		if err != nil {
+			writeError(w, "Malformed offset", http.StatusBadRequest)
+			return
+		}
+		_, err = fmt.Sscan(req.FormValue("length"), &length)
+		if err != nil {
+			writeError(w, "Malformed length", http.StatusBadRequest)
+			return
+		}
+		err = srv.renter.DownloadRange(req.FormValue("nickname"), req.FormValue("destination"), offset, length)
+	}
 	if err != nil {
 		writeError(w, "Download failed: "+err.Error(), http.StatusInternalServerError)
 		return
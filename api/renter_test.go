@@ -1,6 +1,8 @@
 package api
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
 	"testing"
 	"time"
@@ -69,4 +71,20 @@ func TestUploadAndDownload(t *testing.T) {
 	if upRoot != downRoot {
 		t.Error("uploaded and downloaded file have a hash mismatch")
 	}
+
+	// Download a range of the file.
+	rangeName := tester.TempDir("api", "TestUploadAndDownload", "downloadRangeTestData")
+	st.callAPI("/renter/files/download?nickname=first&offset=100&length=1000&destination=" + rangeName)
+	time.Sleep(time.Second * 2)
+	upBytes, err := ioutil.ReadFile(uploadName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rangeBytes, err := ioutil.ReadFile(rangeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Compare(rangeBytes, upBytes[100:1100]) != 0 {
+		t.Error("downloaded range does not match the uploaded file")
+	}
 }
@@ -10,29 +10,31 @@ import (
 // A Server is essentially a collection of modules and an API server to talk
 // to them all.
 type Server struct {
-	cs      *consensus.State
-	gateway modules.Gateway
-	host    modules.Host
-	hostdb  modules.HostDB
-	miner   modules.Miner
-	renter  modules.Renter
-	tpool   modules.TransactionPool
-	wallet  modules.Wallet
+	cs       *consensus.State
+	explorer modules.Explorer
+	gateway  modules.Gateway
+	host     modules.Host
+	hostdb   modules.HostDB
+	miner    modules.Miner
+	renter   modules.Renter
+	tpool    modules.TransactionPool
+	wallet   modules.Wallet
 
 	apiServer *graceful.Server
 }
 
 // NewServer creates a new API server from the provided modules.
-func NewServer(APIaddr string, s *consensus.State, g modules.Gateway, h modules.Host, hdb modules.HostDB, m modules.Miner, r modules.Renter, tp modules.TransactionPool, w modules.Wallet) (*Server, error) {
+func NewServer(APIaddr string, s *consensus.State, e modules.Explorer, g modules.Gateway, h modules.Host, hdb modules.HostDB, m modules.Miner, r modules.Renter, tp modules.TransactionPool, w modules.Wallet) (*Server, error) {
 	srv := &Server{
-		cs:      s,
-		gateway: g,
-		host:    h,
-		hostdb:  hdb,
-		miner:   m,
-		renter:  r,
-		tpool:   tp,
-		wallet:  w,
+		cs:       s,
+		explorer: e,
+		gateway:  g,
+		host:     h,
+		hostdb:   hdb,
+		miner:    m,
+		renter:   r,
+		tpool:    tp,
+		wallet:   w,
 	}
 
 	// Register API handlers
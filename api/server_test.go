@@ -10,6 +10,7 @@ import (
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
+	"github.com/NebulousLabs/Sia/modules/explorer"
 	"github.com/NebulousLabs/Sia/modules/gateway"
 	"github.com/NebulousLabs/Sia/modules/host"
 	"github.com/NebulousLabs/Sia/modules/hostdb"
@@ -32,14 +33,15 @@ var (
 // serverTester contains a server and a set of channels for keeping all of the
 // modules synchronized during testing.
 type serverTester struct {
-	cs      *consensus.State
-	gateway modules.Gateway
-	host    modules.Host
-	hostdb  modules.HostDB
-	miner   modules.Miner
-	renter  modules.Renter
-	tpool   modules.TransactionPool
-	wallet  modules.Wallet
+	cs       *consensus.State
+	explorer modules.Explorer
+	gateway  modules.Gateway
+	host     modules.Host
+	hostdb   modules.HostDB
+	miner    modules.Miner
+	renter   modules.Renter
+	tpool    modules.TransactionPool
+	wallet   modules.Wallet
 
 	server *Server
 
@@ -80,7 +82,7 @@ func newServerTester(name string, t *testing.T) *serverTester {
 	APIPort++
 
 	// Create the modules.
-	g, err := gateway.New(":0", filepath.Join(testdir, "gateway"))
+	g, err := gateway.New(":0", "", filepath.Join(testdir, "gateway"))
 	if err != nil {
 		t.Fatal("Failed to create gateway:", err)
 	}
@@ -88,6 +90,10 @@ func newServerTester(name string, t *testing.T) *serverTester {
 	if err != nil {
 		t.Fatal("Failed to create consensus set:", err)
 	}
+	e, err := explorer.New(cs, filepath.Join(testdir, "explorer"))
+	if err != nil {
+		t.Fatal("Failed to create explorer:", err)
+	}
 	tp, err := transactionpool.New(cs, g)
 	if err != nil {
 		t.Fatal("Failed to create tpool:", err)
@@ -100,11 +106,11 @@ func newServerTester(name string, t *testing.T) *serverTester {
 	if err != nil {
 		t.Fatal("Failed to create miner:", err)
 	}
-	h, err := host.New(cs, tp, w, ":0", filepath.Join(testdir, "host"))
+	h, err := host.New(cs, g, tp, w, ":0", filepath.Join(testdir, "host"))
 	if err != nil {
 		t.Fatal("Failed to create host:", err)
 	}
-	hdb, err := hostdb.New(cs, g)
+	hdb, err := hostdb.New(cs, g, filepath.Join(testdir, "hostdb"))
 	if err != nil {
 		t.Fatal("Failed to create hostdb:", err)
 	}
@@ -112,21 +118,22 @@ func newServerTester(name string, t *testing.T) *serverTester {
 	if err != nil {
 		t.Fatal("Failed to create renter:", err)
 	}
-	srv, err := NewServer(APIAddr, cs, g, h, hdb, m, r, tp, w)
+	srv, err := NewServer(APIAddr, cs, e, g, h, hdb, m, r, tp, w)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// Assemble the serverTester.
 	st := &serverTester{
-		cs:      cs,
-		gateway: g,
-		host:    h,
-		hostdb:  hdb,
-		miner:   m,
-		renter:  r,
-		tpool:   tp,
-		wallet:  w,
+		cs:       cs,
+		explorer: e,
+		gateway:  g,
+		host:     h,
+		hostdb:   hdb,
+		miner:    m,
+		renter:   r,
+		tpool:    tp,
+		wallet:   w,
 
 		server: srv,
 
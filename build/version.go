@@ -0,0 +1,4 @@
+package build
+
+// Version is the current version of siad.
+const Version = "0.3.1"
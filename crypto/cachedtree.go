@@ -0,0 +1,110 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	ErrBadSubtree = errors.New("subtree data does not fit in the cached tree")
+)
+
+// A CachedTree is a Merkle tree that stores the roots of its subtrees at a
+// fixed height instead of the data of the file. Each cached subtree covers
+// 2^height segments. The root of the tree can be updated after data is
+// appended or a subtree is modified, without rehashing the rest of the file.
+//
+// Only the data of the final, partially filled subtree is kept, so that data
+// can be appended to the tree in pieces of any size.
+type CachedTree struct {
+	height       uint64
+	subtreeRoots []Hash
+	tail         []byte
+}
+
+// NewCachedTree returns an empty CachedTree that caches the roots of subtrees
+// covering 2^height segments.
+func NewCachedTree(height uint64) *CachedTree {
+	return &CachedTree{height: height}
+}
+
+// subtreeBytes returns the number of bytes covered by a full cached subtree.
+func (ct *CachedTree) subtreeBytes() int {
+	return SegmentSize << ct.height
+}
+
+// bytesRoot returns the Merkle root of a slice of data.
+func bytesRoot(data []byte) Hash {
+	// ReaderMerkleRoot can only fail if the reader fails.
+	root, _ := ReaderMerkleRoot(bytes.NewReader(data))
+	return root
+}
+
+// Append adds data to the end of the tree.
+func (ct *CachedTree) Append(data []byte) {
+	ct.tail = append(ct.tail, data...)
+	for len(ct.tail) >= ct.subtreeBytes() {
+		ct.subtreeRoots = append(ct.subtreeRoots, bytesRoot(ct.tail[:ct.subtreeBytes()]))
+		ct.tail = ct.tail[ct.subtreeBytes():]
+	}
+	ct.tail = append([]byte(nil), ct.tail...)
+}
+
+// NumSubtrees returns the number of cached subtrees in the tree, including the
+// final subtree if it is only partially filled.
+func (ct *CachedTree) NumSubtrees() uint64 {
+	if len(ct.tail) > 0 {
+		return uint64(len(ct.subtreeRoots)) + 1
+	}
+	return uint64(len(ct.subtreeRoots))
+}
+
+// NumSegments returns the number of segments in the tree.
+func (ct *CachedTree) NumSegments() uint64 {
+	return uint64(len(ct.subtreeRoots))<<ct.height + CalculateSegments(uint64(len(ct.tail)))
+}
+
+// SetSubtree replaces the data of the cached subtree at index i. The data must
+// be the same size as the data it replaces, so the size of the tree never
+// changes; Append should be used to add data to the tree.
+func (ct *CachedTree) SetSubtree(i uint64, data []byte) error {
+	switch {
+	case i < uint64(len(ct.subtreeRoots)):
+		if len(data) != ct.subtreeBytes() {
+			return ErrBadSubtree
+		}
+		ct.subtreeRoots[i] = bytesRoot(data)
+	case i == uint64(len(ct.subtreeRoots)) && len(ct.tail) > 0:
+		if len(data) != len(ct.tail) {
+			return ErrBadSubtree
+		}
+		ct.tail = append([]byte(nil), data...)
+	default:
+		return ErrBadSubtree
+	}
+	return nil
+}
+
+// rootOfRoots combines the roots of adjacent subtrees into a single root. The
+// tree of subtrees is split the same way as a tree of segments, which is
+// correct because every subtree except the last covers the same number of
+// segments, and that number is a power of 2.
+func rootOfRoots(roots []Hash) Hash {
+	if len(roots) == 1 {
+		return roots[0]
+	}
+	split := leftSubtreeSize(uint64(len(roots)))
+	return nodeHash(rootOfRoots(roots[:split]), rootOfRoots(roots[split:]))
+}
+
+// Root returns the Merkle root of the tree.
+func (ct *CachedTree) Root() Hash {
+	roots := ct.subtreeRoots
+	if len(ct.tail) > 0 {
+		roots = append(roots[:len(roots):len(roots)], bytesRoot(ct.tail))
+	}
+	if len(roots) == 0 {
+		return Hash{}
+	}
+	return rootOfRoots(roots)
+}
@@ -0,0 +1,83 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// TestCachedTreeAppend appends data to cached trees of several heights in
+// uneven pieces and checks that the root matches the root of the data.
+func TestCachedTreeAppend(t *testing.T) {
+	data := make([]byte, 37*SegmentSize+5)
+	rand.Read(data)
+
+	for height := uint64(0); height < 4; height++ {
+		ct := NewCachedTree(height)
+		for i := 0; i < len(data); i += 100 {
+			end := i + 100
+			if end > len(data) {
+				end = len(data)
+			}
+			ct.Append(data[i:end])
+
+			root, err := ReaderMerkleRoot(bytes.NewReader(data[:end]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ct.Root() != root {
+				t.Fatal("cached tree root does not match after appending", end, "bytes at height", height)
+			}
+			if ct.NumSegments() != CalculateSegments(uint64(end)) {
+				t.Error("cached tree has the wrong number of segments:", ct.NumSegments())
+			}
+		}
+	}
+}
+
+// TestCachedTreeSetSubtree modifies the subtrees of a cached tree and checks
+// that the root matches the root of the modified data.
+func TestCachedTreeSetSubtree(t *testing.T) {
+	const height = 2
+	subtreeSize := SegmentSize << height
+	data := make([]byte, 5*subtreeSize+10)
+	rand.Read(data)
+	ct := NewCachedTree(height)
+	ct.Append(data)
+	if ct.NumSubtrees() != 6 {
+		t.Fatal("expected 6 subtrees, got", ct.NumSubtrees())
+	}
+
+	// Modify a full subtree and the partial subtree.
+	rand.Read(data[2*subtreeSize : 3*subtreeSize])
+	err := ct.SetSubtree(2, data[2*subtreeSize:3*subtreeSize])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rand.Read(data[5*subtreeSize:])
+	err = ct.SetSubtree(5, data[5*subtreeSize:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.Root() != root {
+		t.Error("cached tree root does not match after modifying subtrees")
+	}
+
+	// Subtrees cannot change size.
+	if ct.SetSubtree(1, data[:subtreeSize-1]) != ErrBadSubtree {
+		t.Error("full subtree was allowed to shrink")
+	}
+	if ct.SetSubtree(5, data[:11]) != ErrBadSubtree {
+		t.Error("partial subtree was allowed to grow")
+	}
+	if ct.SetSubtree(5, data[:9]) != ErrBadSubtree {
+		t.Error("partial subtree was allowed to shrink")
+	}
+	if ct.SetSubtree(6, data[:1]) != ErrBadSubtree {
+		t.Error("nonexistent subtree was allowed to be set")
+	}
+}
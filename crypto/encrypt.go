@@ -6,13 +6,25 @@ package crypto
 import (
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 
 	"golang.org/x/crypto/twofish"
 )
 
+const (
+	// TwofishNonceSize is the size of the nonce that EncryptBytes prepends to
+	// the ciphertext.
+	TwofishNonceSize = 12
+
+	// TwofishOverhead is the number of bytes that EncryptBytes adds to the
+	// plaintext: the nonce and the GCM authentication tag.
+	TwofishOverhead = TwofishNonceSize + 16
+)
+
 var (
 	ErrInsufficientLen = errors.New("supplied ciphertext is not long enough to contain a nonce")
+	ErrRangeTooLarge   = errors.New("range extends beyond the largest ciphertext that GCM supports")
 )
 
 type (
@@ -27,15 +39,20 @@ func GenerateTwofishKey() (key TwofishKey, err error) {
 	return
 }
 
-// EncryptBytes encrypts a []byte using the key. EncryptBytes uses GCM and
-// prepends the nonce (12 bytes) to the ciphertext.
-func (key TwofishKey) EncryptBytes(plaintext []byte) (ct Ciphertext, err error) {
-	// Create the cipher, encryptor, and nonce.
+// NewAEAD returns a Twofish-GCM cipher that uses the key.
+func (key TwofishKey) NewAEAD() (cipher.AEAD, error) {
 	twofishCipher, err := twofish.NewCipher(key[:])
 	if err != nil {
 		return nil, err
 	}
-	aead, err := cipher.NewGCM(twofishCipher)
+	return cipher.NewGCM(twofishCipher)
+}
+
+// EncryptBytes encrypts a []byte using the key. EncryptBytes uses GCM and
+// prepends the nonce (12 bytes) to the ciphertext.
+func (key TwofishKey) EncryptBytes(plaintext []byte) (ct Ciphertext, err error) {
+	// Create the cipher, encryptor, and nonce.
+	aead, err := key.NewAEAD()
 	if err != nil {
 		return nil, err
 	}
@@ -55,11 +72,7 @@ func (key TwofishKey) EncryptBytes(plaintext []byte) (ct Ciphertext, err error)
 // expected to be the first 12 bytes of the ciphertext.
 func (key TwofishKey) DecryptBytes(ct Ciphertext) (plaintext []byte, err error) {
 	// Create the cipher.
-	twofishCipher, err := twofish.NewCipher(key[:])
-	if err != nil {
-		return nil, err
-	}
-	aead, err := cipher.NewGCM(twofishCipher)
+	aead, err := key.NewAEAD()
 	if err != nil {
 		return nil, err
 	}
@@ -76,3 +89,40 @@ func (key TwofishKey) DecryptBytes(ct Ciphertext) (plaintext []byte, err error)
 	}
 	return plaintext, nil
 }
+
+// DecryptRange decrypts part of the ciphertext created by EncryptBytes. 'ct'
+// holds the ciphertext of the plaintext bytes that start at 'offset', and
+// 'nonce' holds the first 12 bytes of the full ciphertext. GCM encrypts with a
+// counter stream, so any range can be decrypted on its own, but the range is
+// not authenticated; its integrity must be checked some other way, such as
+// with a Merkle proof.
+func (key TwofishKey) DecryptRange(nonce []byte, ct Ciphertext, offset uint64) (plaintext []byte, err error) {
+	if len(nonce) != TwofishNonceSize {
+		return nil, ErrInsufficientLen
+	}
+	twofishCipher, err := twofish.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// GCM encrypts block i of the plaintext with the counter block formed by
+	// the nonce and the 32-bit counter i+2; counter 1 is used for the tag. The
+	// counter must not wrap, as cipher.NewCTR would carry into the nonce.
+	blockSize := uint64(twofishCipher.BlockSize())
+	lastBlock := (offset + uint64(len(ct))) / blockSize
+	if lastBlock+2 > 1<<32-1 {
+		return nil, ErrRangeTooLarge
+	}
+	iv := make([]byte, blockSize)
+	copy(iv, nonce)
+	binary.BigEndian.PutUint32(iv[TwofishNonceSize:], uint32(offset/blockSize+2))
+	stream := cipher.NewCTR(twofishCipher, iv)
+
+	// Discard the part of the keystream that precedes the offset within its
+	// block.
+	skip := make([]byte, offset%blockSize)
+	stream.XORKeyStream(skip, skip)
+	plaintext = make([]byte, len(ct))
+	stream.XORKeyStream(plaintext, ct)
+	return plaintext, nil
+}
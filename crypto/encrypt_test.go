@@ -75,6 +75,52 @@ func TestTwofishEncryption(t *testing.T) {
 
 }
 
+// TestTwofishDecryptRange checks that any range of a ciphertext created by
+// EncryptBytes can be decrypted on its own.
+func TestTwofishDecryptRange(t *testing.T) {
+	key, err := GenerateTwofishKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := make([]byte, 600)
+	_, err = rand.Read(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := key.EncryptBytes(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ciphertext) != len(plaintext)+TwofishOverhead {
+		t.Fatal("unexpected ciphertext overhead:", len(ciphertext)-len(plaintext))
+	}
+
+	nonce := ciphertext[:TwofishNonceSize]
+	body := ciphertext[TwofishNonceSize:]
+	ranges := []struct{ offset, length uint64 }{
+		{0, 600},
+		{0, 1},
+		{5, 11},
+		{16, 16},
+		{17, 200},
+		{599, 1},
+	}
+	for _, r := range ranges {
+		decrypted, err := key.DecryptRange(nonce, body[r.offset:r.offset+r.length], r.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Compare(decrypted, plaintext[r.offset:r.offset+r.length]) != 0 {
+			t.Errorf("range %v-%v decrypted incorrectly", r.offset, r.offset+r.length)
+		}
+	}
+
+	_, err = key.DecryptRange(nonce[:10], body, 0)
+	if err != ErrInsufficientLen {
+		t.Error("Expecting ErrInsufficientLen:", err)
+	}
+}
+
 // TestTwofishEntropy encrypts and then decrypts a zero plaintext, checking
 // that the ciphertext is high entropy.
 func TestTwofishEntropy(t *testing.T) {
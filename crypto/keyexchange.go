@@ -0,0 +1,39 @@
+package crypto
+
+// keyexchange.go contains functions for deriving a shared secret between two
+// parties using ephemeral curve25519 keys.
+
+import (
+	"crypto/rand"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+type (
+	ExchangeSecretKey [32]byte
+	ExchangePublicKey [32]byte
+)
+
+// GenerateExchangeKeys creates an ephemeral keypair that can be used to derive
+// a shared secret with another party.
+func GenerateExchangeKeys() (sk ExchangeSecretKey, pk ExchangePublicKey, err error) {
+	_, err = rand.Read(sk[:])
+	if err != nil {
+		return
+	}
+	skNorm := [32]byte(sk)
+	pkNorm := [32]byte(pk)
+	curve25519.ScalarBaseMult(&pkNorm, &skNorm)
+	pk = ExchangePublicKey(pkNorm)
+	return
+}
+
+// SharedSecret combines a secret key with the public key of the other party,
+// returning a secret that only the two parties know.
+func (sk ExchangeSecretKey) SharedSecret(pk ExchangePublicKey) Hash {
+	skNorm := [32]byte(sk)
+	pkNorm := [32]byte(pk)
+	var secret [32]byte
+	curve25519.ScalarMult(&secret, &skNorm, &pkNorm)
+	return HashBytes(secret[:])
+}
@@ -1,7 +1,9 @@
 package crypto
 
 import (
+	"errors"
 	"io"
+	"io/ioutil"
 
 	"github.com/NebulousLabs/Sia/encoding"
 
@@ -12,6 +14,10 @@ const (
 	SegmentSize = 64 // number of bytes that are hashed to form each base leaf of the Merkle tree
 )
 
+var (
+	ErrBadRange = errors.New("range is not within the segments of the tree")
+)
+
 type tree struct {
 	*merkletree.Tree
 }
@@ -88,3 +94,177 @@ func VerifySegment(base [SegmentSize]byte, hashSet []Hash, numSegments, proofInd
 	}
 	return merkletree.VerifyProof(NewHash(), root[:], proofSet, proofIndex, numSegments)
 }
+
+// nodeHash combines two subtree roots into the root of their parent, using the
+// same prefix as the merkletree package.
+func nodeHash(left, right Hash) Hash {
+	return HashBytes(append(append([]byte{1}, left[:]...), right[:]...))
+}
+
+// leftSubtreeSize returns the number of leaves in the left subtree of a tree
+// with n leaves, which is the largest power of 2 that is less than n.
+func leftSubtreeSize(n uint64) uint64 {
+	size := uint64(1)
+	for size*2 < n {
+		size *= 2
+	}
+	return size
+}
+
+// readerSubtreeRoot reads up to n segments from r and returns the Merkle root
+// of the segments.
+func readerSubtreeRoot(r io.Reader, n uint64) (h Hash, err error) {
+	return ReaderMerkleRoot(io.LimitReader(r, int64(n*SegmentSize)))
+}
+
+// A segmentRange is a range of segments [start, end).
+type segmentRange struct {
+	start, end uint64
+}
+
+// classifySubtree reports whether the subtree of 'n' leaves that begins at
+// 'offset' is entirely covered by one of the ranges, and whether it overlaps
+// any of the ranges. The ranges must be sorted and disjoint.
+func classifySubtree(offset, n uint64, ranges []segmentRange) (covered, overlaps bool) {
+	for _, sr := range ranges {
+		if sr.start <= offset && offset+n <= sr.end {
+			return true, true
+		}
+		if sr.start < offset+n && offset < sr.end {
+			overlaps = true
+		}
+	}
+	return false, overlaps
+}
+
+// buildProof walks the subtree of 'n' leaves that begins at 'offset',
+// appending the roots of the subtrees that do not overlap any of the ranges to
+// the proof. Segments are read from r in order.
+func buildProof(r io.Reader, offset, n uint64, ranges []segmentRange, proof []Hash) ([]Hash, error) {
+	covered, overlaps := classifySubtree(offset, n, ranges)
+	switch {
+	case !overlaps:
+		root, err := readerSubtreeRoot(r, n)
+		if err != nil {
+			return nil, err
+		}
+		return append(proof, root), nil
+
+	case covered:
+		_, err := io.CopyN(ioutil.Discard, r, int64(n*SegmentSize))
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return proof, nil
+	}
+
+	split := leftSubtreeSize(n)
+	proof, err := buildProof(r, offset, split, ranges, proof)
+	if err != nil {
+		return nil, err
+	}
+	return buildProof(r, offset+split, n-split, ranges, proof)
+}
+
+// verifyProof mirrors buildProof, computing the root of the subtree of 'n'
+// leaves that begins at 'offset' using the data read from r and the hashes in
+// the proof. The unused portion of the proof is returned.
+func verifyProof(r io.Reader, offset, n uint64, ranges []segmentRange, proof []Hash) (root Hash, remaining []Hash, err error) {
+	covered, overlaps := classifySubtree(offset, n, ranges)
+	switch {
+	case !overlaps:
+		if len(proof) == 0 {
+			return Hash{}, nil, ErrBadRange
+		}
+		return proof[0], proof[1:], nil
+
+	case covered:
+		root, err = readerSubtreeRoot(r, n)
+		return root, proof, err
+	}
+
+	split := leftSubtreeSize(n)
+	left, proof, err := verifyProof(r, offset, split, ranges, proof)
+	if err != nil {
+		return
+	}
+	right, proof, err := verifyProof(r, offset+split, n-split, ranges, proof)
+	if err != nil {
+		return
+	}
+	return nodeHash(left, right), proof, nil
+}
+
+// segmentRanges converts a list of segment indices into a list of ranges,
+// merging adjacent segments. The indices must be sorted, unique, and less than
+// numSegments.
+func segmentRanges(numSegments uint64, segments []uint64) ([]segmentRange, error) {
+	if len(segments) == 0 {
+		return nil, ErrBadRange
+	}
+	var ranges []segmentRange
+	for i, index := range segments {
+		if index >= numSegments || (i > 0 && index <= segments[i-1]) {
+			return nil, ErrBadRange
+		}
+		if len(ranges) > 0 && ranges[len(ranges)-1].end == index {
+			ranges[len(ranges)-1].end++
+		} else {
+			ranges = append(ranges, segmentRange{index, index + 1})
+		}
+	}
+	return ranges, nil
+}
+
+// verifyReaderProof checks that the segments read from r, combined with the
+// proof, hash to the Merkle root of a file with 'numSegments' segments.
+func verifyReaderProof(r io.Reader, proof []Hash, numSegments uint64, ranges []segmentRange, root Hash) bool {
+	proofRoot, remaining, err := verifyProof(r, 0, numSegments, ranges, proof)
+	if err != nil || len(remaining) != 0 {
+		return false
+	}
+	return proofRoot == root
+}
+
+// BuildReaderRangeProof reads the segments of a file from r and returns the
+// proof needed to verify the segments in the range [start, end) against the
+// Merkle root of the file. The proof contains the roots of the subtrees that
+// fall outside of the range, from left to right.
+func BuildReaderRangeProof(r io.Reader, numSegments, start, end uint64) (proof []Hash, err error) {
+	if start >= end || end > numSegments {
+		return nil, ErrBadRange
+	}
+	return buildProof(r, 0, numSegments, []segmentRange{{start, end}}, nil)
+}
+
+// VerifyReaderRangeProof reads the segments in the range [start, end) from r
+// and checks that, combined with the proof, they hash to the Merkle root of a
+// file with 'numSegments' segments.
+func VerifyReaderRangeProof(r io.Reader, proof []Hash, numSegments, start, end uint64, root Hash) bool {
+	if start >= end || end > numSegments {
+		return false
+	}
+	return verifyReaderProof(r, proof, numSegments, []segmentRange{{start, end}}, root)
+}
+
+// BuildReaderSegmentsProof reads the segments of a file from r and returns the
+// proof needed to verify a set of segments against the Merkle root of the
+// file. The segment indices must be sorted and unique.
+func BuildReaderSegmentsProof(r io.Reader, numSegments uint64, segments []uint64) (proof []Hash, err error) {
+	ranges, err := segmentRanges(numSegments, segments)
+	if err != nil {
+		return nil, err
+	}
+	return buildProof(r, 0, numSegments, ranges, nil)
+}
+
+// VerifyReaderSegmentsProof reads a set of segments from r, in order, and
+// checks that, combined with the proof, they hash to the Merkle root of a file
+// with 'numSegments' segments.
+func VerifyReaderSegmentsProof(r io.Reader, proof []Hash, numSegments uint64, segments []uint64, root Hash) bool {
+	ranges, err := segmentRanges(numSegments, segments)
+	if err != nil {
+		return false
+	}
+	return verifyReaderProof(r, proof, numSegments, ranges, root)
+}
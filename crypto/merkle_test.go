@@ -28,3 +28,4 @@ func TestStorageProof(t *testing.T) {
 		}
 	}
 }
+
@@ -1,6 +1,9 @@
 package modules
 
 import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -8,6 +11,58 @@ const (
 	ConsensusDir = "consensus"
 )
 
+var (
+	// ConsensusChangeBeginning is a special ConsensusChangeID that refers to
+	// the beginning of the consensus set's history. Subscribing from
+	// ConsensusChangeBeginning delivers every change to the consensus set.
+	ConsensusChangeBeginning = ConsensusChangeID{}
+
+	// ErrInvalidConsensusChangeID is returned when subscribing from a change
+	// that is not known to the consensus set.
+	ErrInvalidConsensusChangeID = errors.New("consensus subscription has invalid id - files are inconsistent")
+)
+
+// A ConsensusChangeID is the unique identifier of a change to the consensus
+// set. IDs are persistent, so a module can save the ID of the last change it
+// processed and resume from that change after a restart.
+type ConsensusChangeID crypto.Hash
+
+// A ConsensusChange is a set of blocks that were reverted and applied by a
+// single change to the consensus set, along with the diffs that the change
+// made to the consensus set. RevertedBlocks is ordered from highest to lowest
+// height, and AppliedBlocks from lowest to highest.
+//
+// The diffs of the reverted blocks are inverted: their order is reversed and
+// their directions are flipped. A module that applies every diff in order,
+// treating each diff with direction DiffApply as an addition and each diff
+// with direction DiffRevert as a removal, will have a copy of the consensus
+// set after the change.
+type ConsensusChange struct {
+	ID             ConsensusChangeID
+	RevertedBlocks []types.Block
+	AppliedBlocks  []types.Block
+
+	SiacoinOutputDiffs        []SiacoinOutputDiff
+	FileContractDiffs         []FileContractDiff
+	SiafundOutputDiffs        []SiafundOutputDiff
+	DelayedSiacoinOutputDiffs []DelayedSiacoinOutputDiff
+
+	// SiafundPoolDiffs has one diff for each block. The diffs of reverted
+	// blocks have 'Previous' and 'Adjusted' swapped.
+	SiafundPoolDiffs []SiafundPoolDiff
+}
+
+// SyncStatus describes the progress of a synchronization with a peer. The
+// target height is the height of the last header received from the peer, so
+// it grows as more headers are received.
+type SyncStatus struct {
+	Synchronizing    bool
+	Peer             NetAddress
+	StartHeight      types.BlockHeight
+	TargetHeight     types.BlockHeight
+	BlocksDownloaded uint64
+}
+
 // A DiffDirection indicates the "direction" of a diff, either applied or
 // reverted. A bool is used to restrict the value to these two possibilities.
 type DiffDirection bool
@@ -41,6 +96,16 @@ type SiafundOutputDiff struct {
 	SiafundOutput types.SiafundOutput
 }
 
+// A DelayedSiacoinOutputDiff indicates the addition or removal of a siacoin
+// output that cannot be spent until MaturityHeight. When the output matures, a
+// SiacoinOutputDiff adds it to the consensus set.
+type DelayedSiacoinOutputDiff struct {
+	Direction      DiffDirection
+	ID             types.SiacoinOutputID
+	SiacoinOutput  types.SiacoinOutput
+	MaturityHeight types.BlockHeight
+}
+
 // A SiafundPoolDiff contains the value of the siafundPool before the block
 // was applied, and after the block was applied. When applying the diff, set
 // siafundPool to 'Adjusted'. When reverting the diff, set siafundPool to
@@ -3,6 +3,8 @@ package consensus
 import (
 	"errors"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
@@ -10,21 +12,22 @@ import (
 )
 
 var (
-	ErrBadBlock        = errors.New("block is known to be invalid")
-	ErrBlockKnown      = errors.New("block exists in block map")
-	ErrEarlyTimestamp  = errors.New("block timestamp is too early")
-	ErrFutureTimestamp = errors.New("block timestamp too far in future")
-	ErrOrphan          = errors.New("block has no known parent")
-	ErrLargeBlock      = errors.New("block is too large to be accepted")
-	ErrMinerPayout     = errors.New("miner payout sum does not equal block subsidy")
-	ErrMissedTarget    = errors.New("block does not meet target")
+	ErrBadBlock               = errors.New("block is known to be invalid")
+	ErrBlockKnown             = errors.New("block exists in block map")
+	ErrEarlyTimestamp         = errors.New("block timestamp is too early")
+	ErrExtremeFutureTimestamp = errors.New("block timestamp too extreme into the future")
+	ErrFutureTimestamp        = errors.New("block timestamp too far in future")
+	ErrOrphan                 = errors.New("block has no known parent")
+	ErrLargeBlock             = errors.New("block is too large to be accepted")
+	ErrMinerPayout            = errors.New("miner payout sum does not equal block subsidy")
+	ErrMissedTarget           = errors.New("block does not meet target")
 )
 
 // checkMinerPayouts verifies that the sum of all the miner payouts is equal to
 // the block subsidy (which is the coinbase + miner fees).
-func (s *State) checkMinerPayouts(b types.Block) (err error) {
+func (s *State) checkMinerPayouts(tx *bolt.Tx, b types.Block) (err error) {
 	// Sanity check - the block's parent needs to exist and be known.
-	parentNode, exists := s.blockMap[b.ParentID]
+	parentNode, exists := getBlockNode(tx, b.ParentID)
 	if !exists {
 		if build.DEBUG {
 			panic("misuse of checkMinerPayouts - block has no known parent")
@@ -33,7 +36,7 @@ func (s *State) checkMinerPayouts(b types.Block) (err error) {
 	}
 
 	// Find the total subsidy for the miners: coinbase + fees.
-	subsidy := types.CalculateCoinbase(parentNode.height + 1)
+	subsidy := types.CalculateCoinbase(parentNode.Height + 1)
 	for _, txn := range b.Transactions {
 		for _, fee := range txn.MinerFees {
 			subsidy = subsidy.Add(fee)
@@ -58,59 +61,76 @@ func (s *State) checkMinerPayouts(b types.Block) (err error) {
 }
 
 // validHeader does some early, low computation verification on the block.
-func (s *State) validHeader(b types.Block) (err error) {
+func (s *State) validHeader(tx *bolt.Tx, b types.Block) (err error) {
 	// Grab the parent of the block.
-	parent, exists := s.blockMap[b.ParentID]
+	parent, exists := getBlockNode(tx, b.ParentID)
 	if !exists {
 		return ErrOrphan
 	}
 
+	// Check that the block matches the checkpoint at its height, if there is
+	// one.
+	if !s.matchesCheckpoint(parent.Height+1, b.ID()) {
+		return ErrCheckpointMismatch
+	}
+
 	// Check the ID meets the target. This is one of the earliest checks to
 	// enforce that blocks need to have committed to a large amount of work
 	// before being verified - a DoS protection.
-	if !b.CheckTarget(parent.target) {
+	if !b.CheckTarget(parent.Target) {
 		return ErrMissedTarget
 	}
 
+	// Check that the block does not fork from the current path below a
+	// checkpoint.
+	err = s.checkForkPoint(tx, parent)
+	if err != nil {
+		return
+	}
+
 	// Check that the block is the correct size.
 	if uint64(len(encoding.Marshal(b))) > types.BlockSizeLimit {
 		return ErrLargeBlock
 	}
 
 	// If timestamp is too far in the past, reject and put in bad blocks.
-	if parent.earliestChildTimestamp() > b.Timestamp {
+	if parent.earliestChildTimestamp(tx) > b.Timestamp {
 		return ErrEarlyTimestamp
 	}
 
-	// Check that the block is not too far in the future. An external process
-	// will need to be responsible for resubmitting the block once it is no
-	// longer in the future.
-	if b.Timestamp > types.CurrentTimestamp()+types.FutureThreshold {
-		return ErrFutureTimestamp
-	}
-
 	// Verify that the miner payouts sum to the total amount of fees allowed to
 	// be collected by the miners.
-	err = s.checkMinerPayouts(b)
+	err = s.checkMinerPayouts(tx, b)
 	if err != nil {
 		return
 	}
 
+	// Check that the block is not too far in the future. This check comes
+	// last, because a block that is only slightly in the future is held by
+	// the State and tried again once it is no longer in the future; see
+	// futureblocks.go.
+	if b.Timestamp > types.CurrentTimestamp()+types.ExtremeFutureThreshold {
+		return ErrExtremeFutureTimestamp
+	}
+	if b.Timestamp > types.CurrentTimestamp()+types.FutureThreshold {
+		return ErrFutureTimestamp
+	}
+
 	return
 }
 
 // addBlockToTree inserts a block into the blockNode tree by adding it to its
 // parent's list of children. If the new blockNode is heavier than the current
 // node, the blockchain is forked.
-func (s *State) addBlockToTree(b types.Block) (err error) {
-	parentNode := s.blockMap[b.ParentID]
-	newNode := parentNode.newChild(b)
+func (s *State) addBlockToTree(tx *bolt.Tx, b types.Block) (err error) {
+	parentNode, _ := getBlockNode(tx, b.ParentID)
+	newNode := parentNode.newChild(tx, b)
 
 	// Add the node to the block map
-	s.blockMap[b.ID()] = newNode
+	putBlockNode(tx, newNode)
 
-	if newNode.heavierThan(s.currentBlockNode()) {
-		err = s.forkBlockchain(newNode)
+	if newNode.heavierThan(s.currentBlockNode(tx)) {
+		err = s.forkBlockchain(tx, newNode)
 		if err != nil {
 			return
 		}
@@ -119,34 +139,44 @@ func (s *State) addBlockToTree(b types.Block) (err error) {
 	return
 }
 
-// AcceptBlock will add a block to the state, forking the blockchain if it is
-// on a fork that is heavier than the current fork. If the block is accepted,
-// it will be relayed to connected peers.
-func (s *State) AcceptBlock(b types.Block) error {
-	counter := s.mu.Lock()
-	defer s.mu.Unlock(counter)
-
+// acceptBlock performs all of the work of AcceptBlock within a database
+// transaction.
+func (s *State) acceptBlock(tx *bolt.Tx, b types.Block) error {
 	// Check maps for information about the block.
 	_, exists := s.badBlocks[b.ID()]
 	if exists {
 		return ErrBadBlock
 	}
-	_, exists = s.blockMap[b.ID()]
+	_, exists = getBlockNode(tx, b.ID())
 	if exists {
 		return ErrBlockKnown
 	}
 
-	err := s.validHeader(b)
+	err := s.validHeader(tx, b)
+	if err == ErrFutureTimestamp {
+		s.queueFutureBlock(b)
+	}
+	if err == ErrOrphan {
+		s.addOrphan(b)
+	}
 	if err != nil {
 		return err
 	}
 
-	err = s.addBlockToTree(b)
+	return s.addBlockToTree(tx, b)
+}
+
+// AcceptBlock will add a block to the state, forking the blockchain if it is
+// on a fork that is heavier than the current fork. If the block is accepted,
+// it will be relayed to connected peers. All changes caused by the block are
+// written to the database in a single transaction.
+func (s *State) AcceptBlock(b types.Block) error {
+	err := s.addBlock(b)
 	if err != nil {
 		return err
 	}
 
-	go s.gateway.Broadcast("RelayBlock", b)
+	go s.gateway.Announce("RelayBlock", b)
 
 	return nil
 }
@@ -159,9 +189,12 @@ func (s *State) RelayBlock(conn modules.PeerConn) error {
 		return err
 	}
 
+	// An orphan is held in the orphan pool until its parent arrives. The
+	// sender is likely ahead of us, so synchronize with it to fetch the
+	// missing parents.
 	err = s.AcceptBlock(b)
 	if err == ErrOrphan {
-		go s.Synchronize(conn.CallbackAddr())
+		go s.threadedSynchronizePeer(conn.CallbackAddr())
 	}
 	if err != nil {
 		return err
@@ -3,6 +3,8 @@ package consensus
 import (
 	"testing"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -20,10 +22,10 @@ func (ct *ConsensusTester) testBlockTimestamps() {
 	}
 
 	// Create a block with a timestamp that is too late.
-	block = MineTestingBlock(ct.CurrentBlock().ID(), types.CurrentTimestamp()+10+types.FutureThreshold, ct.Payouts(ct.Height()+1, nil), nil, ct.CurrentTarget())
+	block = MineTestingBlock(ct.CurrentBlock().ID(), types.CurrentTimestamp()+10+types.ExtremeFutureThreshold, ct.Payouts(ct.Height()+1, nil), nil, ct.CurrentTarget())
 	err = ct.AcceptBlock(block)
-	if err != ErrFutureTimestamp {
-		ct.Error("unexpected error when submitting a too-early timestamp:", err)
+	if err != ErrExtremeFutureTimestamp {
+		ct.Error("unexpected error when submitting a too-late timestamp:", err)
 	}
 }
 
@@ -49,26 +51,40 @@ func (ct *ConsensusTester) testEmptyBlock() {
 	// These functions break the convention of only using exported functions.
 	// But they provide useful checks by making sure that the internals of the
 	// state have established in the necessary ways.
-	if ct.currentPath[ct.Height()] != block.ID() {
-		ct.Error("the state's current path didn't update correctly after accepting a new block")
-	}
-	bn, exists := ct.blockMap[block.ID()]
-	if !exists {
-		ct.Error("the state's block map did not update correctly after getting an empty block")
-	}
-	if !bn.diffsGenerated {
-		ct.Error("diffs were not generated on the new block")
+	var cbn *blockNode
+	ct.db.View(func(tx *bolt.Tx) error {
+		if id, _ := pathID(tx, ct.height(tx)); id != block.ID() {
+			ct.Error("the state's current path didn't update correctly after accepting a new block")
+		}
+		bn, exists := getBlockNode(tx, block.ID())
+		if !exists {
+			ct.Error("the state's block map did not update correctly after getting an empty block")
+			return nil
+		}
+		if !bn.DiffsGenerated {
+			ct.Error("diffs were not generated on the new block")
+		}
+		cbn = bn
+		return nil
+	})
+	if cbn == nil {
+		ct.FailNow()
 	}
 
 	// These functions manipulate the state using unexported functions, which
 	// breaks proposed conventions. However, they provide useful information
 	// about the accuracy of invertRecentBlock and applyBlockNode.
-	cbn := ct.currentBlockNode()
-	ct.commitDiffSet(cbn, modules.DiffRevert)
+	ct.db.Update(func(tx *bolt.Tx) error {
+		ct.commitDiffSet(tx, cbn, modules.DiffRevert)
+		return nil
+	})
 	if beforeStateHash != ct.StateHash() {
 		ct.Error("state is different after applying and removing diffs")
 	}
-	ct.commitDiffSet(cbn, modules.DiffApply)
+	ct.db.Update(func(tx *bolt.Tx) error {
+		ct.commitDiffSet(tx, cbn, modules.DiffApply)
+		return nil
+	})
 	if afterStateHash != ct.StateHash() {
 		ct.Error("state is different after generateApply, remove, and applying diffs")
 	}
@@ -119,7 +135,12 @@ func (ct *ConsensusTester) testSingleNoFeePayout() {
 	}
 	// Checking the state for correctness requires using an internal function.
 	payoutID := block.MinerPayoutID(0)
-	output, exists := ct.delayedSiacoinOutputs[ct.Height()][payoutID]
+	var output types.SiacoinOutput
+	var exists bool
+	ct.db.View(func(tx *bolt.Tx) error {
+		output, exists = getDelayedSiacoinOutput(tx, ct.height(tx), payoutID)
+		return nil
+	})
 	if !exists {
 		ct.Error("could not find payout in delayedOutputs")
 	}
@@ -1,6 +1,8 @@
 package consensus
 
 import (
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -8,69 +10,70 @@ import (
 
 // applySiacoinInputs takes all of the siacoin inputs in a transaction and
 // applies them to the state, updating the diffs in the block node.
-func (s *State) applySiacoinInputs(bn *blockNode, t types.Transaction) {
+func (s *State) applySiacoinInputs(tx *bolt.Tx, bn *blockNode, t types.Transaction) {
 	// Remove all siacoin inputs from the unspent siacoin outputs list.
 	for _, sci := range t.SiacoinInputs {
 		// Sanity check - the input should exist within the blockchain.
-		if build.DEBUG {
-			_, exists := s.siacoinOutputs[sci.ParentID]
-			if !exists {
-				panic("Applying a transaction with an invalid unspent output!")
-			}
+		sco, exists := getSiacoinOutput(tx, sci.ParentID)
+		if build.DEBUG && !exists {
+			panic("Applying a transaction with an invalid unspent output!")
 		}
 
-		bn.siacoinOutputDiffs = append(bn.siacoinOutputDiffs, modules.SiacoinOutputDiff{
+		scod := modules.SiacoinOutputDiff{
 			Direction:     modules.DiffRevert,
 			ID:            sci.ParentID,
-			SiacoinOutput: s.siacoinOutputs[sci.ParentID],
-		})
-		delete(s.siacoinOutputs, sci.ParentID)
+			SiacoinOutput: sco,
+		}
+		bn.SiacoinOutputDiffs = append(bn.SiacoinOutputDiffs, scod)
+		s.commitSiacoinOutputDiff(tx, scod, modules.DiffApply)
 	}
 }
 
 // applySiacoinOutputs takes all of the siacoin outputs in a transaction and
 // applies them to the state, updating the diffs in the block node.
-func (s *State) applySiacoinOutputs(bn *blockNode, t types.Transaction) {
+func (s *State) applySiacoinOutputs(tx *bolt.Tx, bn *blockNode, t types.Transaction) {
 	// Add all siacoin outputs to the unspent siacoin outputs list.
 	for i, sco := range t.SiacoinOutputs {
 		// Sanity check - the output should not exist within the state.
 		scoid := t.SiacoinOutputID(i)
 		if build.DEBUG {
-			_, exists := s.siacoinOutputs[scoid]
+			_, exists := getSiacoinOutput(tx, scoid)
 			if exists {
 				panic("applying a siacoin output when the output already exists")
 			}
 		}
 
-		bn.siacoinOutputDiffs = append(bn.siacoinOutputDiffs, modules.SiacoinOutputDiff{
+		scod := modules.SiacoinOutputDiff{
 			Direction:     modules.DiffApply,
 			ID:            scoid,
 			SiacoinOutput: sco,
-		})
-		s.siacoinOutputs[scoid] = sco
+		}
+		bn.SiacoinOutputDiffs = append(bn.SiacoinOutputDiffs, scod)
+		s.commitSiacoinOutputDiff(tx, scod, modules.DiffApply)
 	}
 }
 
 // applyFileContracts iterates through all of the file contracts in a
 // transaction and applies them to the state, updating the diffs in the block
 // node.
-func (s *State) applyFileContracts(bn *blockNode, t types.Transaction) {
+func (s *State) applyFileContracts(tx *bolt.Tx, bn *blockNode, t types.Transaction) {
 	for i, fc := range t.FileContracts {
 		// Sanity check - the file contract should not exists within the state.
 		fcid := t.FileContractID(i)
 		if build.DEBUG {
-			_, exists := s.fileContracts[fcid]
+			_, exists := getFileContract(tx, fcid)
 			if exists {
 				panic("applying a file contract when the contract already exists")
 			}
 		}
 
-		bn.fileContractDiffs = append(bn.fileContractDiffs, modules.FileContractDiff{
+		fcd := modules.FileContractDiff{
 			Direction:    modules.DiffApply,
 			ID:           fcid,
 			FileContract: fc,
-		})
-		s.fileContracts[fcid] = fc
+		}
+		bn.FileContractDiffs = append(bn.FileContractDiffs, fcd)
+		s.commitFileContractDiff(tx, fcd, modules.DiffApply)
 	}
 	return
 }
@@ -78,10 +81,10 @@ func (s *State) applyFileContracts(bn *blockNode, t types.Transaction) {
 // applyFileContractRevisions iterates through all of the file contract
 // revisions in a transaction and applies them to the state, updating the diffs
 // in the block node.
-func (s *State) applyFileContractRevisions(bn *blockNode, t types.Transaction) {
+func (s *State) applyFileContractRevisions(tx *bolt.Tx, bn *blockNode, t types.Transaction) {
 	for _, fcr := range t.FileContractRevisions {
 		// Sanity check - termination should affect an existing contract.
-		fc, exists := s.fileContracts[fcr.ParentID]
+		fc, exists := getFileContract(tx, fcr.ParentID)
 		if !exists {
 			if build.DEBUG {
 				panic("file contract termination terminates a nonexisting contract")
@@ -90,12 +93,13 @@ func (s *State) applyFileContractRevisions(bn *blockNode, t types.Transaction) {
 		}
 
 		// Add the diff to delete the old file contract.
-		bn.fileContractDiffs = append(bn.fileContractDiffs, modules.FileContractDiff{
+		fcd := modules.FileContractDiff{
 			Direction:    modules.DiffRevert,
 			ID:           fcr.ParentID,
 			FileContract: fc,
-		})
-		delete(s.fileContracts, fcr.ParentID)
+		}
+		bn.FileContractDiffs = append(bn.FileContractDiffs, fcd)
+		s.commitFileContractDiff(tx, fcd, modules.DiffApply)
 
 		// Add the diff to add the revised file contract.
 		nfc := types.FileContract{
@@ -109,21 +113,23 @@ func (s *State) applyFileContractRevisions(bn *blockNode, t types.Transaction) {
 			UnlockHash:         fcr.NewUnlockHash,
 			RevisionNumber:     fcr.NewRevisionNumber,
 		}
-		bn.fileContractDiffs = append(bn.fileContractDiffs, modules.FileContractDiff{
+		fcd = modules.FileContractDiff{
 			Direction:    modules.DiffApply,
 			ID:           fcr.ParentID,
 			FileContract: nfc,
-		})
+		}
+		bn.FileContractDiffs = append(bn.FileContractDiffs, fcd)
+		s.commitFileContractDiff(tx, fcd, modules.DiffApply)
 	}
 }
 
 // applyStorageProofs iterates through all of the storage proofs in a
 // transaction and applies them to the state, updating the diffs in the block
 // node.
-func (s *State) applyStorageProofs(bn *blockNode, t types.Transaction) {
+func (s *State) applyStorageProofs(tx *bolt.Tx, bn *blockNode, t types.Transaction) {
 	for _, sp := range t.StorageProofs {
 		// Sanity check - the file contract of the storage proof should exist.
-		fc, exists := s.fileContracts[sp.ParentID]
+		fc, exists := getFileContract(tx, sp.ParentID)
 		if !exists {
 			if build.DEBUG {
 				panic("storage proof submitted for a file contract that doesn't exist?")
@@ -133,103 +139,102 @@ func (s *State) applyStorageProofs(bn *blockNode, t types.Transaction) {
 
 		// Get the portion of the contract that goes into the siafund pool and
 		// add it to the siafund pool.
-		s.siafundPool = s.siafundPool.Add(fc.Tax())
+		setSiafundPool(tx, getSiafundPool(tx).Add(fc.Tax()))
 
 		// Add all of the outputs in the ValidProofOutputs of the contract.
 		for i, output := range fc.ValidProofOutputs {
 			// Sanity check - output should not already exist.
 			id := sp.ParentID.StorageProofOutputID(true, i)
 			if build.DEBUG {
-				_, exists := s.siacoinOutputs[id]
+				_, exists := getSiacoinOutput(tx, id)
 				if exists {
 					panic("storage proof output already exists")
 				}
 			}
 
-			s.delayedSiacoinOutputs[s.height()][id] = output
-			bn.delayedSiacoinOutputs[id] = output
+			s.addDelayedSiacoinOutput(tx, bn, id, output)
 		}
 
-		bn.fileContractDiffs = append(bn.fileContractDiffs, modules.FileContractDiff{
+		fcd := modules.FileContractDiff{
 			Direction:    modules.DiffRevert,
 			ID:           sp.ParentID,
 			FileContract: fc,
-		})
-		delete(s.fileContracts, sp.ParentID)
+		}
+		bn.FileContractDiffs = append(bn.FileContractDiffs, fcd)
+		s.commitFileContractDiff(tx, fcd, modules.DiffApply)
 	}
 	return
 }
 
 // applySiafundInputs takes all of the siafund inputs in a transaction and
 // applies them to the state, updating the diffs in the block node.
-func (s *State) applySiafundInputs(bn *blockNode, t types.Transaction) {
+func (s *State) applySiafundInputs(tx *bolt.Tx, bn *blockNode, t types.Transaction) {
 	for _, sfi := range t.SiafundInputs {
 		// Sanity check - the input should exist within the blockchain.
-		if build.DEBUG {
-			_, exists := s.siafundOutputs[sfi.ParentID]
-			if !exists {
+		sfo, exists := getSiafundOutput(tx, sfi.ParentID)
+		if !exists {
+			if build.DEBUG {
 				panic("applying a transaction with an invalid unspent siafund output")
 			}
 			continue
 		}
 
 		// Calculate the volume of siacoins to put in the claim output.
-		sfo := s.siafundOutputs[sfi.ParentID]
-		claimPortion := s.siafundPool.Sub(sfo.ClaimStart).Div(types.NewCurrency64(types.SiafundCount))
+		claimPortion := getSiafundPool(tx).Sub(sfo.ClaimStart).Div(types.NewCurrency64(types.SiafundCount))
 
 		// Add the claim output to the delayed set of outputs.
 		sco := types.SiacoinOutput{
 			Value:      claimPortion,
 			UnlockHash: sfo.ClaimUnlockHash,
 		}
-		scoid := sfi.ParentID.SiaClaimOutputID()
-		s.delayedSiacoinOutputs[s.height()][scoid] = sco
-		bn.delayedSiacoinOutputs[scoid] = sco
+		s.addDelayedSiacoinOutput(tx, bn, sfi.ParentID.SiaClaimOutputID(), sco)
 
 		// Create the siafund output diff and remove the output from the
 		// consensus set.
-		bn.siafundOutputDiffs = append(bn.siafundOutputDiffs, modules.SiafundOutputDiff{
+		sfod := modules.SiafundOutputDiff{
 			Direction:     modules.DiffRevert,
 			ID:            sfi.ParentID,
-			SiafundOutput: s.siafundOutputs[sfi.ParentID],
-		})
-		delete(s.siafundOutputs, sfi.ParentID)
+			SiafundOutput: sfo,
+		}
+		bn.SiafundOutputDiffs = append(bn.SiafundOutputDiffs, sfod)
+		s.commitSiafundOutputDiff(tx, sfod, modules.DiffApply)
 	}
 }
 
 // applySiafundOutputs takes all of the siafund outputs in a transaction and
 // applies them to the state, updating the diffs in the block node.
-func (s *State) applySiafundOutputs(bn *blockNode, t types.Transaction) {
+func (s *State) applySiafundOutputs(tx *bolt.Tx, bn *blockNode, t types.Transaction) {
 	for i, sfo := range t.SiafundOutputs {
 		// Sanity check - the output should not exist within the blockchain.
 		sfoid := t.SiafundOutputID(i)
 		if build.DEBUG {
-			_, exists := s.siafundOutputs[sfoid]
+			_, exists := getSiafundOutput(tx, sfoid)
 			if exists {
 				panic("siafund being added to consensus set when it is already in the consensus set")
 			}
 		}
 
 		// Set the claim start.
-		sfo.ClaimStart = s.siafundPool
+		sfo.ClaimStart = getSiafundPool(tx)
 
 		// Create and apply the diff.
-		bn.siafundOutputDiffs = append(bn.siafundOutputDiffs, modules.SiafundOutputDiff{
+		sfod := modules.SiafundOutputDiff{
 			Direction:     modules.DiffApply,
 			ID:            sfoid,
 			SiafundOutput: sfo,
-		})
-		s.siafundOutputs[sfoid] = sfo
+		}
+		bn.SiafundOutputDiffs = append(bn.SiafundOutputDiffs, sfod)
+		s.commitSiafundOutputDiff(tx, sfod, modules.DiffApply)
 	}
 }
 
 // applyTransaction applies the contents of a transaction to the State. This
 // produces a set of diffs, which are stored in the blockNode containing the
 // transaction.
-func (s *State) applyTransaction(bn *blockNode, t types.Transaction) {
+func (s *State) applyTransaction(tx *bolt.Tx, bn *blockNode, t types.Transaction) {
 	// Sanity check - the input transaction should be valid.
 	if build.DEBUG {
-		err := s.validTransaction(t)
+		err := s.validTransaction(tx, t)
 		if err != nil {
 			panic("applyTransaction called with an invalid transaction!")
 		}
@@ -237,11 +242,11 @@ func (s *State) applyTransaction(bn *blockNode, t types.Transaction) {
 
 	// Apply each component of the transaction. Miner fees are handled as a
 	// separate process.
-	s.applySiacoinInputs(bn, t)
-	s.applySiacoinOutputs(bn, t)
-	s.applyFileContracts(bn, t)
-	s.applyFileContractRevisions(bn, t)
-	s.applyStorageProofs(bn, t)
-	s.applySiafundInputs(bn, t)
-	s.applySiafundOutputs(bn, t)
+	s.applySiacoinInputs(tx, bn, t)
+	s.applySiacoinOutputs(tx, bn, t)
+	s.applyFileContracts(tx, bn, t)
+	s.applyFileContractRevisions(tx, bn, t)
+	s.applyStorageProofs(tx, bn, t)
+	s.applySiafundInputs(tx, bn, t)
+	s.applySiafundOutputs(tx, bn, t)
 }
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -21,7 +23,11 @@ func (ct *ConsensusTester) testApplySiacoinOutput() {
 	}
 
 	// Check that the output got added to the consensus set.
-	_, exists := ct.siacoinOutputs[txn.SiacoinOutputID(0)]
+	var exists bool
+	ct.db.View(func(tx *bolt.Tx) error {
+		_, exists = getSiacoinOutput(tx, txn.SiacoinOutputID(0))
+		return nil
+	})
 	if !exists {
 		ct.Fatal("siacoin output did not make it into the consensus set.")
 	}
@@ -40,7 +46,11 @@ func (ct *ConsensusTester) testApplyFileContract() {
 	}
 
 	// Check for the file contract in the consensus set.
-	_, exists := ct.fileContracts[txn.FileContractID(0)]
+	var exists bool
+	ct.db.View(func(tx *bolt.Tx) error {
+		_, exists = getFileContract(tx, txn.FileContractID(0))
+		return nil
+	})
 	if !exists {
 		ct.Fatal("file contract did not make it into the consensus set.")
 	}
@@ -91,18 +101,18 @@ func (ct *ConsensusTester) testApplyStorageProof() {
 
 	// Check that the file contract was deleted from the consensus set, and
 	// that the delayed outputs for the successful proof were added.
-	_, exists := ct.fileContracts[fcid]
-	if exists {
+	var contractExists, outputExists bool
+	ct.db.View(func(tx *bolt.Tx) error {
+		_, contractExists = getFileContract(tx, fcid)
+		_, outputExists = getDelayedSiacoinOutput(tx, ct.height(tx), fcid.StorageProofOutputID(true, 0))
+		return nil
+	})
+	if contractExists {
 		ct.Error("file contract not deleted from consensus set")
 	}
-	delayedOutputs, exists := ct.delayedSiacoinOutputs[ct.Height()]
-	if !exists {
+	if !outputExists {
 		ct.Fatal("delayed outputs don't seem to exist")
 	}
-	_, exists = delayedOutputs[fcid.StorageProofOutputID(true, 0)]
-	if !exists {
-		ct.Fatal("delayed outputs don't seem to exist, but height map does")
-	}
 }
 
 // TestApplySiacoinOutput creates a new testing environment and uses it to call
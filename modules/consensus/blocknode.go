@@ -4,6 +4,8 @@ import (
 	"math/big"
 	"sort"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -19,38 +21,39 @@ import (
 var SurpassThreshold = big.NewRat(20, 100)
 
 // a blockNode is a node in the tree of competing blockchain forks. It contains
-// the block itself, parent and child blockNodes, and context such as the
-// block height, depth, and target. It also contains a set of diffs that
-// dictate how the consensus set is affected by the block.
+// the block itself, the IDs of its child blocks, and context such as the block
+// height, depth, and target. It also contains a set of diffs that dictate how
+// the consensus set is affected by the block. blockNodes are stored in the
+// database, so their fields are exported in order to be encoded; the parent of
+// a node is found through Block.ParentID.
 type blockNode struct {
-	block    types.Block
-	parent   *blockNode
-	children []*blockNode
+	Block    types.Block
+	Children []types.BlockID
 
-	height types.BlockHeight
-	depth  types.Target // Cumulative weight of all parents.
-	target types.Target // Target for next block, i.e. any child blockNodes.
+	Height types.BlockHeight
+	Depth  types.Target // Cumulative weight of all parents.
+	Target types.Target // Target for next block, i.e. any child blockNodes.
 
 	// Diffs are computationally expensive to generate, so a lazy approach is
 	// taken wherein the diffs are only generated when needed. A boolean
 	// prevents duplicate work from being performed.
 	//
-	// Note that diffsGenerated == true iff the node has ever been in the
-	// State's currentPath; this is because diffs must be generated to apply
+	// Note that DiffsGenerated == true iff the node has ever been in the
+	// State's current path; this is because diffs must be generated to apply
 	// the node.
-	diffsGenerated        bool
-	siafundPoolDiff       modules.SiafundPoolDiff
-	siacoinOutputDiffs    []modules.SiacoinOutputDiff
-	fileContractDiffs     []modules.FileContractDiff
-	siafundOutputDiffs    []modules.SiafundOutputDiff
-	delayedSiacoinOutputs map[types.SiacoinOutputID]types.SiacoinOutput
+	DiffsGenerated        bool
+	SiafundPoolDiff       modules.SiafundPoolDiff
+	SiacoinOutputDiffs    []modules.SiacoinOutputDiff
+	FileContractDiffs     []modules.FileContractDiff
+	SiafundOutputDiffs    []modules.SiafundOutputDiff
+	DelayedSiacoinOutputs []delayedSiacoinOutput
 }
 
 // childDepth returns the depth of a blockNode's child nodes. The depth is the
 // "sum" of the current depth and current difficulty. See target.Add for more
 // detailed information.
 func (bn *blockNode) childDepth() (depth types.Target) {
-	return bn.depth.Add(bn.target)
+	return bn.Depth.Add(bn.Target)
 }
 
 // heavierThan returns true if the blockNode is sufficiently heavier than
@@ -58,21 +61,68 @@ func (bn *blockNode) childDepth() (depth types.Target) {
 // that the weight of 'bn' exceeds the weight of 'cmp' by:
 //		(the target of 'cmp' * 'Surpass Threshold')
 func (bn *blockNode) heavierThan(cmp *blockNode) bool {
-	requirement := cmp.depth.Add(cmp.target.Mul(SurpassThreshold))
-	return requirement.Cmp(bn.depth) > 0
+	requirement := cmp.Depth.Add(cmp.Target.Mul(SurpassThreshold))
+	return requirement.Cmp(bn.Depth) > 0
+}
+
+// delayedSiacoinOutputDiff returns a diff that adds the i'th delayed siacoin
+// output created by the block. Delayed outputs mature MaturityDelay blocks
+// after the block that created them.
+func (bn *blockNode) delayedSiacoinOutputDiff(i int) modules.DelayedSiacoinOutputDiff {
+	return modules.DelayedSiacoinOutputDiff{
+		Direction:      modules.DiffApply,
+		ID:             bn.DelayedSiacoinOutputs[i].ID,
+		SiacoinOutput:  bn.DelayedSiacoinOutputs[i].SiacoinOutput,
+		MaturityHeight: bn.Height + types.MaturityDelay,
+	}
+}
+
+// parentNode returns the blockNode of bn's parent. The genesis block has no
+// parent.
+func parentNode(tx *bolt.Tx, bn *blockNode) (parent *blockNode, exists bool) {
+	if bn.Height == 0 {
+		return nil, false
+	}
+	return getBlockNode(tx, bn.Block.ParentID)
+}
+
+// ancestor returns the ancestor of bn that is n generations older, or the
+// genesis block if bn has fewer than n ancestors. Once the walk reaches a
+// block in the current path, the ancestor is looked up directly in the path.
+func ancestor(tx *bolt.Tx, bn *blockNode, n types.BlockHeight) *blockNode {
+	if n > bn.Height {
+		n = bn.Height
+	}
+	targetHeight := bn.Height - n
+	for bn.Height > targetHeight {
+		if id, exists := pathID(tx, bn.Height); exists && id == bn.Block.ID() {
+			id, _ = pathID(tx, targetHeight)
+			bn, _ = getBlockNode(tx, id)
+			break
+		}
+		parent, exists := parentNode(tx, bn)
+		if !exists {
+			if build.DEBUG {
+				panic("block tree is missing the parent of a block")
+			}
+			break
+		}
+		bn = parent
+	}
+	return bn
 }
 
 // earliestChildTimestamp returns the earliest timestamp that a child node
 // can have while still being valid. See section 'Timestamp Rules' in
 // Consensus.md.
-func (bn *blockNode) earliestChildTimestamp() types.Timestamp {
+func (bn *blockNode) earliestChildTimestamp(tx *bolt.Tx) types.Timestamp {
 	// Get the previous MedianTimestampWindow timestamps.
 	windowTimes := make(types.TimestampSlice, types.MedianTimestampWindow)
 	traverse := bn
 	for i := 0; i < types.MedianTimestampWindow; i++ {
-		windowTimes[i] = traverse.block.Timestamp
-		if traverse.parent != nil {
-			traverse = traverse.parent
+		windowTimes[i] = traverse.Block.Timestamp
+		if parent, exists := parentNode(tx, traverse); exists {
+			traverse = parent
 		}
 	}
 	sort.Sort(windowTimes)
@@ -82,38 +132,33 @@ func (bn *blockNode) earliestChildTimestamp() types.Timestamp {
 }
 
 // newChild creates a blockNode from a block and adds it to the parent's set of
-// children. The new node is also returned.
-func (bn *blockNode) newChild(b types.Block) *blockNode {
+// children. The parent is updated in the database; the new node is returned
+// but not saved.
+func (parent *blockNode) newChild(tx *bolt.Tx, b types.Block) *blockNode {
 	// Sanity check - parent can't be nil.
 	if build.DEBUG {
-		if bn == nil {
+		if parent == nil {
 			panic("can't create blockNode with nil parent")
 		}
 	}
 
 	child := &blockNode{
-		block:  b,
-		parent: bn,
-
-		height: bn.height + 1,
-		depth:  bn.childDepth(),
+		Block: b,
 
-		delayedSiacoinOutputs: make(map[types.SiacoinOutputID]types.SiacoinOutput),
+		Height: parent.Height + 1,
+		Depth:  parent.childDepth(),
 	}
 
 	// Calculate the target for the new node. To calculate the target, we need
 	// to compare our timestamp with the timestamp of the reference node, which
 	// is `TargetWindow` blocks earlier, or if the height is less than
 	// `TargetWindow`, it's the genesis block.
-	var numBlocks types.BlockHeight
-	windowStart := child
-	for numBlocks = 0; numBlocks < types.TargetWindow && windowStart.parent != nil; numBlocks++ {
-		windowStart = windowStart.parent
-	}
+	windowStart := ancestor(tx, parent, types.TargetWindow-1)
+	numBlocks := child.Height - windowStart.Height
 
 	// Calculate the amount to adjust the target by dividing the amount of time
 	// passed by the expected amount of time passed.
-	timePassed := child.block.Timestamp - windowStart.block.Timestamp
+	timePassed := child.Block.Timestamp - windowStart.Block.Timestamp
 	expectedTimePassed := types.BlockFrequency * numBlocks
 	targetAdjustment := big.NewRat(int64(timePassed), int64(expectedTimePassed))
 
@@ -125,11 +170,12 @@ func (bn *blockNode) newChild(b types.Block) *blockNode {
 	}
 
 	// Multiply the previous target by the adjustment to get the new target.
-	newRatTarget := new(big.Rat).Mul(bn.target.Rat(), targetAdjustment)
-	child.target = types.RatToTarget(newRatTarget)
+	newRatTarget := new(big.Rat).Mul(parent.Target.Rat(), targetAdjustment)
+	child.Target = types.RatToTarget(newRatTarget)
 
 	// add child to parent
-	bn.children = append(bn.children, child)
+	parent.Children = append(parent.Children, b.ID())
+	putBlockNode(tx, parent)
 
 	return child
 }
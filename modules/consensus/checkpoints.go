@@ -0,0 +1,86 @@
+package consensus
+
+import (
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// checkpoints.go enforces checkpoints: block IDs that must appear at certain
+// heights of any chain the State will accept. Checkpoints protect new nodes
+// from being fed a long, low-difficulty fork of deep history, and they make
+// it safe to bootstrap from a snapshot of the consensus set instead of
+// validating every block since genesis; see snapshot.go.
+
+var (
+	// Checkpoints are the hard-coded checkpoints of the network. Further
+	// checkpoints can be added to a State with AddCheckpoint.
+	Checkpoints = map[types.BlockHeight]types.BlockID{}
+
+	ErrCheckpointMismatch = errors.New("block does not match the checkpoint at its height")
+	ErrCheckpointConflict = errors.New("checkpoint conflicts with the current path")
+	ErrCheckpointFork     = errors.New("block forks from the current path below a checkpoint")
+)
+
+// matchesCheckpoint returns false if there is a checkpoint at the given height
+// and its block ID is not id.
+func (s *State) matchesCheckpoint(height types.BlockHeight, id types.BlockID) bool {
+	checkpoint, exists := s.checkpoints[height]
+	return !exists || checkpoint == id
+}
+
+// forkHeight returns the height of the most recent ancestor of a block node
+// that is in the current path.
+func forkHeight(tx *bolt.Tx, bn *blockNode) types.BlockHeight {
+	for {
+		id, exists := pathID(tx, bn.Height)
+		if exists && id == bn.Block.ID() {
+			return bn.Height
+		}
+		parent, exists := getBlockNode(tx, bn.Block.ParentID)
+		if !exists {
+			return 0
+		}
+		bn = parent
+	}
+}
+
+// checkForkPoint returns ErrCheckpointFork if a child of parent would fork
+// from the current path below the highest checkpoint in the current path. A
+// fork like that can never reach the checkpoint, so it does not need to be
+// kept, regardless of its height.
+func (s *State) checkForkPoint(tx *bolt.Tx, parent *blockNode) error {
+	height := s.height(tx)
+	var highest types.BlockHeight
+	for cpHeight := range s.checkpoints {
+		if cpHeight > highest && cpHeight <= height {
+			highest = cpHeight
+		}
+	}
+	if highest > 0 && forkHeight(tx, parent) < highest {
+		return ErrCheckpointFork
+	}
+	return nil
+}
+
+// AddCheckpoint adds a checkpoint to the State. Blocks at the checkpoint's
+// height that do not match the checkpoint are rejected. A checkpoint that
+// conflicts with the current path is not added.
+func (s *State) AddCheckpoint(height types.BlockHeight, id types.BlockID) error {
+	lockID := s.mu.Lock()
+	defer s.mu.Unlock(lockID)
+
+	var pathBlock types.BlockID
+	var exists bool
+	s.db.View(func(tx *bolt.Tx) error {
+		pathBlock, exists = pathID(tx, height)
+		return nil
+	})
+	if exists && pathBlock != id {
+		return ErrCheckpointConflict
+	}
+	s.checkpoints[height] = id
+	return nil
+}
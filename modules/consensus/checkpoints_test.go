@@ -0,0 +1,68 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestCheckpoints checks that blocks and headers that do not match a
+// checkpoint are rejected, that blocks which fork below a checkpoint are
+// rejected, and that checkpoints which conflict with the current path cannot
+// be added.
+func TestCheckpoints(t *testing.T) {
+	ct := NewTestingEnvironment("TestCheckpoints", t)
+	defer ct.Close()
+
+	// A checkpoint in the current path must match it.
+	err := ct.AddCheckpoint(1, types.BlockID{1})
+	if err != ErrCheckpointConflict {
+		t.Fatal("expected ErrCheckpointConflict, got", err)
+	}
+	b1, _ := ct.BlockAtHeight(1)
+	err = ct.AddCheckpoint(1, b1.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A block that does not match a checkpoint is rejected.
+	err = ct.AddCheckpoint(ct.Height()+1, types.BlockID{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := ct.MineCurrentBlock(nil)
+	_, err = ct.checkHeaders([]types.BlockHeader{b.Header()})
+	if err != errBadHeaders {
+		t.Error("expected errBadHeaders, got", err)
+	}
+	err = ct.AcceptBlock(b)
+	if err != ErrCheckpointMismatch {
+		t.Fatal("expected ErrCheckpointMismatch, got", err)
+	}
+
+	// A block that matches the checkpoint is accepted.
+	err = ct.AddCheckpoint(ct.Height()+1, b.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ct.AcceptBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A block that forks from the current path below a checkpoint is
+	// rejected, even if it is not at the checkpoint's height.
+	ct.MineAndApplyValidBlock()
+	ct.MineAndApplyValidBlock()
+	err = ct.AddCheckpoint(ct.Height(), ct.CurrentBlock().ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent, _ := ct.BlockAtHeight(ct.Height() - 2)
+	target, _ := ct.ChildTarget(parent.ID())
+	fork := MineTestingBlock(parent.ID(), types.CurrentTimestamp()+1, ct.Payouts(ct.Height()-1, nil), nil, target)
+	err = ct.AcceptBlock(fork)
+	if err != ErrCheckpointFork {
+		t.Fatal("expected ErrCheckpointFork, got", err)
+	}
+}
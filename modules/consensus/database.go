@@ -0,0 +1,461 @@
+package consensus
+
+// database.go contains the functions that read and write the block tree and
+// the consensus set, both of which are stored in a Bolt database. Every change
+// made by a block is written in a single database transaction, so the
+// database on disk is always consistent, and loading it on startup does not
+// require any blocks to be processed.
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	// bucketBlockPath maps each height to the ID of the block at that height
+	// in the current path.
+	bucketBlockPath = []byte("BlockPath")
+
+	// bucketBlockMap maps the ID of every valid block, including those not in
+	// the current path, to its blockNode.
+	bucketBlockMap = []byte("BlockMap")
+
+	// bucketSiacoinOutputs, bucketFileContracts, and bucketSiafundOutputs
+	// hold the unspent outputs and open contracts of the current path, keyed
+	// by ID.
+	bucketSiacoinOutputs = []byte("SiacoinOutputs")
+	bucketFileContracts  = []byte("FileContracts")
+	bucketSiafundOutputs = []byte("SiafundOutputs")
+
+	// bucketFileContractExpirations holds a bucket for each height, which
+	// contains the IDs of the open contracts whose windows end at that height.
+	bucketFileContractExpirations = []byte("FileContractExpirations")
+
+	// bucketDelayedSiacoinOutputs holds a bucket for each height, which
+	// contains the delayed siacoin outputs created at that height.
+	bucketDelayedSiacoinOutputs = []byte("DelayedSiacoinOutputs")
+
+	// bucketFileContractStatistics holds the number of open file contracts
+	// and the total size of their files, which are kept up to date as
+	// contracts are added and removed.
+	bucketFileContractStatistics = []byte("FileContractStatistics")
+	keyFileContractStatistics    = []byte("FileContractStatistics")
+
+	// bucketSiafundPool holds the value of the siafund pool.
+	bucketSiafundPool = []byte("SiafundPool")
+	keySiafundPool    = []byte("SiafundPool")
+
+	// bucketChangeLog holds every change to the consensus set, keyed by its
+	// position in the log, and bucketChangeLogIDs maps the ID of each change
+	// to its position.
+	bucketChangeLog    = []byte("ChangeLog")
+	bucketChangeLogIDs = []byte("ChangeLogIDs")
+
+	// bucketMigration records the progress of migrations from older
+	// versions. keyChainDBPending is present while the blocks of an old block
+	// database have not all been added to the consensus set.
+	bucketMigration   = []byte("Migration")
+	keyChainDBPending = []byte("ChainDBPending")
+
+	errDatabaseCorrupt = errors.New("consensus database is corrupt")
+)
+
+// A delayedSiacoinOutput is a siacoin output that was created by a block but
+// cannot be spent until it matures.
+type delayedSiacoinOutput struct {
+	ID            types.SiacoinOutputID
+	SiacoinOutput types.SiacoinOutput
+}
+
+// fileContractStatistics are the number of open file contracts and the total
+// size of their files.
+type fileContractStatistics struct {
+	Count uint64
+	Size  uint64
+}
+
+// A changeEntry is a change to the consensus set, as it is stored in the
+// change log. Only the IDs of the blocks are stored, because the blocks
+// themselves are in the block tree.
+type changeEntry struct {
+	ID             modules.ConsensusChangeID
+	RevertedBlocks []types.BlockID
+	AppliedBlocks  []types.BlockID
+}
+
+// openDB opens the consensus database at filename, creating it and its
+// buckets if they do not exist.
+func openDB(filename string) (*bolt.DB, error) {
+	db, err := bolt.Open(filename, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	// Syncing after every block makes tests very slow, and a crash during a
+	// test does not need to be recovered from.
+	db.NoSync = build.Release == "testing"
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		buckets := [][]byte{
+			bucketBlockPath,
+			bucketBlockMap,
+			bucketSiacoinOutputs,
+			bucketFileContracts,
+			bucketSiafundOutputs,
+			bucketFileContractExpirations,
+			bucketFileContractStatistics,
+			bucketDelayedSiacoinOutputs,
+			bucketSiafundPool,
+			bucketChangeLog,
+			bucketChangeLogIDs,
+			bucketMigration,
+		}
+		for _, bucket := range buckets {
+			_, err := tx.CreateBucketIfNotExists(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// pathID returns the ID of the block at the given height in the current path.
+func pathID(tx *bolt.Tx, height types.BlockHeight) (id types.BlockID, exists bool) {
+	value := tx.Bucket(bucketBlockPath).Get(persist.HeightKey(height))
+	if value == nil {
+		return
+	}
+	copy(id[:], value)
+	return id, true
+}
+
+// pushPath appends a block to the current path.
+func pushPath(tx *bolt.Tx, height types.BlockHeight, id types.BlockID) {
+	persist.MustPut(tx.Bucket(bucketBlockPath), persist.HeightKey(height), id[:])
+}
+
+// popPath removes the block at the given height, which must be the last block
+// in the current path.
+func popPath(tx *bolt.Tx, height types.BlockHeight) {
+	persist.MustDelete(tx.Bucket(bucketBlockPath), persist.HeightKey(height))
+}
+
+// pathHeight returns the height of the current path.
+func pathHeight(tx *bolt.Tx) types.BlockHeight {
+	key, _ := tx.Bucket(bucketBlockPath).Cursor().Last()
+	return types.BlockHeight(binary.BigEndian.Uint64(key))
+}
+
+// getBlockNode returns the blockNode of a block in the block tree.
+func getBlockNode(tx *bolt.Tx, id types.BlockID) (bn *blockNode, exists bool) {
+	value := tx.Bucket(bucketBlockMap).Get(id[:])
+	if value == nil {
+		return nil, false
+	}
+	bn = new(blockNode)
+	persist.MustUnmarshal(value, bn)
+	return bn, true
+}
+
+// putBlockNode adds a blockNode to the block tree, or updates it if it is
+// already in the tree.
+func putBlockNode(tx *bolt.Tx, bn *blockNode) {
+	id := bn.Block.ID()
+	persist.MustPut(tx.Bucket(bucketBlockMap), id[:], encoding.Marshal(*bn))
+}
+
+// removeBlockNode removes a blockNode from the block tree.
+func removeBlockNode(tx *bolt.Tx, id types.BlockID) {
+	persist.MustDelete(tx.Bucket(bucketBlockMap), id[:])
+}
+
+// getSiacoinOutput returns the unspent siacoin output with the given ID.
+func getSiacoinOutput(tx *bolt.Tx, id types.SiacoinOutputID) (sco types.SiacoinOutput, exists bool) {
+	value := tx.Bucket(bucketSiacoinOutputs).Get(id[:])
+	if value == nil {
+		return
+	}
+	persist.MustUnmarshal(value, &sco)
+	return sco, true
+}
+
+// putSiacoinOutput adds an unspent siacoin output to the consensus set.
+func putSiacoinOutput(tx *bolt.Tx, id types.SiacoinOutputID, sco types.SiacoinOutput) {
+	persist.MustPut(tx.Bucket(bucketSiacoinOutputs), id[:], encoding.Marshal(sco))
+}
+
+// removeSiacoinOutput removes an unspent siacoin output from the consensus
+// set.
+func removeSiacoinOutput(tx *bolt.Tx, id types.SiacoinOutputID) {
+	persist.MustDelete(tx.Bucket(bucketSiacoinOutputs), id[:])
+}
+
+// getFileContract returns the open file contract with the given ID.
+func getFileContract(tx *bolt.Tx, id types.FileContractID) (fc types.FileContract, exists bool) {
+	value := tx.Bucket(bucketFileContracts).Get(id[:])
+	if value == nil {
+		return
+	}
+	persist.MustUnmarshal(value, &fc)
+	return fc, true
+}
+
+// putFileContract adds an open file contract to the consensus set, and
+// records the height at which it expires.
+func putFileContract(tx *bolt.Tx, id types.FileContractID, fc types.FileContract) {
+	persist.MustPut(tx.Bucket(bucketFileContracts), id[:], encoding.Marshal(fc))
+	expirations, err := tx.Bucket(bucketFileContractExpirations).CreateBucketIfNotExists(persist.HeightKey(fc.WindowEnd))
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+	persist.MustPut(expirations, id[:], []byte{})
+}
+
+// removeFileContract removes an open file contract from the consensus set.
+func removeFileContract(tx *bolt.Tx, id types.FileContractID) {
+	fc, exists := getFileContract(tx, id)
+	if !exists {
+		return
+	}
+	persist.MustDelete(tx.Bucket(bucketFileContracts), id[:])
+	expirationsBucket := tx.Bucket(bucketFileContractExpirations)
+	expirations := expirationsBucket.Bucket(persist.HeightKey(fc.WindowEnd))
+	if expirations == nil {
+		return
+	}
+	persist.MustDelete(expirations, id[:])
+	if key, _ := expirations.Cursor().First(); key == nil {
+		err := expirationsBucket.DeleteBucket(persist.HeightKey(fc.WindowEnd))
+		if build.DEBUG && err != nil {
+			panic(err)
+		}
+	}
+}
+
+// getFileContractStatistics returns the statistics of the open file
+// contracts. Databases created before the statistics were kept do not have
+// them.
+func getFileContractStatistics(tx *bolt.Tx) (stats fileContractStatistics, exists bool) {
+	value := tx.Bucket(bucketFileContractStatistics).Get(keyFileContractStatistics)
+	if value == nil {
+		return
+	}
+	persist.MustUnmarshal(value, &stats)
+	return stats, true
+}
+
+// setFileContractStatistics sets the statistics of the open file contracts.
+func setFileContractStatistics(tx *bolt.Tx, stats fileContractStatistics) {
+	persist.MustPut(tx.Bucket(bucketFileContractStatistics), keyFileContractStatistics, encoding.Marshal(stats))
+}
+
+// countFileContracts computes the statistics of the open file contracts by
+// reading every contract.
+func countFileContracts(tx *bolt.Tx) (stats fileContractStatistics) {
+	tx.Bucket(bucketFileContracts).ForEach(func(_, value []byte) error {
+		var fc types.FileContract
+		persist.MustUnmarshal(value, &fc)
+		stats.Count++
+		stats.Size += fc.FileSize
+		return nil
+	})
+	return
+}
+
+// expiringFileContracts returns the IDs of the open file contracts whose
+// windows end at the given height.
+func expiringFileContracts(tx *bolt.Tx, height types.BlockHeight) (ids []types.FileContractID) {
+	expirations := tx.Bucket(bucketFileContractExpirations).Bucket(persist.HeightKey(height))
+	if expirations == nil {
+		return nil
+	}
+	expirations.ForEach(func(key, _ []byte) error {
+		var id types.FileContractID
+		copy(id[:], key)
+		ids = append(ids, id)
+		return nil
+	})
+	return ids
+}
+
+// getSiafundOutput returns the unspent siafund output with the given ID.
+func getSiafundOutput(tx *bolt.Tx, id types.SiafundOutputID) (sfo types.SiafundOutput, exists bool) {
+	value := tx.Bucket(bucketSiafundOutputs).Get(id[:])
+	if value == nil {
+		return
+	}
+	persist.MustUnmarshal(value, &sfo)
+	return sfo, true
+}
+
+// putSiafundOutput adds an unspent siafund output to the consensus set.
+func putSiafundOutput(tx *bolt.Tx, id types.SiafundOutputID, sfo types.SiafundOutput) {
+	persist.MustPut(tx.Bucket(bucketSiafundOutputs), id[:], encoding.Marshal(sfo))
+}
+
+// removeSiafundOutput removes an unspent siafund output from the consensus
+// set.
+func removeSiafundOutput(tx *bolt.Tx, id types.SiafundOutputID) {
+	persist.MustDelete(tx.Bucket(bucketSiafundOutputs), id[:])
+}
+
+// getSiafundPool returns the value of the siafund pool.
+func getSiafundPool(tx *bolt.Tx) (pool types.Currency) {
+	value := tx.Bucket(bucketSiafundPool).Get(keySiafundPool)
+	if value == nil {
+		return types.ZeroCurrency
+	}
+	persist.MustUnmarshal(value, &pool)
+	return pool
+}
+
+// chainDBPending returns true if the migration of an old block database has
+// not finished.
+func chainDBPending(tx *bolt.Tx) bool {
+	return tx.Bucket(bucketMigration).Get(keyChainDBPending) != nil
+}
+
+// setChainDBPending records whether the migration of an old block database
+// has not finished.
+func setChainDBPending(tx *bolt.Tx, pending bool) {
+	if pending {
+		persist.MustPut(tx.Bucket(bucketMigration), keyChainDBPending, []byte{1})
+	} else {
+		persist.MustDelete(tx.Bucket(bucketMigration), keyChainDBPending)
+	}
+}
+
+// setSiafundPool sets the value of the siafund pool.
+func setSiafundPool(tx *bolt.Tx, pool types.Currency) {
+	persist.MustPut(tx.Bucket(bucketSiafundPool), keySiafundPool, encoding.Marshal(pool))
+}
+
+// createDelayedOutputs creates the (empty) set of delayed siacoin outputs for
+// a height.
+func createDelayedOutputs(tx *bolt.Tx, height types.BlockHeight) {
+	_, err := tx.Bucket(bucketDelayedSiacoinOutputs).CreateBucketIfNotExists(persist.HeightKey(height))
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+}
+
+// removeDelayedOutputs removes the set of delayed siacoin outputs for a
+// height.
+func removeDelayedOutputs(tx *bolt.Tx, height types.BlockHeight) {
+	err := tx.Bucket(bucketDelayedSiacoinOutputs).DeleteBucket(persist.HeightKey(height))
+	if build.DEBUG && err != nil && err != bolt.ErrBucketNotFound {
+		panic(err)
+	}
+}
+
+// putDelayedSiacoinOutput adds a delayed siacoin output that was created at
+// the given height. The set of delayed outputs for the height must exist.
+func putDelayedSiacoinOutput(tx *bolt.Tx, height types.BlockHeight, id types.SiacoinOutputID, sco types.SiacoinOutput) {
+	delayed := tx.Bucket(bucketDelayedSiacoinOutputs).Bucket(persist.HeightKey(height))
+	if delayed == nil {
+		if build.DEBUG {
+			panic("adding a delayed output to a height without delayed outputs")
+		}
+		return
+	}
+	persist.MustPut(delayed, id[:], encoding.Marshal(sco))
+}
+
+// getDelayedSiacoinOutput returns the delayed siacoin output that was created
+// at the given height with the given ID.
+func getDelayedSiacoinOutput(tx *bolt.Tx, height types.BlockHeight, id types.SiacoinOutputID) (sco types.SiacoinOutput, exists bool) {
+	delayed := tx.Bucket(bucketDelayedSiacoinOutputs).Bucket(persist.HeightKey(height))
+	if delayed == nil {
+		return
+	}
+	value := delayed.Get(id[:])
+	if value == nil {
+		return
+	}
+	persist.MustUnmarshal(value, &sco)
+	return sco, true
+}
+
+// delayedSiacoinOutputs returns the delayed siacoin outputs created at the
+// given height, sorted by ID.
+func delayedSiacoinOutputs(tx *bolt.Tx, height types.BlockHeight) (dscos []delayedSiacoinOutput) {
+	delayed := tx.Bucket(bucketDelayedSiacoinOutputs).Bucket(persist.HeightKey(height))
+	if delayed == nil {
+		return nil
+	}
+	delayed.ForEach(func(key, value []byte) error {
+		var dsco delayedSiacoinOutput
+		copy(dsco.ID[:], key)
+		persist.MustUnmarshal(value, &dsco.SiacoinOutput)
+		dscos = append(dscos, dsco)
+		return nil
+	})
+	return dscos
+}
+
+// changeLogLen returns the number of changes in the change log.
+func changeLogLen(tx *bolt.Tx) uint64 {
+	key, _ := tx.Bucket(bucketChangeLog).Cursor().Last()
+	if key == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(key) + 1
+}
+
+// appendChange adds a change to the end of the change log. The ID of the
+// change is derived from its contents and the ID of the previous change, so
+// every change has a unique ID, even if the same blocks are reverted and
+// applied more than once.
+func appendChange(tx *bolt.Tx, revertedBlocks, appliedBlocks []types.BlockID) changeEntry {
+	n := changeLogLen(tx)
+	var prevID modules.ConsensusChangeID
+	if n > 0 {
+		prevID = getChange(tx, n-1).ID
+	}
+	ce := changeEntry{
+		RevertedBlocks: revertedBlocks,
+		AppliedBlocks:  appliedBlocks,
+	}
+	ce.ID = modules.ConsensusChangeID(crypto.HashAll(prevID, ce.RevertedBlocks, ce.AppliedBlocks))
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	persist.MustPut(tx.Bucket(bucketChangeLog), key, encoding.Marshal(ce))
+	persist.MustPut(tx.Bucket(bucketChangeLogIDs), ce.ID[:], key)
+	return ce
+}
+
+// getChange returns the change at position n of the change log.
+func getChange(tx *bolt.Tx, n uint64) (ce changeEntry) {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, n)
+	value := tx.Bucket(bucketChangeLog).Get(key)
+	if value == nil {
+		panic(errDatabaseCorrupt)
+	}
+	persist.MustUnmarshal(value, &ce)
+	return ce
+}
+
+// changePosition returns the position of a change in the change log.
+func changePosition(tx *bolt.Tx, id modules.ConsensusChangeID) (n uint64, exists bool) {
+	value := tx.Bucket(bucketChangeLogIDs).Get(id[:])
+	if value == nil {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(value), true
+}
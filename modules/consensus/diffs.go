@@ -3,6 +3,8 @@ package consensus
 import (
 	"errors"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
@@ -14,85 +16,91 @@ import (
 // are created, applied, reverted, and queried in this file.
 
 // commitSiacoinOutputDiff applies or reverts a SiacoinOutputDiff.
-func (s *State) commitSiacoinOutputDiff(scod modules.SiacoinOutputDiff, dir modules.DiffDirection) {
+func (s *State) commitSiacoinOutputDiff(tx *bolt.Tx, scod modules.SiacoinOutputDiff, dir modules.DiffDirection) {
 	// Sanity check - should not be adding an output twice, or deleting an
 	// output that does not exist.
 	if build.DEBUG {
-		_, exists := s.siacoinOutputs[scod.ID]
+		_, exists := getSiacoinOutput(tx, scod.ID)
 		if exists == (scod.Direction == dir) {
 			panic("rogue siacoin output in commitSiacoinOutputDiff")
 		}
 	}
 
 	if scod.Direction == dir {
-		s.siacoinOutputs[scod.ID] = scod.SiacoinOutput
+		putSiacoinOutput(tx, scod.ID, scod.SiacoinOutput)
 	} else {
-		delete(s.siacoinOutputs, scod.ID)
+		removeSiacoinOutput(tx, scod.ID)
 	}
 }
 
 // commitFileContractDiff applies or reverts a FileContractDiff.
-func (s *State) commitFileContractDiff(fcd modules.FileContractDiff, dir modules.DiffDirection) {
+func (s *State) commitFileContractDiff(tx *bolt.Tx, fcd modules.FileContractDiff, dir modules.DiffDirection) {
 	// Sanity check - should not be adding a contract twice, or deleting a
 	// contract that does not exist.
 	if build.DEBUG {
-		_, exists := s.fileContracts[fcd.ID]
+		_, exists := getFileContract(tx, fcd.ID)
 		if exists == (fcd.Direction == dir) {
 			panic("rogue file contract in commitFileContractDiff")
 		}
 	}
 
+	stats, _ := getFileContractStatistics(tx)
 	if fcd.Direction == dir {
-		s.fileContracts[fcd.ID] = fcd.FileContract
+		putFileContract(tx, fcd.ID, fcd.FileContract)
+		stats.Count++
+		stats.Size += fcd.FileContract.FileSize
 	} else {
-		delete(s.fileContracts, fcd.ID)
+		removeFileContract(tx, fcd.ID)
+		stats.Count--
+		stats.Size -= fcd.FileContract.FileSize
 	}
+	setFileContractStatistics(tx, stats)
 }
 
 // commitSiafundOutputDiff applies or reverts a SiafundOutputDiff.
-func (s *State) commitSiafundOutputDiff(sfod modules.SiafundOutputDiff, dir modules.DiffDirection) {
+func (s *State) commitSiafundOutputDiff(tx *bolt.Tx, sfod modules.SiafundOutputDiff, dir modules.DiffDirection) {
 	// Sanity check - should not be adding an output twice, or deleting an
 	// output that does not exist.
 	if build.DEBUG {
-		_, exists := s.siafundOutputs[sfod.ID]
+		_, exists := getSiafundOutput(tx, sfod.ID)
 		if exists == (sfod.Direction == dir) {
 			panic("rogue siafund output in commitSiafundOutputDiff")
 		}
 	}
 
 	if sfod.Direction == dir {
-		s.siafundOutputs[sfod.ID] = sfod.SiafundOutput
+		putSiafundOutput(tx, sfod.ID, sfod.SiafundOutput)
 	} else {
-		delete(s.siafundOutputs, sfod.ID)
+		removeSiafundOutput(tx, sfod.ID)
 	}
 }
 
 // commitSiafundPoolDiff applies or reverts a SiafundPoolDiff.
-func (s *State) commitSiafundPoolDiff(sfpd modules.SiafundPoolDiff, dir modules.DiffDirection) {
+func (s *State) commitSiafundPoolDiff(tx *bolt.Tx, sfpd modules.SiafundPoolDiff, dir modules.DiffDirection) {
 	if dir == modules.DiffApply {
-		s.siafundPool = sfpd.Adjusted
+		setSiafundPool(tx, sfpd.Adjusted)
 	} else {
-		s.siafundPool = sfpd.Previous
+		setSiafundPool(tx, sfpd.Previous)
 	}
 }
 
 // commitDiffSet applies or reverts the diffs in a blockNode.
-func (s *State) commitDiffSet(bn *blockNode, dir modules.DiffDirection) {
+func (s *State) commitDiffSet(tx *bolt.Tx, bn *blockNode, dir modules.DiffDirection) {
 	// Sanity check
 	if build.DEBUG {
 		// Diffs should have already been generated for this node.
-		if !bn.diffsGenerated {
+		if !bn.DiffsGenerated {
 			panic("misuse of applyDiffSet - diffs have not been generated!")
 		}
 
 		// Current node must be the input node's parent if applying, and
 		// current node must be the input node if reverting.
 		if dir == modules.DiffApply {
-			if bn.parent.block.ID() != s.currentBlockID() {
+			if bn.Block.ParentID != s.currentBlockID(tx) {
 				panic("applying a block node when it's not a valid successor")
 			}
 		} else {
-			if bn.block.ID() != s.currentBlockID() {
+			if bn.Block.ID() != s.currentBlockID(tx) {
 				panic("applying a block node when it's not a valid successor")
 			}
 		}
@@ -100,37 +108,38 @@ func (s *State) commitDiffSet(bn *blockNode, dir modules.DiffDirection) {
 
 	// Apply each of the diffs.
 	if dir == modules.DiffApply {
-		for _, scod := range bn.siacoinOutputDiffs {
-			s.commitSiacoinOutputDiff(scod, dir)
+		for _, scod := range bn.SiacoinOutputDiffs {
+			s.commitSiacoinOutputDiff(tx, scod, dir)
 		}
-		for _, fcd := range bn.fileContractDiffs {
-			s.commitFileContractDiff(fcd, dir)
+		for _, fcd := range bn.FileContractDiffs {
+			s.commitFileContractDiff(tx, fcd, dir)
 		}
-		for _, sfod := range bn.siafundOutputDiffs {
-			s.commitSiafundOutputDiff(sfod, dir)
+		for _, sfod := range bn.SiafundOutputDiffs {
+			s.commitSiafundOutputDiff(tx, sfod, dir)
 		}
 	} else {
-		for i := len(bn.siacoinOutputDiffs) - 1; i >= 0; i-- {
-			s.commitSiacoinOutputDiff(bn.siacoinOutputDiffs[i], dir)
+		for i := len(bn.SiacoinOutputDiffs) - 1; i >= 0; i-- {
+			s.commitSiacoinOutputDiff(tx, bn.SiacoinOutputDiffs[i], dir)
 		}
-		for i := len(bn.fileContractDiffs) - 1; i >= 0; i-- {
-			s.commitFileContractDiff(bn.fileContractDiffs[i], dir)
+		for i := len(bn.FileContractDiffs) - 1; i >= 0; i-- {
+			s.commitFileContractDiff(tx, bn.FileContractDiffs[i], dir)
 		}
-		for i := len(bn.siafundOutputDiffs) - 1; i >= 0; i-- {
-			s.commitSiafundOutputDiff(bn.siafundOutputDiffs[i], dir)
+		for i := len(bn.SiafundOutputDiffs) - 1; i >= 0; i-- {
+			s.commitSiafundOutputDiff(tx, bn.SiafundOutputDiffs[i], dir)
 		}
 	}
-	s.commitSiafundPoolDiff(bn.siafundPoolDiff, dir)
+	s.commitSiafundPoolDiff(tx, bn.SiafundPoolDiff, dir)
 
-	// Update the State's metadata
+	// Update the current path and the delayed outputs.
 	if dir == modules.DiffApply {
-		s.currentPath = append(s.currentPath, bn.block.ID())
-		s.db.AddBlock(bn.block)
-		s.delayedSiacoinOutputs[bn.height] = bn.delayedSiacoinOutputs
+		pushPath(tx, bn.Height, bn.Block.ID())
+		createDelayedOutputs(tx, bn.Height)
+		for _, dsco := range bn.DelayedSiacoinOutputs {
+			putDelayedSiacoinOutput(tx, bn.Height, dsco.ID, dsco.SiacoinOutput)
+		}
 	} else {
-		s.currentPath = s.currentPath[:len(s.currentPath)-1]
-		s.db.RemoveBlock()
-		delete(s.delayedSiacoinOutputs, bn.height)
+		popPath(tx, bn.Height)
+		removeDelayedOutputs(tx, bn.Height)
 	}
 }
 
@@ -138,61 +147,62 @@ func (s *State) commitDiffSet(bn *blockNode, dir modules.DiffDirection) {
 // consensus state. These two actions must happen at the same time because
 // transactions are allowed to depend on each other. We can't be sure that a
 // transaction is valid unless we have applied all of the previous transactions
-// in the block, which means we need to apply while we verify.
-func (s *State) generateAndApplyDiff(bn *blockNode) (err error) {
+// in the block, which means we need to apply while we verify. If the block is
+// valid, the node and its diffs are saved in the block tree.
+func (s *State) generateAndApplyDiff(tx *bolt.Tx, bn *blockNode) (err error) {
 	// Sanity check
 	if build.DEBUG {
 		// Generate should only be called if the diffs have not yet been
 		// generated.
-		if bn.diffsGenerated {
+		if bn.DiffsGenerated {
 			panic("misuse of generateAndApplyDiff")
 		}
 
 		// Current node must be the input node's parent.
-		if bn.parent.block.ID() != s.currentBlockID() {
+		if bn.Block.ParentID != s.currentBlockID(tx) {
 			panic("applying a block node when it's not a valid successor")
 		}
 	}
 
 	// Update the state to point to the new block.
-	s.currentPath = append(s.currentPath, bn.block.ID())
-	s.db.AddBlock(bn.block)
-	s.delayedSiacoinOutputs[s.height()] = make(map[types.SiacoinOutputID]types.SiacoinOutput)
+	pushPath(tx, bn.Height, bn.Block.ID())
+	createDelayedOutputs(tx, bn.Height)
 
-	// diffsGenerated is set to true as soon as we start changing the set of
+	// DiffsGenerated is set to true as soon as we start changing the set of
 	// diffs in the block node. If at any point the block is found to be
 	// invalid, the diffs can be safely reversed from whatever point.
-	bn.diffsGenerated = true
+	bn.DiffsGenerated = true
 
 	// The first diff to be applied is to mark what the starting siafundPool balance
 	// is.
-	bn.siafundPoolDiff.Previous = s.siafundPool
+	bn.SiafundPoolDiff.Previous = getSiafundPool(tx)
 
 	// Validate and apply each transaction in the block. They cannot be
 	// validated all at once because some transactions may not be valid until
 	// previous transactions have been applied.
-	for _, txn := range bn.block.Transactions {
-		err = s.validTransaction(txn)
+	for _, txn := range bn.Block.Transactions {
+		err = s.validTransaction(tx, txn)
 		if err != nil {
-			s.badBlocks[bn.block.ID()] = struct{}{}
-			s.deleteNode(bn)
-			s.commitDiffSet(bn, modules.DiffRevert)
+			s.badBlocks[bn.Block.ID()] = struct{}{}
+			s.deleteNode(tx, bn)
+			s.commitDiffSet(tx, bn, modules.DiffRevert)
 			return
 		}
 
-		s.applyTransaction(bn, txn)
+		s.applyTransaction(tx, bn, txn)
 	}
 
 	// After all of the transactions have been applied, 'maintenance' is
 	// applied on the block. This includes adding any outputs that have reached
 	// maturity, applying any contracts with missed storage proofs, and adding
 	// the miner payouts to the list of delayed outputs.
-	s.applyMaintenance(bn)
+	s.applyMaintenance(tx, bn)
 
 	// The final thing is to update the siafundPoolDiff to indicate where the
 	// siafund pool ended up.
-	bn.siafundPoolDiff.Adjusted = s.siafundPool
+	bn.SiafundPoolDiff.Adjusted = getSiafundPool(tx)
 
+	putBlockNode(tx, bn)
 	return
 }
 
@@ -201,15 +211,16 @@ func (s *State) BlockDiffs(bid types.BlockID) (scods []modules.SiacoinOutputDiff
 	id := s.mu.RLock()
 	defer s.mu.RUnlock(id)
 
-	bn, exists := s.blockMap[bid]
-	if !exists {
-		err = errors.New("could not find block")
-		return
-	}
-
-	scods = bn.siacoinOutputDiffs
-	fcds = bn.fileContractDiffs
-	sfods = bn.siafundOutputDiffs
-	sfpd = bn.siafundPoolDiff
+	err = s.db.View(func(tx *bolt.Tx) error {
+		bn, exists := getBlockNode(tx, bid)
+		if !exists {
+			return errors.New("could not find block")
+		}
+		scods = bn.SiacoinOutputDiffs
+		fcds = bn.FileContractDiffs
+		sfods = bn.SiafundOutputDiffs
+		sfpd = bn.SiafundPoolDiff
+		return nil
+	})
 	return
 }
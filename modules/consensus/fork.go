@@ -1,42 +1,49 @@
 package consensus
 
 import (
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 // deleteNode recursively deletes its children from the set of known blocks.
-func (s *State) deleteNode(node *blockNode) {
-	for i := range node.children {
-		s.deleteNode(node.children[i])
+func (s *State) deleteNode(tx *bolt.Tx, node *blockNode) {
+	for _, childID := range node.Children {
+		child, exists := getBlockNode(tx, childID)
+		if exists {
+			s.deleteNode(tx, child)
+		}
 	}
-	delete(s.blockMap, node.block.ID())
+	removeBlockNode(tx, node.Block.ID())
 }
 
 // backtrackToCurrentPath traces backwards from 'bn' until it reaches a node in
 // the State's current path (the "common parent"). It returns the (inclusive)
 // set of nodes between the common parent and 'bn', starting from the former.
-func (s *State) backtrackToCurrentPath(bn *blockNode) []*blockNode {
+func (s *State) backtrackToCurrentPath(tx *bolt.Tx, bn *blockNode) []*blockNode {
 	path := []*blockNode{bn}
 	for {
 		// stop when we reach the common parent
-		if bn.height <= s.height() && s.currentPath[bn.height] == bn.block.ID() {
+		if id, exists := pathID(tx, bn.Height); exists && id == bn.Block.ID() {
 			break
 		}
 
-		bn = bn.parent
-		path = append([]*blockNode{bn}, path...) // prepend, not append
-
 		// Sanity check - all block nodes should have a parent except the
 		// genesis block, and this loop should break before reaching the
 		// genesis block.
-		if bn == nil {
+		parent, exists := parentNode(tx, bn)
+		if !exists {
 			if build.DEBUG {
 				panic("backtrack hit a nil node?")
 			}
 			break
 		}
+
+		bn = parent
+		path = append([]*blockNode{bn}, path...) // prepend, not append
 	}
 	return path
 }
@@ -44,18 +51,18 @@ func (s *State) backtrackToCurrentPath(bn *blockNode) []*blockNode {
 // revertToNode will revert blocks from the State's current path until 'bn' is
 // the current block. The list returned is in reversed order; the first block
 // in the list was the first reverted, and has the highest height.
-func (s *State) revertToNode(bn *blockNode) (revertedNodes []*blockNode) {
+func (s *State) revertToNode(tx *bolt.Tx, bn *blockNode) (revertedNodes []*blockNode) {
 	// Sanity check - make sure that bn is in the currentPath.
 	if build.DEBUG {
-		if s.currentPath[bn.height] != bn.block.ID() {
+		if id, _ := pathID(tx, bn.Height); id != bn.Block.ID() {
 			panic("can't revert to node not in current path")
 		}
 	}
 
 	// Rewind blocks until we reach 'bn'.
-	for s.currentBlockID() != bn.block.ID() {
-		node := s.currentBlockNode()
-		s.commitDiffSet(node, modules.DiffRevert)
+	for s.currentBlockID(tx) != bn.Block.ID() {
+		node := s.currentBlockNode(tx)
+		s.commitDiffSet(tx, node, modules.DiffRevert)
 		revertedNodes = append(revertedNodes, node)
 	}
 	return
@@ -63,18 +70,18 @@ func (s *State) revertToNode(bn *blockNode) (revertedNodes []*blockNode) {
 
 // applyUntilNode will successively apply the blocks between the state's
 // currentPath and 'bn'.
-func (s *State) applyUntilNode(bn *blockNode) (appliedNodes []*blockNode, err error) {
+func (s *State) applyUntilNode(tx *bolt.Tx, bn *blockNode) (appliedNodes []*blockNode, err error) {
 	// Backtrack to the common parent of 'bn' and currentPath.
-	newPath := s.backtrackToCurrentPath(bn)
+	newPath := s.backtrackToCurrentPath(tx, bn)
 
 	// Apply new nodes.
 	for _, node := range newPath[1:] {
 		// If the diffs for this node have already been generated, apply diffs
 		// directly instead of generating them. This is much faster.
-		if node.diffsGenerated {
-			s.commitDiffSet(node, modules.DiffApply)
+		if node.DiffsGenerated {
+			s.commitDiffSet(tx, node, modules.DiffApply)
 		} else {
-			err = s.generateAndApplyDiff(node)
+			err = s.generateAndApplyDiff(tx, node)
 			if err != nil {
 				break
 			}
@@ -89,37 +96,46 @@ func (s *State) applyUntilNode(bn *blockNode) (appliedNodes []*blockNode, err er
 // will be returned if any of the blocks applied in the transition are found to
 // be invalid. forkBlockchain is atomic; the State is only updated if the
 // function returns nil.
-func (s *State) forkBlockchain(newNode *blockNode) (err error) {
+func (s *State) forkBlockchain(tx *bolt.Tx, newNode *blockNode) (err error) {
 	// In debug mode, record the old state hash before attempting the fork.
 	// This variable is otherwise unused.
 	var oldHash crypto.Hash
 	if build.DEBUG {
-		oldHash = s.consensusSetHash()
+		oldHash = s.consensusSetHash(tx)
 	}
-	oldHead := s.currentBlockNode()
+	oldHead := s.currentBlockNode(tx)
 
 	// revert to the common parent
-	commonParent := s.backtrackToCurrentPath(newNode)[0]
-	revertedNodes := s.revertToNode(commonParent)
+	commonParent := s.backtrackToCurrentPath(tx, newNode)[0]
+	revertedNodes := s.revertToNode(tx, commonParent)
 
 	// fast-forward to newNode
-	appliedNodes, err := s.applyUntilNode(newNode)
+	appliedNodes, err := s.applyUntilNode(tx, newNode)
 	if err == nil {
 		// If application succeeded, notify the subscribers and return. Error
 		// handling happens outside this if statement.
-		s.updateSubscribers(revertedNodes, appliedNodes)
+		s.updateSubscribers(tx, blockIDs(revertedNodes), blockIDs(appliedNodes))
 		return
 	}
 
 	// restore old path
-	s.revertToNode(commonParent)
-	_, errReapply := s.applyUntilNode(oldHead)
+	s.revertToNode(tx, commonParent)
+	_, errReapply := s.applyUntilNode(tx, oldHead)
 	if build.DEBUG {
 		if errReapply != nil {
 			panic("couldn't reapply previously applied diffs")
-		} else if s.consensusSetHash() != oldHash {
+		} else if s.consensusSetHash(tx) != oldHash {
 			panic("state hash changed after an unsuccessful fork attempt")
 		}
 	}
 	return
 }
+
+// blockIDs returns the IDs of the blocks in a list of nodes.
+func blockIDs(nodes []*blockNode) []types.BlockID {
+	ids := make([]types.BlockID, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.Block.ID()
+	}
+	return ids
+}
@@ -49,7 +49,7 @@ func TestComplexForking(t *testing.T) {
 
 	// Create gateway. For this test, we can use the same gateway in all
 	// States without causing problems.
-	g, err := gateway.New(":0", tester.TempDir("consensus", "TestComplexForking", "gateway"))
+	g, err := gateway.New(":0", "", tester.TempDir("consensus", "TestComplexForking", "gateway"))
 	if err != nil {
 		t.Fatal(err)
 	}
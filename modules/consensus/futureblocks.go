@@ -0,0 +1,50 @@
+package consensus
+
+import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// futureblocks.go holds blocks whose timestamps are more than FutureThreshold
+// into the future. Such blocks are usually valid blocks from a node whose
+// clock is slightly ahead, so instead of being dropped they are held until
+// their timestamps are valid, and then accepted again. Blocks more than
+// ExtremeFutureThreshold into the future are rejected outright, and only a
+// limited number of blocks are held, so the queue cannot be used to exhaust
+// memory.
+
+const (
+	// maxFutureBlocks is the maximum number of blocks that are held until
+	// their timestamps are no longer in the future.
+	maxFutureBlocks = 50
+)
+
+// queueFutureBlock holds a block until its timestamp is no longer in the
+// future. If the block is already held or the queue is full, the block is
+// dropped.
+func (s *State) queueFutureBlock(b types.Block) {
+	id := b.ID()
+	if _, exists := s.futureBlocks[id]; exists || len(s.futureBlocks) >= maxFutureBlocks {
+		return
+	}
+	s.futureBlocks[id] = b
+	go s.threadedAcceptFutureBlock(b)
+}
+
+// threadedAcceptFutureBlock waits until the timestamp of a held block is no
+// longer in the future, and then tries to accept the block again. If the block
+// is accepted, it is relayed to peers like any other block.
+func (s *State) threadedAcceptFutureBlock(b types.Block) {
+	// Wait an extra second, because timestamps are only accurate to the
+	// second.
+	if valid := b.Timestamp - types.FutureThreshold; valid > types.CurrentTimestamp() {
+		time.Sleep(time.Duration(valid-types.CurrentTimestamp()+1) * time.Second)
+	}
+
+	id := s.mu.Lock()
+	delete(s.futureBlocks, b.ID())
+	s.mu.Unlock(id)
+
+	s.AcceptBlock(b)
+}
@@ -0,0 +1,71 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestFutureBlock checks that a block with a timestamp slightly in the future
+// is held and accepted once its timestamp is valid, and that blocks further in
+// the future are rejected.
+func TestFutureBlock(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ct := NewTestingEnvironment("TestFutureBlock", t)
+	defer ct.Close()
+
+	// A block beyond the extreme threshold is not held.
+	extreme := MineTestingBlock(ct.CurrentBlock().ID(), types.CurrentTimestamp()+types.ExtremeFutureThreshold+5, ct.Payouts(ct.Height()+1, nil), nil, ct.CurrentTarget())
+	err := ct.AcceptBlock(extreme)
+	if err != ErrExtremeFutureTimestamp {
+		t.Fatal("expected ErrExtremeFutureTimestamp, got", err)
+	}
+	id := ct.mu.RLock()
+	held := len(ct.futureBlocks)
+	ct.mu.RUnlock(id)
+	if held != 0 {
+		t.Fatal("block with an extreme timestamp was held")
+	}
+
+	// A block just beyond the future threshold is held, and accepted later.
+	future := MineTestingBlock(ct.CurrentBlock().ID(), types.CurrentTimestamp()+types.FutureThreshold+2, ct.Payouts(ct.Height()+1, nil), nil, ct.CurrentTarget())
+	err = ct.AcceptBlock(future)
+	if err != ErrFutureTimestamp {
+		t.Fatal("expected ErrFutureTimestamp, got", err)
+	}
+	for i := 0; ct.CurrentBlock().ID() != future.ID(); i++ {
+		if i == 100 {
+			t.Fatal("held block was not accepted")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// TestFutureBlockLimit checks that no more than maxFutureBlocks blocks are
+// held.
+func TestFutureBlockLimit(t *testing.T) {
+	ct := NewTestingEnvironment("TestFutureBlockLimit", t)
+	defer ct.Close()
+
+	// Fill the queue.
+	id := ct.mu.Lock()
+	for i := 0; i < maxFutureBlocks; i++ {
+		ct.futureBlocks[types.BlockID{byte(i)}] = types.Block{}
+	}
+	ct.mu.Unlock(id)
+
+	future := MineTestingBlock(ct.CurrentBlock().ID(), types.CurrentTimestamp()+types.FutureThreshold+2, ct.Payouts(ct.Height()+1, nil), nil, ct.CurrentTarget())
+	err := ct.AcceptBlock(future)
+	if err != ErrFutureTimestamp {
+		t.Fatal("expected ErrFutureTimestamp, got", err)
+	}
+	id = ct.mu.RLock()
+	_, held := ct.futureBlocks[future.ID()]
+	ct.mu.RUnlock(id)
+	if held {
+		t.Fatal("block was held after the queue was full")
+	}
+}
@@ -3,10 +3,10 @@ package consensus
 import (
 	"errors"
 	"math/big"
-	"sort"
+
+	"github.com/boltdb/bolt"
 
 	"github.com/NebulousLabs/Sia/build"
-	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -18,104 +18,83 @@ type StateInfo struct {
 	Target       types.Target
 }
 
+// StatusInfo contains the information about the current path that is reported
+// by status queries. See the methods of the same names for a description of
+// each field.
+type StatusInfo struct {
+	StateInfo
+
+	SyncStatus        modules.SyncStatus
+	EstimatedHashrate *big.Int
+	EarliestTimestamp types.Timestamp
+	RecentBlockTimes  []int64
+
+	SiafundPool           types.Currency
+	FileContractCount     uint64
+	FileContractTotalSize uint64
+}
+
 // blockAtHeight returns the block on the current path with the given height.
-func (s *State) blockAtHeight(height types.BlockHeight) (b types.Block, exists bool) {
-	exists = height <= s.height()
-	if exists {
-		b = s.blockMap[s.currentPath[height]].block
+func (s *State) blockAtHeight(tx *bolt.Tx, height types.BlockHeight) (b types.Block, exists bool) {
+	id, exists := pathID(tx, height)
+	if !exists {
+		return
 	}
-	return
+	bn, exists := getBlockNode(tx, id)
+	if !exists {
+		return
+	}
+	return bn.Block, true
 }
 
 // currentBlockID returns the ID of the current block.
-func (s *State) currentBlockID() types.BlockID {
-	return s.currentPath[s.height()]
+func (s *State) currentBlockID(tx *bolt.Tx) types.BlockID {
+	id, _ := pathID(tx, s.height(tx))
+	return id
 }
 
 // currentBlockNode returns the blockNode of the current block.
-func (s *State) currentBlockNode() *blockNode {
-	return s.blockMap[s.currentBlockID()]
+func (s *State) currentBlockNode(tx *bolt.Tx) *blockNode {
+	bn, exists := getBlockNode(tx, s.currentBlockID(tx))
+	if !exists && build.DEBUG {
+		panic("current block is not in the block tree")
+	}
+	return bn
 }
 
 // currentBlockWeight returns the weight of the current block.
-func (s *State) currentBlockWeight() *big.Rat {
-	return s.currentBlockNode().target.Inverse()
+func (s *State) currentBlockWeight(tx *bolt.Tx) *big.Rat {
+	return s.currentBlockNode(tx).Target.Inverse()
 }
 
 // height returns the current height of the state.
-func (s *State) height() types.BlockHeight {
-	return types.BlockHeight(len(s.currentPath) - 1)
-}
-
-// output returns the unspent SiacoinOutput associated with the given ID. If
-// the output is not in the UTXO set, 'exists' will be false.
-func (s *State) output(id types.SiacoinOutputID) (sco types.SiacoinOutput, exists bool) {
-	sco, exists = s.siacoinOutputs[id]
-	return
-}
-
-// sortedUscoSet returns all of the unspent siacoin outputs sorted
-// according to the numerical value of their id.
-func (s *State) sortedUscoSet() []types.SiacoinOutput {
-	// Get all of the outputs in string form and sort the strings.
-	unspentOutputs := make(crypto.HashSlice, len(s.siacoinOutputs))
-	for outputID := range s.siacoinOutputs {
-		unspentOutputs = append(unspentOutputs, crypto.Hash(outputID))
-	}
-	sort.Sort(unspentOutputs)
-
-	// Get the outputs in order according to their sorted form.
-	sortedOutputs := make([]types.SiacoinOutput, len(unspentOutputs))
-	for i, outputID := range unspentOutputs {
-		output, _ := s.output(types.SiacoinOutputID(outputID))
-		sortedOutputs[i] = output
-	}
-	return sortedOutputs
-}
-
-// Sorted UsfoSet returns all of the unspent siafund outputs sorted according
-// to the numerical value of their id.
-func (s *State) sortedUsfoSet() []types.SiafundOutput {
-	// Get all of the outputs in string form and sort the strings.
-	outputIDs := make(crypto.HashSlice, len(s.siafundOutputs))
-	for outputID := range s.siafundOutputs {
-		outputIDs = append(outputIDs, crypto.Hash(outputID))
-	}
-	sort.Sort(outputIDs)
-
-	// Get the outputs in order according to their sorted string form.
-	sortedOutputs := make([]types.SiafundOutput, len(outputIDs))
-	for i, outputID := range outputIDs {
-		// Sanity check - the output should exist.
-		output, exists := s.siafundOutputs[types.SiafundOutputID(outputID)]
-		if build.DEBUG {
-			if !exists {
-				panic("output doesn't exist")
-			}
-		}
-
-		sortedOutputs[i] = output
-	}
-	return sortedOutputs
+func (s *State) height(tx *bolt.Tx) types.BlockHeight {
+	return pathHeight(tx)
 }
 
 // BlockAtHeight returns the block on the current path with the given height.
 func (s *State) BlockAtHeight(height types.BlockHeight) (b types.Block, exists bool) {
 	counter := s.mu.RLock()
 	defer s.mu.RUnlock(counter)
-	return s.blockAtHeight(height)
+	s.db.View(func(tx *bolt.Tx) error {
+		b, exists = s.blockAtHeight(tx, height)
+		return nil
+	})
+	return
 }
 
 // Block returns the block associated with the given id.
 func (s *State) Block(bid types.BlockID) (b types.Block, exists bool) {
 	id := s.mu.RLock()
 	defer s.mu.RUnlock(id)
-
-	node, exists := s.blockMap[bid]
-	if !exists {
-		return
-	}
-	b = node.block
+	s.db.View(func(tx *bolt.Tx) error {
+		var node *blockNode
+		node, exists = getBlockNode(tx, bid)
+		if exists {
+			b = node.Block
+		}
+		return nil
+	})
 	return
 }
 
@@ -124,49 +103,65 @@ func (s *State) BlockOutputDiffs(id types.BlockID) (scods []modules.SiacoinOutpu
 	counter := s.mu.RLock()
 	defer s.mu.RUnlock(counter)
 
-	node, exists := s.blockMap[id]
-	if !exists {
-		err = errors.New("requested an unknown block")
-		return
-	}
-	if !node.diffsGenerated {
-		err = errors.New("diffs have not been generated for the requested block")
-		return
-	}
-	scods = node.siacoinOutputDiffs
+	err = s.db.View(func(tx *bolt.Tx) error {
+		node, exists := getBlockNode(tx, id)
+		if !exists {
+			return errors.New("requested an unknown block")
+		}
+		if !node.DiffsGenerated {
+			return errors.New("diffs have not been generated for the requested block")
+		}
+		scods = node.SiacoinOutputDiffs
+		return nil
+	})
 	return
 }
 
 // CurrentBlock returns the highest block on the tallest fork.
-func (s *State) CurrentBlock() types.Block {
+func (s *State) CurrentBlock() (b types.Block) {
 	counter := s.mu.RLock()
 	defer s.mu.RUnlock(counter)
-	return s.currentBlockNode().block
+	s.db.View(func(tx *bolt.Tx) error {
+		b = s.currentBlockNode(tx).Block
+		return nil
+	})
+	return
 }
 
 func (s *State) ChildTarget(bid types.BlockID) (target types.Target, exists bool) {
 	id := s.mu.RLock()
 	defer s.mu.RUnlock(id)
-	bn, exists := s.blockMap[bid]
-	if !exists {
-		return
-	}
-	target = bn.target
+	s.db.View(func(tx *bolt.Tx) error {
+		var bn *blockNode
+		bn, exists = getBlockNode(tx, bid)
+		if exists {
+			target = bn.Target
+		}
+		return nil
+	})
 	return
 }
 
 // CurrentTarget returns the target of the next block that needs to be submitted
 // to the state.
-func (s *State) CurrentTarget() types.Target {
+func (s *State) CurrentTarget() (target types.Target) {
 	id := s.mu.RLock()
 	defer s.mu.RUnlock(id)
-	return s.currentBlockNode().target
+	s.db.View(func(tx *bolt.Tx) error {
+		target = s.currentBlockNode(tx).Target
+		return nil
+	})
+	return
 }
 
-func (s *State) EarliestTimestamp() types.Timestamp {
+func (s *State) EarliestTimestamp() (timestamp types.Timestamp) {
 	id := s.mu.RLock()
 	defer s.mu.RUnlock(id)
-	return s.currentBlockNode().earliestChildTimestamp()
+	s.db.View(func(tx *bolt.Tx) error {
+		timestamp = s.currentBlockNode(tx).earliestChildTimestamp(tx)
+		return nil
+	})
+	return
 }
 
 // EarliestTimestamp returns the earliest timestamp that the next block can
@@ -174,31 +169,40 @@ func (s *State) EarliestTimestamp() types.Timestamp {
 func (s *State) EarliestChildTimestamp(bid types.BlockID) (timestamp types.Timestamp, exists bool) {
 	id := s.mu.RLock()
 	defer s.mu.RUnlock(id)
-	bn, exists := s.blockMap[bid]
-	if !exists {
-		return
-	}
-	timestamp = bn.earliestChildTimestamp()
+	s.db.View(func(tx *bolt.Tx) error {
+		var bn *blockNode
+		bn, exists = getBlockNode(tx, bid)
+		if exists {
+			timestamp = bn.earliestChildTimestamp(tx)
+		}
+		return nil
+	})
 	return
 }
 
 // Height returns the height of the current blockchain (the longest fork).
-func (s *State) Height() types.BlockHeight {
+func (s *State) Height() (height types.BlockHeight) {
 	counter := s.mu.RLock()
 	defer s.mu.RUnlock(counter)
-	return s.height()
+	s.db.View(func(tx *bolt.Tx) error {
+		height = s.height(tx)
+		return nil
+	})
+	return
 }
 
 // HeightOfBlock returns the height of the block with the given ID.
 func (s *State) HeightOfBlock(bid types.BlockID) (height types.BlockHeight, exists bool) {
 	counter := s.mu.RLock()
 	defer s.mu.RUnlock(counter)
-
-	bn, exists := s.blockMap[bid]
-	if !exists {
-		return
-	}
-	height = bn.height
+	s.db.View(func(tx *bolt.Tx) error {
+		var bn *blockNode
+		bn, exists = getBlockNode(tx, bid)
+		if exists {
+			height = bn.Height
+		}
+		return nil
+	})
 	return
 }
 
@@ -207,5 +211,160 @@ func (s *State) HeightOfBlock(bid types.BlockID) (height types.BlockHeight, exis
 func (s *State) StorageProofSegment(fcid types.FileContractID) (index uint64, err error) {
 	counter := s.mu.RLock()
 	defer s.mu.RUnlock(counter)
-	return s.storageProofSegment(fcid)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		index, err = s.storageProofSegment(tx, fcid)
+		return err
+	})
+	return
+}
+
+// recentNodes returns the last n+1 nodes of the current path, oldest first.
+// Fewer nodes are returned if the current path is shorter than n+1 blocks.
+func (s *State) recentNodes(tx *bolt.Tx, n int) []*blockNode {
+	bn := s.currentBlockNode(tx)
+	nodes := []*blockNode{bn}
+	for i := 0; i < n; i++ {
+		parent, exists := parentNode(tx, bn)
+		if !exists {
+			break
+		}
+		nodes = append(nodes, parent)
+		bn = parent
+	}
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	return nodes
+}
+
+// BlockHeaders returns the headers of the blocks in the current path from
+// height start to height end, inclusive. At most 'MaxCatchUpHeaders' headers
+// are returned, and heights past the end of the current path are ignored.
+func (s *State) BlockHeaders(start, end types.BlockHeight) (headers []types.BlockHeader) {
+	id := s.mu.RLock()
+	defer s.mu.RUnlock(id)
+	s.db.View(func(tx *bolt.Tx) error {
+		for i := start; i <= end && i < start+MaxCatchUpHeaders; i++ {
+			b, exists := s.blockAtHeight(tx, i)
+			if !exists {
+				break
+			}
+			headers = append(headers, b.Header())
+		}
+		return nil
+	})
+	return
+}
+
+// EstimatedHashrate estimates the hashrate of the network, in hashes per
+// second, from the targets and timestamps of the last n blocks in the current
+// path.
+func (s *State) EstimatedHashrate(n int) (hashrate *big.Int) {
+	id := s.mu.RLock()
+	defer s.mu.RUnlock(id)
+	s.db.View(func(tx *bolt.Tx) error {
+		hashrate = estimatedHashrate(s.recentNodes(tx, n))
+		return nil
+	})
+	return
+}
+
+// estimatedHashrate estimates the hashrate of the network from a sequence of
+// nodes in the current path.
+func estimatedHashrate(nodes []*blockNode) *big.Int {
+	if len(nodes) < 2 {
+		return new(big.Int)
+	}
+
+	// The target of a node is the target that its child had to meet, so the
+	// expected number of hashes in the window is RootDepth times the sum of
+	// the inverses of every target but the last.
+	work := new(big.Rat)
+	for _, bn := range nodes[:len(nodes)-1] {
+		work.Add(work, bn.Target.Inverse())
+	}
+	work.Mul(work, types.RootDepth.Rat())
+	// Timestamps are set by miners and are not strictly increasing, so the
+	// duration of the window is at least one second.
+	first, last := nodes[0].Block.Timestamp, nodes[len(nodes)-1].Block.Timestamp
+	seconds := int64(1)
+	if last > first {
+		seconds = int64(last - first)
+	}
+	work.Quo(work, new(big.Rat).SetInt64(seconds))
+	return new(big.Int).Quo(work.Num(), work.Denom())
+}
+
+// FileContractStatistics returns the number of file contracts in the
+// consensus set and the total size of the files that they cover.
+func (s *State) FileContractStatistics() (count uint64, size uint64) {
+	id := s.mu.RLock()
+	defer s.mu.RUnlock(id)
+	s.db.View(func(tx *bolt.Tx) error {
+		stats, _ := getFileContractStatistics(tx)
+		count, size = stats.Count, stats.Size
+		return nil
+	})
+	return
+}
+
+// RecentBlockTimes returns the number of seconds between each of the last n
+// blocks in the current path and its parent, oldest first. Timestamps are set
+// by miners, so a block time can be negative.
+func (s *State) RecentBlockTimes(n int) (times []int64) {
+	id := s.mu.RLock()
+	defer s.mu.RUnlock(id)
+	s.db.View(func(tx *bolt.Tx) error {
+		times = blockTimes(s.recentNodes(tx, n))
+		return nil
+	})
+	return
+}
+
+// blockTimes returns the number of seconds between each of a sequence of
+// nodes and its parent, skipping the first node.
+func blockTimes(nodes []*blockNode) (times []int64) {
+	for i := 1; i < len(nodes); i++ {
+		times = append(times, int64(nodes[i].Block.Timestamp)-int64(nodes[i-1].Block.Timestamp))
+	}
+	return
+}
+
+// SiafundPool returns the value of the siafund pool.
+func (s *State) SiafundPool() (pool types.Currency) {
+	id := s.mu.RLock()
+	defer s.mu.RUnlock(id)
+	s.db.View(func(tx *bolt.Tx) error {
+		pool = getSiafundPool(tx)
+		return nil
+	})
+	return
+}
+
+// Status returns the information about the current path that is reported by
+// status queries. The hashrate is estimated from the last hashrateBlocks
+// blocks, and the times of the last recentBlocks blocks are returned.
+// Everything is read under a single lock, so that every field describes the
+// same current path.
+func (s *State) Status(hashrateBlocks, recentBlocks int) (status StatusInfo) {
+	id := s.mu.RLock()
+	defer s.mu.RUnlock(id)
+	status.SyncStatus = s.syncStatus
+	s.db.View(func(tx *bolt.Tx) error {
+		bn := s.currentBlockNode(tx)
+		status.StateInfo = StateInfo{
+			CurrentBlock: bn.Block.ID(),
+			Height:       bn.Height,
+			Target:       bn.Target,
+		}
+		status.EstimatedHashrate = estimatedHashrate(s.recentNodes(tx, hashrateBlocks))
+		status.EarliestTimestamp = bn.earliestChildTimestamp(tx)
+		status.RecentBlockTimes = blockTimes(s.recentNodes(tx, recentBlocks))
+		status.SiafundPool = getSiafundPool(tx)
+		stats, _ := getFileContractStatistics(tx)
+		status.FileContractCount = stats.Count
+		status.FileContractTotalSize = stats.Size
+		return nil
+	})
+	return
 }
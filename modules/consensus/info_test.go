@@ -0,0 +1,83 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestStatusInfo checks the information about the current path that the
+// state reports for status queries.
+func TestStatusInfo(t *testing.T) {
+	ct := NewTestingEnvironment("TestStatusInfo", t)
+	defer ct.Close()
+
+	txn, _ := ct.FileContractTransaction(ct.Height()+2, ct.Height()+3)
+	ct.MineAndSubmitCurrentBlock([]types.Transaction{txn})
+	count, size := ct.FileContractStatistics()
+	if count != 1 || size != txn.FileContracts[0].FileSize {
+		t.Errorf("expected 1 contract covering %v bytes, got %v covering %v", txn.FileContracts[0].FileSize, count, size)
+	}
+
+	// Headers are returned for every height in the range that is in the
+	// current path.
+	height := ct.Height()
+	headers := ct.BlockHeaders(1, height+5)
+	if types.BlockHeight(len(headers)) != height {
+		t.Fatalf("expected %v headers, got %v", height, len(headers))
+	}
+	for i, h := range headers {
+		b, _ := ct.BlockAtHeight(types.BlockHeight(i + 1))
+		if h.ID() != b.ID() {
+			t.Error("header does not match the block at height", i+1)
+		}
+	}
+	if len(ct.BlockHeaders(height+1, height+5)) != 0 {
+		t.Error("headers were returned for heights past the current path")
+	}
+
+	// Block times are measured between the last blocks of the current path.
+	times := ct.RecentBlockTimes(2)
+	if len(times) != 2 {
+		t.Fatalf("expected 2 block times, got %v", len(times))
+	}
+	parent, _ := ct.BlockAtHeight(height - 1)
+	current := ct.CurrentBlock()
+	if times[1] != int64(current.Timestamp)-int64(parent.Timestamp) {
+		t.Error("block time does not match the timestamps of the blocks")
+	}
+	if len(ct.RecentBlockTimes(int(height)+5)) != int(height) {
+		t.Error("block times were returned for blocks before the genesis block")
+	}
+
+	if ct.EstimatedHashrate(int(height)).Sign() <= 0 {
+		t.Error("hashrate estimate is not positive")
+	}
+	if ct.EstimatedHashrate(0).Sign() != 0 {
+		t.Error("hashrate was estimated without any blocks")
+	}
+
+	// The status matches the individual queries.
+	status := ct.Status(int(height), 2)
+	if status.Height != height || status.CurrentBlock != current.ID() {
+		t.Error("status does not describe the current block")
+	}
+	if status.EstimatedHashrate.Cmp(ct.EstimatedHashrate(int(height))) != 0 {
+		t.Error("status hashrate does not match the hashrate estimate")
+	}
+	if len(status.RecentBlockTimes) != 2 || status.RecentBlockTimes[1] != times[1] {
+		t.Error("status block times do not match the recent block times")
+	}
+	if status.FileContractCount != count || status.FileContractTotalSize != size {
+		t.Error("status file contract statistics do not match")
+	}
+
+	// The statistics are updated when the contract expires.
+	for ct.Height() <= txn.FileContracts[0].WindowEnd {
+		ct.MineAndSubmitCurrentBlock(nil)
+	}
+	count, size = ct.FileContractStatistics()
+	if count != 0 || size != 0 {
+		t.Errorf("expected no contracts after expiration, got %v covering %v", count, size)
+	}
+}
@@ -1,62 +1,77 @@
 package consensus
 
 import (
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// addDelayedSiacoinOutput adds a siacoin output to the set of delayed outputs
+// created by a block. It is also recorded in the blockNode itself.
+func (s *State) addDelayedSiacoinOutput(tx *bolt.Tx, bn *blockNode, id types.SiacoinOutputID, sco types.SiacoinOutput) {
+	putDelayedSiacoinOutput(tx, bn.Height, id, sco)
+	bn.DelayedSiacoinOutputs = append(bn.DelayedSiacoinOutputs, delayedSiacoinOutput{
+		ID:            id,
+		SiacoinOutput: sco,
+	})
+}
+
 // applyMinerSubsidy adds a block's MinerPayouts to the State as delayed
 // siacoin outputs. They are also recorded in the blockNode itself.
-func (s *State) applyMinerSubsidy(bn *blockNode) {
-	for i, payout := range bn.block.MinerPayouts {
+func (s *State) applyMinerSubsidy(tx *bolt.Tx, bn *blockNode) {
+	for i, payout := range bn.Block.MinerPayouts {
 		// Sanity check - the output should not already be in
 		// delayedSiacoinOutputs, and should also not be in siacoinOutputs.
-		id := bn.block.MinerPayoutID(i)
+		id := bn.Block.MinerPayoutID(i)
 		if build.DEBUG {
-			_, exists := s.delayedSiacoinOutputs[s.height()][id]
+			_, exists := getDelayedSiacoinOutput(tx, bn.Height, id)
 			if exists {
 				panic("miner subsidy already in delayed outputs")
 			}
-			_, exists = s.siacoinOutputs[id]
+			_, exists = getSiacoinOutput(tx, id)
 			if exists {
 				panic("miner subsidy already in siacoin outputs")
 			}
 		}
 
-		s.delayedSiacoinOutputs[s.height()][id] = payout
-		bn.delayedSiacoinOutputs[id] = payout
+		s.addDelayedSiacoinOutput(tx, bn, id, payout)
 	}
 	return
 }
 
 // applyMaturedSiacoinOutputs goes through all of the outputs that
 // have matured and adds them to the list of siacoinOutputs.
-func (s *State) applyMaturedSiacoinOutputs(bn *blockNode) {
-	for id, sco := range s.delayedSiacoinOutputs[bn.height-types.MaturityDelay] {
+func (s *State) applyMaturedSiacoinOutputs(tx *bolt.Tx, bn *blockNode) {
+	if bn.Height < types.MaturityDelay {
+		return
+	}
+	for _, dsco := range delayedSiacoinOutputs(tx, bn.Height-types.MaturityDelay) {
 		// Sanity check - the output should not already be in siacoinOuptuts.
 		if build.DEBUG {
-			_, exists := s.siacoinOutputs[id]
+			_, exists := getSiacoinOutput(tx, dsco.ID)
 			if exists {
 				panic("trying to add a delayed output when the output is already there")
 			}
 		}
 
 		// Add the output to the State and record the diff in the blockNode.
-		s.siacoinOutputs[id] = sco
-		bn.siacoinOutputDiffs = append(bn.siacoinOutputDiffs, modules.SiacoinOutputDiff{
+		scod := modules.SiacoinOutputDiff{
 			Direction:     modules.DiffApply,
-			ID:            id,
-			SiacoinOutput: sco,
-		})
+			ID:            dsco.ID,
+			SiacoinOutput: dsco.SiacoinOutput,
+		}
+		bn.SiacoinOutputDiffs = append(bn.SiacoinOutputDiffs, scod)
+		s.commitSiacoinOutputDiff(tx, scod, modules.DiffApply)
 	}
 }
 
 // applyMissedProof adds the outputs and diffs that result from a contract
 // expiring.
-func (s *State) applyMissedProof(bn *blockNode, fcid types.FileContractID) {
+func (s *State) applyMissedProof(tx *bolt.Tx, bn *blockNode, fcid types.FileContractID) {
 	// Sanity check - the id must correspond to an existing contract.
-	fc, exists := s.fileContracts[fcid]
+	fc, exists := getFileContract(tx, fcid)
 	if !exists {
 		if build.DEBUG {
 			panic("misuse of applyMissedProof")
@@ -69,58 +84,46 @@ func (s *State) applyMissedProof(bn *blockNode, fcid types.FileContractID) {
 		// Sanity check - output should not already exist.
 		outputID := fcid.StorageProofOutputID(false, i)
 		if build.DEBUG {
-			_, exists := s.delayedSiacoinOutputs[s.height()][outputID]
+			_, exists := getDelayedSiacoinOutput(tx, bn.Height, outputID)
 			if exists {
 				panic("missed proof output already exists in the delayed outputs set")
 			}
-			_, exists = s.siacoinOutputs[outputID]
+			_, exists = getSiacoinOutput(tx, outputID)
 			if exists {
 				panic("missed proof output already exists in the siacoin outputs set")
 			}
 		}
 
-		bn.delayedSiacoinOutputs[outputID] = output
-		s.delayedSiacoinOutputs[s.height()][outputID] = output
+		s.addDelayedSiacoinOutput(tx, bn, outputID, output)
 	}
 
 	// Remove the contract from the State and record the diff in the blockNode.
-	delete(s.fileContracts, fcid)
-	bn.fileContractDiffs = append(bn.fileContractDiffs, modules.FileContractDiff{
+	fcd := modules.FileContractDiff{
 		Direction:    modules.DiffRevert,
 		ID:           fcid,
 		FileContract: fc,
-	})
+	}
+	bn.FileContractDiffs = append(bn.FileContractDiffs, fcd)
+	s.commitFileContractDiff(tx, fcd, modules.DiffApply)
 
 	return
 }
 
-// applyContractMaintenance iterates through all of the contracts in the
-// consensus set and calls 'applyMissedProof' on any that have expired.
-func (s *State) applyContractMaintenance(bn *blockNode) {
-	// Iterate through all contracts and figure out which ones have expired.
-	// Expiring a contract deletes it from the map we are iterating through, so
-	// we need to store it and deleted once we're done iterating through the
-	// map.
-	currentHeight := s.height()
-	var expiredFileContracts []types.FileContractID
-	for id, fc := range s.fileContracts {
-		if fc.WindowEnd == currentHeight {
-			expiredFileContracts = append(expiredFileContracts, id)
-		}
+// applyContractMaintenance calls 'applyMissedProof' on every contract in the
+// consensus set that expires at the block's height. Contracts are indexed by
+// expiration height, so only the expiring contracts are visited.
+func (s *State) applyContractMaintenance(tx *bolt.Tx, bn *blockNode) {
+	for _, id := range expiringFileContracts(tx, bn.Height) {
+		s.applyMissedProof(tx, bn, id)
 	}
-	for _, id := range expiredFileContracts {
-		s.applyMissedProof(bn, id)
-	}
-
-	return
 }
 
 // applyMaintenance generates, adds, and applies diffs that are generated after
 // all of the transactions of a block have been processed. This includes adding
 // the miner susidies, adding any matured outputs to the set of siacoin
 // outputs, and dealing with any contracts that have expired.
-func (s *State) applyMaintenance(bn *blockNode) {
-	s.applyMinerSubsidy(bn)
-	s.applyMaturedSiacoinOutputs(bn)
-	s.applyContractMaintenance(bn)
+func (s *State) applyMaintenance(tx *bolt.Tx, bn *blockNode) {
+	s.applyMinerSubsidy(tx, bn)
+	s.applyMaturedSiacoinOutputs(tx, bn)
+	s.applyContractMaintenance(tx, bn)
 }
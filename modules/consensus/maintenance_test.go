@@ -3,6 +3,8 @@ package consensus
 import (
 	"testing"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -26,16 +28,16 @@ func (ct *ConsensusTester) testApplyMissedProof() {
 	// Check that the contract has been deleted, and that the missed proof
 	// outputs have been created.
 	fcid := txn.FileContractID(0)
-	_, exists := ct.fileContracts[fcid]
-	if exists {
+	var contractExists, outputExists bool
+	ct.db.View(func(tx *bolt.Tx) error {
+		_, contractExists = getFileContract(tx, fcid)
+		_, outputExists = getDelayedSiacoinOutput(tx, ct.height(tx), fcid.StorageProofOutputID(false, 0))
+		return nil
+	})
+	if contractExists {
 		ct.Error("file contract not removed from consensus set upon missed storage proof")
 	}
-	outputs, exists := ct.delayedSiacoinOutputs[ct.Height()]
-	if !exists {
-		ct.Fatal("missed proof outputs not created")
-	}
-	_, exists = outputs[fcid.StorageProofOutputID(false, 0)]
-	if !exists {
+	if !outputExists {
 		ct.Error("missed proof outputs not created")
 	}
 
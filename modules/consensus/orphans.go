@@ -0,0 +1,105 @@
+package consensus
+
+import (
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// orphans.go holds blocks whose parents are not yet known. When a peer relays
+// a block that builds on a block we have not received, the block is kept in
+// the orphan pool, keyed by the ID of the missing parent. Once the parent is
+// accepted, its orphaned children are accepted as well. The proof of work of
+// an orphan cannot be checked until its parent is known, so the pool is
+// limited by both the number and the age of the orphans it holds.
+
+const (
+	// maxOrphans is the maximum number of orphans held in the orphan pool.
+	// When the pool is full, the oldest orphan is evicted.
+	maxOrphans = 50
+
+	// orphanExpiration is how long an orphan is held before it is evicted.
+	orphanExpiration = 10 * time.Minute
+)
+
+// An orphanBlock is a block in the orphan pool, along with the time that it
+// was added to the pool.
+type orphanBlock struct {
+	block types.Block
+	added time.Time
+}
+
+// addOrphan adds a block to the orphan pool, evicting expired orphans and, if
+// the pool is full, the oldest orphan.
+func (s *State) addOrphan(b types.Block) {
+	if uint64(len(encoding.Marshal(b))) > types.BlockSizeLimit {
+		return
+	}
+	id := b.ID()
+	for _, ob := range s.orphans[b.ParentID] {
+		if ob.block.ID() == id {
+			return
+		}
+	}
+
+	// Evict expired orphans.
+	for parentID, obs := range s.orphans {
+		var kept []orphanBlock
+		for _, ob := range obs {
+			if time.Since(ob.added) < orphanExpiration {
+				kept = append(kept, ob)
+			}
+		}
+		s.setOrphans(parentID, kept)
+	}
+
+	// Evict the oldest orphan if the pool is full.
+	if s.orphanCount >= maxOrphans {
+		var oldestParent types.BlockID
+		oldest := -1
+		for parentID, obs := range s.orphans {
+			for i, ob := range obs {
+				if oldest == -1 || ob.added.Before(s.orphans[oldestParent][oldest].added) {
+					oldestParent, oldest = parentID, i
+				}
+			}
+		}
+		obs := s.orphans[oldestParent]
+		s.setOrphans(oldestParent, append(obs[:oldest:oldest], obs[oldest+1:]...))
+	}
+
+	s.setOrphans(b.ParentID, append(s.orphans[b.ParentID], orphanBlock{
+		block: b,
+		added: time.Now(),
+	}))
+}
+
+// setOrphans replaces the orphans of a missing parent, keeping orphanCount up
+// to date.
+func (s *State) setOrphans(parentID types.BlockID, obs []orphanBlock) {
+	s.orphanCount += len(obs) - len(s.orphans[parentID])
+	if len(obs) == 0 {
+		delete(s.orphans, parentID)
+	} else {
+		s.orphans[parentID] = obs
+	}
+}
+
+// connectOrphans adds the orphans whose missing parent was just accepted to
+// the State. Each orphan is verified and added like any other block, in its
+// own database transaction, and connects its own orphaned children in turn.
+// Connected orphans are relayed to peers; orphans that turn out to be invalid
+// are dropped.
+func (s *State) connectOrphans(parentID types.BlockID) {
+	id := s.mu.Lock()
+	obs := s.orphans[parentID]
+	s.setOrphans(parentID, nil)
+	s.mu.Unlock(id)
+
+	for _, ob := range obs {
+		if s.addBlock(ob.block) == nil {
+			go s.gateway.Announce("RelayBlock", ob.block)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package consensus
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/modules/tester"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestOrphanConnected checks that orphans are held until their parents arrive,
+// and then connected to the blockchain and relayed to peers.
+func TestOrphanConnected(t *testing.T) {
+	ct := NewTestingEnvironment("TestOrphanConnected", t)
+	defer ct.Close()
+
+	// The peer records the blocks that are relayed to it.
+	peer, err := gateway.New(":0", "", tester.TempDir("consensus", "TestOrphanConnected", "peer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	var mu sync.Mutex
+	relayed := make(map[types.BlockID]bool)
+	peer.RegisterRPC("RelayBlock", func(conn modules.PeerConn) error {
+		var b types.Block
+		err := encoding.ReadObject(conn, &b, types.BlockSizeLimit)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		relayed[b.ID()] = true
+		mu.Unlock()
+		return nil
+	})
+	err = ct.gateway.Connect(peer.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1 := ct.MineCurrentBlock(nil)
+	b2 := MineTestingBlock(b1.ID(), types.CurrentTimestamp(), ct.Payouts(ct.Height()+2, nil), nil, ct.CurrentTarget())
+	b3 := MineTestingBlock(b2.ID(), types.CurrentTimestamp(), ct.Payouts(ct.Height()+3, nil), nil, ct.CurrentTarget())
+
+	// Submit the blocks in reverse order.
+	err = ct.AcceptBlock(b3)
+	if err != ErrOrphan {
+		t.Fatal("expected ErrOrphan, got", err)
+	}
+	err = ct.AcceptBlock(b2)
+	if err != ErrOrphan {
+		t.Fatal("expected ErrOrphan, got", err)
+	}
+	id := ct.mu.RLock()
+	count := ct.orphanCount
+	ct.mu.RUnlock(id)
+	if count != 2 {
+		t.Fatalf("orphan pool holds %v blocks, expected 2", count)
+	}
+
+	err = ct.AcceptBlock(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.CurrentBlock().ID() != b3.ID() {
+		t.Fatal("orphans were not connected after their parent arrived")
+	}
+	id = ct.mu.RLock()
+	count, pools := ct.orphanCount, len(ct.orphans)
+	ct.mu.RUnlock(id)
+	if count != 0 || pools != 0 {
+		t.Error("orphan pool is not empty after the orphans were connected")
+	}
+
+	for i := 0; ; i++ {
+		mu.Lock()
+		done := relayed[b1.ID()] && relayed[b2.ID()] && relayed[b3.ID()]
+		mu.Unlock()
+		if done {
+			break
+		} else if i == 100 {
+			t.Fatal("connected orphans were not relayed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestOrphanEviction checks that the orphan pool evicts expired orphans, and
+// the oldest orphan when it is full.
+func TestOrphanEviction(t *testing.T) {
+	ct := NewTestingEnvironment("TestOrphanEviction", t)
+	defer ct.Close()
+
+	id := ct.mu.Lock()
+	defer ct.mu.Unlock(id)
+
+	// Fill the pool, and check that the oldest orphan is evicted.
+	for i := 0; i <= maxOrphans; i++ {
+		ct.addOrphan(types.Block{ParentID: types.BlockID{byte(i)}})
+	}
+	if ct.orphanCount != maxOrphans {
+		t.Fatalf("orphan pool holds %v blocks, expected %v", ct.orphanCount, maxOrphans)
+	}
+	if _, exists := ct.orphans[types.BlockID{0}]; exists {
+		t.Error("oldest orphan was not evicted from a full pool")
+	}
+
+	// Expire every orphan but one, and check that they are evicted.
+	for parentID, obs := range ct.orphans {
+		for i := range obs {
+			if parentID != (types.BlockID{1}) {
+				obs[i].added = obs[i].added.Add(-orphanExpiration)
+			}
+		}
+	}
+	ct.addOrphan(types.Block{ParentID: types.BlockID{0}})
+	if ct.orphanCount != 2 {
+		t.Fatalf("orphan pool holds %v blocks after expiration, expected 2", ct.orphanCount)
+	}
+
+	// Adding the same orphan twice has no effect.
+	ct.addOrphan(types.Block{ParentID: types.BlockID{0}})
+	if ct.orphanCount != 2 {
+		t.Errorf("orphan pool holds %v blocks after a duplicate, expected 2", ct.orphanCount)
+	}
+}
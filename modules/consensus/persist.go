@@ -1,44 +1,178 @@
 package consensus
 
 import (
+	"os"
 	"path/filepath"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/blockdb"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
-func (s *State) load(saveDir string) error {
-	db, err := blockdb.Open(filepath.Join(saveDir, "chain.db"))
+const (
+	// consensusDBFilename is the name of the consensus database.
+	consensusDBFilename = "consensus.db"
+
+	// chainDBFilename is the name of the block database used by older
+	// versions, which only stored the blocks of the current path.
+	chainDBFilename = "chain.db"
+)
+
+// GenesisChange returns a consensus change that applies the genesis block
+// and creates its consensus set. The genesis block is part of every consensus
+// set, so it is not in the changes sent to subscribers; subscribers that
+// track the consensus set start from this change.
+func GenesisChange() modules.ConsensusChange {
+	genesisBlock := types.Block{
+		Timestamp: types.GenesisTimestamp,
+	}
+	return modules.ConsensusChange{
+		AppliedBlocks: []types.Block{genesisBlock},
+		SiacoinOutputDiffs: []modules.SiacoinOutputDiff{{
+			Direction: modules.DiffApply,
+			ID:        genesisBlock.MinerPayoutID(0),
+			SiacoinOutput: types.SiacoinOutput{
+				Value:      types.CalculateCoinbase(0),
+				UnlockHash: types.ZeroUnlockHash,
+			},
+		}},
+		SiafundOutputDiffs: []modules.SiafundOutputDiff{{
+			Direction: modules.DiffApply,
+			ID:        types.SiafundOutputID{0},
+			SiafundOutput: types.SiafundOutput{
+				Value:           types.NewCurrency64(types.SiafundCount),
+				UnlockHash:      types.GenesisSiafundUnlockHash,
+				ClaimUnlockHash: types.GenesisClaimUnlockHash,
+			},
+		}},
+	}
+}
+
+// initDB adds the genesis block and the consensus set of the genesis block to
+// an empty database.
+func (s *State) initDB(tx *bolt.Tx) {
+	genesis := GenesisChange()
+	genesisBlock := genesis.AppliedBlocks[0]
+	putBlockNode(tx, &blockNode{
+		Block:  genesisBlock,
+		Target: types.RootTarget,
+		Depth:  types.RootDepth,
+
+		DiffsGenerated: true,
+	})
+
+	// Fill out the consensus information for the genesis block.
+	pushPath(tx, 0, genesisBlock.ID())
+	for _, scod := range genesis.SiacoinOutputDiffs {
+		putSiacoinOutput(tx, scod.ID, scod.SiacoinOutput)
+	}
+	for _, sfod := range genesis.SiafundOutputDiffs {
+		putSiafundOutput(tx, sfod.ID, sfod.SiafundOutput)
+	}
+	setSiafundPool(tx, types.ZeroCurrency)
+}
+
+// migrateChainDB adds the blocks of a block database created by an older
+// version to the consensus set. Only a new consensus database is migrated, so
+// the block database is left in place, but never read again once the
+// migration has finished. Blocks that are already in the consensus set are
+// skipped, so a migration that was interrupted can be run again.
+func (s *State) migrateChainDB(filename string) error {
+	db, err := blockdb.Open(filename)
 	if err != nil {
 		return err
 	}
+	defer db.Close()
 	height, err := db.Height()
 	if err != nil {
 		return err
 	}
-	if height == 0 {
-		// add genesis block
-		s.db = db
-		return db.AddBlock(s.blockMap[s.currentPath[0]].block)
-	}
-	// load blocks from the db, starting after the genesis block
-	// NOTE: during load, the state uses the NilDB. This prevents AcceptBlock
-	// from adding duplicate blocks to the real database.
-	s.db = blockdb.NilDB
+	// The genesis block is at height 0 and is already in the consensus set.
 	for i := types.BlockHeight(1); i < height; i++ {
 		b, err := db.Block(i)
 		if err != nil {
-			// should never happen
 			return err
 		}
 		err = s.AcceptBlock(b)
-		if err == ErrBlockKnown {
-			println(i)
-		} else if err != nil {
+		if err != nil && err != ErrBlockKnown {
 			return err
 		}
 	}
-	// start using the real db
+	return s.db.Update(func(tx *bolt.Tx) error {
+		setChainDBPending(tx, false)
+		return nil
+	})
+}
+
+// load opens the consensus database in saveDir. Because the consensus set is
+// stored in the database, no blocks need to be processed, unless the database
+// is new and a block database from an older version is present. The
+// migration of the block database is recorded in the consensus database, and
+// is retried on the next load if it does not finish.
+func (s *State) load(saveDir string) error {
+	db, err := openDB(filepath.Join(saveDir, consensusDBFilename))
+	if err != nil {
+		return err
+	}
 	s.db = db
-	return nil
+
+	// A database created before the file contract statistics were kept has
+	// none, so the open contracts are counted once.
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if _, exists := getFileContractStatistics(tx); !exists {
+			setFileContractStatistics(tx, countFileContracts(tx))
+		}
+		return nil
+	})
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+
+	// Initialize a new database.
+	chainDB := filepath.Join(saveDir, chainDBFilename)
+	var initialized, pending bool
+	s.db.View(func(tx *bolt.Tx) error {
+		_, initialized = pathID(tx, 0)
+		pending = chainDBPending(tx)
+		return nil
+	})
+	if !initialized {
+		_, statErr := os.Stat(chainDB)
+		pending = statErr == nil
+		err = s.db.Update(func(tx *bolt.Tx) error {
+			s.initDB(tx)
+			setChainDBPending(tx, pending)
+			return nil
+		})
+		if err != nil {
+			s.db.Close()
+			return err
+		}
+	}
+	if pending {
+		err = s.migrateChainDB(chainDB)
+		if err != nil {
+			s.db.Close()
+			return err
+		}
+	}
+
+	// A database created before the change log was added has no changes,
+	// so the entire current path is added as a single change, as it would be
+	// if the blocks had just been accepted.
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if changeLogLen(tx) != 0 || s.height(tx) == 0 {
+			return nil
+		}
+		var path []types.BlockID
+		for i := types.BlockHeight(1); i <= s.height(tx); i++ {
+			id, _ := pathID(tx, i)
+			path = append(path, id)
+		}
+		appendChange(tx, nil, path)
+		return nil
+	})
 }
@@ -0,0 +1,137 @@
+package consensus
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/blockdb"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/modules/tester"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// reopenState creates a new State from the consensus database in saveDir.
+func reopenState(name string, saveDir string, t *testing.T) *State {
+	g, err := gateway.New(":0", "", tester.TempDir("consensus", name, modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(g, saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestLoadConsensusSet checks that a reopened State has the same consensus set
+// as the State that was closed.
+func TestLoadConsensusSet(t *testing.T) {
+	ct := NewTestingEnvironment("TestLoadConsensusSet", t)
+	ct.MineAndSubmitCurrentBlock([]types.Transaction{ct.SiacoinOutputTransaction()})
+	ct.MineAndApplyValidBlock()
+	height := ct.Height()
+	hash := ct.StateHash()
+	ct.Close()
+
+	saveDir := filepath.Join(tester.SiaTestingDir, "consensus", "TestLoadConsensusSet", modules.ConsensusDir)
+	s := reopenState("TestLoadConsensusSetReopen", saveDir, t)
+	defer s.Close()
+	if s.Height() != height {
+		t.Fatalf("height is %v after reopening, expected %v", s.Height(), height)
+	}
+	if s.StateHash() != hash {
+		t.Fatal("consensus set changed after reopening")
+	}
+
+	// The reopened State should continue to accept blocks.
+	ct = NewConsensusTester(t, s)
+	ct.MineAndApplyValidBlock()
+	ct.ConsistencyChecks()
+}
+
+// TestMigrateChainDB checks that the blocks of a block database created by an
+// older version are added to a new consensus database.
+func TestMigrateChainDB(t *testing.T) {
+	ct := NewTestingEnvironment("TestMigrateChainDB", t)
+	defer ct.Close()
+	ct.MineAndApplyValidBlock()
+
+	// Write the current path to an old block database.
+	saveDir := tester.TempDir("consensus", "TestMigrateChainDB", "migrated")
+	err := os.MkdirAll(saveDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := blockdb.Open(filepath.Join(saveDir, chainDBFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := types.BlockHeight(0); i <= ct.Height(); i++ {
+		b, _ := ct.BlockAtHeight(i)
+		err = db.AddBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	s := reopenState("TestMigrateChainDBMigrated", saveDir, t)
+	defer s.Close()
+	if s.StateHash() != ct.StateHash() {
+		t.Fatal("migrated consensus set does not match the original")
+	}
+}
+
+// TestMigrateChainDBRetry checks that a migration that fails partway through
+// is finished the next time the consensus set is loaded.
+func TestMigrateChainDBRetry(t *testing.T) {
+	ct := NewTestingEnvironment("TestMigrateChainDBRetry", t)
+	defer ct.Close()
+	ct.MineAndApplyValidBlock()
+	ct.MineAndApplyValidBlock()
+
+	saveDir := tester.TempDir("consensus", "TestMigrateChainDBRetry", "migrated")
+	err := os.MkdirAll(saveDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeChainDB := func(corrupt bool) {
+		filename := filepath.Join(saveDir, chainDBFilename)
+		os.Remove(filename)
+		db, err := blockdb.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		for i := types.BlockHeight(0); i <= ct.Height(); i++ {
+			b, _ := ct.BlockAtHeight(i)
+			if corrupt && i == ct.Height() {
+				b.ParentID = types.BlockID{1}
+			}
+			err = db.AddBlock(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The last block of the corrupt database is an orphan, so the migration
+	// stops after the first block.
+	writeChainDB(true)
+	g, err := gateway.New(":0", "", tester.TempDir("consensus", "TestMigrateChainDBRetry", modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(g, saveDir); err == nil {
+		t.Fatal("migration of a corrupt block database succeeded")
+	}
+
+	writeChainDB(false)
+	s := reopenState("TestMigrateChainDBRetryMigrated", saveDir, t)
+	defer s.Close()
+	if s.StateHash() != ct.StateHash() {
+		t.Fatal("retried migration does not match the original")
+	}
+}
@@ -0,0 +1,309 @@
+package consensus
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// snapshot.go exports and imports snapshots of the consensus set. A snapshot
+// holds the blocks of the current path up to a checkpoint, and the consensus
+// set at the checkpoint. A new node that trusts the signer of a snapshot can
+// load it instead of validating every block since genesis; the blocks are
+// only checked against the checkpoint, and their transactions are never
+// validated.
+//
+// A loaded snapshot is stored as if the blocks had been accepted. The node of
+// the checkpoint block holds diffs that turn the consensus set of the genesis
+// block into the consensus set of the snapshot, so subscribers see every
+// output, and the nodes of the other blocks only hold the delayed outputs
+// they created. Reverting the blocks would corrupt the consensus set, but
+// because every chain must pass through the checkpoint, they are never
+// reverted.
+
+var (
+	ErrSnapshotCheckpoint = errors.New("snapshot does not end at a known checkpoint")
+	ErrSnapshotHeight     = errors.New("snapshot height is not in the current path")
+	ErrSnapshotNotNew     = errors.New("snapshots can only be loaded into a new consensus set")
+	ErrSnapshotSignature  = errors.New("snapshot signature is invalid")
+	ErrUntrustedSnapshot  = errors.New("snapshot is not signed by the trusted key")
+
+	errBadSnapshot = errors.New("snapshot is malformed")
+
+	// errSnapshotRollback is returned from the database transaction that
+	// creates a snapshot, so that the blocks reverted to reach the checkpoint
+	// are restored.
+	errSnapshotRollback = errors.New("snapshot rollback")
+)
+
+// A Snapshot is the consensus set at a checkpoint, signed by the node that
+// created it. Blocks holds the current path after the genesis block, ending
+// with the checkpoint block. The elements of the consensus set are stored as
+// diffs that apply them.
+type Snapshot struct {
+	Blocks                []types.Block
+	SiacoinOutputs        []modules.SiacoinOutputDiff
+	FileContracts         []modules.FileContractDiff
+	SiafundOutputs        []modules.SiafundOutputDiff
+	DelayedSiacoinOutputs []modules.DelayedSiacoinOutputDiff
+	SiafundPool           types.Currency
+
+	PublicKey crypto.PublicKey
+	Signature crypto.Signature
+}
+
+// Height returns the height of the checkpoint block of the snapshot.
+func (snap *Snapshot) Height() types.BlockHeight {
+	return types.BlockHeight(len(snap.Blocks))
+}
+
+// hash returns the hash of the snapshot that is signed.
+func (snap *Snapshot) hash() crypto.Hash {
+	return crypto.HashAll(
+		snap.Blocks,
+		snap.SiacoinOutputs,
+		snap.FileContracts,
+		snap.SiafundOutputs,
+		snap.DelayedSiacoinOutputs,
+		snap.SiafundPool,
+		snap.PublicKey,
+	)
+}
+
+// Sign signs the snapshot with a secret key.
+func (snap *Snapshot) Sign(sk crypto.SecretKey) (err error) {
+	// An ed25519 secret key ends with its public key.
+	copy(snap.PublicKey[:], sk[crypto.SecretKeySize-crypto.PublicKeySize:])
+	snap.Signature, err = crypto.SignHash(snap.hash(), sk)
+	return
+}
+
+// snapshot returns the consensus set at the given height of the current path.
+// The current path is reverted to the height within a database transaction
+// that is then rolled back.
+func (s *State) snapshot(height types.BlockHeight) (snap Snapshot, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		if height == 0 || height > s.height(tx) {
+			return ErrSnapshotHeight
+		}
+		for i := types.BlockHeight(1); i <= height; i++ {
+			b, _ := s.blockAtHeight(tx, i)
+			snap.Blocks = append(snap.Blocks, b)
+		}
+		checkpoint, _ := getBlockNode(tx, snap.Blocks[height-1].ID())
+		s.revertToNode(tx, checkpoint)
+
+		tx.Bucket(bucketSiacoinOutputs).ForEach(func(key, value []byte) error {
+			scod := modules.SiacoinOutputDiff{Direction: modules.DiffApply}
+			copy(scod.ID[:], key)
+			persist.MustUnmarshal(value, &scod.SiacoinOutput)
+			snap.SiacoinOutputs = append(snap.SiacoinOutputs, scod)
+			return nil
+		})
+		tx.Bucket(bucketFileContracts).ForEach(func(key, value []byte) error {
+			fcd := modules.FileContractDiff{Direction: modules.DiffApply}
+			copy(fcd.ID[:], key)
+			persist.MustUnmarshal(value, &fcd.FileContract)
+			snap.FileContracts = append(snap.FileContracts, fcd)
+			return nil
+		})
+		tx.Bucket(bucketSiafundOutputs).ForEach(func(key, value []byte) error {
+			sfod := modules.SiafundOutputDiff{Direction: modules.DiffApply}
+			copy(sfod.ID[:], key)
+			persist.MustUnmarshal(value, &sfod.SiafundOutput)
+			snap.SiafundOutputs = append(snap.SiafundOutputs, sfod)
+			return nil
+		})
+
+		// Delayed outputs are kept after they mature, so the delayed outputs
+		// of every height are included.
+		for i := types.BlockHeight(1); i <= height; i++ {
+			for _, dsco := range delayedSiacoinOutputs(tx, i) {
+				snap.DelayedSiacoinOutputs = append(snap.DelayedSiacoinOutputs, modules.DelayedSiacoinOutputDiff{
+					Direction:      modules.DiffApply,
+					ID:             dsco.ID,
+					SiacoinOutput:  dsco.SiacoinOutput,
+					MaturityHeight: i + types.MaturityDelay,
+				})
+			}
+		}
+		snap.SiafundPool = getSiafundPool(tx)
+		return errSnapshotRollback
+	})
+	if err == errSnapshotRollback {
+		err = nil
+	}
+	return
+}
+
+// Snapshot returns an unsigned snapshot of the consensus set at the given
+// height of the current path.
+func (s *State) Snapshot(height types.BlockHeight) (Snapshot, error) {
+	id := s.mu.Lock()
+	defer s.mu.Unlock(id)
+	return s.snapshot(height)
+}
+
+// ExportSnapshot returns an unsigned snapshot of the consensus database in
+// saveDir at the given height of the current path. It is meant to be used
+// while no State has the database open.
+func ExportSnapshot(saveDir string, height types.BlockHeight) (Snapshot, error) {
+	filename := filepath.Join(saveDir, consensusDBFilename)
+	if _, err := os.Stat(filename); err != nil {
+		return Snapshot{}, err
+	}
+	db, err := openDB(filename)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer db.Close()
+	s := &State{db: db}
+	return s.snapshot(height)
+}
+
+// snapshotLoaded returns true if the last block of a snapshot is already in
+// the current path, which is the case when the State was started with the
+// same snapshot before.
+func (s *State) snapshotLoaded(snap Snapshot) bool {
+	height := snap.Height()
+	if height == 0 {
+		return false
+	}
+
+	lockID := s.mu.RLock()
+	defer s.mu.RUnlock(lockID)
+	var pathBlock types.BlockID
+	var exists bool
+	s.db.View(func(tx *bolt.Tx) error {
+		pathBlock, exists = pathID(tx, height)
+		return nil
+	})
+	return exists && pathBlock == snap.Blocks[height-1].ID()
+}
+
+// LoadSnapshot loads a snapshot into a State that only holds the genesis
+// block. The snapshot must be signed by the trusted key, and its last block
+// must match a checkpoint of the State.
+func (s *State) LoadSnapshot(snap Snapshot, key crypto.PublicKey) error {
+	if snap.PublicKey != key {
+		return ErrUntrustedSnapshot
+	}
+	if crypto.VerifyHash(snap.hash(), snap.PublicKey, snap.Signature) != nil {
+		return ErrSnapshotSignature
+	}
+
+	id := s.mu.Lock()
+	defer s.mu.Unlock(id)
+
+	height := snap.Height()
+	if checkpoint, exists := s.checkpoints[height]; height == 0 || !exists || snap.Blocks[height-1].ID() != checkpoint {
+		return ErrSnapshotCheckpoint
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if s.height(tx) != 0 {
+			return ErrSnapshotNotNew
+		}
+
+		// Sort the delayed outputs by the height of the blocks that created
+		// them.
+		delayed := make(map[types.BlockHeight][]delayedSiacoinOutput)
+		for _, dscod := range snap.DelayedSiacoinOutputs {
+			created := dscod.MaturityHeight - types.MaturityDelay
+			if dscod.MaturityHeight < types.MaturityDelay || created == 0 || created > height {
+				return errBadSnapshot
+			}
+			delayed[created] = append(delayed[created], delayedSiacoinOutput{
+				ID:            dscod.ID,
+				SiacoinOutput: dscod.SiacoinOutput,
+			})
+		}
+
+		// Check that the blocks form a chain before anything is written.
+		prevID := s.currentBlockID(tx)
+		for i, b := range snap.Blocks {
+			if b.ParentID != prevID || !s.matchesCheckpoint(types.BlockHeight(i+1), b.ID()) {
+				return errBadSnapshot
+			}
+			prevID = b.ID()
+		}
+
+		var appliedNodes []*blockNode
+		parent := s.currentBlockNode(tx)
+		for _, b := range snap.Blocks {
+			node := parent.newChild(tx, b)
+			node.DiffsGenerated = true
+			node.DelayedSiacoinOutputs = delayed[node.Height]
+			if node.Height == height {
+				s.snapshotDiffs(tx, node, snap)
+			}
+			s.commitDiffSet(tx, node, modules.DiffApply)
+			putBlockNode(tx, node)
+			appliedNodes = append(appliedNodes, node)
+			parent = node
+		}
+		s.updateSubscribers(tx, nil, blockIDs(appliedNodes))
+		return nil
+	})
+}
+
+// snapshotDiffs sets the diffs of the checkpoint node of a snapshot, which
+// turn the consensus set of the genesis block into the consensus set of the
+// snapshot.
+func (s *State) snapshotDiffs(tx *bolt.Tx, bn *blockNode, snap Snapshot) {
+	scos := make(map[types.SiacoinOutputID]struct{})
+	for _, scod := range snap.SiacoinOutputs {
+		scos[scod.ID] = struct{}{}
+	}
+	tx.Bucket(bucketSiacoinOutputs).ForEach(func(key, value []byte) error {
+		scod := modules.SiacoinOutputDiff{Direction: modules.DiffRevert}
+		copy(scod.ID[:], key)
+		persist.MustUnmarshal(value, &scod.SiacoinOutput)
+		if _, exists := scos[scod.ID]; exists {
+			delete(scos, scod.ID)
+		} else {
+			bn.SiacoinOutputDiffs = append(bn.SiacoinOutputDiffs, scod)
+		}
+		return nil
+	})
+	for _, scod := range snap.SiacoinOutputs {
+		if _, exists := scos[scod.ID]; exists {
+			bn.SiacoinOutputDiffs = append(bn.SiacoinOutputDiffs, scod)
+		}
+	}
+
+	sfos := make(map[types.SiafundOutputID]struct{})
+	for _, sfod := range snap.SiafundOutputs {
+		sfos[sfod.ID] = struct{}{}
+	}
+	tx.Bucket(bucketSiafundOutputs).ForEach(func(key, value []byte) error {
+		sfod := modules.SiafundOutputDiff{Direction: modules.DiffRevert}
+		copy(sfod.ID[:], key)
+		persist.MustUnmarshal(value, &sfod.SiafundOutput)
+		if _, exists := sfos[sfod.ID]; exists {
+			delete(sfos, sfod.ID)
+		} else {
+			bn.SiafundOutputDiffs = append(bn.SiafundOutputDiffs, sfod)
+		}
+		return nil
+	})
+	for _, sfod := range snap.SiafundOutputs {
+		if _, exists := sfos[sfod.ID]; exists {
+			bn.SiafundOutputDiffs = append(bn.SiafundOutputDiffs, sfod)
+		}
+	}
+
+	// The genesis block has no file contracts.
+	bn.FileContractDiffs = snap.FileContracts
+	bn.SiafundPoolDiff = modules.SiafundPoolDiff{
+		Previous: getSiafundPool(tx),
+		Adjusted: snap.SiafundPool,
+	}
+}
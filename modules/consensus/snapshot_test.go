@@ -0,0 +1,136 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/modules/tester"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSnapshot checks that a State bootstrapped from a snapshot has the same
+// consensus set as the State that created it, and that it continues to
+// accept blocks.
+func TestSnapshot(t *testing.T) {
+	ct := NewTestingEnvironment("TestSnapshot", t)
+	defer ct.Close()
+	ct.MineAndSubmitCurrentBlock([]types.Transaction{ct.SiacoinOutputTransaction()})
+	ct.MineAndApplyValidBlock()
+	height := ct.Height() - 1
+	checkpoint, _ := ct.BlockAtHeight(height)
+	hash := ct.StateHash()
+
+	// Creating a snapshot below the current height does not change the
+	// consensus set.
+	snap, err := ct.Snapshot(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.StateHash() != hash {
+		t.Fatal("creating a snapshot changed the consensus set")
+	}
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = snap.Sign(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := reopenState("TestSnapshotLoad", tester.TempDir("consensus", "TestSnapshotLoad", modules.ConsensusDir), t)
+	defer s.Close()
+
+	// The snapshot must be signed by the trusted key, and end at a
+	// checkpoint.
+	err = s.LoadSnapshot(snap, crypto.PublicKey{})
+	if err != ErrUntrustedSnapshot {
+		t.Error("expected ErrUntrustedSnapshot, got", err)
+	}
+	err = s.LoadSnapshot(snap, pk)
+	if err != ErrSnapshotCheckpoint {
+		t.Error("expected ErrSnapshotCheckpoint, got", err)
+	}
+	err = s.AddCheckpoint(height, checkpoint.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := snap
+	tampered.SiafundPool = types.NewCurrency64(1)
+	err = s.LoadSnapshot(tampered, pk)
+	if err != ErrSnapshotSignature {
+		t.Error("expected ErrSnapshotSignature, got", err)
+	}
+
+	err = s.LoadSnapshot(snap, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Height() != height {
+		t.Fatalf("loaded snapshot has height %v, expected %v", s.Height(), height)
+	}
+
+	// After accepting the rest of the blocks, the consensus sets match.
+	b, _ := ct.BlockAtHeight(height + 1)
+	err = s.AcceptBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.StateHash() != hash {
+		t.Error("consensus set of the loaded snapshot does not match")
+	}
+
+	// A snapshot can only be loaded into a new State.
+	err = s.LoadSnapshot(snap, pk)
+	if err != ErrSnapshotNotNew {
+		t.Error("expected ErrSnapshotNotNew, got", err)
+	}
+}
+
+// TestNewBootstrapped checks that a State can be created with checkpoints and
+// a snapshot, and that it can be restarted with the same snapshot.
+func TestNewBootstrapped(t *testing.T) {
+	ct := NewTestingEnvironment("TestNewBootstrapped", t)
+	defer ct.Close()
+	ct.MineAndApplyValidBlock()
+	height := ct.Height()
+	snap, err := ct.Snapshot(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = snap.Sign(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoints := map[types.BlockHeight]types.BlockID{height: ct.CurrentBlock().ID()}
+
+	saveDir := tester.TempDir("consensus", "TestNewBootstrappedLoad", modules.ConsensusDir)
+	g, err := gateway.New(":0", "", tester.TempDir("consensus", "TestNewBootstrappedLoad", modules.GatewayDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewBootstrapped(g, saveDir, checkpoints, &snap, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Height() != height || s.StateHash() != ct.StateHash() {
+		t.Error("snapshot was not loaded")
+	}
+	s.Close()
+
+	// Restarting with the same snapshot does not load it again.
+	s, err = NewBootstrapped(g, saveDir, checkpoints, &snap, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Height() != height || s.StateHash() != ct.StateHash() {
+		t.Error("restarted State does not match the snapshot")
+	}
+	s.Close()
+}
@@ -3,10 +3,10 @@ package consensus
 import (
 	"errors"
 	"os"
-	"testing"
 
-	"github.com/NebulousLabs/Sia/blockdb"
-	"github.com/NebulousLabs/Sia/build"
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/sync"
 	"github.com/NebulousLabs/Sia/types"
@@ -16,52 +16,66 @@ import (
 // blockchain. Broadly speaking, it is responsible for maintaining consensus.
 // It accepts blocks and constructs a blockchain, forking when necessary.
 type State struct {
-	// The blockRoot is the block node that contains the genesis block.
-	blockRoot *blockNode
-
-	// blockMap and badBlocks keep track of seen blocks. blockMap holds all
-	// valid blocks, including those not on the main blockchain. badBlocks
-	// is a "blacklist" of blocks known to be invalid.
-	blockMap  map[types.BlockID]*blockNode
-	badBlocks map[types.BlockID]struct{}
-
-	// The currentPath is the longest known blockchain.
-	currentPath []types.BlockID
-
-	// These are the consensus variables, referred to as the "consensus set."
-	// All nodes with the same current path must have the same consensus set.
+	// The db holds the block tree and the consensus set. The block tree
+	// contains every valid block, including those not on the main
+	// blockchain, along with the diffs that each block applies. The current
+	// path is the longest known blockchain.
 	//
-	// The siafundPool tracks the total number of siacoins that have been
-	// taxed from file contracts. Unless a reorg occurs, the siafundPool
+	// The consensus set is made up of the siafund pool, the unspent siacoin
+	// outputs, the open file contracts, the unspent siafund outputs, and the
+	// delayed siacoin outputs. All nodes with the same current path must
+	// have the same consensus set.
+	//
+	// The siafund pool tracks the total number of siacoins that have been
+	// taxed from file contracts. Unless a reorg occurs, the siafund pool
 	// should never decrease.
 	//
-	// siacoinOutputs, fileContracts, and siafundOutputs keep track of the
+	// Siacoin outputs, file contracts, and siafund outputs keep track of the
 	// unspent outputs and active contracts present in the current path. If an
 	// output is spent or a contract expires, it is removed from the consensus
 	// set. These objects may also be removed in the event of a reorg.
 	//
-	// delayedSiacoinOutputs are siacoin outputs that have been created in a
+	// Delayed siacoin outputs are siacoin outputs that have been created in a
 	// block, but are not allowed to be spent until a certain height. When
-	// that height is reached, they are moved to the siacoinOutputs map.
-	siafundPool           types.Currency
-	siacoinOutputs        map[types.SiacoinOutputID]types.SiacoinOutput
-	fileContracts         map[types.FileContractID]types.FileContract
-	siafundOutputs        map[types.SiafundOutputID]types.SiafundOutput
-	delayedSiacoinOutputs map[types.BlockHeight]map[types.SiacoinOutputID]types.SiacoinOutput
-
-	// Updates to the state are stored as a list, pointing to the block nodes
-	// that were added and removed at each step. Modules subscribed to the
-	// state will receive the changes in order that they occur.
-	revertUpdates [][]*blockNode
-	applyUpdates  [][]*blockNode
-	subscriptions []chan struct{}
+	// that height is reached, they are added to the siacoin outputs.
+	//
+	// See database.go for the layout of the database.
+	db *bolt.DB
 
-	// block database, used for saving/loading the current path
-	db blockdb.DB
+	// badBlocks is a "blacklist" of blocks known to be invalid.
+	badBlocks map[types.BlockID]struct{}
+
+	// futureBlocks holds blocks whose timestamps are too far in the future
+	// to be accepted yet. See futureblocks.go.
+	futureBlocks map[types.BlockID]types.Block
+
+	// orphans holds blocks whose parents are not yet known, keyed by the ID
+	// of the missing parent. orphanCount is the number of blocks in the
+	// pool. See orphans.go.
+	orphans     map[types.BlockID][]orphanBlock
+	orphanCount int
+
+	// checkpoints maps heights to the IDs of the blocks that must appear at
+	// those heights. See checkpoints.go.
+	checkpoints map[types.BlockHeight]types.BlockID
+
+	// Changes to the state are stored in the change log of the database,
+	// holding the IDs of the blocks that were added and removed at each step.
+	// Modules subscribed to the state will receive the changes in order that
+	// they occur, and are notified of new changes through subscriptions.
+	subscriptions []chan struct{}
 
 	// gateway, for receiving/relaying blocks to/from peers
 	gateway modules.Gateway
 
+	// syncLock ensures that only one synchronization runs at a time, and
+	// syncStatus describes the progress of the most recent one. peerSyncs
+	// holds the peers that relayed an orphan and have a synchronization
+	// running or waiting for syncLock.
+	syncLock   chan struct{}
+	syncStatus modules.SyncStatus
+	peerSyncs  map[modules.NetAddress]struct{}
+
 	// Per convention, all exported functions in the consensus package can be
 	// called concurrently. The state mutex helps to orchestrate thread safety.
 	// To keep things simple, the entire state was chosen to have a single
@@ -72,53 +86,36 @@ type State struct {
 }
 
 // New returns a new State, containing at least the genesis block. If there is
-// an existing block database present in saveDir, it will be loaded. Otherwise,
-// a new database will be created.
+// an existing consensus database present in saveDir, it will be loaded.
+// Otherwise, a new database will be created.
 func New(gateway modules.Gateway, saveDir string) (*State, error) {
+	return NewBootstrapped(gateway, saveDir, nil, nil, crypto.PublicKey{})
+}
+
+// NewBootstrapped returns a new State like New, which also enforces the given
+// checkpoints. If snap is not nil, it is loaded into the State, and must be
+// signed by key; see LoadSnapshot. The checkpoints and the snapshot are in
+// place before the State starts synchronizing with peers.
+func NewBootstrapped(gateway modules.Gateway, saveDir string, checkpoints map[types.BlockHeight]types.BlockID, snap *Snapshot, key crypto.PublicKey) (*State, error) {
 	if gateway == nil {
 		return nil, errors.New("cannot have nil gateway")
 	}
 
 	// Create the State object.
 	s := &State{
-		blockMap:  make(map[types.BlockID]*blockNode),
-		badBlocks: make(map[types.BlockID]struct{}),
+		badBlocks:    make(map[types.BlockID]struct{}),
+		futureBlocks: make(map[types.BlockID]types.Block),
+		orphans:      make(map[types.BlockID][]orphanBlock),
+		checkpoints:  make(map[types.BlockHeight]types.BlockID),
 
-		currentPath: make([]types.BlockID, 1),
-
-		siacoinOutputs:        make(map[types.SiacoinOutputID]types.SiacoinOutput),
-		fileContracts:         make(map[types.FileContractID]types.FileContract),
-		siafundOutputs:        make(map[types.SiafundOutputID]types.SiafundOutput),
-		delayedSiacoinOutputs: make(map[types.BlockHeight]map[types.SiacoinOutputID]types.SiacoinOutput),
-
-		gateway: gateway,
+		gateway:   gateway,
+		syncLock:  make(chan struct{}, 1),
+		peerSyncs: make(map[modules.NetAddress]struct{}),
 
 		mu: sync.New(modules.SafeMutexDelay, 1),
 	}
-
-	// Create the genesis block and add it as the BlockRoot.
-	genesisBlock := types.Block{
-		Timestamp: types.GenesisTimestamp,
-	}
-	s.blockRoot = &blockNode{
-		block:  genesisBlock,
-		target: types.RootTarget,
-		depth:  types.RootDepth,
-
-		diffsGenerated: true,
-	}
-	s.blockMap[genesisBlock.ID()] = s.blockRoot
-
-	// Fill out the consensus information for the genesis block.
-	s.currentPath[0] = genesisBlock.ID()
-	s.siacoinOutputs[genesisBlock.MinerPayoutID(0)] = types.SiacoinOutput{
-		Value:      types.CalculateCoinbase(0),
-		UnlockHash: types.ZeroUnlockHash,
-	}
-	s.siafundOutputs[types.SiafundOutputID{0}] = types.SiafundOutput{
-		Value:           types.NewCurrency64(types.SiafundCount),
-		UnlockHash:      types.GenesisSiafundUnlockHash,
-		ClaimUnlockHash: types.GenesisClaimUnlockHash,
+	for height, id := range Checkpoints {
+		s.checkpoints[height] = id
 	}
 
 	// Create the consensus directory.
@@ -127,19 +124,33 @@ func New(gateway modules.Gateway, saveDir string) (*State, error) {
 		return nil, err
 	}
 
-	// During short tests, use an in-memory database.
-	if build.Release == "testing" && testing.Short() {
-		s.db = blockdb.NilDB
-	} else {
-		// Otherwise, try to load an existing database from disk.
-		err = s.load(saveDir)
+	// Load the consensus database, creating it if it does not exist.
+	err = s.load(saveDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the checkpoints and load the snapshot, unless it was loaded when the
+	// State was created before.
+	for height, id := range checkpoints {
+		err = s.AddCheckpoint(height, id)
+		if err != nil {
+			s.db.Close()
+			return nil, err
+		}
+	}
+	if snap != nil && !s.snapshotLoaded(*snap) {
+		err = s.LoadSnapshot(*snap, key)
 		if err != nil {
+			s.db.Close()
 			return nil, err
 		}
 	}
 
 	// Register RPCs
 	gateway.RegisterRPC("SendBlocks", s.SendBlocks)
+	gateway.RegisterRPC("SendHeaders", s.SendHeaders)
+	gateway.RegisterRPC("SendBlk", s.SendBlk)
 	gateway.RegisterRPC("RelayBlock", s.RelayBlock)
 
 	// spawn resynchronize loop
@@ -148,7 +159,7 @@ func New(gateway modules.Gateway, saveDir string) (*State, error) {
 	return s, nil
 }
 
-// Close safely closes the block database.
+// Close safely closes the consensus database.
 func (s *State) Close() error {
 	return s.db.Close()
 }
@@ -1,6 +1,8 @@
 package consensus
 
 import (
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -13,42 +15,93 @@ type ConsensusSetSubscriber interface {
 	// Usually, the function receiving the updates will also process the
 	// changes. If the function blocks indefinitely, the state will still
 	// function.
-	ReceiveConsensusSetUpdate(revertedBlocks []types.Block, appliedBlocks []types.Block)
+	ReceiveConsensusSetUpdate(modules.ConsensusChange)
+}
+
+// consensusChange loads the blocks of a change from the block tree, and
+// collects the diffs that the blocks made to the consensus set. The diffs of
+// reverted blocks are inverted, so that every diff in the change can be
+// applied in order.
+func (s *State) consensusChange(tx *bolt.Tx, ce changeEntry) (cc modules.ConsensusChange) {
+	cc.ID = ce.ID
+	for _, bid := range ce.RevertedBlocks {
+		node, _ := getBlockNode(tx, bid)
+		cc.RevertedBlocks = append(cc.RevertedBlocks, node.Block)
+		for i := len(node.SiacoinOutputDiffs) - 1; i >= 0; i-- {
+			scod := node.SiacoinOutputDiffs[i]
+			scod.Direction = !scod.Direction
+			cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, scod)
+		}
+		for i := len(node.FileContractDiffs) - 1; i >= 0; i-- {
+			fcd := node.FileContractDiffs[i]
+			fcd.Direction = !fcd.Direction
+			cc.FileContractDiffs = append(cc.FileContractDiffs, fcd)
+		}
+		for i := len(node.SiafundOutputDiffs) - 1; i >= 0; i-- {
+			sfod := node.SiafundOutputDiffs[i]
+			sfod.Direction = !sfod.Direction
+			cc.SiafundOutputDiffs = append(cc.SiafundOutputDiffs, sfod)
+		}
+		for i := len(node.DelayedSiacoinOutputs) - 1; i >= 0; i-- {
+			dscod := node.delayedSiacoinOutputDiff(i)
+			dscod.Direction = modules.DiffRevert
+			cc.DelayedSiacoinOutputDiffs = append(cc.DelayedSiacoinOutputDiffs, dscod)
+		}
+		cc.SiafundPoolDiffs = append(cc.SiafundPoolDiffs, modules.SiafundPoolDiff{
+			Previous: node.SiafundPoolDiff.Adjusted,
+			Adjusted: node.SiafundPoolDiff.Previous,
+		})
+	}
+	for _, bid := range ce.AppliedBlocks {
+		node, _ := getBlockNode(tx, bid)
+		cc.AppliedBlocks = append(cc.AppliedBlocks, node.Block)
+		cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, node.SiacoinOutputDiffs...)
+		cc.FileContractDiffs = append(cc.FileContractDiffs, node.FileContractDiffs...)
+		cc.SiafundOutputDiffs = append(cc.SiafundOutputDiffs, node.SiafundOutputDiffs...)
+		for i := range node.DelayedSiacoinOutputs {
+			cc.DelayedSiacoinOutputDiffs = append(cc.DelayedSiacoinOutputDiffs, node.delayedSiacoinOutputDiff(i))
+		}
+		cc.SiafundPoolDiffs = append(cc.SiafundPoolDiffs, node.SiafundPoolDiff)
+	}
+	return cc
 }
 
 // threadedSendUpdates sends updates to a specific subscriber as they become
-// available. One thread is needed per subscriber. A separate function was
-// needed due to race conditions; subscribers must receive updates in the
-// correct order. Furthermore, a deadlocked subscriber should not interfere
-// with consensus; updates cannot make blocking calls from any thread that is
-// holding a lock on consensus. The result is a construction where all updates
-// are added to a list of updates in the consensus set while the consensus set
-// is locked. Then, a separate thread for each subscriber will be notified (via
-// the update chan) that there are new updates. The thread will lock the
-// consensus set for long enough to get the updates, and then will unlock the
-// consensus set while it makes a blocking call to the subscriber. If the
-// subscriber deadlocks or has problems, the thread will stall indefinitely,
-// but the rest of consensus will not be disrupted.
-func (s *State) threadedSendUpdates(update chan struct{}, subscriber ConsensusSetSubscriber) {
-	i := 0
+// available, starting with the change at position i of the change log. One
+// thread is needed per subscriber. A separate function was needed due to race
+// conditions; subscribers must receive updates in the correct order.
+// Furthermore, a deadlocked subscriber should not interfere with consensus;
+// updates cannot make blocking calls from any thread that is holding a lock
+// on consensus. The result is a construction where all changes are added to
+// the change log in the consensus database while the consensus set is locked.
+// Then, a separate thread for each subscriber will be notified (via the
+// update chan) that there are new changes. The thread will lock the consensus
+// set for long enough to read a change, and then will unlock the consensus
+// set while it makes a blocking call to the subscriber. If the subscriber
+// deadlocks or has problems, the thread will stall indefinitely, but the rest
+// of consensus will not be disrupted.
+func (s *State) threadedSendUpdates(update chan struct{}, subscriber ConsensusSetSubscriber, i uint64) {
 	for {
-		id := s.mu.RLock()
-		updateCount := len(s.revertUpdates)
-		s.mu.RUnlock(id)
-		for i < updateCount {
-			// Get the set of blocks that changed since the previous update.
+		for {
+			// Read the next change from the change log, if there is one.
 			id := s.mu.RLock()
-			var revertedBlocks, appliedBlocks []types.Block
-			for _, node := range s.revertUpdates[i] {
-				revertedBlocks = append(revertedBlocks, node.block)
-			}
-			for _, node := range s.applyUpdates[i] {
-				appliedBlocks = append(appliedBlocks, node.block)
-			}
+			var cc modules.ConsensusChange
+			var ok bool
+			s.db.View(func(tx *bolt.Tx) error {
+				if i >= changeLogLen(tx) {
+					return nil
+				}
+				cc = s.consensusChange(tx, getChange(tx, i))
+				ok = true
+				return nil
+			})
 			s.mu.RUnlock(id)
+			if !ok {
+				break
+			}
 
 			// Update the subscriber with the changes.
-			subscriber.ReceiveConsensusSetUpdate(revertedBlocks, appliedBlocks)
+			subscriber.ReceiveConsensusSetUpdate(cc)
 			i++
 		}
 
@@ -58,13 +111,16 @@ func (s *State) threadedSendUpdates(update chan struct{}, subscriber ConsensusSe
 }
 
 // updateSubscribers will inform all subscribers of the new update to the
-// consensus set.
-func (s *State) updateSubscribers(revertedNodes []*blockNode, appliedNodes []*blockNode) {
-	// Add the changes to the change set.
-	s.revertUpdates = append(s.revertUpdates, revertedNodes)
-	s.applyUpdates = append(s.applyUpdates, appliedNodes)
+// consensus set. The change is added to the change log in the same database
+// transaction as the blocks, so the log always matches the current path. Only
+// the IDs of the blocks are kept; the blocks are loaded from the database when
+// the update is sent.
+func (s *State) updateSubscribers(tx *bolt.Tx, revertedBlocks []types.BlockID, appliedBlocks []types.BlockID) {
+	appendChange(tx, revertedBlocks, appliedBlocks)
 
-	// Notify each update channel that a new update is ready.
+	// Notify each update channel that a new update is ready. The change is
+	// not visible to the subscriber threads until the transaction commits,
+	// and they cannot read the database until the State is unlocked.
 	for _, subscriber := range s.subscriptions {
 		// If the channel is already full, don't block.
 		select {
@@ -86,10 +142,28 @@ func (s *State) ConsensusSetNotify() <-chan struct{} {
 
 // ConsensusSetSubscribe accepts a new subscriber who will receive a call to
 // ReceiveConsensusSetUpdate every time there is a change in the consensus set.
-func (s *State) ConsensusSetSubscribe(subscriber ConsensusSetSubscriber) {
-	c := make(chan struct{}, 1)
+// The subscriber is first sent every change that came after the change with
+// ID start, or every change if start is modules.ConsensusChangeBeginning. An
+// error is returned if the consensus set has no change with ID start.
+func (s *State) ConsensusSetSubscribe(subscriber ConsensusSetSubscriber, start modules.ConsensusChangeID) error {
 	id := s.mu.Lock()
+	defer s.mu.Unlock(id)
+
+	var i uint64
+	if start != modules.ConsensusChangeBeginning {
+		var exists bool
+		s.db.View(func(tx *bolt.Tx) error {
+			i, exists = changePosition(tx, start)
+			return nil
+		})
+		if !exists {
+			return modules.ErrInvalidConsensusChangeID
+		}
+		i++
+	}
+
+	c := make(chan struct{}, 1)
 	s.subscriptions = append(s.subscriptions, c)
-	s.mu.Unlock(id)
-	go s.threadedSendUpdates(c, subscriber)
+	go s.threadedSendUpdates(c, subscriber, i)
+	return nil
 }
@@ -0,0 +1,195 @@
+package consensus
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/tester"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// changeRecorder is a ConsensusSetSubscriber that passes every change it
+// receives to a channel.
+type changeRecorder struct {
+	changes chan modules.ConsensusChange
+}
+
+// ReceiveConsensusSetUpdate sends the change to the recorder's channel.
+func (cr changeRecorder) ReceiveConsensusSetUpdate(cc modules.ConsensusChange) {
+	cr.changes <- cc
+}
+
+// receiveChanges returns the next n changes sent to the recorder.
+func (cr changeRecorder) receiveChanges(n uint64, t *testing.T) (ccs []modules.ConsensusChange) {
+	for i := uint64(0); i < n; i++ {
+		select {
+		case cc := <-cr.changes:
+			ccs = append(ccs, cc)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %v changes, expected %v", i, n)
+		}
+	}
+	return ccs
+}
+
+// TestResumeSubscription checks that a subscriber can resume receiving changes
+// from the last change it processed after the State is reopened.
+func TestResumeSubscription(t *testing.T) {
+	ct := NewTestingEnvironment("TestResumeSubscription", t)
+	ct.MineAndApplyValidBlock()
+	ct.MineAndApplyValidBlock()
+
+	// A subscriber starting at the beginning receives every change in the
+	// change log.
+	var logLen uint64
+	ct.db.View(func(tx *bolt.Tx) error {
+		logLen = changeLogLen(tx)
+		return nil
+	})
+	cr := changeRecorder{make(chan modules.ConsensusChange)}
+	err := ct.ConsensusSetSubscribe(cr, modules.ConsensusChangeBeginning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ccs := cr.receiveChanges(logLen, t)
+	lastID := ccs[len(ccs)-1].ID
+	var applied int
+	for _, cc := range ccs {
+		applied += len(cc.AppliedBlocks) - len(cc.RevertedBlocks)
+	}
+	if applied != int(ct.Height()) {
+		t.Fatalf("changes applied %v blocks, expected %v", applied, ct.Height())
+	}
+	ct.Close()
+
+	// After reopening, a subscriber starting at the last change only
+	// receives new changes.
+	saveDir := filepath.Join(tester.SiaTestingDir, "consensus", "TestResumeSubscription", modules.ConsensusDir)
+	s := reopenState("TestResumeSubscriptionReopen", saveDir, t)
+	defer s.Close()
+	cr = changeRecorder{make(chan modules.ConsensusChange)}
+	err = s.ConsensusSetSubscribe(cr, lastID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct = NewConsensusTester(t, s)
+	b := ct.MineAndApplyValidBlock()
+	cc := cr.receiveChanges(1, t)[0]
+	if cc.ID == lastID {
+		t.Fatal("new change has the same ID as the previous change")
+	}
+	if len(cc.RevertedBlocks) != 0 || len(cc.AppliedBlocks) != 1 || cc.AppliedBlocks[0].ID() != b.ID() {
+		t.Fatal("resumed subscriber did not receive the new block")
+	}
+}
+
+// TestInvalidConsensusChangeID checks that subscribing with an unknown change
+// ID returns an error.
+func TestInvalidConsensusChangeID(t *testing.T) {
+	ct := NewTestingEnvironment("TestInvalidConsensusChangeID", t)
+	defer ct.Close()
+	cr := changeRecorder{make(chan modules.ConsensusChange)}
+	err := ct.ConsensusSetSubscribe(cr, modules.ConsensusChangeID{1})
+	if err != modules.ErrInvalidConsensusChangeID {
+		t.Fatalf("expected %v, got %v", modules.ErrInvalidConsensusChangeID, err)
+	}
+}
+
+// TestConsensusChangeDiffs checks that a subscriber can keep a copy of the
+// siacoin outputs and the siafund pool by applying the diffs of each change in
+// order, including a change that reverts blocks.
+func TestConsensusChangeDiffs(t *testing.T) {
+	ct := NewTestingEnvironment("TestConsensusChangeDiffs", t)
+	defer ct.Close()
+
+	// Copy the siacoin outputs, and subscribe from the most recent change.
+	outputs := make(map[types.SiacoinOutputID]types.SiacoinOutput)
+	start := modules.ConsensusChangeBeginning
+	ct.db.View(func(tx *bolt.Tx) error {
+		tx.Bucket(bucketSiacoinOutputs).ForEach(func(key, value []byte) error {
+			var id types.SiacoinOutputID
+			var sco types.SiacoinOutput
+			copy(id[:], key)
+			persist.MustUnmarshal(value, &sco)
+			outputs[id] = sco
+			return nil
+		})
+		if n := changeLogLen(tx); n > 0 {
+			start = getChange(tx, n-1).ID
+		}
+		return nil
+	})
+	cr := changeRecorder{make(chan modules.ConsensusChange, 10)}
+	err := ct.ConsensusSetSubscribe(cr, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Apply two blocks, and then a longer fork that reverts them.
+	forkParent := ct.CurrentBlock().ID()
+	forkHeight := ct.Height()
+	intTarget := ct.CurrentTarget().Int()
+	forkTarget := types.IntToTarget(intTarget.Div(intTarget, big.NewInt(2)))
+	ct.MineAndApplyValidBlock()
+	ct.MineAndApplyValidBlock()
+	for i := types.BlockHeight(1); i <= 3; i++ {
+		// Pay a different address so that the fork does not contain the
+		// same blocks.
+		payouts := ct.Payouts(forkHeight+i, nil)
+		payouts[0].UnlockHash = types.UnlockHash{1}
+		b := MineTestingBlock(forkParent, types.CurrentTimestamp(), payouts, nil, forkTarget)
+		err = ct.AcceptBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forkParent = b.ID()
+	}
+	if ct.CurrentBlock().ID() != forkParent {
+		t.Fatal("fork was not applied")
+	}
+
+	ccs := cr.receiveChanges(3, t)
+	if len(ccs[2].RevertedBlocks) != 2 || len(ccs[2].AppliedBlocks) != 3 {
+		t.Fatal("fork change has the wrong blocks")
+	}
+	var pool types.Currency
+	for _, cc := range ccs {
+		for _, scod := range cc.SiacoinOutputDiffs {
+			if scod.Direction == modules.DiffApply {
+				outputs[scod.ID] = scod.SiacoinOutput
+			} else {
+				delete(outputs, scod.ID)
+			}
+		}
+		if len(cc.SiafundPoolDiffs) != len(cc.RevertedBlocks)+len(cc.AppliedBlocks) {
+			t.Fatal("change does not have a siafund pool diff for each block")
+		}
+		pool = cc.SiafundPoolDiffs[len(cc.SiafundPoolDiffs)-1].Adjusted
+	}
+
+	// The copy should match the consensus set.
+	var matches bool
+	var consensusPool types.Currency
+	ct.db.View(func(tx *bolt.Tx) error {
+		matches = tx.Bucket(bucketSiacoinOutputs).Stats().KeyN == len(outputs)
+		for id := range outputs {
+			if _, exists := getSiacoinOutput(tx, id); !exists {
+				matches = false
+			}
+		}
+		consensusPool = getSiafundPool(tx)
+		return nil
+	})
+	if !matches {
+		t.Error("siacoin outputs built from the diffs do not match the consensus set")
+	}
+	if pool.Cmp(consensusPool) != 0 {
+		t.Error("siafund pool built from the diffs does not match the consensus set")
+	}
+}
@@ -1,8 +1,12 @@
 package consensus
 
 import (
+	"errors"
+	"math/big"
 	"time"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
@@ -12,8 +16,30 @@ import (
 
 const (
 	MaxCatchUpBlocks = 50
+
+	// MaxCatchUpHeaders is the maximum number of headers sent in response to
+	// a single SendHeaders call.
+	MaxCatchUpHeaders = 1000
+
+	// maxDownloadPeers is the maximum number of peers that blocks are
+	// downloaded from in parallel during synchronization.
+	maxDownloadPeers = 8
 )
 
+var (
+	errBadHeaders    = errors.New("peer sent an invalid chain of headers")
+	errMissingBlocks = errors.New("peer does not have the requested blocks")
+	errWrongBlocks   = errors.New("peer sent blocks that do not match the requested headers")
+)
+
+// A batchResult is the result of downloading a batch of blocks from a peer.
+type batchResult struct {
+	index  int
+	peer   modules.NetAddress
+	blocks []types.Block
+	err    error
+}
+
 // threadedResynchronize continuously calls Synchronize on a random peer every
 // few minutes. This helps prevent unintentional desychronization in the event
 // that broadcasts start failing.
@@ -32,29 +58,173 @@ func (s *State) threadedResynchronize() {
 	}
 }
 
+// peerHandles returns true if the peer at addr handles the named RPC. The
+// gateway identifies an RPC by the first 8 bytes of its name.
+func (s *State) peerHandles(addr modules.NetAddress, name string) bool {
+	if len(name) > 8 {
+		name = name[:8]
+	}
+	for _, info := range s.gateway.PeerInfo() {
+		if info.Address != addr {
+			continue
+		}
+		for _, rpc := range info.RPCs {
+			if rpc == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addBlock adds a block to the State without relaying it to peers. Blocks
+// downloaded during synchronization are already known to the network, so
+// they are not relayed. Once the block is added, the orphans that were
+// waiting for it are connected.
+func (s *State) addBlock(b types.Block) error {
+	s.verifyBlock(b)
+
+	// An invalid block leaves the database consistent, so the transaction is
+	// committed even if the block is rejected.
+	counter := s.mu.Lock()
+	var acceptErr error
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		acceptErr = s.acceptBlock(tx, b)
+		return nil
+	})
+	s.mu.Unlock(counter)
+	if err != nil {
+		return err
+	}
+	if acceptErr != nil {
+		return acceptErr
+	}
+
+	s.connectOrphans(b.ID())
+	return nil
+}
+
+// threadedSynchronizePeer synchronizes with a peer that relayed an orphan.
+// A peer can relay many orphans in a row, so the synchronization is skipped
+// if one is already running or waiting for that peer.
+func (s *State) threadedSynchronizePeer(peer modules.NetAddress) {
+	id := s.mu.Lock()
+	_, pending := s.peerSyncs[peer]
+	if !pending {
+		s.peerSyncs[peer] = struct{}{}
+	}
+	s.mu.Unlock(id)
+	if pending {
+		return
+	}
+	defer func() {
+		id := s.mu.Lock()
+		delete(s.peerSyncs, peer)
+		s.mu.Unlock(id)
+	}()
+
+	s.Synchronize(peer)
+}
+
 // Synchronize synchronizes the local consensus set (i.e. the blockchain) with
 // the network consensus set. The process is as follows: synchronize asks a
-// peer for new blocks. The requester sends 32 block IDs, starting with the 12
+// peer for the headers of the blocks that follow the most recent block known
+// to both peers, which is found by sending 32 block IDs, starting with the 12
 // most recent and then progressing exponentially backwards to the genesis
-// block. The receiver uses these blocks to find the most recent block seen by
-// both peers. From this starting height, it transmits blocks sequentially.
-// The requester then integrates these blocks into its consensus set. Multiple
-// such transmissions may be required to fully synchronize.
+// block. The chain of headers is checked for proof of work, and then the
+// blocks are downloaded in batches from several peers in parallel. Batches
+// may arrive in any order, but the blocks are integrated into the consensus
+// set in order. Multiple rounds of headers may be required to fully
+// synchronize.
 //
-// TODO: don't run two Synchronize threads at the same time
+// A peer that sends an invalid chain of headers, or blocks that do not match
+// the requested headers, is given a strike by the gateway. Only one
+// synchronization runs at a time; Synchronize waits for any other
+// synchronization to finish.
 func (s *State) Synchronize(peer modules.NetAddress) error {
+	s.syncLock <- struct{}{}
+	defer func() {
+		<-s.syncLock
+	}()
+
+	// Peers running older versions only support SendBlocks.
+	if !s.peerHandles(peer, "SendHeaders") {
+		return s.synchronizeBlocks(peer)
+	}
+
+	height := s.Height()
+	id := s.mu.Lock()
+	s.syncStatus = modules.SyncStatus{
+		Synchronizing: true,
+		Peer:          peer,
+		StartHeight:   height,
+		TargetHeight:  height,
+	}
+	s.mu.Unlock(id)
+	defer func() {
+		id := s.mu.Lock()
+		s.syncStatus.Synchronizing = false
+		s.mu.Unlock(id)
+	}()
+
+	// tip is the last header received. Each round of headers starts after
+	// the tip, even if the blocks of the tip are not yet heavier than the
+	// current path.
+	var tip types.BlockID
+	for {
+		var headers []types.BlockHeader
+		var parentHeight types.BlockHeight
+		var more bool
+		err := s.gateway.RPC(peer, "SendHeaders", func(conn modules.PeerConn) error {
+			err := encoding.WriteObject(conn, s.syncHistory(tip))
+			if err != nil {
+				return err
+			}
+			maxLen := uint64(8 + MaxCatchUpHeaders*len(encoding.Marshal(types.BlockHeader{})))
+			err = encoding.ReadObject(conn, &headers, maxLen)
+			if err != nil {
+				return err
+			}
+			err = encoding.ReadObject(conn, &more, 1)
+			if err != nil {
+				return err
+			}
+			parentHeight, err = s.checkHeaders(headers)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if len(headers) == 0 {
+			return nil
+		}
+
+		id := s.mu.Lock()
+		s.syncStatus.TargetHeight = parentHeight + types.BlockHeight(len(headers))
+		s.mu.Unlock(id)
+
+		err = s.downloadBlocks(peer, headers)
+		if err != nil {
+			return err
+		}
+		tip = headers[len(headers)-1].ID()
+		if !more {
+			return nil
+		}
+	}
+}
+
+// synchronizeBlocks synchronizes with a peer that does not support
+// SendHeaders, by requesting 'MaxCatchUpBlocks' blocks at a time through
+// SendBlocks.
+func (s *State) synchronizeBlocks(peer modules.NetAddress) error {
 	// loop until there are no more blocks available
 	moreAvailable := true
 	for moreAvailable {
-		// get blockIDs to send
-		id := s.mu.RLock()
-		history := s.blockHistory()
-		s.mu.RUnlock(id)
-
 		// perform RPC
 		var newBlocks []types.Block
 		err := s.gateway.RPC(peer, "SendBlocks", func(conn modules.PeerConn) error {
-			err := encoding.WriteObject(conn, history)
+			err := encoding.WriteObject(conn, s.syncHistory(types.BlockID{}))
 			if err != nil {
 				return err
 			}
@@ -70,17 +240,278 @@ func (s *State) Synchronize(peer modules.NetAddress) error {
 
 		// integrate received blocks
 		for _, block := range newBlocks {
-			// TODO: don't Broadcast these blocks
-			acceptErr := s.AcceptBlock(block)
-			if acceptErr != nil {
-				// TODO: If the error is a FutureTimestampErr, need to wait before trying the
-				// block again.
+			err = s.addBlock(block)
+			if err != nil && err != ErrBlockKnown {
+				return err
 			}
 		}
 	}
 	return nil
 }
 
+// syncHistory returns the block history that is sent to a peer during
+// synchronization. The history starts at tip if tip is in the block tree, and
+// at the current block otherwise.
+func (s *State) syncHistory(tip types.BlockID) (history [32]types.BlockID) {
+	id := s.mu.RLock()
+	defer s.mu.RUnlock(id)
+	s.db.View(func(tx *bolt.Tx) error {
+		bn, exists := getBlockNode(tx, tip)
+		if !exists {
+			bn = s.currentBlockNode(tx)
+		}
+		history = s.blockHistory(tx, bn)
+		return nil
+	})
+	return
+}
+
+// checkHeaders checks that a set of headers is a chain that starts at a block
+// in the block tree, and that each header meets the highest target that its
+// block could have. The height of the parent of the first header is returned.
+func (s *State) checkHeaders(headers []types.BlockHeader) (parentHeight types.BlockHeight, err error) {
+	if len(headers) > MaxCatchUpHeaders {
+		return 0, errBadHeaders
+	}
+	if len(headers) == 0 {
+		return 0, nil
+	}
+
+	id := s.mu.RLock()
+	defer s.mu.RUnlock(id)
+	var parent *blockNode
+	var exists bool
+	s.db.View(func(tx *bolt.Tx) error {
+		parent, exists = getBlockNode(tx, headers[0].ParentID)
+		return nil
+	})
+	if !exists {
+		return 0, errBadHeaders
+	}
+
+	// The target of a block can be at most MaxAdjustmentUp times the target
+	// of its parent. Headers must also match any checkpoints at their
+	// heights.
+	target := parent.Target
+	prevID := parent.Block.ID()
+	for i, header := range headers {
+		if header.ParentID != prevID || !header.CheckTarget(target) {
+			return 0, errBadHeaders
+		}
+		prevID = header.ID()
+		if !s.matchesCheckpoint(parent.Height+types.BlockHeight(i)+1, prevID) {
+			return 0, errBadHeaders
+		}
+		if _, exists := s.badBlocks[prevID]; exists {
+			return 0, errBadHeaders
+		}
+		target = types.RatToTarget(new(big.Rat).Mul(target.Rat(), types.MaxAdjustmentUp))
+	}
+	return parent.Height, nil
+}
+
+// downloadPeers returns the peers that blocks are downloaded from, starting
+// with source.
+func (s *State) downloadPeers(source modules.NetAddress) []modules.NetAddress {
+	peers := []modules.NetAddress{source}
+	for _, peer := range s.gateway.Peers() {
+		if len(peers) >= maxDownloadPeers {
+			break
+		}
+		if peer != source && s.peerHandles(peer, "SendBlk") {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// downloadBlocks downloads the blocks of a chain of headers in batches, and
+// adds them to the consensus set in order. Each download peer takes batches
+// from a shared queue; a batch that a peer fails to send is returned to the
+// queue for another peer, and the peer is not used again. A peer that sends a
+// block that matches its header but is invalid is given a strike.
+func (s *State) downloadBlocks(source modules.NetAddress, headers []types.BlockHeader) error {
+	var batches [][]types.BlockID
+	for i := 0; i < len(headers); i += MaxCatchUpBlocks {
+		var batch []types.BlockID
+		for j := i; j < len(headers) && j < i+MaxCatchUpBlocks; j++ {
+			batch = append(batch, headers[j].ID())
+		}
+		batches = append(batches, batch)
+	}
+
+	peers := s.downloadPeers(source)
+	work := make(chan int, len(batches))
+	results := make(chan batchResult, len(batches)+len(peers))
+	done := make(chan struct{})
+	defer close(done)
+	for i := range batches {
+		work <- i
+	}
+	for _, peer := range peers {
+		go s.threadedDownloadBatches(peer, batches, work, results, done)
+	}
+
+	// Add the batches to the consensus set in order as they arrive.
+	received := make(map[int]batchResult)
+	workers := len(peers)
+	for next := 0; next < len(batches); {
+		r := <-results
+		if r.err != nil {
+			workers--
+			if workers == 0 {
+				return r.err
+			}
+			work <- r.index
+			continue
+		}
+		received[r.index] = r
+
+		// A block with a future timestamp is held by the State, which ends
+		// the synchronization; the blocks after it are downloaded by a later
+		// synchronization, once the block has been accepted.
+		for batch, ok := received[next]; ok; batch, ok = received[next] {
+			delete(received, next)
+			for _, b := range batch.blocks {
+				err := s.addBlock(b)
+				if err != nil && err != ErrBlockKnown {
+					if err != ErrFutureTimestamp {
+						s.gateway.Strike(batch.peer)
+					}
+					return err
+				}
+				id := s.mu.Lock()
+				s.syncStatus.BlocksDownloaded++
+				s.mu.Unlock(id)
+			}
+			next++
+		}
+	}
+	return nil
+}
+
+// threadedDownloadBatches downloads batches of blocks from a peer until done
+// is closed or the peer fails to send a batch.
+func (s *State) threadedDownloadBatches(peer modules.NetAddress, batches [][]types.BlockID, work chan int, results chan batchResult, done chan struct{}) {
+	for {
+		var index int
+		select {
+		case index = <-work:
+		case <-done:
+			return
+		}
+
+		blocks, err := s.requestBlocks(peer, batches[index])
+		select {
+		case results <- batchResult{index, peer, blocks, err}:
+		case <-done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// requestBlocks requests a batch of blocks from a peer. Blocks that do not
+// match the requested IDs are invalid data, so the RPC fails and the peer is
+// given a strike; a peer that is missing some of the blocks is not penalized.
+func (s *State) requestBlocks(peer modules.NetAddress, ids []types.BlockID) (blocks []types.Block, err error) {
+	err = s.gateway.RPC(peer, "SendBlk", func(conn modules.PeerConn) error {
+		err := encoding.WriteObject(conn, ids)
+		if err != nil {
+			return err
+		}
+		err = encoding.ReadObject(conn, &blocks, uint64(len(ids))*types.BlockSizeLimit)
+		if err != nil {
+			return err
+		}
+		if len(blocks) > len(ids) {
+			return errWrongBlocks
+		}
+		for i := range blocks {
+			if blocks[i].ID() != ids[i] {
+				return errWrongBlocks
+			}
+		}
+		return nil
+	})
+	if err == nil && len(blocks) < len(ids) {
+		err = errMissingBlocks
+	}
+	return
+}
+
+// SendHeaders returns the headers of up to 'MaxCatchUpHeaders' blocks in the
+// current path, starting after the most recent of the 32 input block IDs that
+// is in the current path. It also sends a boolean indicating whether more
+// headers are available.
+func (s *State) SendHeaders(conn modules.PeerConn) error {
+	var knownBlocks [32]types.BlockID
+	err := encoding.ReadObject(conn, &knownBlocks, 32*crypto.HashSize)
+	if err != nil {
+		return err
+	}
+
+	id := s.mu.RLock()
+	var headers []types.BlockHeader
+	var more bool
+	s.db.View(func(tx *bolt.Tx) error {
+		start, found := s.commonHeight(tx, knownBlocks)
+		if !found {
+			return nil
+		}
+		height := s.height(tx)
+		for i := start; i <= height && i < start+MaxCatchUpHeaders; i++ {
+			b, _ := s.blockAtHeight(tx, i)
+			headers = append(headers, b.Header())
+		}
+		more = start+MaxCatchUpHeaders <= height
+		return nil
+	})
+	s.mu.RUnlock(id)
+
+	err = encoding.WriteObject(conn, headers)
+	if err != nil {
+		return err
+	}
+	return encoding.WriteObject(conn, more)
+}
+
+// SendBlk returns the blocks in the block tree with the requested IDs, in the
+// order they were requested, stopping at the first block that is not in the
+// tree. At most 'MaxCatchUpBlocks' blocks can be requested.
+func (s *State) SendBlk(conn modules.PeerConn) error {
+	var ids []types.BlockID
+	err := encoding.ReadObject(conn, &ids, 8+MaxCatchUpBlocks*crypto.HashSize)
+	if err != nil {
+		return err
+	}
+
+	id := s.mu.RLock()
+	var blocks []types.Block
+	s.db.View(func(tx *bolt.Tx) error {
+		for _, bid := range ids {
+			bn, exists := getBlockNode(tx, bid)
+			if !exists {
+				break
+			}
+			blocks = append(blocks, bn.Block)
+		}
+		return nil
+	})
+	s.mu.RUnlock(id)
+
+	return encoding.WriteObject(conn, blocks)
+}
+
+// SyncStatus returns the progress of the most recent synchronization.
+func (s *State) SyncStatus() modules.SyncStatus {
+	id := s.mu.RLock()
+	defer s.mu.RUnlock(id)
+	return s.syncStatus
+}
+
 // SendBlocks returns a sequential set of blocks based on the 32 input block
 // IDs. The most recent known ID is used as the starting point, and up to
 // 'MaxCatchUpBlocks' from that BlockHeight onwards are returned. It also
@@ -95,16 +526,12 @@ func (s *State) SendBlocks(conn modules.PeerConn) error {
 
 	// Find the most recent block from knownBlocks that is in our current path.
 	id := s.mu.RLock()
-	found := false
+	var found bool
 	var start types.BlockHeight
-	for _, id := range knownBlocks {
-		bn, exists := s.blockMap[id]
-		if exists && bn.height <= s.height() && id == s.currentPath[bn.height] {
-			found = true
-			start = bn.height + 1 // start at child
-			break
-		}
-	}
+	s.db.View(func(tx *bolt.Tx) error {
+		start, found = s.commonHeight(tx, knownBlocks)
+		return nil
+	})
 	s.mu.RUnlock(id)
 
 	// If we didn't find any matching blocks, or if we're already
@@ -123,18 +550,22 @@ func (s *State) SendBlocks(conn modules.PeerConn) error {
 
 	// Fetch blocks to send.
 	id = s.mu.RLock()
-	height := s.height()
+	var height types.BlockHeight
 	var blocks []types.Block
-	for i := start; i <= height && i < start+MaxCatchUpBlocks; i++ {
-		node, exists := s.blockMap[s.currentPath[i]]
-		if !exists {
-			if build.DEBUG {
-				panic("blockMap is missing a block whose ID is in the currentPath")
+	s.db.View(func(tx *bolt.Tx) error {
+		height = s.height(tx)
+		for i := start; i <= height && i < start+MaxCatchUpBlocks; i++ {
+			b, exists := s.blockAtHeight(tx, i)
+			if !exists {
+				if build.DEBUG {
+					panic("block tree is missing a block whose ID is in the current path")
+				}
+				break
 			}
-			break
+			blocks = append(blocks, b)
 		}
-		blocks = append(blocks, node.block)
-	}
+		return nil
+	})
 	// Indicate whether more blocks are available.
 	more := start+MaxCatchUpBlocks < height
 	s.mu.RUnlock(id)
@@ -147,15 +578,32 @@ func (s *State) SendBlocks(conn modules.PeerConn) error {
 	return encoding.WriteObject(conn, more)
 }
 
+// commonHeight returns the height after the most recent block from
+// knownBlocks that is in the current path. If none of the blocks are in the
+// current path, found is false.
+func (s *State) commonHeight(tx *bolt.Tx, knownBlocks [32]types.BlockID) (start types.BlockHeight, found bool) {
+	for _, id := range knownBlocks {
+		bn, exists := getBlockNode(tx, id)
+		if !exists {
+			continue
+		}
+		if pid, exists := pathID(tx, bn.Height); exists && id == pid {
+			return bn.Height + 1, true // start at child
+		}
+	}
+	return 0, false
+}
+
 // blockHistory returns up to 32 BlockIDs, starting with the 12 most recent
-// BlockIDs and then doubling in step size until the genesis block is reached.
-// The genesis block is always included. This array of BlockIDs is used to
-// establish a shared commonality between peers during synchronization.
-func (s *State) blockHistory() (blockIDs [32]types.BlockID) {
+// ancestors of bn (including bn) and then doubling in step size until the
+// genesis block is reached. The genesis block is always included. This array
+// of BlockIDs is used to establish a shared commonality between peers during
+// synchronization.
+func (s *State) blockHistory(tx *bolt.Tx, bn *blockNode) (blockIDs [32]types.BlockID) {
 	knownBlocks := make([]types.BlockID, 0, 32)
 	step := types.BlockHeight(1)
-	for height := s.height(); ; height -= step {
-		knownBlocks = append(knownBlocks, s.currentPath[height])
+	for height := bn.Height; ; height -= step {
+		knownBlocks = append(knownBlocks, ancestor(tx, bn, bn.Height-height).Block.ID())
 
 		// after 12, start doubling
 		if len(knownBlocks) >= 12 {
@@ -169,7 +617,8 @@ func (s *State) blockHistory() (blockIDs [32]types.BlockID) {
 		}
 	}
 	// always include the genesis block
-	knownBlocks = append(knownBlocks, s.currentPath[0])
+	genesisID, _ := pathID(tx, 0)
+	knownBlocks = append(knownBlocks, genesisID)
 
 	copy(blockIDs[:], knownBlocks)
 	return
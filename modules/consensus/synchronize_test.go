@@ -0,0 +1,177 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/gateway"
+	"github.com/NebulousLabs/Sia/modules/tester"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSynchronize checks that a new State catches up to a peer, downloading
+// the blocks in several batches.
+func TestSynchronize(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	ct1 := NewTestingEnvironment("TestSynchronize1", t)
+	defer ct1.Close()
+	ct2 := NewTestingEnvironment("TestSynchronize2", t)
+	defer ct2.Close()
+	for i := 0; i < 2*MaxCatchUpBlocks+1; i++ {
+		ct1.MineAndApplyValidBlock()
+	}
+
+	err := ct2.gateway.Connect(ct1.gateway.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ct2.Synchronize(ct1.gateway.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct2.CurrentBlock().ID() != ct1.CurrentBlock().ID() {
+		t.Fatal("current blocks do not match after synchronize")
+	}
+	if ct2.StateHash() != ct1.StateHash() {
+		t.Fatal("consensus sets do not match after synchronize")
+	}
+
+	status := ct2.SyncStatus()
+	if status.Synchronizing {
+		t.Error("sync status reports an active synchronization")
+	}
+	if status.TargetHeight != ct1.Height() {
+		t.Errorf("sync status has target height %v, expected %v", status.TargetHeight, ct1.Height())
+	}
+	if status.BlocksDownloaded != uint64(ct1.Height()) {
+		t.Errorf("sync status has %v blocks downloaded, expected %v", status.BlocksDownloaded, ct1.Height())
+	}
+}
+
+// TestSynchronizePeer checks that only one synchronization with a peer that
+// relayed an orphan can be running or waiting at a time.
+func TestSynchronizePeer(t *testing.T) {
+	ct := NewTestingEnvironment("TestSynchronizePeer", t)
+	defer ct.Close()
+	pending := func() bool {
+		id := ct.mu.RLock()
+		defer ct.mu.RUnlock(id)
+		_, exists := ct.peerSyncs["foo:1"]
+		return exists
+	}
+
+	// Hold the sync lock so that the first synchronization waits.
+	ct.syncLock <- struct{}{}
+	go ct.threadedSynchronizePeer("foo:1")
+	for i := 0; !pending(); i++ {
+		if i == 100 {
+			t.Fatal("synchronization is not waiting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A second synchronization with the same peer returns immediately.
+	done := make(chan struct{})
+	go func() {
+		ct.threadedSynchronizePeer("foo:1")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("second synchronization waited for the sync lock")
+	}
+
+	// Once the first synchronization finishes, the peer can be synchronized
+	// with again.
+	<-ct.syncLock
+	for i := 0; pending(); i++ {
+		if i == 100 {
+			t.Fatal("synchronization did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestCheckHeaders probes the checkHeaders function of the State.
+func TestCheckHeaders(t *testing.T) {
+	ct := NewTestingEnvironment("TestCheckHeaders", t)
+	defer ct.Close()
+	b1 := ct.MineCurrentBlock(nil)
+	b2 := MineTestingBlock(b1.ID(), types.CurrentTimestamp(), ct.Payouts(ct.Height()+2, nil), nil, ct.CurrentTarget())
+
+	// A chain that starts at the current block is valid.
+	height, err := ct.checkHeaders([]types.BlockHeader{b1.Header(), b2.Header()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != ct.Height() {
+		t.Errorf("checkHeaders returned parent height %v, expected %v", height, ct.Height())
+	}
+
+	// Headers that are not a chain are invalid.
+	_, err = ct.checkHeaders([]types.BlockHeader{b2.Header(), b1.Header()})
+	if err != errBadHeaders {
+		t.Error("expected errBadHeaders for unchained headers, got", err)
+	}
+
+	// Headers that do not meet the target are invalid.
+	bad := b1.Header()
+	for bad.CheckTarget(ct.CurrentTarget()) {
+		bad.Nonce++
+	}
+	_, err = ct.checkHeaders([]types.BlockHeader{bad})
+	if err != errBadHeaders {
+		t.Error("expected errBadHeaders for a header that misses the target, got", err)
+	}
+
+	// Too many headers are invalid.
+	_, err = ct.checkHeaders(make([]types.BlockHeader, MaxCatchUpHeaders+1))
+	if err != errBadHeaders {
+		t.Error("expected errBadHeaders for too many headers, got", err)
+	}
+}
+
+// TestDownloadInvalidBlock checks that a peer that sends a block that matches
+// its header but is invalid is given strikes until it is banned.
+func TestDownloadInvalidBlock(t *testing.T) {
+	ct := NewTestingEnvironment("TestDownloadInvalidBlock", t)
+	defer ct.Close()
+	g, err := gateway.New(":0", "", tester.TempDir("consensus", "TestDownloadInvalidBlock", "peer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	// The block meets the target, but has no miner payouts.
+	bad := MineTestingBlock(ct.CurrentBlock().ID(), types.CurrentTimestamp(), nil, nil, ct.CurrentTarget())
+	g.RegisterRPC("SendBlk", func(conn modules.PeerConn) error {
+		var ids []types.BlockID
+		err := encoding.ReadObject(conn, &ids, MaxCatchUpBlocks*crypto.HashSize)
+		if err != nil {
+			return err
+		}
+		return encoding.WriteObject(conn, []types.Block{bad})
+	})
+	err = ct.gateway.Connect(g.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if ct.downloadBlocks(g.Address(), []types.BlockHeader{bad.Header()}) == nil {
+			t.Fatal("invalid block was accepted")
+		}
+	}
+	if len(ct.gateway.Peers()) != 0 {
+		t.Error("peer that sent invalid blocks was not disconnected")
+	}
+	if len(ct.gateway.Bans()) != 1 {
+		t.Error("peer that sent invalid blocks was not banned")
+	}
+}
@@ -1,9 +1,10 @@
 package consensus
 
 import (
-	"sort"
+	"github.com/boltdb/bolt"
 
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -14,24 +15,34 @@ func (ct *ConsensusTester) CurrentPathCheck() {
 	counter := ct.mu.RLock()
 	defer ct.mu.RUnlock(counter)
 
-	currentNode := ct.currentBlockNode()
-	for i := ct.Height(); i != 0; i-- {
-		// Check that the node has a corresponding entry in the blockMap
-		if _, exists := ct.blockMap[currentNode.block.ID()]; !exists {
-			ct.Error("currentPath has diverged from blockMap")
-		}
+	var errs []string
+	ct.db.View(func(tx *bolt.Tx) error {
+		currentNode := ct.currentBlockNode(tx)
+		for i := ct.height(tx); i != 0; i-- {
+			// Check that the CurrentPath entry contains the correct block ID.
+			id, _ := pathID(tx, i)
+			if currentNode.Block.ID() != id {
+				errs = append(errs, "current path does not have correct ID!")
+			}
 
-		// Check that the CurrentPath entry contains the correct block ID.
-		if currentNode.block.ID() != ct.currentPath[i] {
-			ct.Error("current path does not have correct ID!")
-		}
+			// Check that the node has a parent in the block tree.
+			parent, exists := parentNode(tx, currentNode)
+			if !exists {
+				errs = append(errs, "currentPath has diverged from blockMap")
+				return nil
+			}
 
-		// Check that the node's height is correct.
-		if currentNode.height != currentNode.parent.height+1 {
-			ct.Error("heights are messed up")
-		}
+			// Check that the node's height is correct.
+			if currentNode.Height != parent.Height+1 {
+				errs = append(errs, "heights are messed up")
+			}
 
-		currentNode = currentNode.parent
+			currentNode = parent
+		}
+		return nil
+	})
+	for _, err := range errs {
+		ct.Error(err)
 	}
 }
 
@@ -42,11 +53,18 @@ func (ct *ConsensusTester) RewindApplyCheck() {
 	counter := ct.mu.Lock()
 	defer ct.mu.Unlock(counter)
 
-	csh := ct.consensusSetHash()
-	cn := ct.currentBlockNode()
-	ct.revertToNode(ct.blockRoot)
-	ct.applyUntilNode(cn)
-	if csh != ct.consensusSetHash() {
+	var consistent bool
+	ct.db.Update(func(tx *bolt.Tx) error {
+		csh := ct.consensusSetHash(tx)
+		cn := ct.currentBlockNode(tx)
+		genesisID, _ := pathID(tx, 0)
+		genesisNode, _ := getBlockNode(tx, genesisID)
+		ct.revertToNode(tx, genesisNode)
+		ct.applyUntilNode(tx, cn)
+		consistent = csh == ct.consensusSetHash(tx)
+		return nil
+	})
+	if !consistent {
 		ct.Error("state hash is not consistent after rewinding and applying all the way through")
 	}
 }
@@ -58,31 +76,44 @@ func (ct *ConsensusTester) CurrencyCheck() {
 	counter := ct.mu.RLock()
 	defer ct.mu.RUnlock(counter)
 
-	siafunds := types.NewCurrency64(0)
-	for _, siafundOutput := range ct.siafundOutputs {
-		siafunds = siafunds.Add(siafundOutput.Value)
-	}
-	if siafunds.Cmp(types.NewCurrency64(types.SiafundCount)) != 0 {
-		ct.Error("siafunds inconsistency")
-	}
-
-	expectedSiacoins := types.NewCurrency64(0)
-	for i := types.BlockHeight(0); i <= ct.Height(); i++ {
-		expectedSiacoins = expectedSiacoins.Add(types.CalculateCoinbase(i))
-	}
-	siacoins := ct.siafundPool
-	for _, output := range ct.siacoinOutputs {
-		siacoins = siacoins.Add(output.Value)
-	}
-	for _, contract := range ct.fileContracts {
-		siacoins = siacoins.Add(contract.Payout)
-	}
-	for height, dsoMap := range ct.delayedSiacoinOutputs {
-		if height+types.MaturityDelay > ct.Height() {
-			for _, dso := range dsoMap {
-				siacoins = siacoins.Add(dso.Value)
+	var siafunds, siacoins, expectedSiacoins types.Currency
+	ct.db.View(func(tx *bolt.Tx) error {
+		tx.Bucket(bucketSiafundOutputs).ForEach(func(_, value []byte) error {
+			var sfo types.SiafundOutput
+			persist.MustUnmarshal(value, &sfo)
+			siafunds = siafunds.Add(sfo.Value)
+			return nil
+		})
+
+		height := ct.height(tx)
+		for i := types.BlockHeight(0); i <= height; i++ {
+			expectedSiacoins = expectedSiacoins.Add(types.CalculateCoinbase(i))
+		}
+		siacoins = getSiafundPool(tx)
+		tx.Bucket(bucketSiacoinOutputs).ForEach(func(_, value []byte) error {
+			var sco types.SiacoinOutput
+			persist.MustUnmarshal(value, &sco)
+			siacoins = siacoins.Add(sco.Value)
+			return nil
+		})
+		tx.Bucket(bucketFileContracts).ForEach(func(_, value []byte) error {
+			var fc types.FileContract
+			persist.MustUnmarshal(value, &fc)
+			siacoins = siacoins.Add(fc.Payout)
+			return nil
+		})
+		for i := types.BlockHeight(0); i <= height; i++ {
+			if i+types.MaturityDelay > height {
+				for _, dsco := range delayedSiacoinOutputs(tx, i) {
+					siacoins = siacoins.Add(dsco.SiacoinOutput.Value)
+				}
 			}
 		}
+		return nil
+	})
+
+	if siafunds.Cmp(types.NewCurrency64(types.SiafundCount)) != 0 {
+		ct.Error("siafunds inconsistency")
 	}
 	if siacoins.Cmp(expectedSiacoins) != 0 {
 		ct.Error(siacoins.String())
@@ -100,7 +131,7 @@ func (ct *ConsensusTester) ConsistencyChecks() {
 }
 
 // stateHash returns the Merkle root of the current state of consensus.
-func (s *State) consensusSetHash() crypto.Hash {
+func (s *State) consensusSetHash(tx *bolt.Tx) crypto.Hash {
 	// Items of interest:
 	// 1.	genesis block
 	// 2.	current block id
@@ -113,63 +144,68 @@ func (s *State) consensusSetHash() crypto.Hash {
 	// 9.	open file contracts, sorted by id.
 	// 10.	unspent siafund outputs, sorted by id.
 	// 11.	delayed siacoin outputs, sorted by height, then sorted by id.
+	//
+	// The database keeps each set sorted by id, and the delayed siacoin
+	// outputs sorted by height.
 
 	// Create a slice of hashes representing all items of interest.
 	tree := crypto.NewTree()
-	tree.PushObject(s.blockRoot.block)
-	tree.PushObject(s.height())
-	tree.PushObject(s.currentBlockNode().target)
-	tree.PushObject(s.currentBlockNode().depth)
-	tree.PushObject(s.currentBlockNode().earliestChildTimestamp())
+	genesisBlock, _ := s.blockAtHeight(tx, 0)
+	currentNode := s.currentBlockNode(tx)
+	tree.PushObject(genesisBlock)
+	tree.PushObject(s.height(tx))
+	tree.PushObject(currentNode.Target)
+	tree.PushObject(currentNode.Depth)
+	tree.PushObject(currentNode.earliestChildTimestamp(tx))
 
 	// Add all the blocks in the current path.
-	for i := 0; i < len(s.currentPath); i++ {
-		tree.PushObject(s.currentPath[types.BlockHeight(i)])
-	}
-
-	// Get the set of siacoin outputs in sorted order and add them.
-	sortedUscos := s.sortedUscoSet()
-	for _, output := range sortedUscos {
-		tree.PushObject(output)
-	}
-
-	// Sort the open contracts by ID.
-	var openContracts crypto.HashSlice
-	for contractID := range s.fileContracts {
-		openContracts = append(openContracts, crypto.Hash(contractID))
-	}
-	sort.Sort(openContracts)
-
-	// Add the open contracts in sorted order.
-	for _, id := range openContracts {
+	tx.Bucket(bucketBlockPath).ForEach(func(_, id []byte) error {
 		tree.PushObject(id)
-	}
-
-	// Get the set of siafund outputs in sorted order and add them.
-	for _, output := range s.sortedUsfoSet() {
-		tree.PushObject(output)
-	}
-
-	// Get the set of delayed siacoin outputs, sorted by maturity height then
-	// sorted by id and add them.
-	for i := types.BlockHeight(0); i <= s.height(); i++ {
-		var delayedOutputs crypto.HashSlice
-		for id := range s.delayedSiacoinOutputs[i] {
-			delayedOutputs = append(delayedOutputs, crypto.Hash(id))
-		}
-		sort.Sort(delayedOutputs)
-
-		for _, output := range delayedOutputs {
-			tree.PushObject(output)
-		}
-	}
+		return nil
+	})
+
+	// Add the siacoin outputs in sorted order.
+	tx.Bucket(bucketSiacoinOutputs).ForEach(func(_, value []byte) error {
+		var sco types.SiacoinOutput
+		persist.MustUnmarshal(value, &sco)
+		tree.PushObject(sco)
+		return nil
+	})
+
+	// Add the IDs of the open contracts in sorted order.
+	tx.Bucket(bucketFileContracts).ForEach(func(id, _ []byte) error {
+		tree.PushObject(id)
+		return nil
+	})
+
+	// Add the siafund outputs in sorted order.
+	tx.Bucket(bucketSiafundOutputs).ForEach(func(_, value []byte) error {
+		var sfo types.SiafundOutput
+		persist.MustUnmarshal(value, &sfo)
+		tree.PushObject(sfo)
+		return nil
+	})
+
+	// Add the IDs of the delayed siacoin outputs, sorted by height and then
+	// by ID.
+	tx.Bucket(bucketDelayedSiacoinOutputs).ForEach(func(height, _ []byte) error {
+		tx.Bucket(bucketDelayedSiacoinOutputs).Bucket(height).ForEach(func(id, _ []byte) error {
+			tree.PushObject(id)
+			return nil
+		})
+		return nil
+	})
 
 	return tree.Root()
 }
 
 // StateHash returns the markle root of the current state of consensus.
-func (s *State) StateHash() crypto.Hash {
+func (s *State) StateHash() (hash crypto.Hash) {
 	counter := s.mu.RLock()
 	defer s.mu.RUnlock(counter)
-	return s.consensusSetHash()
+	s.db.View(func(tx *bolt.Tx) error {
+		hash = s.consensusSetHash(tx)
+		return nil
+	})
+	return
 }
@@ -4,6 +4,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
@@ -105,8 +107,10 @@ func (ct *ConsensusTester) RewindABlock() {
 	counter := ct.mu.Lock()
 	defer ct.mu.Unlock(counter)
 
-	bn := ct.currentBlockNode()
-	ct.commitDiffSet(bn, modules.DiffRevert)
+	ct.db.Update(func(tx *bolt.Tx) error {
+		ct.commitDiffSet(tx, ct.currentBlockNode(tx), modules.DiffRevert)
+		return nil
+	})
 }
 
 // NewConsensusTester returns an assistant that's ready to help with testing.
@@ -142,7 +146,7 @@ func NewConsensusTester(t *testing.T, s *State) (ct *ConsensusTester) {
 func NewTestingEnvironment(name string, t *testing.T) (ct *ConsensusTester) {
 	// Get the state and assistant.
 	testdir := tester.TempDir("consensus", name)
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", "", filepath.Join(testdir, modules.GatewayDir))
 	s, err := New(g, filepath.Join(testdir, modules.ConsensusDir))
 	if err != nil {
 		t.Fatal(err)
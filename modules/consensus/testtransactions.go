@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"crypto/rand"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/persist"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -12,8 +15,18 @@ import (
 // to spend, as well as the value of the input. There is no guarantee on the
 // value, it could be anything.
 func (ct *ConsensusTester) FindSpendableSiacoinInput() (sci types.SiacoinInput, value types.Currency) {
-	for id, output := range ct.siacoinOutputs {
-		if output.UnlockHash == ct.UnlockHash {
+	var found bool
+	ct.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketSiacoinOutputs).Cursor()
+		for key, encOutput := c.First(); key != nil; key, encOutput = c.Next() {
+			var id types.SiacoinOutputID
+			var output types.SiacoinOutput
+			copy(id[:], key)
+			persist.MustUnmarshal(encOutput, &output)
+			if output.UnlockHash != ct.UnlockHash {
+				continue
+			}
+
 			// Check that we haven't already spent this input.
 			_, exists := ct.usedOutputs[id]
 			if exists {
@@ -28,12 +41,15 @@ func (ct *ConsensusTester) FindSpendableSiacoinInput() (sci types.SiacoinInput,
 
 			// Mark the input as spent.
 			ct.usedOutputs[id] = struct{}{}
-
-			return
+			found = true
+			return nil
 		}
-	}
+		return nil
+	})
 
-	ct.Fatal("could not find a spendable siacoin input")
+	if !found {
+		ct.Fatal("could not find a spendable siacoin input")
+	}
 	return
 }
 
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"math/big"
 
+	"github.com/boltdb/bolt"
+
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -16,11 +18,11 @@ var (
 
 // validSiacoins checks that the siacoin inputs and outputs are valid in the
 // context of the current consensus set.
-func (s *State) validSiacoins(t types.Transaction) (err error) {
+func (s *State) validSiacoins(tx *bolt.Tx, t types.Transaction) (err error) {
 	var inputSum types.Currency
 	for _, sci := range t.SiacoinInputs {
 		// Check that the input spends an existing output.
-		sco, exists := s.siacoinOutputs[sci.ParentID]
+		sco, exists := getSiacoinOutput(tx, sci.ParentID)
 		if !exists {
 			return ErrMissingSiacoinOutput
 		}
@@ -40,9 +42,9 @@ func (s *State) validSiacoins(t types.Transaction) (err error) {
 
 // storageProofSegment returns the index of the segment that needs to be proven
 // exists in a file contract.
-func (s *State) storageProofSegment(fcid types.FileContractID) (index uint64, err error) {
+func (s *State) storageProofSegment(tx *bolt.Tx, fcid types.FileContractID) (index uint64, err error) {
 	// Get the file contract associated with the input id.
-	fc, exists := s.fileContracts[fcid]
+	fc, exists := getFileContract(tx, fcid)
 	if !exists {
 		err = errors.New("unrecognized file contract id")
 		return
@@ -50,11 +52,11 @@ func (s *State) storageProofSegment(fcid types.FileContractID) (index uint64, er
 
 	// Get the ID of the trigger block.
 	triggerHeight := fc.WindowStart - 1
-	if triggerHeight > s.height() {
+	triggerID, exists := pathID(tx, triggerHeight)
+	if !exists {
 		err = errors.New("no block found at contract trigger block height")
 		return
 	}
-	triggerID := s.currentPath[triggerHeight]
 
 	// Get the index by appending the file contract ID to the trigger block and
 	// taking the hash, then converting the hash to a numerical value and
@@ -73,27 +75,20 @@ func (s *State) storageProofSegment(fcid types.FileContractID) (index uint64, er
 
 // validStorageProofs checks that the storage proofs are valid in the context
 // of the consensus set.
-func (s *State) validStorageProofs(t types.Transaction) error {
+func (s *State) validStorageProofs(tx *bolt.Tx, t types.Transaction) error {
 	for _, sp := range t.StorageProofs {
-		fc, exists := s.fileContracts[sp.ParentID]
+		fc, exists := getFileContract(tx, sp.ParentID)
 		if !exists {
 			return errors.New("unrecognized file contract ID in storage proof")
 		}
 
 		// Check that the storage proof itself is valid.
-		segmentIndex, err := s.storageProofSegment(sp.ParentID)
+		segmentIndex, err := s.storageProofSegment(tx, sp.ParentID)
 		if err != nil {
 			return err
 		}
 
-		verified := crypto.VerifySegment(
-			sp.Segment,
-			sp.HashSet,
-			crypto.CalculateSegments(fc.FileSize),
-			segmentIndex,
-			fc.FileMerkleRoot,
-		)
-		if !verified {
+		if !types.VerifyStorageProof(sp, fc, segmentIndex) {
 			return errors.New("provided storage proof is invalid")
 		}
 	}
@@ -103,10 +98,10 @@ func (s *State) validStorageProofs(t types.Transaction) error {
 
 // validFileContractRevision checks that each file contract revision is valid
 // in the context of the current consensus set.
-func (s *State) validFileContractRevisions(t types.Transaction) (err error) {
+func (s *State) validFileContractRevisions(tx *bolt.Tx, t types.Transaction) (err error) {
 	for _, fcr := range t.FileContractRevisions {
 		// Check that the revision revises an existing contract.
-		fc, exists := s.fileContracts[fcr.ParentID]
+		fc, exists := getFileContract(tx, fcr.ParentID)
 		if !exists {
 			return ErrMissingFileContract
 		}
@@ -114,7 +109,7 @@ func (s *State) validFileContractRevisions(t types.Transaction) (err error) {
 		// Check that the height is less than fc.WindowStart - revisions are
 		// not allowed to be submitted once the storage proof window has
 		// opened.  This reduces complexity for unconfirmed transactions.
-		if s.height() > fc.WindowStart {
+		if s.height(tx) > fc.WindowStart {
 			return errors.New("contract revision submitted too late")
 		}
 
@@ -148,12 +143,12 @@ func (s *State) validFileContractRevisions(t types.Transaction) (err error) {
 
 // validSiafunds checks that the siafund portions of the transaction are valid
 // in the context of the consensus set.
-func (s *State) validSiafunds(t types.Transaction) (err error) {
+func (s *State) validSiafunds(tx *bolt.Tx, t types.Transaction) (err error) {
 	// Compare the number of input siafunds to the output siafunds.
 	var siafundInputSum types.Currency
 	var siafundOutputSum types.Currency
 	for _, sfi := range t.SiafundInputs {
-		sfo, exists := s.siafundOutputs[sfi.ParentID]
+		sfo, exists := getSiafundOutput(tx, sfi.ParentID)
 		if !exists {
 			return ErrMissingSiafundOutput
 		}
@@ -176,29 +171,29 @@ func (s *State) validSiafunds(t types.Transaction) (err error) {
 
 // validTransaction checks that all fields are valid within the current
 // consensus state. If not an error is returned.
-func (s *State) validTransaction(t types.Transaction) (err error) {
+func (s *State) validTransaction(tx *bolt.Tx, t types.Transaction) (err error) {
 	// StandaloneValid will check things like signatures and properties that
 	// should be inherent to the transaction. (storage proof rules, etc.)
-	err = t.StandaloneValid(s.height())
+	err = t.StandaloneValid(s.height(tx))
 	if err != nil {
 		return
 	}
 
 	// Check that each portion of the transaction is legal given the current
 	// consensus set.
-	err = s.validSiacoins(t)
+	err = s.validSiacoins(tx, t)
 	if err != nil {
 		return
 	}
-	err = s.validFileContractRevisions(t)
+	err = s.validFileContractRevisions(tx, t)
 	if err != nil {
 		return
 	}
-	err = s.validStorageProofs(t)
+	err = s.validStorageProofs(tx, t)
 	if err != nil {
 		return
 	}
-	err = s.validSiafunds(t)
+	err = s.validSiafunds(tx, t)
 	if err != nil {
 		return
 	}
@@ -211,5 +206,7 @@ func (s *State) validTransaction(t types.Transaction) (err error) {
 func (s *State) ValidStorageProofs(t types.Transaction) (err error) {
 	id := s.mu.RLock()
 	defer s.mu.RUnlock(id)
-	return s.validStorageProofs(t)
+	return s.db.View(func(tx *bolt.Tx) error {
+		return s.validStorageProofs(tx, t)
+	})
 }
@@ -0,0 +1,87 @@
+package consensus
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// verify.go checks the signatures and storage proofs of a block across all
+// CPU cores before the block is processed. Validating a block happens while
+// the State is locked, and checks one transaction at a time. The expensive
+// cryptography is done beforehand, and successful results are stored in the
+// verification caches of the types package, so the checks made while the
+// State is locked find their results in the caches. The caches are shared
+// with the transaction pool, so transactions that were verified when they
+// entered the pool are not verified again.
+
+// A storageProofCheck is a storage proof along with the context needed to
+// verify it.
+type storageProofCheck struct {
+	proof        types.StorageProof
+	contract     types.FileContract
+	segmentIndex uint64
+}
+
+// verifyBlock verifies the signatures and storage proofs of a block in
+// parallel. Failed verifications are not reported; they are found again when
+// the block is validated. Only blocks that meet the target of a known parent
+// are verified, so that blocks without work cannot be used to waste CPU time.
+func (s *State) verifyBlock(b types.Block) {
+	var checks []storageProofCheck
+	var meetsTarget bool
+	id := s.mu.RLock()
+	s.db.View(func(tx *bolt.Tx) error {
+		parent, exists := getBlockNode(tx, b.ParentID)
+		if !exists || !b.CheckTarget(parent.Target) {
+			return nil
+		}
+		meetsTarget = true
+
+		// The storage proofs are checked against the current path, which is
+		// where the block will be validated unless it causes a reorg.
+		for _, txn := range b.Transactions {
+			for _, sp := range txn.StorageProofs {
+				fc, exists := getFileContract(tx, sp.ParentID)
+				if !exists {
+					continue
+				}
+				segmentIndex, err := s.storageProofSegment(tx, sp.ParentID)
+				if err != nil {
+					continue
+				}
+				checks = append(checks, storageProofCheck{sp, fc, segmentIndex})
+			}
+		}
+		return nil
+	})
+	s.mu.RUnlock(id)
+	if !meetsTarget {
+		return
+	}
+
+	jobs := make(chan func())
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				job()
+			}
+		}()
+	}
+	for _, txn := range b.Transactions {
+		txn := txn
+		jobs <- func() { txn.VerifySignatures() }
+	}
+	for _, check := range checks {
+		check := check
+		jobs <- func() { types.VerifyStorageProof(check.proof, check.contract, check.segmentIndex) }
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,81 @@
+package modules
+
+import (
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	ExplorerDir = "explorer"
+)
+
+// An ExplorerBlock is a block in the current path, along with its height and
+// the target that it had to meet.
+type ExplorerBlock struct {
+	Block  types.Block
+	ID     types.BlockID
+	Height types.BlockHeight
+	Target types.Target
+}
+
+// An ExplorerTransaction is a transaction in the current path, along with the
+// block that contains it.
+type ExplorerTransaction struct {
+	Transaction types.Transaction
+	ID          crypto.Hash
+	BlockID     types.BlockID
+	Height      types.BlockHeight
+}
+
+// An ExplorerAddress lists the activity of an unlock hash in the current path.
+// Transactions holds the IDs of the transactions that spend from or send to
+// the unlock hash, and Blocks holds the IDs of the blocks that pay miner
+// payouts to it, both ordered by height. SiacoinOutputs and SiafundOutputs
+// hold the IDs of its unspent outputs.
+type ExplorerAddress struct {
+	Transactions   []crypto.Hash
+	Blocks         []types.BlockID
+	SiacoinOutputs []types.SiacoinOutputID
+	SiafundOutputs []types.SiafundOutputID
+}
+
+// ExplorerStatistics are statistics about the current path.
+type ExplorerStatistics struct {
+	Height       types.BlockHeight
+	CurrentBlock types.BlockID
+	Target       types.Target
+
+	// TotalCoins is the number of siacoins created by miner subsidies.
+	TotalCoins  types.Currency
+	SiafundPool types.Currency
+
+	TransactionCount     uint64
+	ActiveContractCount  uint64
+	ActiveContractCost   types.Currency
+	ActiveContractSize   uint64
+	SiacoinOutputCount   uint64
+	SiafundOutputCount   uint64
+	UniqueAddressesCount uint64
+}
+
+// The Explorer indexes the current path of the consensus set, so that blocks,
+// transactions, and addresses can be looked up.
+type Explorer interface {
+	// Block returns the block with the given ID, if it is in the current
+	// path.
+	Block(types.BlockID) (ExplorerBlock, bool)
+
+	// Transaction returns the transaction with the given ID, if it is in
+	// the current path.
+	Transaction(crypto.Hash) (ExplorerTransaction, bool)
+
+	// Address returns the activity of an unlock hash in the current path.
+	Address(types.UnlockHash) ExplorerAddress
+
+	// Statistics returns statistics about the current path.
+	Statistics() ExplorerStatistics
+
+	// Targets returns the targets of the blocks in the current path from
+	// height start to height end, inclusive.
+	Targets(start, end types.BlockHeight) []types.Target
+}
@@ -0,0 +1,241 @@
+package explorer
+
+// database.go contains the functions that read and write the index of the
+// explorer, which is stored in a Bolt database. Blocks are not stored in the
+// index; they are read from the consensus set, which holds every block. Each
+// consensus change is written in a single database transaction, so the index
+// on disk always matches the last change that the explorer processed.
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// dbFilename is the name of the explorer database.
+	dbFilename = "explorer.db"
+)
+
+var (
+	// bucketBlockPath maps each height to the pathEntry of the block at that
+	// height in the current path, and bucketBlockHeights maps the ID of each
+	// block in the current path to its height.
+	bucketBlockPath    = []byte("BlockPath")
+	bucketBlockHeights = []byte("BlockHeights")
+
+	// bucketTransactions maps the ID of each transaction in the current path
+	// to its txnLocation.
+	bucketTransactions = []byte("Transactions")
+
+	// bucketAddresses holds a bucket for each unlock hash with activity in
+	// the current path, which holds the nested buckets below. The activity is
+	// stored in the keys of the nested buckets, and the values are empty, so
+	// that adding or removing activity does not rewrite the rest of it.
+	// bucketAddressTransactions and bucketAddressBlocks are keyed by an
+	// addressKey, and
+	// bucketAddressSiacoinOutputs and bucketAddressSiafundOutputs are keyed
+	// by the IDs of unspent outputs.
+	bucketAddresses             = []byte("Addresses")
+	bucketAddressTransactions   = []byte("Transactions")
+	bucketAddressBlocks         = []byte("Blocks")
+	bucketAddressSiacoinOutputs = []byte("SiacoinOutputs")
+	bucketAddressSiafundOutputs = []byte("SiafundOutputs")
+
+	// bucketStatistics holds the dbStatistics of the current path.
+	bucketStatistics = []byte("Statistics")
+	keyStatistics    = []byte("Statistics")
+
+	buckets = [][]byte{
+		bucketBlockPath,
+		bucketBlockHeights,
+		bucketTransactions,
+		bucketAddresses,
+		bucketStatistics,
+	}
+	addressBuckets = [][]byte{
+		bucketAddressTransactions,
+		bucketAddressBlocks,
+		bucketAddressSiacoinOutputs,
+		bucketAddressSiafundOutputs,
+	}
+)
+
+// A pathEntry is a block in the current path, along with the target that it
+// had to meet.
+type pathEntry struct {
+	ID     types.BlockID
+	Target types.Target
+}
+
+// A txnLocation is the position of a transaction in the current path.
+type txnLocation struct {
+	Height types.BlockHeight
+	Index  uint64
+}
+
+// An addressEntry holds the activity of an unlock hash in the current path, as
+// it is read from the nested buckets of the unlock hash.
+type addressEntry struct {
+	Transactions   []crypto.Hash
+	Blocks         []types.BlockID
+	SiacoinOutputs []types.SiacoinOutputID
+	SiafundOutputs []types.SiafundOutputID
+}
+
+// dbStatistics are the statistics of the current path that are kept up to
+// date as blocks are applied and reverted, along with the ID of the last
+// consensus change that was processed.
+type dbStatistics struct {
+	LastChange modules.ConsensusChangeID
+
+	TotalCoins         types.Currency
+	SiafundPool        types.Currency
+	ActiveContractCost types.Currency
+
+	TransactionCount     uint64
+	ActiveContractCount  uint64
+	ActiveContractSize   uint64
+	SiacoinOutputCount   uint64
+	SiafundOutputCount   uint64
+	UniqueAddressesCount uint64
+}
+
+// openDB opens the explorer database at filename, creating it if it does not
+// exist.
+func openDB(filename string) (*bolt.DB, error) {
+	db, err := bolt.Open(filename, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	db.NoSync = build.Release == "testing"
+	return db, nil
+}
+
+// initDB creates the buckets of an empty database.
+func initDB(tx *bolt.Tx) error {
+	for _, bucket := range buckets {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetDB removes the whole index from the database.
+func resetDB(tx *bolt.Tx) error {
+	for _, bucket := range buckets {
+		err := tx.DeleteBucket(bucket)
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	return initDB(tx)
+}
+
+// pathLength returns the number of blocks in the current path.
+func pathLength(tx *bolt.Tx) types.BlockHeight {
+	key, _ := tx.Bucket(bucketBlockPath).Cursor().Last()
+	if key == nil {
+		return 0
+	}
+	return types.BlockHeight(binary.BigEndian.Uint64(key)) + 1
+}
+
+// getPathEntry returns the pathEntry of the block at a height in the current
+// path.
+func getPathEntry(tx *bolt.Tx, height types.BlockHeight) (pe pathEntry, exists bool) {
+	value := tx.Bucket(bucketBlockPath).Get(persist.HeightKey(height))
+	if value == nil {
+		return pe, false
+	}
+	persist.MustUnmarshal(value, &pe)
+	return pe, true
+}
+
+// getBlockHeight returns the height of a block in the current path.
+func getBlockHeight(tx *bolt.Tx, id types.BlockID) (height types.BlockHeight, exists bool) {
+	value := tx.Bucket(bucketBlockHeights).Get(id[:])
+	if value == nil {
+		return 0, false
+	}
+	return types.BlockHeight(binary.BigEndian.Uint64(value)), true
+}
+
+// getTxnLocation returns the location of a transaction in the current path.
+func getTxnLocation(tx *bolt.Tx, id crypto.Hash) (loc txnLocation, exists bool) {
+	value := tx.Bucket(bucketTransactions).Get(id[:])
+	if value == nil {
+		return loc, false
+	}
+	persist.MustUnmarshal(value, &loc)
+	return loc, true
+}
+
+// addressKey returns the key of a transaction or block in the nested buckets
+// of an unlock hash, which is the height of the block, the index of the
+// transaction in the block, and the ID. The keys of an unlock hash are sorted
+// in the order that they appear in the current path.
+func addressKey(height types.BlockHeight, index uint64, id []byte) []byte {
+	key := make([]byte, 16, 16+len(id))
+	binary.BigEndian.PutUint64(key[:8], uint64(height))
+	binary.BigEndian.PutUint64(key[8:], index)
+	return append(key, id...)
+}
+
+// getAddress returns the entry of an unlock hash, which is empty if the
+// unlock hash has no activity.
+func getAddress(tx *bolt.Tx, uh types.UnlockHash) (entry addressEntry) {
+	b := tx.Bucket(bucketAddresses).Bucket(uh[:])
+	if b == nil {
+		return
+	}
+	b.Bucket(bucketAddressTransactions).ForEach(func(key, _ []byte) error {
+		var id crypto.Hash
+		copy(id[:], key[16:])
+		entry.Transactions = append(entry.Transactions, id)
+		return nil
+	})
+	b.Bucket(bucketAddressBlocks).ForEach(func(key, _ []byte) error {
+		var id types.BlockID
+		copy(id[:], key[16:])
+		entry.Blocks = append(entry.Blocks, id)
+		return nil
+	})
+	b.Bucket(bucketAddressSiacoinOutputs).ForEach(func(key, _ []byte) error {
+		var id types.SiacoinOutputID
+		copy(id[:], key)
+		entry.SiacoinOutputs = append(entry.SiacoinOutputs, id)
+		return nil
+	})
+	b.Bucket(bucketAddressSiafundOutputs).ForEach(func(key, _ []byte) error {
+		var id types.SiafundOutputID
+		copy(id[:], key)
+		entry.SiafundOutputs = append(entry.SiafundOutputs, id)
+		return nil
+	})
+	return
+}
+
+// getStatistics returns the statistics of the current path.
+func getStatistics(tx *bolt.Tx) (stats dbStatistics) {
+	value := tx.Bucket(bucketStatistics).Get(keyStatistics)
+	if value != nil {
+		persist.MustUnmarshal(value, &stats)
+	}
+	return
+}
+
+// putStatistics stores the statistics of the current path.
+func putStatistics(tx *bolt.Tx, stats dbStatistics) {
+	persist.MustPut(tx.Bucket(bucketStatistics), keyStatistics, encoding.Marshal(stats))
+}
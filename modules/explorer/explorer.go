@@ -0,0 +1,96 @@
+// package explorer provides an Explorer object that implements the
+// modules.Explorer interface. The explorer subscribes to the consensus set and
+// indexes the blocks, transactions, outputs, file contracts, and addresses of
+// the current path, so that historical chain data can be looked up.
+package explorer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/consensus"
+)
+
+var (
+	ErrNilConsensusSet = errors.New("explorer cannot use a nil consensus set")
+)
+
+// The Explorer indexes the current path of the consensus set. The index is
+// stored in a database, and blocks are read from the consensus set, so little
+// is kept in memory. On startup, the Explorer resumes from the last consensus
+// change that it processed.
+type Explorer struct {
+	cs *consensus.State
+	db *bolt.DB
+}
+
+// New creates an Explorer that indexes the consensus set, storing the index
+// in saveDir.
+func New(cs *consensus.State, saveDir string) (*Explorer, error) {
+	if cs == nil {
+		return nil, ErrNilConsensusSet
+	}
+
+	err := os.MkdirAll(saveDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openDB(filepath.Join(saveDir, dbFilename))
+	if err != nil {
+		return nil, err
+	}
+	e := &Explorer{
+		cs: cs,
+		db: db,
+	}
+
+	// A new index starts with the genesis block, which is not part of any
+	// consensus change.
+	var lastChange modules.ConsensusChangeID
+	err = e.db.Update(func(tx *bolt.Tx) error {
+		err := initDB(tx)
+		if err != nil {
+			return err
+		}
+		if pathLength(tx) == 0 {
+			e.update(tx, consensus.GenesisChange())
+		}
+		lastChange = getStatistics(tx).LastChange
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	err = cs.ConsensusSetSubscribe(e, lastChange)
+	if err == modules.ErrInvalidConsensusChangeID {
+		// The consensus set does not know the last change that the explorer
+		// processed, so the index is rebuilt from the beginning.
+		err = e.db.Update(func(tx *bolt.Tx) error {
+			err := resetDB(tx)
+			if err != nil {
+				return err
+			}
+			e.update(tx, consensus.GenesisChange())
+			return nil
+		})
+		if err == nil {
+			err = cs.ConsensusSetSubscribe(e, modules.ConsensusChangeBeginning)
+		}
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Close closes the explorer database.
+func (e *Explorer) Close() error {
+	return e.db.Close()
+}
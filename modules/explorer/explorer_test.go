@@ -0,0 +1,146 @@
+package explorer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules/consensus"
+	"github.com/NebulousLabs/Sia/modules/tester"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// waitForHeight blocks until the explorer has indexed the current path of the
+// consensus set.
+func waitForHeight(e *Explorer, ct *consensus.ConsensusTester, t *testing.T) {
+	for i := 0; e.Statistics().CurrentBlock != ct.CurrentBlock().ID(); i++ {
+		if i == 100 {
+			t.Fatal("explorer did not index the current path")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestExplorer checks that the explorer indexes blocks, transactions,
+// addresses, and file contracts, and removes them when they are reverted.
+func TestExplorer(t *testing.T) {
+	ct := consensus.NewTestingEnvironment("TestExplorer", t)
+	defer ct.Close()
+	e, err := New(ct.State, tester.TempDir("explorer", "TestExplorer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	parent := ct.CurrentBlock()
+	txn := ct.SiacoinOutputTransaction()
+	fcTxn, _ := ct.FileContractTransaction(ct.Height()+2, ct.Height()+3)
+	b := ct.MineCurrentBlock([]types.Transaction{txn, fcTxn})
+	err = ct.AcceptBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForHeight(e, ct, t)
+
+	eb, exists := e.Block(b.ID())
+	if !exists || eb.Height != ct.Height() {
+		t.Fatal("block was not indexed at the correct height")
+	}
+	et, exists := e.Transaction(txn.ID())
+	if !exists || et.BlockID != b.ID() || et.Height != ct.Height() {
+		t.Fatal("transaction was not indexed in the correct block")
+	}
+	ea := e.Address(ct.UnlockHash)
+	if len(ea.Transactions) != 2 || ea.Transactions[0] != txn.ID() {
+		t.Error("transactions were not indexed by address")
+	}
+	if len(ea.Blocks) != int(ct.Height()) || ea.Blocks[len(ea.Blocks)-1] != b.ID() {
+		t.Error("miner payouts were not indexed by address")
+	}
+	if len(ea.SiacoinOutputs) == 0 {
+		t.Error("unspent outputs were not indexed by address")
+	}
+
+	stats := e.Statistics()
+	var totalCoins types.Currency
+	for i := types.BlockHeight(0); i <= ct.Height(); i++ {
+		totalCoins = totalCoins.Add(types.CalculateCoinbase(i))
+	}
+	if stats.TotalCoins.Cmp(totalCoins) != 0 {
+		t.Errorf("explorer reports %v total coins, expected %v", stats.TotalCoins, totalCoins)
+	}
+	if stats.ActiveContractCount != 1 || stats.ActiveContractSize != fcTxn.FileContracts[0].FileSize {
+		t.Error("file contract was not indexed")
+	}
+	if targets := e.Targets(0, ct.Height()); len(targets) != int(ct.Height())+1 || targets[ct.Height()] != eb.Target {
+		t.Error("targets were not indexed")
+	}
+
+	// Replace the block with a heavier fork, which reverts the transactions.
+	target, _ := ct.ChildTarget(parent.ID())
+	f1 := consensus.MineTestingBlock(parent.ID(), types.CurrentTimestamp(), ct.Payouts(ct.Height(), nil), nil, target)
+	err = ct.AcceptBlock(f1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _ = ct.ChildTarget(f1.ID())
+	f2 := consensus.MineTestingBlock(f1.ID(), types.CurrentTimestamp(), ct.Payouts(ct.Height()+1, nil), nil, target)
+	err = ct.AcceptBlock(f2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForHeight(e, ct, t)
+
+	if _, exists := e.Block(b.ID()); exists {
+		t.Error("reverted block is still indexed")
+	}
+	if _, exists := e.Transaction(txn.ID()); exists {
+		t.Error("reverted transaction is still indexed")
+	}
+	if len(e.Address(ct.UnlockHash).Transactions) != 0 {
+		t.Error("reverted transactions are still indexed by address")
+	}
+	if e.Statistics().ActiveContractCount != 0 {
+		t.Error("reverted file contract is still indexed")
+	}
+}
+
+// TestExplorerResume checks that a reopened explorer resumes from the last
+// consensus change that it processed, and matches an explorer that indexed
+// the consensus set from the beginning.
+func TestExplorerResume(t *testing.T) {
+	ct := consensus.NewTestingEnvironment("TestExplorerResume", t)
+	defer ct.Close()
+	saveDir := tester.TempDir("explorer", "TestExplorerResume")
+	e, err := New(ct.State, saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct.MineAndApplyValidBlock()
+	waitForHeight(e, ct, t)
+	e.Close()
+
+	// Blocks found while the explorer is closed are indexed when it is
+	// reopened.
+	b := ct.MineAndApplyValidBlock()
+	e, err = New(ct.State, saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	waitForHeight(e, ct, t)
+	if eb, exists := e.Block(b.ID()); !exists || eb.Height != ct.Height() {
+		t.Error("block found while the explorer was closed was not indexed")
+	}
+
+	fresh, err := New(ct.State, tester.TempDir("explorer", "TestExplorerResumeFresh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+	waitForHeight(fresh, ct, t)
+	if !bytes.Equal(encoding.Marshal(e.Statistics()), encoding.Marshal(fresh.Statistics())) {
+		t.Errorf("reopened explorer has statistics %v, expected %v", e.Statistics(), fresh.Statistics())
+	}
+}
@@ -0,0 +1,123 @@
+package explorer
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// Block returns the block with the given ID, if it is in the current path.
+func (e *Explorer) Block(id types.BlockID) (modules.ExplorerBlock, bool) {
+	var height types.BlockHeight
+	var pe pathEntry
+	var exists bool
+	e.db.View(func(tx *bolt.Tx) error {
+		height, exists = getBlockHeight(tx, id)
+		if exists {
+			pe, exists = getPathEntry(tx, height)
+		}
+		return nil
+	})
+	if !exists {
+		return modules.ExplorerBlock{}, false
+	}
+	b, exists := e.cs.Block(id)
+	if !exists {
+		return modules.ExplorerBlock{}, false
+	}
+	return modules.ExplorerBlock{
+		Block:  b,
+		ID:     id,
+		Height: height,
+		Target: pe.Target,
+	}, true
+}
+
+// Transaction returns the transaction with the given ID, if it is in the
+// current path.
+func (e *Explorer) Transaction(id crypto.Hash) (modules.ExplorerTransaction, bool) {
+	var loc txnLocation
+	var pe pathEntry
+	var exists bool
+	e.db.View(func(tx *bolt.Tx) error {
+		loc, exists = getTxnLocation(tx, id)
+		if exists {
+			pe, exists = getPathEntry(tx, loc.Height)
+		}
+		return nil
+	})
+	if !exists {
+		return modules.ExplorerTransaction{}, false
+	}
+	b, exists := e.cs.Block(pe.ID)
+	if !exists || loc.Index >= uint64(len(b.Transactions)) {
+		return modules.ExplorerTransaction{}, false
+	}
+	return modules.ExplorerTransaction{
+		Transaction: b.Transactions[loc.Index],
+		ID:          id,
+		BlockID:     pe.ID,
+		Height:      loc.Height,
+	}, true
+}
+
+// Address returns the activity of an unlock hash in the current path.
+func (e *Explorer) Address(uh types.UnlockHash) (ea modules.ExplorerAddress) {
+	var entry addressEntry
+	e.db.View(func(tx *bolt.Tx) error {
+		entry = getAddress(tx, uh)
+		return nil
+	})
+	return modules.ExplorerAddress{
+		Transactions:   entry.Transactions,
+		Blocks:         entry.Blocks,
+		SiacoinOutputs: entry.SiacoinOutputs,
+		SiafundOutputs: entry.SiafundOutputs,
+	}
+}
+
+// Statistics returns statistics about the current path.
+func (e *Explorer) Statistics() (stats modules.ExplorerStatistics) {
+	e.db.View(func(tx *bolt.Tx) error {
+		height := pathLength(tx) - 1
+		pe, _ := getPathEntry(tx, height)
+		dbStats := getStatistics(tx)
+		stats = modules.ExplorerStatistics{
+			Height:       height,
+			CurrentBlock: pe.ID,
+			Target:       pe.Target,
+
+			TotalCoins:  dbStats.TotalCoins,
+			SiafundPool: dbStats.SiafundPool,
+
+			TransactionCount:     dbStats.TransactionCount,
+			ActiveContractCount:  dbStats.ActiveContractCount,
+			ActiveContractCost:   dbStats.ActiveContractCost,
+			ActiveContractSize:   dbStats.ActiveContractSize,
+			SiacoinOutputCount:   dbStats.SiacoinOutputCount,
+			SiafundOutputCount:   dbStats.SiafundOutputCount,
+			UniqueAddressesCount: dbStats.UniqueAddressesCount,
+		}
+		return nil
+	})
+	return
+}
+
+// Targets returns the targets of the blocks in the current path from height
+// start to height end, inclusive. Heights past the end of the current path are
+// ignored.
+func (e *Explorer) Targets(start, end types.BlockHeight) (targets []types.Target) {
+	e.db.View(func(tx *bolt.Tx) error {
+		for height := start; height <= end; height++ {
+			pe, exists := getPathEntry(tx, height)
+			if !exists {
+				break
+			}
+			targets = append(targets, pe.Target)
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,224 @@
+package explorer
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/persist"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// addAddressActivity adds a key to a nested bucket of an unlock hash, creating
+// the buckets of the unlock hash if it had no activity.
+func addAddressActivity(tx *bolt.Tx, stats *dbStatistics, uh types.UnlockHash, bucket, key []byte) {
+	addresses := tx.Bucket(bucketAddresses)
+	b := addresses.Bucket(uh[:])
+	if b == nil {
+		var err error
+		b, err = addresses.CreateBucket(uh[:])
+		for _, nested := range addressBuckets {
+			if err == nil {
+				_, err = b.CreateBucket(nested)
+			}
+		}
+		if err != nil {
+			panic(err)
+		}
+		stats.UniqueAddressesCount++
+	}
+	persist.MustPut(b.Bucket(bucket), key, []byte{})
+}
+
+// removeAddressActivity removes a key from a nested bucket of an unlock hash,
+// removing the buckets of the unlock hash once it has no activity.
+func removeAddressActivity(tx *bolt.Tx, stats *dbStatistics, uh types.UnlockHash, bucket, key []byte) {
+	addresses := tx.Bucket(bucketAddresses)
+	b := addresses.Bucket(uh[:])
+	if b == nil {
+		panic(persist.ErrDatabaseCorrupt)
+	}
+	persist.MustDelete(b.Bucket(bucket), key)
+	for _, nested := range addressBuckets {
+		if key, _ := b.Bucket(nested).Cursor().First(); key != nil {
+			return
+		}
+	}
+	err := addresses.DeleteBucket(uh[:])
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+	stats.UniqueAddressesCount--
+}
+
+// payoutAddresses returns the unlock hashes that a block pays miner payouts
+// to, without duplicates.
+func payoutAddresses(b types.Block) []types.UnlockHash {
+	var uhs []types.UnlockHash
+	seen := make(map[types.UnlockHash]struct{})
+	for _, payout := range b.MinerPayouts {
+		if _, exists := seen[payout.UnlockHash]; !exists {
+			seen[payout.UnlockHash] = struct{}{}
+			uhs = append(uhs, payout.UnlockHash)
+		}
+	}
+	return uhs
+}
+
+// transactionAddresses returns the unlock hashes that a transaction spends
+// from or sends to, without duplicates.
+func transactionAddresses(t types.Transaction) []types.UnlockHash {
+	var uhs []types.UnlockHash
+	seen := make(map[types.UnlockHash]struct{})
+	add := func(uh types.UnlockHash) {
+		if _, exists := seen[uh]; !exists {
+			seen[uh] = struct{}{}
+			uhs = append(uhs, uh)
+		}
+	}
+	for _, sci := range t.SiacoinInputs {
+		add(sci.UnlockConditions.UnlockHash())
+	}
+	for _, sco := range t.SiacoinOutputs {
+		add(sco.UnlockHash)
+	}
+	for _, fc := range t.FileContracts {
+		add(fc.UnlockHash)
+		for _, sco := range fc.ValidProofOutputs {
+			add(sco.UnlockHash)
+		}
+		for _, sco := range fc.MissedProofOutputs {
+			add(sco.UnlockHash)
+		}
+	}
+	for _, fcr := range t.FileContractRevisions {
+		add(fcr.UnlockConditions.UnlockHash())
+		for _, sco := range fcr.NewValidProofOutputs {
+			add(sco.UnlockHash)
+		}
+		for _, sco := range fcr.NewMissedProofOutputs {
+			add(sco.UnlockHash)
+		}
+	}
+	for _, sfi := range t.SiafundInputs {
+		add(sfi.UnlockConditions.UnlockHash())
+	}
+	for _, sfo := range t.SiafundOutputs {
+		add(sfo.UnlockHash)
+	}
+	return uhs
+}
+
+// applyBlock adds a block to the end of the current path.
+func (e *Explorer) applyBlock(tx *bolt.Tx, stats *dbStatistics, b types.Block) {
+	height := pathLength(tx)
+	id := b.ID()
+
+	// The genesis block has no parent, and meets the root target.
+	target, exists := e.cs.ChildTarget(b.ParentID)
+	if !exists {
+		target = types.RootTarget
+	}
+	persist.MustPut(tx.Bucket(bucketBlockPath), persist.HeightKey(height), encoding.Marshal(pathEntry{id, target}))
+	persist.MustPut(tx.Bucket(bucketBlockHeights), id[:], persist.HeightKey(height))
+	stats.TotalCoins = stats.TotalCoins.Add(types.CalculateCoinbase(height))
+
+	for _, uh := range payoutAddresses(b) {
+		addAddressActivity(tx, stats, uh, bucketAddressBlocks, addressKey(height, 0, id[:]))
+	}
+	for i, txn := range b.Transactions {
+		txid := txn.ID()
+		persist.MustPut(tx.Bucket(bucketTransactions), txid[:], encoding.Marshal(txnLocation{height, uint64(i)}))
+		stats.TransactionCount++
+		for _, uh := range transactionAddresses(txn) {
+			addAddressActivity(tx, stats, uh, bucketAddressTransactions, addressKey(height, uint64(i), txid[:]))
+		}
+	}
+}
+
+// revertBlock removes the last block of the current path.
+func (e *Explorer) revertBlock(tx *bolt.Tx, stats *dbStatistics, b types.Block) {
+	height := pathLength(tx) - 1
+	id := b.ID()
+	persist.MustDelete(tx.Bucket(bucketBlockPath), persist.HeightKey(height))
+	persist.MustDelete(tx.Bucket(bucketBlockHeights), id[:])
+	stats.TotalCoins = stats.TotalCoins.Sub(types.CalculateCoinbase(height))
+
+	for _, uh := range payoutAddresses(b) {
+		removeAddressActivity(tx, stats, uh, bucketAddressBlocks, addressKey(height, 0, id[:]))
+	}
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		txn := b.Transactions[i]
+		txid := txn.ID()
+		persist.MustDelete(tx.Bucket(bucketTransactions), txid[:])
+		stats.TransactionCount--
+		for _, uh := range transactionAddresses(txn) {
+			removeAddressActivity(tx, stats, uh, bucketAddressTransactions, addressKey(height, uint64(i), txid[:]))
+		}
+	}
+}
+
+// applyDiffs updates the statistics and the unspent outputs of each address
+// with the diffs of a consensus change.
+func applyDiffs(tx *bolt.Tx, stats *dbStatistics, cc modules.ConsensusChange) {
+	for _, scod := range cc.SiacoinOutputDiffs {
+		if scod.Direction == modules.DiffApply {
+			addAddressActivity(tx, stats, scod.SiacoinOutput.UnlockHash, bucketAddressSiacoinOutputs, scod.ID[:])
+			stats.SiacoinOutputCount++
+		} else {
+			removeAddressActivity(tx, stats, scod.SiacoinOutput.UnlockHash, bucketAddressSiacoinOutputs, scod.ID[:])
+			stats.SiacoinOutputCount--
+		}
+	}
+	for _, fcd := range cc.FileContractDiffs {
+		if fcd.Direction == modules.DiffApply {
+			stats.ActiveContractCount++
+			stats.ActiveContractCost = stats.ActiveContractCost.Add(fcd.FileContract.Payout)
+			stats.ActiveContractSize += fcd.FileContract.FileSize
+		} else {
+			stats.ActiveContractCount--
+			stats.ActiveContractCost = stats.ActiveContractCost.Sub(fcd.FileContract.Payout)
+			stats.ActiveContractSize -= fcd.FileContract.FileSize
+		}
+	}
+	for _, sfod := range cc.SiafundOutputDiffs {
+		if sfod.Direction == modules.DiffApply {
+			addAddressActivity(tx, stats, sfod.SiafundOutput.UnlockHash, bucketAddressSiafundOutputs, sfod.ID[:])
+			stats.SiafundOutputCount++
+		} else {
+			removeAddressActivity(tx, stats, sfod.SiafundOutput.UnlockHash, bucketAddressSiafundOutputs, sfod.ID[:])
+			stats.SiafundOutputCount--
+		}
+	}
+	if len(cc.SiafundPoolDiffs) > 0 {
+		stats.SiafundPool = cc.SiafundPoolDiffs[len(cc.SiafundPoolDiffs)-1].Adjusted
+	}
+}
+
+// update applies a consensus change to the index.
+func (e *Explorer) update(tx *bolt.Tx, cc modules.ConsensusChange) {
+	stats := getStatistics(tx)
+	for _, b := range cc.RevertedBlocks {
+		e.revertBlock(tx, &stats, b)
+	}
+	for _, b := range cc.AppliedBlocks {
+		e.applyBlock(tx, &stats, b)
+	}
+	applyDiffs(tx, &stats, cc)
+	stats.LastChange = cc.ID
+	putStatistics(tx, stats)
+}
+
+// ReceiveConsensusSetUpdate updates the index with a change to the consensus
+// set. The whole change is written in a single database transaction. Changes
+// received after the Explorer is closed are ignored.
+func (e *Explorer) ReceiveConsensusSetUpdate(cc modules.ConsensusChange) {
+	err := e.db.Update(func(tx *bolt.Tx) error {
+		e.update(tx, cc)
+		return nil
+	})
+	if build.DEBUG && err != nil && err != bolt.ErrDatabaseNotOpen {
+		panic(err)
+	}
+}
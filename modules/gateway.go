@@ -2,6 +2,9 @@ package modules
 
 import (
 	"net"
+	"time"
+
+	"github.com/NebulousLabs/Sia/types"
 )
 
 const (
@@ -45,6 +48,26 @@ func (na NetAddress) Port() string {
 	return port
 }
 
+// PeerInfo contains the information that the Gateway has about a connected
+// peer, most of which is learned during the handshake.
+type PeerInfo struct {
+	Address         NetAddress
+	Inbound         bool
+	ProtocolVersion uint64
+	Version         string
+	RPCs            []string
+	ConnectTime     time.Time
+}
+
+// A PeerBan prevents the Gateway from connecting to, or accepting connections
+// from, a host. Bans apply to every port of the host. A ban with a zero
+// Expiration lasts until it is removed.
+type PeerBan struct {
+	Host       string
+	Reason     string
+	Expiration types.Timestamp
+}
+
 // A Gateway facilitates the interactions between the local node and remote
 // nodes (peers). It relays incoming blocks and transactions to local modules,
 // and broadcasts outgoing blocks and transactions to peers. In a broad sense,
@@ -63,6 +86,23 @@ type Gateway interface {
 	// Peers returns the addresses that the Gateway is currently connected to.
 	Peers() []NetAddress
 
+	// PeerInfo returns information about each of the Gateway's peers.
+	PeerInfo() []PeerInfo
+
+	// Strike gives a peer a strike for violating the protocol, temporarily
+	// banning it if it has too many.
+	Strike(NetAddress)
+
+	// Ban disconnects from the host of an address and prevents the Gateway
+	// from connecting to it again until it is unbanned.
+	Ban(NetAddress) error
+
+	// Unban removes the ban on the host of an address.
+	Unban(NetAddress) error
+
+	// Bans returns the Gateway's current bans.
+	Bans() []PeerBan
+
 	// RegisterRPC registers a function to handle incoming connections that
 	// supply the given RPC ID.
 	RegisterRPC(string, RPCFunc)
@@ -75,6 +115,11 @@ type Gateway interface {
 	// Gateway's connected peers in parallel.
 	Broadcast(name string, obj interface{})
 
+	// Announce relays obj to the Gateway's connected peers that have not
+	// already seen it. Peers handle obj with the named RPC. Objects are
+	// identified by the hash of their encoding.
+	Announce(name string, obj interface{})
+
 	// Close safely stops the Gateway's listener process.
 	Close() error
 }
@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"net"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// unspecifiedAddr returns true if the host of addr is the unspecified IP
+// address, meaning that the node does not yet know its external IP.
+func unspecifiedAddr(addr modules.NetAddress) bool {
+	ip := net.ParseIP(addr.Host())
+	return ip != nil && ip.IsUnspecified()
+}
+
+// remoteIP returns the IP address that a connection comes from.
+func remoteIP(conn net.Conn) string {
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	return host
+}
+
+// recordAddrReport records the IP address that a peer reported seeing us at
+// during the handshake. The Gateway adopts the IP reported by the most peers,
+// so that a single misbehaving peer cannot change our address. Reports are
+// ignored if the user specified an external IP.
+func (g *Gateway) recordAddrReport(peer modules.NetAddress, ip string) {
+	if g.externalIP != "" {
+		return
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsUnspecified() {
+		g.log.Printf("WARN: %v reported an invalid address: %q", peer, ip)
+		return
+	}
+	g.addrReports[peer] = ip
+
+	// Count the reports for each IP, preferring the IP we already have if it
+	// is tied for the most reports.
+	counts := make(map[string]int)
+	for _, reported := range g.addrReports {
+		counts[reported]++
+	}
+	best := g.myAddr.Host()
+	for reported, n := range counts {
+		if n > counts[best] {
+			best = reported
+		}
+	}
+
+	newAddr := modules.NetAddress(net.JoinHostPort(best, g.myAddr.Port()))
+	if newAddr == g.myAddr {
+		return
+	}
+	g.log.Println("INFO: peers report that our address is", newAddr)
+	g.removeNode(g.myAddr)
+	g.myAddr = newAddr
+	g.addNode(g.myAddr)
+}
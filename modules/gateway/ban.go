@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"errors"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// strikeBanDuration is how long a peer is banned for after it reaches
+	// maxStrikes.
+	strikeBanDuration = 24 * time.Hour
+)
+
+var (
+	errBadBanAddress = errors.New("address has no host to ban")
+	errNotBanned     = errors.New("host is not banned")
+	errPeerBanned    = errors.New("peer is banned")
+)
+
+// banHost returns the part of an address that is banned. Addresses without a
+// port are treated as a bare host.
+func banHost(addr modules.NetAddress) string {
+	if host := addr.Host(); host != "" {
+		return host
+	}
+	return string(addr)
+}
+
+// banActive returns true if the host of addr is banned and the ban has not
+// expired. Unlike isBanned, banActive does not modify the Gateway, so it may
+// be called while holding a read lock.
+func (g *Gateway) banActive(addr modules.NetAddress) bool {
+	b, exists := g.bans[banHost(addr)]
+	return exists && (b.Expiration == 0 || b.Expiration > types.CurrentTimestamp())
+}
+
+// isBanned returns true if the host of addr is banned. Expired bans are
+// removed.
+func (g *Gateway) isBanned(addr modules.NetAddress) bool {
+	host := banHost(addr)
+	b, exists := g.bans[host]
+	if !exists {
+		return false
+	}
+	if b.Expiration != 0 && b.Expiration <= types.CurrentTimestamp() {
+		delete(g.bans, host)
+		g.saveBans()
+		return false
+	}
+	return true
+}
+
+// addBan bans a host, returning the addresses of the peers that should be
+// disconnected because of the ban.
+func (g *Gateway) addBan(b modules.PeerBan) (banned []modules.NetAddress) {
+	g.bans[b.Host] = b
+	g.saveBans()
+	g.log.Printf("INFO: banned %v (%v)", b.Host, b.Reason)
+	for addr := range g.peers {
+		if banHost(addr) == b.Host {
+			banned = append(banned, addr)
+		}
+	}
+	return
+}
+
+// strikeOut bans a peer that has reached maxStrikes and disconnects from it.
+func (g *Gateway) strikeOut(addr modules.NetAddress) {
+	id := g.mu.Lock()
+	banned := g.addBan(modules.PeerBan{
+		Host:       banHost(addr),
+		Reason:     "too many strikes",
+		Expiration: types.CurrentTimestamp() + types.Timestamp(strikeBanDuration/time.Second),
+	})
+	g.mu.Unlock(id)
+	for _, peer := range banned {
+		g.Disconnect(peer)
+	}
+}
+
+// Strike gives a peer a strike for violating the protocol, disconnecting from
+// it and temporarily banning it if it has too many. Strikes given to addresses
+// that are not peers are ignored.
+func (g *Gateway) Strike(addr modules.NetAddress) {
+	id := g.mu.Lock()
+	var strikes int
+	if p, exists := g.peers[addr]; exists {
+		strikes = p.addStrike(time.Now())
+	}
+	g.mu.Unlock(id)
+	if strikes == maxStrikes {
+		g.log.Printf("WARN: peer %v has too many strikes", addr)
+		g.strikeOut(addr)
+	}
+}
+
+// Ban disconnects from the host of an address and prevents the Gateway from
+// connecting to it again until it is unbanned.
+func (g *Gateway) Ban(addr modules.NetAddress) error {
+	if banHost(addr) == "" {
+		return errBadBanAddress
+	}
+	id := g.mu.Lock()
+	banned := g.addBan(modules.PeerBan{
+		Host:   banHost(addr),
+		Reason: "banned by user",
+	})
+	g.mu.Unlock(id)
+	for _, peer := range banned {
+		g.Disconnect(peer)
+	}
+	return nil
+}
+
+// Unban removes the ban on the host of an address.
+func (g *Gateway) Unban(addr modules.NetAddress) error {
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+	host := banHost(addr)
+	if _, exists := g.bans[host]; !exists {
+		return errNotBanned
+	}
+	delete(g.bans, host)
+	g.log.Println("INFO: unbanned", host)
+	return g.saveBans()
+}
+
+// Bans returns the Gateway's current bans.
+func (g *Gateway) Bans() []modules.PeerBan {
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+	var bans []modules.PeerBan
+	for host, b := range g.bans {
+		if g.isBanned(modules.NetAddress(host)) {
+			bans = append(bans, b)
+		}
+	}
+	return bans
+}
@@ -0,0 +1,184 @@
+package gateway
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestBan checks that banned peers are disconnected and refused, and that
+// bans persist until they are removed.
+func TestBan(t *testing.T) {
+	g1 := newTestingGateway("TestBan1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestBan2", t)
+	defer g2.Close()
+
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g1.Ban(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g1.Peers()) != 0 {
+		t.Error("banned peer was not disconnected")
+	}
+	if bans := g1.Bans(); len(bans) != 1 || bans[0].Host != g2.Address().Host() || bans[0].Expiration != 0 {
+		t.Error("ban list is wrong:", bans)
+	}
+
+	// Connections in both directions are refused.
+	if g1.Connect(g2.Address()) != errPeerBanned {
+		t.Error("connected to a banned peer")
+	}
+	for len(g2.Peers()) != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	err = g2.Connect(g1.Address())
+	if err == nil || !strings.Contains(err.Error(), errPeerBanned.Error()) {
+		t.Error("banned peer was allowed to connect:", err)
+	}
+
+	// The ban is kept when the gateway is restarted.
+	g1.Close()
+	g1, err = New(":0", "", g1.saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g1.Bans()) != 1 {
+		t.Fatal("ban was not persisted")
+	}
+
+	// Once unbanned, the peer can be connected to again.
+	err = g1.Unban(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g1.Unban(g2.Address()) != errNotBanned {
+		t.Error("unbanned a host that was not banned")
+	}
+	err = g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired bans are removed.
+	id := g1.mu.Lock()
+	g1.bans["foo"] = modules.PeerBan{Host: "foo", Expiration: types.CurrentTimestamp() - 1}
+	if g1.isBanned("foo:9981") {
+		t.Error("expired ban is still in effect")
+	}
+	if _, exists := g1.bans["foo"]; exists {
+		t.Error("expired ban was not removed")
+	}
+	g1.mu.Unlock(id)
+}
+
+// TestStrikeOut checks that a peer is temporarily banned after too many
+// failed RPCs.
+func TestStrikeOut(t *testing.T) {
+	g1 := newTestingGateway("TestStrikeOut1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestStrikeOut2", t)
+	defer g2.Close()
+
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail := func(modules.PeerConn) error { return errors.New("failed") }
+	for i := 0; i < maxStrikes-1; i++ {
+		g1.RPC(g2.Address(), "Fail", fail)
+	}
+	if len(g1.Peers()) != 1 {
+		t.Fatal("peer was disconnected before reaching maxStrikes")
+	}
+	g1.RPC(g2.Address(), "Fail", fail)
+	if len(g1.Peers()) != 0 {
+		t.Error("peer was not disconnected after reaching maxStrikes")
+	}
+	bans := g1.Bans()
+	if len(bans) != 1 || bans[0].Expiration == 0 {
+		t.Error("peer was not temporarily banned:", bans)
+	}
+}
+
+// TestTransientRPCErrors checks that RPCs that fail because of the connection
+// do not give the peer strikes.
+func TestTransientRPCErrors(t *testing.T) {
+	g1 := newTestingGateway("TestTransientRPCErrors1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestTransientRPCErrors2", t)
+	defer g2.Close()
+
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// g2 has no handler for the RPC and closes the connection, so reading
+	// the response fails.
+	read := func(conn modules.PeerConn) error {
+		var s string
+		return encoding.ReadObject(conn, &s, 8)
+	}
+	for i := 0; i < maxStrikes; i++ {
+		if g1.RPC(g2.Address(), "Missing", read) == nil {
+			t.Fatal("RPC on a closed connection succeeded")
+		}
+	}
+	if len(g1.Peers()) != 1 {
+		t.Error("peer was disconnected for connection errors")
+	}
+}
+
+// TestStrikeDecay checks that strikes are forgiven over time.
+func TestStrikeDecay(t *testing.T) {
+	var p peer
+	now := time.Now()
+	for i := 0; i < maxStrikes-1; i++ {
+		p.addStrike(now)
+	}
+	if p.addStrike(now.Add(strikeDecay)) != maxStrikes-1 {
+		t.Error("one strike was not forgiven after strikeDecay")
+	}
+	if p.addStrike(now.Add(100*strikeDecay)) != 1 {
+		t.Error("all strikes were not forgiven after a long time")
+	}
+}
+
+// TestPeerLimits checks that the gateway refuses outbound and inbound peers
+// beyond its limits.
+func TestPeerLimits(t *testing.T) {
+	g := newTestingGateway("TestPeerLimits", t)
+	defer g.Close()
+
+	// Fill the outbound peer slots with fake peers.
+	id := g.mu.Lock()
+	for i := 0; i < maxOutboundPeers; i++ {
+		g.peers[modules.NetAddress("foo"+string(rune('a'+i)))] = &peer{}
+	}
+	g.mu.Unlock(id)
+	other := newTestingGateway("TestPeerLimits2", t)
+	defer other.Close()
+	if g.Connect(other.Address()) != errTooManyPeers {
+		t.Error("connected to too many outbound peers")
+	}
+
+	// Fill the inbound peer slots.
+	id = g.mu.Lock()
+	for i := 0; i < maxInboundPeers; i++ {
+		g.peers[modules.NetAddress("bar"+string(rune('a'+i)))] = &peer{inbound: true}
+	}
+	g.mu.Unlock(id)
+	err := other.Connect(g.Address())
+	if err == nil || !strings.Contains(err.Error(), errTooManyPeers.Error()) {
+		t.Error("accepted too many inbound peers:", err)
+	}
+}
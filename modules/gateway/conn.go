@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"net"
+	"sync/atomic"
 
 	"github.com/NebulousLabs/Sia/modules"
 )
@@ -16,3 +17,35 @@ type peerConn struct {
 func (pc *peerConn) CallbackAddr() modules.NetAddress {
 	return pc.addr
 }
+
+// An rpcConn wraps the connection of an RPC called by the Gateway. It records
+// whether a read or write on the connection failed, so that an RPC that fails
+// because of the connection, rather than because of what the peer sent, is
+// not counted against the peer.
+type rpcConn struct {
+	modules.PeerConn
+	failed uint32
+}
+
+// Read implements the io.Reader interface.
+func (rc *rpcConn) Read(b []byte) (int, error) {
+	n, err := rc.PeerConn.Read(b)
+	if err != nil {
+		atomic.StoreUint32(&rc.failed, 1)
+	}
+	return n, err
+}
+
+// Write implements the io.Writer interface.
+func (rc *rpcConn) Write(b []byte) (int, error) {
+	n, err := rc.PeerConn.Write(b)
+	if err != nil {
+		atomic.StoreUint32(&rc.failed, 1)
+	}
+	return n, err
+}
+
+// connFailed returns true if a read or write on the connection failed.
+func (rc *rpcConn) connFailed() bool {
+	return atomic.LoadUint32(&rc.failed) == 1
+}
@@ -1,28 +1,38 @@
 package gateway
 
 import (
+	"crypto/rand"
 	"errors"
-	"io"
 	"log"
 	"net"
-	"net/http"
 	"os"
+	"time"
 
 	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/sync"
 )
 
 const (
 	// maxStrikes is the number of "strikes" that can be incurred by a peer
-	// before it will be removed.
+	// before it is disconnected and temporarily banned.
 	// TODO: need a way to whitelist peers (e.g. hosts)
 	maxStrikes = 5
+
+	// strikeDecay is how long it takes for a peer to be forgiven one strike.
+	strikeDecay = 30 * time.Minute
+
+	// maxInboundPeers and maxOutboundPeers limit the number of peers that
+	// connect to the Gateway and that the Gateway connects to, respectively.
+	maxInboundPeers  = 24
+	maxOutboundPeers = 8
 )
 
 var (
-	errNoPeers     = errors.New("no peers")
-	errUnreachable = errors.New("peer did not respond to ping")
+	errNoPeers      = errors.New("no peers")
+	errTooManyPeers = errors.New("too many peers")
+	errUnreachable  = errors.New("peer did not respond to ping")
 )
 
 // Gateway implements the modules.Gateway interface.
@@ -30,6 +40,16 @@ type Gateway struct {
 	listener net.Listener
 	myAddr   modules.NetAddress
 
+	// id identifies the Gateway in handshakes with other nodes.
+	id nodeID
+
+	// externalIP, if set, is the IP address or hostname that the Gateway
+	// uses in its address. Otherwise, the Gateway learns its IP address from
+	// the peers that it connects to. addrReports holds the IP address that
+	// each of those peers reported.
+	externalIP  string
+	addrReports map[modules.NetAddress]string
+
 	// Each incoming connection begins with a string of 8 bytes, indicating
 	// which function should handle the connection.
 	handlerMap map[rpcID]modules.RPCFunc
@@ -37,10 +57,22 @@ type Gateway struct {
 	// peers are the nodes we are currently connected to.
 	peers map[modules.NetAddress]*peer
 
-	// nodes is a list of all known nodes (i.e. potential peers) on the
-	// network.
-	// TODO: map to a timestamp?
-	nodes map[modules.NetAddress]struct{}
+	// nodes is the address book of all known nodes (i.e. potential peers)
+	// on the network.
+	nodes map[modules.NetAddress]*node
+
+	// seen holds the IDs of the objects that the Gateway has announced or
+	// fetched from peers, and requested maps the IDs of the objects that are
+	// being fetched to the other peers that announced them. inventory holds
+	// recently announced objects, so that they can be served to peers;
+	// inventoryOrder is used to evict the oldest.
+	seen           *inventorySet
+	requested      map[crypto.Hash][]modules.NetAddress
+	inventory      map[crypto.Hash]inventoryObject
+	inventoryOrder []crypto.Hash
+
+	// bans maps each banned host to its ban.
+	bans map[string]modules.PeerBan
 
 	// saveDir is the path used to save/load peers.
 	saveDir string
@@ -57,6 +89,7 @@ func (g *Gateway) Address() modules.NetAddress {
 	return g.myAddr
 }
 
+// Peers returns the addresses of the Gateway's peers.
 func (g *Gateway) Peers() []modules.NetAddress {
 	id := g.mu.RLock()
 	defer g.mu.RUnlock(id)
@@ -67,13 +100,32 @@ func (g *Gateway) Peers() []modules.NetAddress {
 	return peers
 }
 
+// PeerInfo returns information about each of the Gateway's peers.
+func (g *Gateway) PeerInfo() []modules.PeerInfo {
+	id := g.mu.RLock()
+	defer g.mu.RUnlock(id)
+	var infos []modules.PeerInfo
+	for _, p := range g.peers {
+		infos = append(infos, modules.PeerInfo{
+			Address:         p.addr,
+			Inbound:         p.inbound,
+			ProtocolVersion: p.handshake.ProtocolVersion,
+			Version:         p.handshake.Version,
+			RPCs:            p.handshake.RPCs,
+			ConnectTime:     p.connectTime,
+		})
+	}
+	return infos
+}
+
 // Close stops the Gateway's listener process.
 func (g *Gateway) Close() error {
 	return g.listener.Close()
 }
 
-// New returns an initialized Gateway.
-func New(addr string, saveDir string) (g *Gateway, err error) {
+// New returns an initialized Gateway. If externalIP is empty, the Gateway
+// learns its external IP address from its peers.
+func New(addr string, externalIP string, saveDir string) (g *Gateway, err error) {
 	// Create the directory if it doesn't exist.
 	err = os.MkdirAll(saveDir, 0700)
 	if err != nil {
@@ -87,16 +139,29 @@ func New(addr string, saveDir string) (g *Gateway, err error) {
 	}
 
 	g = &Gateway{
-		handlerMap: make(map[rpcID]modules.RPCFunc),
-		peers:      make(map[modules.NetAddress]*peer),
-		nodes:      make(map[modules.NetAddress]struct{}),
-		saveDir:    saveDir,
-		mu:         sync.New(modules.SafeMutexDelay, 0),
-		log:        logger,
+		handlerMap:  make(map[rpcID]modules.RPCFunc),
+		peers:       make(map[modules.NetAddress]*peer),
+		nodes:       make(map[modules.NetAddress]*node),
+		bans:        make(map[string]modules.PeerBan),
+		seen:        newInventorySet(maxKnownInventory),
+		requested:   make(map[crypto.Hash][]modules.NetAddress),
+		inventory:   make(map[crypto.Hash]inventoryObject),
+		externalIP:  externalIP,
+		addrReports: make(map[modules.NetAddress]string),
+		saveDir:     saveDir,
+		mu:          sync.New(modules.SafeMutexDelay, 0),
+		log:         logger,
+	}
+
+	_, err = rand.Read(g.id[:])
+	if err != nil {
+		return
 	}
 
 	g.RegisterRPC("ShareNodes", g.shareNodes)
 	g.RegisterRPC("RelayNode", g.relayNode)
+	g.RegisterRPC("Inv", g.relayInventory)
+	g.RegisterRPC("GetInv", g.serveInventory)
 
 	g.log.Println("INFO: gateway created, started logging")
 
@@ -109,14 +174,15 @@ func New(addr string, saveDir string) (g *Gateway, err error) {
 	// will assign us a random open port).
 	g.myAddr = modules.NetAddress(g.listener.Addr().String())
 
-	// Discover our external IP. (During testing, return the loopback address.)
-	var hostname string
-	if build.Release == "testing" {
-		hostname = "::1"
-	} else {
-		hostname, err = getExternalIP()
-		if err != nil {
-			return nil, err
+	// Until a peer reports our external IP, use the unspecified address,
+	// which peers replace with the IP they see us connecting from. (During
+	// testing, use the loopback address.)
+	hostname := externalIP
+	if hostname == "" {
+		if build.Release == "testing" {
+			hostname = "::1"
+		} else {
+			hostname = "::"
 		}
 	}
 	g.myAddr = modules.NetAddress(net.JoinHostPort(hostname, g.myAddr.Port()))
@@ -124,7 +190,9 @@ func New(addr string, saveDir string) (g *Gateway, err error) {
 	g.log.Println("INFO: our address is", g.myAddr)
 
 	// Add ourselves as a node.
-	g.addNode(g.myAddr)
+	if !unspecifiedAddr(g.myAddr) {
+		g.addNode(g.myAddr)
+	}
 
 	// Spawn the primary listener.
 	go g.listen()
@@ -134,6 +202,9 @@ func New(addr string, saveDir string) (g *Gateway, err error) {
 	if loadErr := g.load(); loadErr != nil && !os.IsNotExist(loadErr) {
 		return nil, loadErr
 	}
+	if loadErr := g.loadBans(); loadErr != nil && !os.IsNotExist(loadErr) {
+		return nil, loadErr
+	}
 
 	// Spawn the connector loop. This will continually attempt to add nodes as
 	// peers to ensure we stay well-connected.
@@ -142,22 +213,5 @@ func New(addr string, saveDir string) (g *Gateway, err error) {
 	return
 }
 
-// getExternalIP learns the server's hostname from a centralized service,
-// myexternalip.com.
-func getExternalIP() (string, error) {
-	resp, err := http.Get("http://myexternalip.com/raw")
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	buf := make([]byte, 64)
-	n, err := resp.Body.Read(buf)
-	if err != nil && err != io.EOF {
-		return "", err
-	}
-	hostname := string(buf[:n-1]) // trim newline
-	return hostname, nil
-}
-
 // enforce that Gateway satisfies the modules.Gateway interface
 var _ modules.Gateway = (*Gateway)(nil)
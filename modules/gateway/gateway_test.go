@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/tester"
@@ -13,7 +14,7 @@ import (
 
 // newTestingGateway returns a gateway read to use in a testing environment.
 func newTestingGateway(name string, t *testing.T) *Gateway {
-	g, err := New(":0", tester.TempDir("gateway", name))
+	g, err := New(":0", "", tester.TempDir("gateway", name))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -57,13 +58,13 @@ func TestPeers(t *testing.T) {
 }
 
 func TestNew(t *testing.T) {
-	if _, err := New("", ""); err == nil {
+	if _, err := New("", "", ""); err == nil {
 		t.Fatal("expecting saveDir error, got nil")
 	}
-	if _, err := New(":0", ""); err == nil {
+	if _, err := New(":0", "", ""); err == nil {
 		t.Fatal("expecting saveDir error, got nil")
 	}
-	if g, err := New("foo", tester.TempDir("gateway", "TestNew1")); err == nil {
+	if g, err := New("foo", "", tester.TempDir("gateway", "TestNew1")); err == nil {
 		t.Fatal("expecting listener error, got nil", g.myAddr)
 	}
 	// create corrupted peers.dat
@@ -73,21 +74,66 @@ func TestNew(t *testing.T) {
 	if err != nil {
 		t.Fatal("couldn't create corrupted file:", err)
 	}
-	if _, err := New(":0", dir); err == nil {
+	if _, err := New(":0", "", dir); err == nil {
 		t.Fatal("expected load error, got nil")
 	}
 }
 
-func TestExternalIP(t *testing.T) {
-	if testing.Short() {
-		t.SkipNow()
+// TestLearnAddress checks that a gateway learns its IP address from the peers
+// that it connects to, and that a specified external IP is kept.
+func TestLearnAddress(t *testing.T) {
+	g1 := newTestingGateway("TestLearnAddress1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestLearnAddress2", t)
+	defer g2.Close()
+
+	// Pretend that g1 has not learned its address. g2 should replace the
+	// unspecified address with the address it sees g1 at, and g1 should learn
+	// its address from g2.
+	port := g1.Address().Port()
+	g1.myAddr = modules.NetAddress(net.JoinHostPort("::", port))
+	err := g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expAddr := modules.NetAddress(net.JoinHostPort("::1", port))
+	if g1.Address() != expAddr {
+		t.Errorf("g1 did not learn its address: expected %v, got %v", expAddr, g1.Address())
+	}
+	for len(g2.Peers()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if peers := g2.Peers(); peers[0] != expAddr {
+		t.Errorf("g2 has the wrong address for g1: expected %v, got %v", expAddr, peers[0])
 	}
 
-	ip, err := getExternalIP()
+	// A single peer cannot outvote the others.
+	id := g1.mu.Lock()
+	g1.addrReports["foo"] = "::1"
+	g1.recordAddrReport("bar", "1.2.3.4")
+	if g1.myAddr != expAddr {
+		t.Error("g1 adopted an address reported by a minority of peers:", g1.myAddr)
+	}
+	g1.recordAddrReport("baz", "not an IP")
+	if _, exists := g1.addrReports["baz"]; exists {
+		t.Error("g1 accepted an invalid address report")
+	}
+	g1.mu.Unlock(id)
+
+	// A gateway with a specified external IP ignores reports.
+	g3, err := New(":0", "sia.example.com", tester.TempDir("gateway", "TestLearnAddress3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g3.Close()
+	if g3.Address().Host() != "sia.example.com" {
+		t.Fatal("g3 did not use its external IP:", g3.Address())
+	}
+	err = g3.Connect(g2.Address())
 	if err != nil {
-		t.Fatal("couldn't determine external IP:", err)
+		t.Fatal(err)
 	}
-	if net.ParseIP(ip) == nil {
-		t.Fatal("getExternalIP returned bad IP:", ip)
+	if g3.Address().Host() != "sia.example.com" {
+		t.Error("g3 replaced its external IP with", g3.Address())
 	}
 }
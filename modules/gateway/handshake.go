@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// protocolVersion is the version of the gateway protocol spoken by this
+	// node. Peers older than minProtocolVersion are rejected. Version 1
+	// peers cannot decode this handshake, so they are not supported.
+	protocolVersion    = 2
+	minProtocolVersion = 2
+
+	// handshakeAccept is sent by a node to accept a connecting node's
+	// handshake. Any other response is the reason that the handshake was
+	// rejected.
+	handshakeAccept = "accept"
+
+	maxHandshakeLen = 1 << 12
+)
+
+var (
+	errIncompatiblePeer = errors.New("peer uses an incompatible protocol version")
+	errSelfConnection   = errors.New("can't connect to ourselves")
+)
+
+// A nodeID is a random identifier chosen by each node when it starts. It lets
+// a node detect a connection to itself, which can't be done by address alone
+// because the node may be reachable at several addresses.
+type nodeID [16]byte
+
+// A handshake is exchanged by two nodes when one connects to the other. The
+// connecting node sends its handshake first; if the receiving node accepts it,
+// the receiving node responds with its own handshake.
+type handshake struct {
+	ProtocolVersion uint64
+	Version         string
+	ID              nodeID
+
+	// Address is the address that the node listens on, and RPCs lists the
+	// RPCs that it handles.
+	Address modules.NetAddress
+	RPCs    []string
+
+	// YourIP is the IP address that the node sees the other node connecting
+	// from, which lets the other node learn its external IP. It is only set by
+	// the receiving node.
+	YourIP string
+}
+
+// ourHandshake returns the handshake that we send to other nodes.
+func (g *Gateway) ourHandshake(yourIP string) handshake {
+	var rpcs []string
+	for id := range g.handlerMap {
+		rpcs = append(rpcs, strings.TrimSpace(id.String()))
+	}
+	sort.Strings(rpcs)
+	return handshake{
+		ProtocolVersion: protocolVersion,
+		Version:         build.Version,
+		ID:              g.id,
+		Address:         g.myAddr,
+		RPCs:            rpcs,
+		YourIP:          yourIP,
+	}
+}
+
+// checkHandshake returns an error if we should not connect to the node that
+// sent a handshake.
+func (g *Gateway) checkHandshake(h handshake) error {
+	if h.ProtocolVersion < minProtocolVersion {
+		return errIncompatiblePeer
+	}
+	if h.ID == g.id {
+		return errSelfConnection
+	}
+	return nil
+}
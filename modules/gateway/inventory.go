@@ -0,0 +1,287 @@
+package gateway
+
+// inventory.go implements the relay of blocks and transactions. Instead of
+// sending an object to every peer, the Gateway announces the object's ID, and
+// only peers that have not seen the object request it. The Gateway remembers
+// which IDs each peer has announced or been sent, so that an object is not
+// announced to a peer that already has it. An object's ID is the hash of its
+// encoding, so that a fetched object can be checked against its announcement.
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// inventoryProtocolVersion is the first protocol version that supports
+	// inventory announcements. Objects are sent in full to older peers.
+	inventoryProtocolVersion = 2
+
+	// maxKnownInventory is the number of IDs remembered for each peer, and
+	// the number of IDs that the Gateway remembers having seen itself.
+	maxKnownInventory = 4096
+
+	// maxInventoryObjects is the number of recently announced objects that
+	// the Gateway keeps in order to serve them to peers.
+	maxInventoryObjects = 32
+
+	// maxAnnouncers is the number of peers that the Gateway remembers as
+	// having announced an object while it is being fetched. If fetching the
+	// object from one of them fails, the next is tried.
+	maxAnnouncers = 8
+
+	// fetchTimeout is how long the Gateway waits for a peer to send an
+	// object that it announced.
+	fetchTimeout = 2 * time.Minute
+
+	maxAnnouncementLen = 1 << 8
+)
+
+var (
+	errUnknownInventory = errors.New("object is not in the inventory")
+	errInventoryID      = errors.New("object does not match the announced ID")
+)
+
+// An inventoryAnnouncement tells a peer that an object is available. RPC is
+// the name of the RPC that handles the object.
+type inventoryAnnouncement struct {
+	RPC string
+	ID  crypto.Hash
+}
+
+// An inventoryObject is an announced object, as it is sent to peers.
+type inventoryObject struct {
+	rpc  string
+	data []byte
+}
+
+// An inventorySet is a set of IDs that holds at most max IDs. When it is full,
+// the oldest ID is forgotten.
+type inventorySet struct {
+	ids   map[crypto.Hash]struct{}
+	order []crypto.Hash
+	max   int
+}
+
+// newInventorySet returns an empty inventorySet that holds at most max IDs.
+func newInventorySet(max int) *inventorySet {
+	return &inventorySet{
+		ids: make(map[crypto.Hash]struct{}),
+		max: max,
+	}
+}
+
+// add adds an ID to the set. It returns false if the ID was already present.
+func (s *inventorySet) add(id crypto.Hash) bool {
+	if s.has(id) {
+		return false
+	}
+	s.ids[id] = struct{}{}
+	s.order = append(s.order, id)
+	if len(s.order) > s.max {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
+
+// has returns true if the ID is in the set.
+func (s *inventorySet) has(id crypto.Hash) bool {
+	_, exists := s.ids[id]
+	return exists
+}
+
+// storeInventory keeps an encoded object so that it can be served to peers,
+// forgetting the oldest object if too many are stored.
+func (g *Gateway) storeInventory(id crypto.Hash, obj inventoryObject) {
+	if _, exists := g.inventory[id]; exists {
+		return
+	}
+	g.inventory[id] = obj
+	g.inventoryOrder = append(g.inventoryOrder, id)
+	if len(g.inventoryOrder) > maxInventoryObjects {
+		delete(g.inventory, g.inventoryOrder[0])
+		g.inventoryOrder = g.inventoryOrder[1:]
+	}
+}
+
+// Announce relays an object to every peer that has not already seen it. Peers
+// that support inventory announcements are sent the object's ID, and request
+// the object if they do not have it; older peers are sent the object itself.
+// In either case, the object is handled by the named RPC.
+func (g *Gateway) Announce(name string, obj interface{}) {
+	// only encode obj once, instead of using WriteObject
+	enc := encoding.Marshal(obj)
+	id := crypto.HashBytes(enc)
+
+	var announceTo, sendTo []modules.NetAddress
+	lockID := g.mu.Lock()
+	g.seen.add(id)
+	g.storeInventory(id, inventoryObject{name, enc})
+	for addr, p := range g.peers {
+		if !p.known.add(id) {
+			continue
+		}
+		if p.handshake.ProtocolVersion >= inventoryProtocolVersion {
+			announceTo = append(announceTo, addr)
+		} else {
+			sendTo = append(sendTo, addr)
+		}
+	}
+	g.mu.Unlock(lockID)
+	g.log.Printf("INFO: announcing %v to %v peers and sending it to %v peers", id, len(announceTo), len(sendTo))
+
+	ann := inventoryAnnouncement{name, id}
+	announce := func(conn modules.PeerConn) error {
+		return encoding.WriteObject(conn, ann)
+	}
+	send := func(conn modules.PeerConn) error {
+		return encoding.WritePrefix(conn, enc)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(announceTo) + len(sendTo))
+	call := func(addr modules.NetAddress, rpc string, fn modules.RPCFunc) {
+		err := g.RPC(addr, rpc, fn)
+		if err != nil {
+			g.log.Printf("WARN: announce: calling RPC \"%v\" on peer %v returned error: %v", rpc, addr, err)
+		}
+		wg.Done()
+	}
+	for _, addr := range announceTo {
+		go call(addr, "Inv", announce)
+	}
+	for _, addr := range sendTo {
+		go call(addr, name, send)
+	}
+	wg.Wait()
+}
+
+// relayInventory is an RPC that receives an inventory announcement from a
+// peer. If the Gateway has not seen the object, it requests the object from
+// the peer that announced it. If the object is already being requested from
+// another peer, the announcer is remembered in case that request fails.
+func (g *Gateway) relayInventory(conn modules.PeerConn) error {
+	var ann inventoryAnnouncement
+	if err := encoding.ReadObject(conn, &ann, maxAnnouncementLen); err != nil {
+		return err
+	}
+	addr := conn.CallbackAddr()
+
+	id := g.mu.Lock()
+	if p, exists := g.peers[addr]; exists {
+		p.known.add(ann.ID)
+	}
+	announcers, requested := g.requested[ann.ID]
+	_, handled := g.handlerMap[handlerName(ann.RPC)]
+	want := handled && !requested && !g.seen.has(ann.ID)
+	if want {
+		g.requested[ann.ID] = nil
+	} else if requested && len(announcers) < maxAnnouncers {
+		g.requested[ann.ID] = append(announcers, addr)
+	}
+	g.mu.Unlock(id)
+
+	if want {
+		go g.fetchInventory(addr, ann)
+	}
+	return nil
+}
+
+// A replayConn is a connection whose first reads are served from a buffer.
+// It is used to hand an object that has already been read from a peer to the
+// RPC that handles it.
+type replayConn struct {
+	modules.PeerConn
+	r io.Reader
+}
+
+// Read implements the io.Reader interface.
+func (rc *replayConn) Read(b []byte) (int, error) {
+	return rc.r.Read(b)
+}
+
+// fetchInventory requests an announced object from a peer and passes it to
+// the RPC that handles it. If the peer cannot be reached or sends an object
+// that does not match the announced ID, the object is requested from the next
+// peer that announced it, if there is one. Errors returned by the handler do
+// not count as strikes against the peer, just as when the peer sends the
+// object itself.
+func (g *Gateway) fetchInventory(addr modules.NetAddress, ann inventoryAnnouncement) {
+	for {
+		err := g.fetchInventoryFrom(addr, ann)
+
+		id := g.mu.Lock()
+		announcers := g.requested[ann.ID]
+		if err == nil || len(announcers) == 0 {
+			delete(g.requested, ann.ID)
+			g.mu.Unlock(id)
+			return
+		}
+		addr, g.requested[ann.ID] = announcers[0], announcers[1:]
+		g.mu.Unlock(id)
+	}
+}
+
+// fetchInventoryFrom requests an announced object from a peer, checks it
+// against the announced ID, and passes it to the RPC that handles it. Once the
+// object matches the ID it is marked as seen, because every peer would send
+// the same object; an error is only returned if the object could not be
+// fetched.
+func (g *Gateway) fetchInventoryFrom(addr modules.NetAddress, ann inventoryAnnouncement) error {
+	id := g.mu.RLock()
+	handler := g.handlerMap[handlerName(ann.RPC)]
+	g.mu.RUnlock(id)
+
+	var handlerErr error
+	err := g.RPC(addr, "GetInv", func(conn modules.PeerConn) error {
+		conn.SetDeadline(time.Now().Add(fetchTimeout))
+		if err := encoding.WriteObject(conn, ann); err != nil {
+			return err
+		}
+		data, err := encoding.ReadPrefix(conn, types.BlockSizeLimit)
+		if err != nil {
+			return err
+		}
+		if crypto.HashBytes(data) != ann.ID {
+			return errInventoryID
+		}
+		id := g.mu.Lock()
+		g.seen.add(ann.ID)
+		g.mu.Unlock(id)
+		replay := io.MultiReader(bytes.NewReader(encoding.EncUint64(uint64(len(data)))), bytes.NewReader(data))
+		handlerErr = handler(&replayConn{conn, replay})
+		return nil
+	})
+	if err != nil {
+		g.log.Printf("WARN: could not fetch %v from %v: %v", ann.ID, addr, err)
+		return err
+	}
+	if handlerErr != nil {
+		g.log.Printf("WARN: RPC \"%v\" rejected %v from %v: %v", ann.RPC, ann.ID, addr, handlerErr)
+	}
+	return nil
+}
+
+// serveInventory is an RPC that sends an announced object to a peer.
+func (g *Gateway) serveInventory(conn modules.PeerConn) error {
+	var ann inventoryAnnouncement
+	if err := encoding.ReadObject(conn, &ann, maxAnnouncementLen); err != nil {
+		return err
+	}
+	id := g.mu.RLock()
+	obj, exists := g.inventory[ann.ID]
+	g.mu.RUnlock(id)
+	if !exists || obj.rpc != ann.RPC {
+		return errUnknownInventory
+	}
+	return encoding.WritePrefix(conn, obj.data)
+}
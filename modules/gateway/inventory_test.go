@@ -0,0 +1,244 @@
+package gateway
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestInventorySet checks that an inventorySet forgets its oldest IDs when it
+// is full.
+func TestInventorySet(t *testing.T) {
+	s := newInventorySet(2)
+	ids := []crypto.Hash{{1}, {2}, {3}}
+	if !s.add(ids[0]) || !s.add(ids[1]) {
+		t.Fatal("add failed")
+	}
+	if s.add(ids[0]) {
+		t.Fatal("add succeeded for an ID already in the set")
+	}
+	s.add(ids[2])
+	if s.has(ids[0]) || !s.has(ids[1]) || !s.has(ids[2]) {
+		t.Fatal("set did not forget its oldest ID:", s.order)
+	}
+}
+
+// TestAnnounce checks that announced objects are relayed across the network,
+// and that each node fetches an object only once.
+func TestAnnounce(t *testing.T) {
+	g1 := newTestingGateway("TestAnnounce1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestAnnounce2", t)
+	defer g2.Close()
+	g3 := newTestingGateway("TestAnnounce3", t)
+	defer g3.Close()
+
+	// connect g1 to g2 and g3, and g2 to g3
+	for _, pair := range [][2]*Gateway{{g1, g2}, {g1, g3}, {g2, g3}} {
+		if err := pair[0].Connect(pair[1].Address()); err != nil {
+			t.Fatal("failed to connect:", err)
+		}
+	}
+
+	// Each gateway counts the objects it receives, and announces them again,
+	// as the consensus set and transaction pool do.
+	var mu sync.Mutex
+	received := make(map[*Gateway]int)
+	for _, g := range []*Gateway{g1, g2, g3} {
+		g := g
+		g.RegisterRPC("Recv", func(conn modules.PeerConn) error {
+			var payload string
+			if err := encoding.ReadObject(conn, &payload, 100); err != nil {
+				return err
+			}
+			mu.Lock()
+			received[g]++
+			mu.Unlock()
+			g.Announce("Recv", payload)
+			return nil
+		})
+	}
+
+	g1.Announce("Recv", "foo")
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	if received[g1] != 0 || received[g2] != 1 || received[g3] != 1 {
+		t.Fatal("object was not received exactly once by each peer:", received[g1], received[g2], received[g3])
+	}
+	mu.Unlock()
+
+	// Announcing the object again should not send it to anyone.
+	g1.Announce("Recv", "foo")
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	if received[g2] != 1 || received[g3] != 1 {
+		t.Fatal("object was relayed again:", received[g2], received[g3])
+	}
+	mu.Unlock()
+
+	// Peers that do not support announcements are sent the object itself.
+	id := g1.mu.Lock()
+	g1.peers[g2.Address()].handshake.ProtocolVersion = inventoryProtocolVersion - 1
+	g1.mu.Unlock(id)
+	g1.Announce("Recv", "bar")
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	if received[g2] != 2 || received[g3] != 2 {
+		t.Fatal("object was not received exactly once by each peer:", received[g2], received[g3])
+	}
+	mu.Unlock()
+}
+
+// TestServeInventory checks that only objects in the inventory are served.
+func TestServeInventory(t *testing.T) {
+	g1 := newTestingGateway("TestServeInventory1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestServeInventory2", t)
+	defer g2.Close()
+	if err := g1.Connect(g2.Address()); err != nil {
+		t.Fatal("failed to connect:", err)
+	}
+
+	g2.Announce("Recv", "foo")
+	fetch := func(ann inventoryAnnouncement) (payload string, err error) {
+		err = g1.RPC(g2.Address(), "GetInv", func(conn modules.PeerConn) error {
+			if err := encoding.WriteObject(conn, ann); err != nil {
+				return err
+			}
+			return encoding.ReadObject(conn, &payload, 100)
+		})
+		return
+	}
+	if payload, err := fetch(inventoryAnnouncement{"Recv", crypto.HashObject("foo")}); err != nil || payload != "foo" {
+		t.Fatal("announced object was not served:", payload, err)
+	}
+	if _, err := fetch(inventoryAnnouncement{"Recv", crypto.HashObject("bar")}); err == nil {
+		t.Fatal("unknown object was served")
+	}
+	if _, err := fetch(inventoryAnnouncement{"Other", crypto.HashObject("foo")}); err == nil {
+		t.Fatal("object was served for the wrong RPC")
+	}
+}
+
+// TestFetchInventory checks that a fetched object is only marked as seen if it
+// matches its announcement, and that the other peers that announced an object
+// are tried when fetching it fails.
+func TestFetchInventory(t *testing.T) {
+	g1 := newTestingGateway("TestFetchInventory1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestFetchInventory2", t)
+	defer g2.Close()
+	g3 := newTestingGateway("TestFetchInventory3", t)
+	defer g3.Close()
+	for _, g := range []*Gateway{g2, g3} {
+		if err := g1.Connect(g.Address()); err != nil {
+			t.Fatal("failed to connect:", err)
+		}
+	}
+
+	received := make(chan string, 10)
+	g1.RegisterRPC("Recv", func(conn modules.PeerConn) error {
+		var payload string
+		if err := encoding.ReadObject(conn, &payload, 100); err != nil {
+			return err
+		}
+		received <- payload
+		return nil
+	})
+	announce := func(g *Gateway, ann inventoryAnnouncement) {
+		err := g.RPC(g1.Address(), "Inv", func(conn modules.PeerConn) error {
+			return encoding.WriteObject(conn, ann)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitRequested := func(id crypto.Hash) {
+		// Give g1 time to handle the announcement before polling.
+		time.Sleep(50 * time.Millisecond)
+		for i := 0; ; i++ {
+			lockID := g1.mu.RLock()
+			_, requested := g1.requested[id]
+			g1.mu.RUnlock(lockID)
+			if !requested {
+				return
+			}
+			if i == 100 {
+				t.Fatal("object is still being requested")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// An object that does not match its ID is not handled or marked as seen.
+	fakeID := crypto.HashObject("bar")
+	id := g2.mu.Lock()
+	g2.storeInventory(fakeID, inventoryObject{"Recv", encoding.Marshal("foo")})
+	g2.mu.Unlock(id)
+	announce(g2, inventoryAnnouncement{"Recv", fakeID})
+	waitRequested(fakeID)
+	id = g1.mu.RLock()
+	seen := g1.seen.has(fakeID)
+	g1.mu.RUnlock(id)
+	if seen || len(received) != 0 {
+		t.Fatal("object that does not match its ID was accepted")
+	}
+
+	// An object that matches its ID is marked as seen even if the handler
+	// rejects it, so it is not fetched again from other peers.
+	var rejected int
+	g1.RegisterRPC("Reject", func(conn modules.PeerConn) error {
+		rejected++
+		return errors.New("rejected")
+	})
+	rejectID := crypto.HashObject("baz")
+	for _, g := range []*Gateway{g2, g3} {
+		id = g.mu.Lock()
+		g.storeInventory(rejectID, inventoryObject{"Reject", encoding.Marshal("baz")})
+		g.mu.Unlock(id)
+	}
+	announce(g2, inventoryAnnouncement{"Reject", rejectID})
+	waitRequested(rejectID)
+	announce(g3, inventoryAnnouncement{"Reject", rejectID})
+	waitRequested(rejectID)
+	id = g1.mu.RLock()
+	seen = g1.seen.has(rejectID)
+	g1.mu.RUnlock(id)
+	if !seen || rejected != 1 {
+		t.Fatal("rejected object was not marked as seen:", seen, rejected)
+	}
+
+	// g2 stalls and then fails to serve the object, so g1 fetches it from
+	// g3, which announced it while g1 was waiting for g2.
+	g2.RegisterRPC("GetInv", func(modules.PeerConn) error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+	id = g3.mu.Lock()
+	g3.storeInventory(crypto.HashObject("foo"), inventoryObject{"Recv", encoding.Marshal("foo")})
+	g3.mu.Unlock(id)
+	ann := inventoryAnnouncement{"Recv", crypto.HashObject("foo")}
+	announce(g2, ann)
+	time.Sleep(50 * time.Millisecond)
+	announce(g3, ann)
+	select {
+	case payload := <-received:
+		if payload != "foo" {
+			t.Fatal("wrong object was received:", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("object was not fetched from the second announcer")
+	}
+	waitRequested(ann.ID)
+	id = g1.mu.RLock()
+	seen = g1.seen.has(ann.ID)
+	g1.mu.RUnlock(id)
+	if !seen {
+		t.Error("accepted object was not marked as seen")
+	}
+}
@@ -3,23 +3,78 @@ package gateway
 import (
 	"errors"
 	"math/rand"
+	"net"
+	"strconv"
+	"time"
 
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 const (
 	maxSharedNodes = 10
 	maxAddrLength  = 100
 	minPeers       = 3
+
+	// maxNodes is the maximum number of nodes in the address book. When it is
+	// full, the least promising node is evicted to make room for a new one.
+	maxNodes = 1000
+
+	// maxNodeFailures is the number of consecutive failed connection attempts
+	// after which a node is removed from the address book.
+	maxNodeFailures = 5
+
+	// recentlySeen is how long a node is considered to be "recently good"
+	// after we were last connected to it. Such nodes are more likely to be
+	// selected by randomNode.
+	recentlySeen = 24 * time.Hour
+)
+
+var (
+	errBadNodeAddress = errors.New("node address is invalid")
 )
 
-// addNode adds an address to the set of nodes on the network.
+// A node is an entry in the Gateway's address book. It records when we last
+// had a working connection to the node, when we last tried to connect to it,
+// and how many times in a row connecting has failed.
+type node struct {
+	LastSeen    types.Timestamp
+	LastAttempt types.Timestamp
+	Failures    uint64
+}
+
+// validNodeAddr returns an error if addr cannot be the address of a node,
+// i.e. if it does not consist of a host and a valid port number, or if the
+// host is the unspecified address.
+func validNodeAddr(addr modules.NetAddress) error {
+	if len(addr) > maxAddrLength {
+		return errBadNodeAddress
+	}
+	host, port, err := net.SplitHostPort(string(addr))
+	if err != nil || host == "" {
+		return errBadNodeAddress
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil || portNum <= 0 || portNum > 65535 {
+		return errBadNodeAddress
+	}
+	if unspecifiedAddr(addr) {
+		return errBadNodeAddress
+	}
+	return nil
+}
+
+// addNode adds an address to the set of nodes on the network. If the address
+// book is full, a node is evicted to make room.
 func (g *Gateway) addNode(addr modules.NetAddress) error {
 	if _, exists := g.nodes[addr]; exists {
 		return errors.New("node already added")
 	}
-	g.nodes[addr] = struct{}{}
+	if len(g.nodes) >= maxNodes {
+		g.evictNode()
+	}
+	g.nodes[addr] = new(node)
 	g.log.Println("INFO: added node", addr)
 	return nil
 }
@@ -33,17 +88,91 @@ func (g *Gateway) removeNode(addr modules.NetAddress) error {
 	return nil
 }
 
+// evictNode removes the least promising node from the address book: the node
+// that has failed the most consecutive connection attempts, or, among nodes
+// with equal failures, the one that was seen least recently. Our own address
+// and the addresses of current peers are never evicted.
+func (g *Gateway) evictNode() {
+	var worst modules.NetAddress
+	var worstNode *node
+	for addr, n := range g.nodes {
+		if _, isPeer := g.peers[addr]; isPeer || addr == g.myAddr {
+			continue
+		}
+		if worstNode == nil || n.Failures > worstNode.Failures ||
+			(n.Failures == worstNode.Failures && n.LastSeen < worstNode.LastSeen) {
+			worst, worstNode = addr, n
+		}
+	}
+	if worstNode != nil {
+		g.removeNode(worst)
+	}
+}
+
+// nodeSeen records that we have a working connection to addr, adding it to
+// the address book if necessary.
+func (g *Gateway) nodeSeen(addr modules.NetAddress) {
+	n, exists := g.nodes[addr]
+	if !exists {
+		if g.addNode(addr) != nil {
+			return
+		}
+		n = g.nodes[addr]
+	}
+	n.LastSeen = types.CurrentTimestamp()
+	n.Failures = 0
+}
+
+// nodeFailed records a failed attempt to connect to addr. Nodes that fail too
+// many times in a row are removed from the address book.
+func (g *Gateway) nodeFailed(addr modules.NetAddress) {
+	n, exists := g.nodes[addr]
+	if !exists || addr == g.myAddr {
+		return
+	}
+	n.LastAttempt = types.CurrentTimestamp()
+	n.Failures++
+	if n.Failures >= maxNodeFailures {
+		g.removeNode(addr)
+	}
+}
+
+// nodeWeight returns the relative likelihood that randomNode selects n. Each
+// consecutive failure halves the weight of a node, and nodes that were seen
+// recently are favored.
+func nodeWeight(n *node) uint64 {
+	weight := uint64(1<<maxNodeFailures) >> n.Failures
+	if n.LastSeen != 0 && time.Since(time.Unix(int64(n.LastSeen), 0)) < recentlySeen {
+		weight *= 4
+	}
+	return weight
+}
+
+// randomNode returns a random node from the address book, biased toward nodes
+// that have recently been connected to and away from nodes that have failed.
+// Banned nodes are never returned.
 func (g *Gateway) randomNode() (modules.NetAddress, error) {
-	if len(g.nodes) > 0 {
-		r := rand.Intn(len(g.nodes))
-		for node := range g.nodes {
-			if r == 0 {
-				return node, nil
-			}
-			r--
+	var total uint64
+	for addr, n := range g.nodes {
+		if !g.banActive(addr) {
+			total += nodeWeight(n)
 		}
 	}
+	if total == 0 {
+		return "", errNoPeers
+	}
 
+	r := uint64(rand.Int63n(int64(total)))
+	for addr, n := range g.nodes {
+		if g.banActive(addr) {
+			continue
+		}
+		w := nodeWeight(n)
+		if r < w {
+			return addr, nil
+		}
+		r -= w
+	}
 	return "", errNoPeers
 }
 
@@ -63,13 +192,16 @@ func (g *Gateway) shareNodes(conn modules.PeerConn) error {
 
 // relayNode adds a node to the Gateway's node list and relays it to each of
 // the Gateway's peers. If the node is already in the node list, it is not
-// relayed.
+// relayed. Invalid addresses are rejected.
 func (g *Gateway) relayNode(conn modules.PeerConn) error {
 	// read address
 	var addr modules.NetAddress
 	if err := encoding.ReadObject(conn, &addr, maxAddrLength); err != nil {
 		return err
 	}
+	if err := validNodeAddr(addr); err != nil {
+		return err
+	}
 	// add node
 	id := g.mu.Lock()
 	err := g.addNode(addr)
@@ -7,6 +7,7 @@ import (
 
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
 )
 
 func TestAddNode(t *testing.T) {
@@ -88,8 +89,8 @@ func TestShareNodes(t *testing.T) {
 	g2 := newTestingGateway("TestShareNodes2", t)
 	defer g2.Close()
 
-	// add a node to g2
-	g2.addNode("foo")
+	// add a node to g2; nodes received from peers must have valid addresses
+	g2.addNode("foo:9981")
 
 	// connect
 	err := g1.Connect(g2.Address())
@@ -98,18 +99,18 @@ func TestShareNodes(t *testing.T) {
 	}
 
 	// g1 should have received foo
-	if g1.addNode("foo") == nil {
+	if g1.addNode("foo:9981") == nil {
 		t.Fatal("gateway did not receive nodes during Connect:", g1.nodes)
 	}
 
 	// remove all nodes from both peers
-	g1.removeNode("foo")
+	g1.removeNode("foo:9981")
 	g1.removeNode(g1.Address())
 	g1.removeNode(g2.Address())
 	if len(g1.nodes) != 0 {
 		t.Fatal("gateway has nodes remaining after removal:", g1.nodes)
 	}
-	g2.removeNode("foo")
+	g2.removeNode("foo:9981")
 	g2.removeNode(g1.Address())
 	g2.removeNode(g2.Address())
 	if len(g2.nodes) != 0 {
@@ -171,3 +172,148 @@ func TestRelayNodes(t *testing.T) {
 		t.Fatal("node was not relayed:", g2.nodes)
 	}
 }
+
+// TestValidNodeAddr checks that only addresses with a host and a valid port
+// are accepted as node addresses.
+func TestValidNodeAddr(t *testing.T) {
+	for _, addr := range []modules.NetAddress{"foo:9981", "1.2.3.4:1", "[::1]:65535"} {
+		if err := validNodeAddr(addr); err != nil {
+			t.Errorf("valid address %v was rejected: %v", addr, err)
+		}
+	}
+	for _, addr := range []modules.NetAddress{"", "foo", ":9981", "foo:0", "foo:65536", "foo:bar", "0.0.0.0:9981", "[::]:9981"} {
+		if validNodeAddr(addr) != errBadNodeAddress {
+			t.Errorf("invalid address %q was accepted", addr)
+		}
+	}
+}
+
+// TestNodeFailures checks that failed connection attempts are recorded, that
+// a successful connection resets them, and that nodes which fail too often
+// are removed.
+func TestNodeFailures(t *testing.T) {
+	g := newTestingGateway("TestNodeFailures", t)
+	defer g.Close()
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+
+	g.addNode("foo:9981")
+	g.nodeFailed("foo:9981")
+	if n := g.nodes["foo:9981"]; n.Failures != 1 || n.LastAttempt == 0 {
+		t.Fatal("failure was not recorded:", n)
+	}
+	g.nodeSeen("foo:9981")
+	if n := g.nodes["foo:9981"]; n.Failures != 0 || n.LastSeen == 0 {
+		t.Fatal("success was not recorded:", n)
+	}
+	for i := 0; i < maxNodeFailures; i++ {
+		g.nodeFailed("foo:9981")
+	}
+	if _, exists := g.nodes["foo:9981"]; exists {
+		t.Fatal("node was not removed after", maxNodeFailures, "failures")
+	}
+
+	// Our own address is never removed.
+	for i := 0; i < maxNodeFailures; i++ {
+		g.nodeFailed(g.myAddr)
+	}
+	if _, exists := g.nodes[g.myAddr]; !exists {
+		t.Fatal("our own address was removed")
+	}
+}
+
+// TestEvictNode checks that the address book does not grow beyond maxNodes,
+// and that the least promising nodes are evicted first.
+func TestEvictNode(t *testing.T) {
+	g := newTestingGateway("TestEvictNode", t)
+	defer g.Close()
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+
+	for i := 0; len(g.nodes) < maxNodes; i++ {
+		g.addNode(modules.NetAddress("foo:" + strconv.Itoa(i+1)))
+		g.nodeSeen(modules.NetAddress("foo:" + strconv.Itoa(i+1)))
+	}
+	g.nodeFailed("foo:1")
+	g.addNode("bar:9981")
+	if len(g.nodes) != maxNodes {
+		t.Fatalf("address book has %v nodes, expected %v", len(g.nodes), maxNodes)
+	}
+	if _, exists := g.nodes["foo:1"]; exists {
+		t.Fatal("failing node was not evicted")
+	}
+
+	// Nodes that have never been seen are evicted before nodes that have.
+	g.addNode("baz:9981")
+	if _, exists := g.nodes["bar:9981"]; exists {
+		t.Fatal("unseen node was not evicted")
+	}
+	if _, exists := g.nodes[g.myAddr]; !exists {
+		t.Fatal("our own address was evicted")
+	}
+}
+
+// TestRandomNodeBias checks that randomNode prefers nodes that were recently
+// seen over nodes that have failed.
+func TestRandomNodeBias(t *testing.T) {
+	g := newTestingGateway("TestRandomNodeBias", t)
+	defer g.Close()
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+
+	g.removeNode(g.myAddr)
+	g.addNode("good:9981")
+	g.nodeSeen("good:9981")
+	g.addNode("bad:9981")
+	for i := 0; i < maxNodeFailures-1; i++ {
+		g.nodeFailed("bad:9981")
+	}
+
+	counts := make(map[modules.NetAddress]int)
+	for i := 0; i < 1000; i++ {
+		addr, err := g.randomNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[addr]++
+	}
+	// good has 64 times the weight of bad.
+	if counts["good:9981"] < 10*counts["bad:9981"] {
+		t.Fatal("randomNode was not biased toward the good node:", counts)
+	}
+}
+
+// TestRandomNodeBanned checks that randomNode never returns a banned node.
+func TestRandomNodeBanned(t *testing.T) {
+	g := newTestingGateway("TestRandomNodeBanned", t)
+	defer g.Close()
+	id := g.mu.Lock()
+	defer g.mu.Unlock(id)
+
+	g.removeNode(g.myAddr)
+	g.addNode("good:9981")
+	g.addNode("banned:9981")
+	g.bans["banned"] = modules.PeerBan{Host: "banned"}
+	for i := 0; i < 100; i++ {
+		addr, err := g.randomNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr == "banned:9981" {
+			t.Fatal("randomNode returned a banned node")
+		}
+	}
+
+	// An expired ban does not exclude the node.
+	g.bans["banned"] = modules.PeerBan{Host: "banned", Expiration: 1}
+	g.removeNode("good:9981")
+	if addr, err := g.randomNode(); err != nil || addr != "banned:9981" {
+		t.Error("randomNode excluded a node whose ban expired:", addr, err)
+	}
+
+	// A node whose ban has not expired is excluded.
+	g.bans["banned"] = modules.PeerBan{Host: "banned", Expiration: types.CurrentTimestamp() + 100}
+	if _, err := g.randomNode(); err != errNoPeers {
+		t.Error("randomNode returned a banned node:", err)
+	}
+}
@@ -11,12 +11,45 @@ import (
 	"github.com/inconshreveable/muxado"
 )
 
-const dialTimeout = 10 * time.Second
+const (
+	dialTimeout      = 10 * time.Second
+	handshakeTimeout = 10 * time.Second
+)
 
 type peer struct {
-	strikes uint32
-	addr    modules.NetAddress
-	sess    muxado.Session
+	addr modules.NetAddress
+	sess muxado.Session
+
+	// strikes counts the RPCs in which the peer violated the protocol.
+	// Strikes decay over time; see addStrike.
+	strikes    int
+	lastStrike time.Time
+
+	// inbound is true if the peer connected to us. handshake is the handshake
+	// that the peer sent when the connection was made.
+	inbound     bool
+	handshake   handshake
+	connectTime time.Time
+
+	// known holds the IDs of the objects that the peer has announced to us,
+	// or that we have announced to it.
+	known *inventorySet
+}
+
+// addStrike gives the peer a strike and returns its number of strikes. One
+// strike is forgiven for each strikeDecay that has passed since the peer's
+// last strike, so that a long-lived peer is not banned for occasional errors.
+func (p *peer) addStrike(now time.Time) int {
+	if p.strikes > 0 {
+		forgiven := int(now.Sub(p.lastStrike) / strikeDecay)
+		if forgiven > p.strikes {
+			forgiven = p.strikes
+		}
+		p.strikes -= forgiven
+	}
+	p.strikes++
+	p.lastStrike = now
+	return p.strikes
 }
 
 func (p *peer) open() (modules.PeerConn, error) {
@@ -35,11 +68,24 @@ func (p *peer) accept() (modules.PeerConn, error) {
 	return &peerConn{conn, p.addr}, nil
 }
 
+// numPeers returns the number of inbound or outbound peers.
+func (g *Gateway) numPeers(inbound bool) (n int) {
+	for _, p := range g.peers {
+		if p.inbound == inbound {
+			n++
+		}
+	}
+	return
+}
+
 // addPeer adds a peer to the Gateway's peer list and spawns a listener thread
 // to handle its requests.
 func (g *Gateway) addPeer(p *peer) {
+	if p.known == nil {
+		p.known = newInventorySet(maxKnownInventory)
+	}
 	g.peers[p.addr] = p
-	g.addNode(p.addr)
+	g.nodeSeen(p.addr)
 	go g.listenPeer(p)
 }
 
@@ -56,52 +102,118 @@ func (g *Gateway) listen() {
 	}
 }
 
-// acceptConn adds a connecting node as a peer.
-// TODO: reject when we have too many active connections
+// acceptConn adds a connecting node as a peer. The node sends its handshake,
+// which includes the address it is listening on. If we accept the handshake,
+// we respond with our own, which includes the IP address that we see the node
+// connecting from so that the node can learn its external IP. A node that does
+// not know its IP yet sends the unspecified address, which we replace. Nodes
+// are rejected if they are banned or if we have too many inbound peers.
 func (g *Gateway) acceptConn(conn net.Conn) {
-	var addr modules.NetAddress
-	if err := encoding.ReadObject(conn, &addr, maxAddrLength); err != nil {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	var theirs handshake
+	if err := encoding.ReadObject(conn, &theirs, maxHandshakeLen); err != nil {
 		conn.Close()
 		return
 	}
-	g.log.Printf("INFO: %v wants to connect (gave address: %v)", conn.RemoteAddr(), addr)
+	addr := theirs.Address
+	g.log.Printf("INFO: %v wants to connect (gave address: %v, version: %v)", conn.RemoteAddr(), addr, theirs.Version)
+	if unspecifiedAddr(addr) {
+		addr = modules.NetAddress(net.JoinHostPort(remoteIP(conn), addr.Port()))
+	}
+
 	id := g.mu.Lock()
-	g.addPeer(&peer{addr: addr, sess: muxado.Server(conn)})
+	err := g.checkHandshake(theirs)
+	if err == nil && (g.isBanned(modules.NetAddress(remoteIP(conn))) || g.isBanned(addr)) {
+		err = errPeerBanned
+	}
+	if err == nil && g.numPeers(true) >= maxInboundPeers {
+		err = errTooManyPeers
+	}
+	ours := g.ourHandshake(remoteIP(conn))
+	g.mu.Unlock(id)
+	if err != nil {
+		g.log.Printf("INFO: rejected connection from %v: %v", addr, err)
+		encoding.WriteObject(conn, err.Error())
+		conn.Close()
+		return
+	}
+	if err := encoding.WriteObject(conn, handshakeAccept); err != nil {
+		conn.Close()
+		return
+	}
+	if err := encoding.WriteObject(conn, ours); err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	id = g.mu.Lock()
+	g.addPeer(&peer{
+		addr:        addr,
+		sess:        muxado.Server(conn),
+		inbound:     true,
+		handshake:   theirs,
+		connectTime: time.Now(),
+	})
 	g.mu.Unlock(id)
 	g.log.Printf("INFO: accepted connection from new peer %v", addr)
 
-	// broadcast our new peer's address
-	g.Broadcast("RelayNode", addr)
+	// broadcast our new peer's address, if other nodes can connect to it
+	if validNodeAddr(addr) == nil {
+		g.Broadcast("RelayNode", addr)
+	}
 }
 
 // Connect establishes a persistent connection to a peer, and adds it to the
-// Gateway's peer list.
+// Gateway's peer list. Banned peers are refused, as are new peers when the
+// Gateway already has the maximum number of outbound peers.
 func (g *Gateway) Connect(addr modules.NetAddress) error {
 	if addr == g.Address() {
 		return errors.New("can't connect to our own address")
 	}
 
-	id := g.mu.RLock()
+	id := g.mu.Lock()
 	_, exists := g.peers[addr]
-	g.mu.RUnlock(id)
+	banned := g.isBanned(addr)
+	numOutbound := g.numPeers(false)
+	g.mu.Unlock(id)
 	if exists {
 		return errors.New("peer already added")
 	}
+	if banned {
+		return errPeerBanned
+	}
+	if numOutbound >= maxOutboundPeers {
+		return errTooManyPeers
+	}
 
 	conn, err := net.DialTimeout("tcp", string(addr), dialTimeout)
 	if err != nil {
+		id = g.mu.Lock()
+		g.nodeFailed(addr)
+		g.mu.Unlock(id)
 		return err
 	}
-	// send our address
-	if err := encoding.WriteObject(conn, g.Address()); err != nil {
+	// exchange handshakes, learning the IP that the peer sees us at
+	theirs, err := g.connectHandshake(conn)
+	if err != nil {
+		conn.Close()
+		id = g.mu.Lock()
+		g.nodeFailed(addr)
+		g.mu.Unlock(id)
 		return err
 	}
-	// TODO: exchange version messages
 
-	g.log.Println("INFO: connected to new peer", addr)
+	g.log.Printf("INFO: connected to new peer %v (version: %v)", addr, theirs.Version)
 
 	id = g.mu.Lock()
-	g.addPeer(&peer{addr: addr, sess: muxado.Client(conn)})
+	g.addPeer(&peer{
+		addr:        addr,
+		sess:        muxado.Client(conn),
+		handshake:   theirs,
+		connectTime: time.Now(),
+	})
+	g.recordAddrReport(addr, theirs.YourIP)
 	g.mu.Unlock(id)
 
 	// request nodes
@@ -117,7 +229,9 @@ func (g *Gateway) Connect(addr modules.NetAddress) error {
 	g.log.Printf("INFO: %v sent us %v peers", addr, len(nodes))
 	id = g.mu.Lock()
 	for _, node := range nodes {
-		g.addNode(node)
+		if validNodeAddr(node) == nil {
+			g.addNode(node)
+		}
 	}
 	g.save()
 	g.mu.Unlock(id)
@@ -125,8 +239,39 @@ func (g *Gateway) Connect(addr modules.NetAddress) error {
 	return nil
 }
 
+// connectHandshake performs the connecting node's half of the handshake,
+// returning the handshake of the node that was connected to.
+func (g *Gateway) connectHandshake(conn net.Conn) (theirs handshake, err error) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	id := g.mu.RLock()
+	ours := g.ourHandshake("")
+	g.mu.RUnlock(id)
+	if err = encoding.WriteObject(conn, ours); err != nil {
+		return
+	}
+	var response string
+	if err = encoding.ReadObject(conn, &response, maxHandshakeLen); err != nil {
+		return
+	}
+	if response != handshakeAccept {
+		err = errors.New("peer rejected handshake: " + response)
+		return
+	}
+	if err = encoding.ReadObject(conn, &theirs, maxHandshakeLen); err != nil {
+		return
+	}
+	id = g.mu.RLock()
+	err = g.checkHandshake(theirs)
+	g.mu.RUnlock(id)
+	return
+}
+
 // Disconnect terminates a connection to a peer and removes it from the
-// Gateway's peer list. The peer's address remains in the node list.
+// Gateway's peer list. The peer's address remains in the node list, with the
+// record of when it was last seen and how often connecting to it has failed
+// left unchanged.
 func (g *Gateway) Disconnect(addr modules.NetAddress) error {
 	id := g.mu.RLock()
 	p, exists := g.peers[addr]
@@ -137,6 +282,7 @@ func (g *Gateway) Disconnect(addr modules.NetAddress) error {
 	p.sess.Close()
 	id = g.mu.Lock()
 	delete(g.peers, addr)
+	delete(g.addrReports, addr)
 	g.mu.Unlock(id)
 
 	g.log.Println("INFO: disconnected from peer", addr)
@@ -151,10 +297,10 @@ func (g *Gateway) makeOutboundConnections() {
 	for {
 		for i := 0; i < 100; i++ {
 			id := g.mu.RLock()
-			numPeers := len(g.peers)
+			numOutbound := g.numPeers(false)
 			addr, err := g.randomNode()
 			g.mu.RUnlock(id)
-			if err != nil || numPeers >= 8 {
+			if err != nil || numOutbound >= maxOutboundPeers {
 				break
 			}
 			g.Connect(addr)
@@ -3,9 +3,11 @@ package gateway
 import (
 	"net"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/inconshreveable/muxado"
@@ -33,8 +35,8 @@ func TestListen(t *testing.T) {
 	if err != nil {
 		t.Fatal("dial failed:", err)
 	}
-	if err := encoding.WriteObject(conn, "foo"); err != nil {
-		t.Fatal("couldn't write address")
+	if err := encoding.WriteObject(conn, handshake{ProtocolVersion: protocolVersion, Address: "foo"}); err != nil {
+		t.Fatal("couldn't write handshake")
 	}
 	// g should add foo
 	var ok bool
@@ -73,7 +75,7 @@ func TestConnect(t *testing.T) {
 	defer bootstrap.Close()
 
 	// give it a node
-	bootstrap.addNode("foo")
+	bootstrap.addNode("foo:9981")
 
 	// create peer who will connect to bootstrap
 	g := newTestingGateway("TestConnect2", t)
@@ -89,7 +91,7 @@ func TestConnect(t *testing.T) {
 		t.Fatal(err)
 	}
 	// g should not have foo
-	if g.removeNode("foo") == nil {
+	if g.removeNode("foo:9981") == nil {
 		t.Fatal("bootstrapper should not have received foo:", g.nodes)
 	}
 
@@ -104,11 +106,66 @@ func TestConnect(t *testing.T) {
 		t.Fatal(err)
 	}
 	// g should have foo
-	if g.removeNode("foo") != nil {
+	if g.removeNode("foo:9981") != nil {
 		t.Fatal("bootstrapper should have received foo:", g.nodes)
 	}
 }
 
+// TestHandshake checks that the handshake rejects incompatible peers and
+// connections to ourselves, and records information about peers.
+func TestHandshake(t *testing.T) {
+	g1 := newTestingGateway("TestHandshake1", t)
+	defer g1.Close()
+	g2 := newTestingGateway("TestHandshake2", t)
+	defer g2.Close()
+
+	// A peer using an old protocol version is rejected.
+	conn, err := net.Dial("tcp", string(g1.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = encoding.WriteObject(conn, handshake{ProtocolVersion: minProtocolVersion - 1, Address: "foo:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response string
+	err = encoding.ReadObject(conn, &response, maxHandshakeLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response != errIncompatiblePeer.Error() {
+		t.Error("expected peer to be rejected as incompatible, got", response)
+	}
+
+	// A connection to ourselves at a different address is rejected.
+	err = g1.Connect(modules.NetAddress(net.JoinHostPort("127.0.0.1", g1.Address().Port())))
+	if err == nil || !strings.Contains(err.Error(), errSelfConnection.Error()) {
+		t.Error("expected self connection to be rejected, got", err)
+	}
+
+	// Both sides of a successful connection record each other's information.
+	err = g1.Connect(g2.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(g2.Peers()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	info1, info2 := g1.PeerInfo(), g2.PeerInfo()
+	if len(info1) != 1 || info1[0].Inbound || info1[0].Address != g2.Address() {
+		t.Error("g1 has bad peer info:", info1)
+	}
+	if len(info2) != 1 || !info2[0].Inbound || info2[0].Address != g1.Address() {
+		t.Error("g2 has bad peer info:", info2)
+	}
+	for _, info := range append(info1, info2...) {
+		if info.ProtocolVersion != protocolVersion || info.Version != build.Version || info.ConnectTime.IsZero() {
+			t.Error("peer info is missing handshake information:", info)
+		}
+	}
+}
+
 func TestDisconnect(t *testing.T) {
 	g := newTestingGateway("TestDisconnect", t)
 	defer g.Close()
@@ -136,10 +193,18 @@ func TestDisconnect(t *testing.T) {
 	}
 	id := g.mu.Lock()
 	g.addPeer(&peer{addr: "foo", sess: muxado.Client(conn)})
+	g.nodes["foo"].Failures = 2
 	g.mu.Unlock(id)
 	if err := g.Disconnect("foo"); err != nil {
 		t.Fatal("disconnect failed:", err)
 	}
+
+	// Disconnecting does not count as seeing the node.
+	id = g.mu.RLock()
+	defer g.mu.RUnlock(id)
+	if n := g.nodes["foo"]; n == nil || n.Failures != 2 {
+		t.Error("disconnect changed the node's record:", n)
+	}
 }
 
 func TestMakeOutboundConnections(t *testing.T) {
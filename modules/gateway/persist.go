@@ -9,22 +9,50 @@ import (
 	"github.com/NebulousLabs/Sia/modules"
 )
 
+// A savedNode is an entry of the address book as it is stored on disk.
+type savedNode struct {
+	Address modules.NetAddress
+	Node    node
+}
+
 func (g *Gateway) save() error {
-	var nodes []modules.NetAddress
-	for node := range g.nodes {
-		nodes = append(nodes, node)
+	var nodes []savedNode
+	for addr, n := range g.nodes {
+		nodes = append(nodes, savedNode{addr, *n})
 	}
 	return encoding.WriteFile(filepath.Join(g.saveDir, "nodes.dat"), nodes)
 }
 
 func (g *Gateway) load() error {
-	var nodes []modules.NetAddress
+	var nodes []savedNode
 	err := encoding.ReadFile(filepath.Join(g.saveDir, "nodes.dat"), &nodes)
 	if err != nil {
 		return err
 	}
-	for _, node := range nodes {
-		g.addNode(node)
+	for _, sn := range nodes {
+		if g.addNode(sn.Address) == nil {
+			*g.nodes[sn.Address] = sn.Node
+		}
+	}
+	return nil
+}
+
+func (g *Gateway) saveBans() error {
+	var bans []modules.PeerBan
+	for _, b := range g.bans {
+		bans = append(bans, b)
+	}
+	return encoding.WriteFile(filepath.Join(g.saveDir, "bans.dat"), bans)
+}
+
+func (g *Gateway) loadBans() error {
+	var bans []modules.PeerBan
+	err := encoding.ReadFile(filepath.Join(g.saveDir, "bans.dat"), &bans)
+	if err != nil {
+		return err
+	}
+	for _, b := range bans {
+		g.bans[b.Host] = b
 	}
 	return nil
 }
@@ -15,7 +15,7 @@ func TestLoad(t *testing.T) {
 	g.mu.Unlock(id)
 	g.Close()
 
-	g2, err := New(":0", g.saveDir)
+	g2, err := New(":0", "", g.saveDir)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -36,7 +36,7 @@ func TestLoadPeer(t *testing.T) {
 	g1.Close()
 
 	// g1 should reconnect to g2 upon load
-	g1, err = New(":0", g1.saveDir)
+	g1, err = New(":0", "", g1.saveDir)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -46,3 +46,28 @@ func TestLoadPeer(t *testing.T) {
 		t.Fatalf("gateway did not reconnect to loaded peer: expected %v, got %v", []modules.NetAddress{g2.Address()}, peers)
 	}
 }
+
+// TestLoadNodeRecords checks that the address book records are saved along
+// with the node addresses.
+func TestLoadNodeRecords(t *testing.T) {
+	g := newTestingGateway("TestLoadNodeRecords", t)
+	id := g.mu.Lock()
+	g.addNode("foo:9981")
+	g.nodeSeen("foo:9981")
+	g.nodeFailed("foo:9981")
+	saved := *g.nodes["foo:9981"]
+	g.save()
+	g.mu.Unlock(id)
+	g.Close()
+
+	g2, err := New(":0", "", g.saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g2.Close()
+	id = g2.mu.RLock()
+	defer g2.mu.RUnlock(id)
+	if n, ok := g2.nodes["foo:9981"]; !ok || *n != saved {
+		t.Fatalf("gateway did not load node record: expected %v, got %v", saved, n)
+	}
+}
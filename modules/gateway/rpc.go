@@ -3,7 +3,6 @@ package gateway
 import (
 	"errors"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/NebulousLabs/Sia/encoding"
@@ -40,11 +39,12 @@ func (g *Gateway) RPC(addr modules.NetAddress, name string, fn modules.RPCFunc)
 		return errors.New("can't call RPC on unconnected peer " + string(addr))
 	}
 
-	conn, err := peer.open()
+	pc, err := peer.open()
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer pc.Close()
+	conn := &rpcConn{PeerConn: pc}
 
 	// write header
 	if err := encoding.WriteObject(conn, handlerName(name)); err != nil {
@@ -52,10 +52,12 @@ func (g *Gateway) RPC(addr modules.NetAddress, name string, fn modules.RPCFunc)
 	}
 	// call fn
 	err = fn(conn)
-	if err != nil {
-		// TODO: log error here?
-		// give peer a strike
-		atomic.AddUint32(&peer.strikes, 1)
+	if err != nil && !conn.connFailed() {
+		// The peer violated the protocol; give it a strike, banning it if it
+		// has too many. Failures of the connection itself, such as timeouts,
+		// are not the peer's fault and do not count.
+		g.log.Printf("WARN: RPC \"%v\" on peer %v failed: %v", name, addr, err)
+		g.Strike(addr)
 	}
 	return err
 }
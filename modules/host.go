@@ -1,6 +1,7 @@
 package modules
 
 import (
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/types"
 )
 
@@ -20,13 +21,133 @@ type ContractTerms struct {
 	Collateral         types.Currency        // Host contribution towards payout each window
 	ValidProofOutputs  []types.SiacoinOutput // Where money goes if the storage proof is successful.
 	MissedProofOutputs []types.SiacoinOutput // Where the money goes if the storage proof fails.
+	RenterKey          types.SiaPublicKey    // The key that the renter uses to sign download requests.
 }
 
+// RetrievalUnlockConditions returns the unlock conditions of a file contract,
+// which commit to the renter's download key. Revising the contract requires
+// the signatures of both the renter and the host.
+func RetrievalUnlockConditions(renterKey, hostKey types.SiaPublicKey) types.UnlockConditions {
+	return types.UnlockConditions{
+		PublicKeys:         []types.SiaPublicKey{renterKey, hostKey},
+		SignaturesRequired: 2,
+	}
+}
+
+// A RetrieveRequest asks a host for 'Length' bytes of a file, starting at
+// 'Offset'. The request is signed by the key that the file contract commits
+// to, so that only the renter can download the file.
+type RetrieveRequest struct {
+	ContractID types.FileContractID
+	Offset     uint64
+	Length     uint64
+	RenterKey  types.SiaPublicKey
+	Signature  crypto.Signature
+}
+
+// SigHash returns the hash that is signed by the renter. The challenge is a
+// random value chosen by the host, which prevents requests from being
+// replayed.
+func (rr RetrieveRequest) SigHash(challenge crypto.Hash) crypto.Hash {
+	return crypto.HashAll(challenge, rr.ContractID, rr.Offset, rr.Length)
+}
+
+// SegmentRange returns the range of Merkle tree segments, [start, end), that
+// contain the requested bytes.
+func (rr RetrieveRequest) SegmentRange() (start, end uint64) {
+	start = rr.Offset / crypto.SegmentSize
+	end = crypto.CalculateSegments(rr.Offset + rr.Length)
+	return
+}
+
+// DownloadTerms are sent by a host at the start of a download. They state the
+// cost of the download and the address that payment must be sent to. The
+// renter responds with a transaction paying the cost to the address.
+type DownloadTerms struct {
+	Cost       types.Currency
+	UnlockHash types.UnlockHash
+}
+
+// A HostPricingPolicy describes how the host sets its price. When the policy
+// is enabled, the host recomputes its price every block and updates its
+// settings whenever the computed price changes.
+//
+// The starting price comes from TargetPrice if both TargetPrice and
+// ReferenceRate are set, and from BasePrice otherwise. TargetPrice is the
+// desired price in an external reference unit (such as cents) per terabyte
+// per month, and ReferenceRate is the number of hastings per reference unit.
+// The starting price is then increased according to how much of the host's
+// storage is in use, reaching an increase of UtilizationPremium percent when
+// all of the storage is in use. Finally, the price is clamped to be between
+// MinPrice and MaxPrice. A MaxPrice of zero means there is no upper bound.
+type HostPricingPolicy struct {
+	Enabled bool
+
+	BasePrice          types.Currency
+	TargetPrice        types.Currency
+	ReferenceRate      types.Currency
+	UtilizationPremium uint64
+
+	MinPrice types.Currency
+	MaxPrice types.Currency
+}
+
+// HostLimits protect the host from clients that would exhaust its resources.
+// MaxConnections is the number of connections that the host will serve at
+// once, and MaxRPCsPerIP is the number of RPCs that a single IP address may
+// call per minute. Timeout is the number of seconds that the host allows for
+// an RPC; RPCs that transfer files are also given time to transfer them. UploadLimit and DownloadLimit cap the
+// bandwidth, in bytes per second, that the host uses to send and receive data
+// across all connections. A limit of zero means there is no limit.
+type HostLimits struct {
+	MaxConnections uint64
+	MaxRPCsPerIP   uint64
+	Timeout        uint64
+
+	UploadLimit   uint64
+	DownloadLimit uint64
+}
+
+// HostContractInfo reports the status of a single file contract held by the
+// host, along with the host's financial stake in the contract.
+type HostContractInfo struct {
+	ID          types.FileContractID
+	FileSize    uint64
+	WindowStart types.BlockHeight
+	WindowEnd   types.BlockHeight
+
+	// Collateral is the amount of money the host put into the contract, and
+	// Revenue is the amount of money the host will earn if it submits a valid
+	// storage proof.
+	Collateral types.Currency
+	Revenue    types.Currency
+
+	ContractConfirmed bool
+	ProofConfirmed    bool
+}
+
+// HostInfo contains the settings of the host along with information about the
+// host's storage and finances.
 type HostInfo struct {
 	HostSettings
 
 	StorageRemaining int64
 	NumContracts     int
+
+	// LockedCollateral and AnticipatedRevenue are the totals of the collateral
+	// and revenue in confirmed contracts that have not yet been resolved.
+	// RevenueRealized is the revenue earned from storage proofs that have been
+	// buried in the blockchain, and CollateralLost is the collateral lost to
+	// missed storage proofs.
+	LockedCollateral   types.Currency
+	AnticipatedRevenue types.Currency
+	RevenueRealized    types.Currency
+	CollateralLost     types.Currency
+
+	// DownloadRevenue is the revenue earned from download payments.
+	DownloadRevenue types.Currency
+
+	Contracts []HostContractInfo
 }
 
 type Host interface {
@@ -36,17 +157,35 @@ type Host interface {
 	// Announce announces the host on the blockchain.
 	Announce() error
 
+	// AnnounceAddress announces the host on the blockchain at the given
+	// address, which may be a hostname. The host uses the address from then
+	// on instead of discovering its own.
+	AnnounceAddress(NetAddress) error
+
 	// HostNotify will push a struct down the channel every time that an update
 	// is received.
 	HostNotify() <-chan struct{}
 
+	// Limits returns the limits that the host places on its connections.
+	Limits() HostLimits
+
+	// PricingPolicy returns the host's pricing policy.
+	PricingPolicy() HostPricingPolicy
+
 	// SetConfig sets the hosting parameters of the host.
 	SetSettings(HostSettings)
 
+	// SetLimits sets the limits that the host places on its connections.
+	SetLimits(HostLimits)
+
+	// SetPricingPolicy sets the policy used by the host to set its price.
+	SetPricingPolicy(HostPricingPolicy) error
+
 	// Settings returns the host's settings.
 	Settings() HostSettings
 
 	// Info returns info about the host, including its hosting parameters, the
-	// amount of storage remaining, and the number of active contracts.
+	// amount of storage remaining, the active contracts, and the host's
+	// revenue and collateral.
 	Info() HostInfo
 }
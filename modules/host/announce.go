@@ -1,44 +1,126 @@
 package host
 
 import (
+	"errors"
+	"net"
+	"time"
+
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
-// Announce creates a host announcement transaction, adding information to the
-// arbitrary data, signing the transaction, and submitting it to the
-// transaction pool.
-func (h *Host) Announce() (err error) {
-	lockID := h.mu.Lock()
-	defer h.mu.Unlock(lockID)
+const (
+	// addressCheckInterval is how often the host checks whether its external
+	// address has changed.
+	addressCheckInterval = time.Minute
+)
 
+var (
+	errBadAnnounceAddress = errors.New("announce address must be of the form host:port")
+	errUnknownAddress     = errors.New("external IP is not known yet; specify an address to announce")
+)
+
+// announce creates a host announcement transaction for the given address,
+// adding information to the arbitrary data, signing the transaction, and
+// submitting it to the transaction pool. If the announcement is submitted, the
+// address is remembered so that the host knows when it needs to announce
+// itself again.
+func (h *Host) announce(addr modules.NetAddress) error {
 	// create the transaction that will hold the announcement
 	var t types.Transaction
 	id, err := h.wallet.RegisterTransaction(t)
 	if err != nil {
-		return
+		return err
 	}
 
 	// create and encode the announcement and add it to the arbitrary data of
 	// the transaction.
 	announcement := encoding.Marshal(modules.HostAnnouncement{
-		IPAddress: h.myAddr,
+		IPAddress: addr,
+		PublicKey: h.PublicKey,
 	})
 	_, _, err = h.wallet.AddArbitraryData(id, modules.PrefixHostAnnouncement+string(announcement))
 	if err != nil {
-		return
+		return err
 	}
 	t, err = h.wallet.SignTransaction(id, true)
 	if err != nil {
-		return
+		return err
 	}
 
 	// Add the transaction to the transaction pool.
 	err = h.tpool.AcceptTransaction(t)
 	if err != nil {
-		return
+		return err
+	}
+
+	h.announcedAddr = addr
+	h.log.Println("INFO: host announced at", addr)
+	return h.save()
+}
+
+// Announce announces the host on the blockchain at its current address.
+func (h *Host) Announce() error {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	if ip := net.ParseIP(h.myAddr.Host()); ip != nil && ip.IsUnspecified() {
+		return errUnknownAddress
+	}
+	return h.announce(h.myAddr)
+}
+
+// AnnounceAddress announces the host on the blockchain at a user-specified
+// address, which may use a hostname instead of an IP address. The host keeps
+// the address from then on instead of discovering its own, so it does not
+// re-announce when its IP address changes.
+func (h *Host) AnnounceAddress(addr modules.NetAddress) error {
+	host, port, err := net.SplitHostPort(string(addr))
+	if err != nil || host == "" || port == "" {
+		return errBadAnnounceAddress
 	}
 
-	return
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	h.userAddr = addr
+	h.myAddr = addr
+	return h.announce(addr)
+}
+
+// updateAddress is called with the external hostname known to the gateway. If
+// the host has announced itself at a different address, it announces itself
+// again at the new address. Addresses specified by the user are never
+// replaced.
+func (h *Host) updateAddress(hostname string) error {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	if h.userAddr != "" {
+		return nil
+	}
+	if ip := net.ParseIP(hostname); ip != nil && ip.IsUnspecified() {
+		return nil
+	}
+
+	addr := modules.NetAddress(net.JoinHostPort(hostname, h.myAddr.Port()))
+	if addr != h.myAddr {
+		h.log.Println("INFO: host address changed from", h.myAddr, "to", addr)
+		h.myAddr = addr
+	}
+	if h.announcedAddr == "" || h.announcedAddr == h.myAddr {
+		return nil
+	}
+	return h.announce(h.myAddr)
+}
+
+// threadedCheckAddress periodically checks the external address learned by
+// the gateway, re-announcing the host when the address changes. Failed
+// announcements are retried at the next check.
+func (h *Host) threadedCheckAddress() {
+	for {
+		time.Sleep(addressCheckInterval)
+		err := h.updateAddress(h.gateway.Address().Host())
+		if err != nil {
+			h.log.Println("WARN: could not update host address:", err)
+		}
+	}
 }
@@ -31,3 +31,108 @@ func TestAnnouncement(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// announcedAddress returns the address in the most recent announcement in the
+// transaction pool.
+func (ht *hostTester) announcedAddress() modules.NetAddress {
+	txns := ht.tpool.TransactionSet()
+	if len(txns) == 0 {
+		ht.t.Fatal("no announcement in the transaction pool")
+	}
+	encodedAnnouncement := strings.TrimPrefix(txns[len(txns)-1].ArbitraryData[0], modules.PrefixHostAnnouncement)
+	var ha modules.HostAnnouncement
+	err := encoding.Unmarshal([]byte(encodedAnnouncement), &ha)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	return ha.IPAddress
+}
+
+// TestAnnounceAddress checks that the host can be announced at a hostname,
+// and that the host keeps using the hostname.
+func TestAnnounceAddress(t *testing.T) {
+	ht := CreateHostTester("TestAnnounceAddress", t)
+
+	// Malformed addresses are rejected.
+	for _, addr := range []modules.NetAddress{"", "host.example.com", ":9982", "host.example.com:"} {
+		if ht.host.AnnounceAddress(addr) != errBadAnnounceAddress {
+			t.Error("malformed address was accepted:", addr)
+		}
+	}
+
+	addr := modules.NetAddress("host.example.com:9982")
+	err := ht.host.AnnounceAddress(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.announcedAddress() != addr {
+		t.Error("announcement has the wrong address:", ht.announcedAddress())
+	}
+	if ht.host.Address() != addr {
+		t.Error("host did not adopt the announced address")
+	}
+
+	// A change in the host's IP address does not replace the user's address.
+	err = ht.host.updateAddress("1.2.3.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.Address() != addr {
+		t.Error("user address was replaced by", ht.host.Address())
+	}
+}
+
+// TestUpdateAddress checks that the host re-announces itself when its address
+// changes, but only if it has announced itself before.
+func TestUpdateAddress(t *testing.T) {
+	ht := CreateHostTester("TestUpdateAddress", t)
+	port := ht.host.Address().Port()
+
+	// A host that has not announced itself only updates its address.
+	err := ht.host.updateAddress("1.2.3.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.Address() != modules.NetAddress("1.2.3.4:"+port) {
+		t.Error("host address was not updated:", ht.host.Address())
+	}
+	if len(ht.tpool.TransactionSet()) != 0 {
+		t.Error("host announced itself without being asked to")
+	}
+
+	// The unspecified address, used by the gateway before it learns its IP,
+	// is ignored, and the host cannot announce itself at it.
+	err = ht.host.updateAddress("::")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.Address() != modules.NetAddress("1.2.3.4:"+port) {
+		t.Error("host adopted the unspecified address")
+	}
+	ht.host.myAddr = modules.NetAddress("[::]:" + port)
+	if ht.host.Announce() != errUnknownAddress {
+		t.Error("host announced itself at the unspecified address")
+	}
+	ht.host.myAddr = modules.NetAddress("1.2.3.4:" + port)
+
+	// Once the host has announced itself, an address change causes the host
+	// to announce itself again.
+	err = ht.host.Announce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.updateAddress("1.2.3.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ht.tpool.TransactionSet()) != 1 {
+		t.Error("host re-announced at an unchanged address")
+	}
+	err = ht.host.updateAddress("5.6.7.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.announcedAddress() != modules.NetAddress("5.6.7.8:"+port) {
+		t.Error("host did not re-announce at its new address:", ht.announcedAddress())
+	}
+}
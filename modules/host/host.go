@@ -2,12 +2,12 @@ package host
 
 import (
 	"errors"
-	"io"
+	"log"
 	"net"
-	"net/http"
 	"os"
 
-	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
 	"github.com/NebulousLabs/Sia/sync"
@@ -19,7 +19,19 @@ const (
 	// a storage proof. This reduces the chance of needing to resubmit because
 	// of a reorg.
 	StorageProofReorgDepth = 20
-	maxContractLen         = 1 << 16 // The maximum allowed size of a file contract coming in over the wire. This does not include the file.
+
+	// StorageProofResubmitInterval is the number of blocks that the host will
+	// wait for a submitted storage proof to appear in the blockchain before
+	// submitting it again.
+	StorageProofResubmitInterval = 6
+
+	// ContractConfirmationTimeout is the number of blocks that the host will
+	// wait for a newly negotiated file contract to appear in the blockchain.
+	// If the contract does not appear in time, the obligation is dropped and
+	// the storage is freed.
+	ContractConfirmationTimeout = 36
+
+	maxContractLen = 1 << 16 // The maximum allowed size of a file contract coming in over the wire. This does not include the file.
 )
 
 // A contractObligation tracks a file contract that the host is obligated to
@@ -28,39 +40,97 @@ type contractObligation struct {
 	ID           types.FileContractID
 	FileContract types.FileContract
 	Path         string // Where on disk the file is stored.
+
+	// ContractConfirmed is set when the file contract appears in the
+	// blockchain. If the contract is not confirmed by ConfirmationDeadline,
+	// the obligation is dropped.
+	ContractConfirmed    bool
+	ConfirmationDeadline types.BlockHeight
+
+	// Collateral is the amount of money the host added to the contract.
+	Collateral types.Currency
+
+	// ProofConfirmed is set when a storage proof for the contract appears in
+	// the blockchain, and ProofHeight is the height of the block containing
+	// the proof. The file is kept until the proof is StorageProofReorgDepth
+	// blocks deep.
+	ProofConfirmed bool
+	ProofHeight    types.BlockHeight
 }
 
 // A Host contains all the fields necessary for storing files for clients and
 // performing the storage proofs on the received files.
 type Host struct {
 	cs          *consensus.State
+	gateway     modules.Gateway
 	tpool       modules.TransactionPool
 	wallet      modules.Wallet
 	blockHeight types.BlockHeight
 
-	myAddr         modules.NetAddress
+	// lastChange is the ID of the last consensus change that the host has
+	// processed. It is saved with the host, so that the host only receives
+	// the changes that came after it when it is restarted.
+	lastChange modules.ConsensusChangeID
+
+	// myAddr is the address that the host is reachable at. userAddr is the
+	// address chosen by the user, if any, which takes the place of the
+	// discovered address. announcedAddr is the address in the host's latest
+	// announcement.
+	myAddr        modules.NetAddress
+	userAddr      modules.NetAddress
+	announcedAddr modules.NetAddress
+
 	saveDir        string
 	spaceRemaining int64
 	fileCounter    int
 
+	// revenueRealized is the revenue earned from contracts whose storage
+	// proofs have been buried in the blockchain. collateralLost is the
+	// collateral lost from contracts that missed their storage proofs.
+	revenueRealized types.Currency
+	collateralLost  types.Currency
+
+	// downloadRevenue is the revenue earned from download payments.
+	downloadRevenue types.Currency
+
 	listener net.Listener
 
-	obligationsByID     map[types.FileContractID]contractObligation
-	obligationsByHeight map[types.BlockHeight][]contractObligation
+	// limits protect the host from clients that would exhaust its resources.
+	// activeConns and rpcCounters track the connections that count against
+	// the limits.
+	limits          modules.HostLimits
+	activeConns     uint64
+	rpcCounters     map[string]*rpcCounter
+	uploadLimiter   bandwidthLimiter
+	downloadLimiter bandwidthLimiter
+
+	// secretKey is used to sign session handshakes. The corresponding public
+	// key is published in the host's announcement and settings.
+	secretKey crypto.SecretKey
+
+	obligationsByID     map[types.FileContractID]*contractObligation
+	obligationsByHeight map[types.BlockHeight][]*contractObligation
 
 	modules.HostSettings
+	pricingPolicy modules.HostPricingPolicy
 
 	subscriptions []chan struct{}
 
+	log *log.Logger
+
 	mu *sync.RWMutex
 }
 
 // New returns an initialized Host.
-func New(cs *consensus.State, tpool modules.TransactionPool, wallet modules.Wallet, addr string, saveDir string) (h *Host, err error) {
+func New(cs *consensus.State, g modules.Gateway, tpool modules.TransactionPool, wallet modules.Wallet, addr string, saveDir string) (h *Host, err error) {
 	if cs == nil {
 		err = errors.New("host cannot use a nil state")
 		return
 	}
+	if g == nil {
+		err = errors.New("host cannot use a nil gateway")
+		return
+	}
 	if tpool == nil {
 		err = errors.New("host cannot use a nil tpool")
 		return
@@ -75,9 +145,10 @@ func New(cs *consensus.State, tpool modules.TransactionPool, wallet modules.Wall
 		return
 	}
 	h = &Host{
-		cs:     cs,
-		tpool:  tpool,
-		wallet: wallet,
+		cs:      cs,
+		gateway: g,
+		tpool:   tpool,
+		wallet:  wallet,
 
 		// default host settings
 		HostSettings: modules.HostSettings{
@@ -93,8 +164,11 @@ func New(cs *consensus.State, tpool modules.TransactionPool, wallet modules.Wall
 		saveDir:        saveDir,
 		spaceRemaining: 2e9,
 
-		obligationsByID:     make(map[types.FileContractID]contractObligation),
-		obligationsByHeight: make(map[types.BlockHeight][]contractObligation),
+		obligationsByID:     make(map[types.FileContractID]*contractObligation),
+		obligationsByHeight: make(map[types.BlockHeight][]*contractObligation),
+
+		limits:      defaultLimits,
+		rpcCounters: make(map[string]*rpcCounter),
 
 		mu: sync.New(modules.SafeMutexDelay, 1),
 	}
@@ -103,40 +177,74 @@ func New(cs *consensus.State, tpool modules.TransactionPool, wallet modules.Wall
 	if err != nil {
 		return
 	}
-	h.myAddr = modules.NetAddress(h.listener.Addr().String())
+	// The host is reachable at the same IP as the gateway.
+	h.myAddr = modules.NetAddress(net.JoinHostPort(g.Address().Host(), modules.NetAddress(h.listener.Addr().String()).Port()))
 
-	// discover external IP (during testing, use the loopback address)
-	var hostname string
-	if build.Release == "testing" {
-		hostname = "::1"
-	} else {
-		hostname, err = getExternalIP()
-		if err != nil {
-			return nil, err
-		}
+	err = os.MkdirAll(saveDir, 0700)
+	if err != nil {
+		return
+	}
+	h.log, err = makeLogger(saveDir)
+	if err != nil {
+		return
 	}
-	h.myAddr = modules.NetAddress(net.JoinHostPort(hostname, h.myAddr.Port()))
 
-	err = os.MkdirAll(saveDir, 0700)
+	// Generate the host's key, which is replaced by the saved key if the host
+	// has been run before.
+	sk, pk, err := crypto.GenerateSignatureKeys()
 	if err != nil {
 		return
 	}
-	h.load()
+	h.secretKey = sk
+	h.PublicKey = types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       string(encoding.Marshal(pk)),
+	}
+	// Load the saved host. If it doesn't exist, the host is new, but any
+	// other error must not be hidden by overwriting the saved host with the
+	// defaults.
+	if loadErr := h.load(); loadErr != nil && !os.IsNotExist(loadErr) {
+		h.listener.Close()
+		return nil, loadErr
+	}
+	h.uploadLimiter.setRate(h.limits.UploadLimit)
+	h.downloadLimiter.setRate(h.limits.DownloadLimit)
+	h.save()
+	h.log.Println("INFO: host created, started logging")
 
 	// spawn listener
 	go h.listen()
 
-	h.cs.ConsensusSetSubscribe(h)
+	// Keep the host's address and announcement up to date as the gateway
+	// learns its external IP.
+	go h.threadedCheckAddress()
+
+	err = h.cs.ConsensusSetSubscribe(h, h.lastChange)
+	if err == modules.ErrInvalidConsensusChangeID {
+		// The consensus set does not know the last change that the host
+		// processed, so the blockchain is replayed from the beginning.
+		lockID := h.mu.Lock()
+		h.resetConsensusState()
+		h.mu.Unlock(lockID)
+		err = h.cs.ConsensusSetSubscribe(h, modules.ConsensusChangeBeginning)
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	return
 }
 
 // SetConfig updates the host's internal HostSettings object. To modify
-// a specific field, use a combination of Info and SetConfig
+// a specific field, use a combination of Info and SetConfig. If the pricing
+// policy is enabled, the price in the settings is replaced by the price that
+// the policy computes.
 func (h *Host) SetSettings(settings modules.HostSettings) {
 	lockID := h.mu.Lock()
 	defer h.mu.Unlock(lockID)
+	settings.PublicKey = h.PublicKey
 	h.HostSettings = settings
+	h.updatePrice()
 	h.save()
 }
 
@@ -147,8 +255,10 @@ func (h *Host) Settings() modules.HostSettings {
 	return h.HostSettings
 }
 
+// Address returns the address that the host is reachable at.
 func (h *Host) Address() modules.NetAddress {
-	// no lock needed; h.myAddr is only set once (in New).
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
 	return h.myAddr
 }
 
@@ -161,23 +271,30 @@ func (h *Host) Info() modules.HostInfo {
 
 		StorageRemaining: h.spaceRemaining,
 		NumContracts:     len(h.obligationsByID),
-	}
-	return info
-}
 
-// getExternalIP learns the server's hostname from a centralized service,
-// myexternalip.com.
-func getExternalIP() (string, error) {
-	resp, err := http.Get("http://myexternalip.com/raw")
-	if err != nil {
-		return "", err
+		RevenueRealized: h.revenueRealized,
+		CollateralLost:  h.collateralLost,
+		DownloadRevenue: h.downloadRevenue,
 	}
-	defer resp.Body.Close()
-	buf := make([]byte, 64)
-	n, err := resp.Body.Read(buf)
-	if err != nil && err != io.EOF {
-		return "", err
+	for _, obligation := range h.obligationsByID {
+		fc := obligation.FileContract
+		revenue := obligation.revenue()
+		info.Contracts = append(info.Contracts, modules.HostContractInfo{
+			ID:          obligation.ID,
+			FileSize:    fc.FileSize,
+			WindowStart: fc.WindowStart,
+			WindowEnd:   fc.WindowEnd,
+
+			Collateral: obligation.Collateral,
+			Revenue:    revenue,
+
+			ContractConfirmed: obligation.ContractConfirmed,
+			ProofConfirmed:    obligation.ProofConfirmed,
+		})
+		if obligation.ContractConfirmed {
+			info.LockedCollateral = info.LockedCollateral.Add(obligation.Collateral)
+			info.AnticipatedRevenue = info.AnticipatedRevenue.Add(revenue)
+		}
 	}
-	hostname := string(buf[:n-1]) // trim newline
-	return hostname, nil
+	return info
 }
@@ -52,7 +52,7 @@ func CreateHostTester(name string, t *testing.T) *hostTester {
 	testdir := tester.TempDir(modules.HostDir, name)
 
 	// Create the gateway.
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", "", filepath.Join(testdir, modules.GatewayDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -82,7 +82,7 @@ func CreateHostTester(name string, t *testing.T) *hostTester {
 	}
 
 	// Create the host.
-	h, err := New(cs, tp, w, ":0", filepath.Join(testdir, modules.HostDir))
+	h, err := New(cs, g, tp, w, ":0", filepath.Join(testdir, modules.HostDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -108,11 +108,7 @@ func CreateHostTester(name string, t *testing.T) *hostTester {
 
 	// Mine blocks until there is money in the wallet.
 	for i := types.BlockHeight(0); i <= types.MaturityDelay; i++ {
-		_, _, err = m.FindBlock()
-		if err != nil {
-			t.Fatal(err)
-		}
-		ht.csUpdateWait()
+		ht.mineBlock()
 	}
 
 	return ht
@@ -0,0 +1,217 @@
+package host
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// rateLimitWindow is the period over which the RPCs of each IP address
+	// are counted.
+	rateLimitWindow = time.Minute
+
+	// maxBurst is the number of bytes that a bandwidth limiter will allow to
+	// be transferred at once, and the size of the chunks that writes are
+	// broken into.
+	maxBurst = 1 << 14
+
+	// minTransferRate is the slowest rate, in bytes per second, at which the
+	// host expects file data to be transferred. RPCs that transfer files are
+	// given enough time to transfer them at this rate.
+	minTransferRate = 1 << 14
+)
+
+var (
+	// defaultLimits are the limits used by a new host.
+	defaultLimits = modules.HostLimits{
+		MaxConnections: 100,
+		MaxRPCsPerIP:   60,
+		Timeout:        60,
+	}
+
+	errTooManyConnections = errors.New("host is serving too many connections")
+	errRateLimited        = errors.New("address has called too many RPCs")
+)
+
+// A bandwidthLimiter limits the rate at which data is transferred across all
+// of the connections that share it. Each transfer is scheduled after the
+// transfers that came before it, and waits until its scheduled time.
+type bandwidthLimiter struct {
+	mu   sync.Mutex
+	rate uint64 // bytes per second; zero means unlimited
+	next time.Time
+}
+
+// setRate changes the rate of the limiter.
+func (bl *bandwidthLimiter) setRate(rate uint64) {
+	bl.mu.Lock()
+	bl.rate = rate
+	bl.mu.Unlock()
+}
+
+// wait blocks until n bytes can be transferred.
+func (bl *bandwidthLimiter) wait(n int) {
+	bl.mu.Lock()
+	if bl.rate == 0 {
+		bl.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if bl.next.Before(now) {
+		bl.next = now
+	}
+	start := bl.next
+	bl.next = bl.next.Add(time.Duration(uint64(n) * uint64(time.Second) / bl.rate))
+	bl.mu.Unlock()
+
+	// Transfers up to maxBurst bytes ahead of schedule are allowed.
+	burst := time.Duration(maxBurst * uint64(time.Second) / bl.rate)
+	if delay := start.Sub(now) - burst; delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// A limitedConn is a connection that is subject to the host's bandwidth
+// limits.
+type limitedConn struct {
+	net.Conn
+	upload   *bandwidthLimiter
+	download *bandwidthLimiter
+}
+
+// Read implements the io.Reader interface.
+func (lc *limitedConn) Read(b []byte) (int, error) {
+	if len(b) > maxBurst {
+		b = b[:maxBurst]
+	}
+	n, err := lc.Conn.Read(b)
+	lc.download.wait(n)
+	return n, err
+}
+
+// Write implements the io.Writer interface.
+func (lc *limitedConn) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > maxBurst {
+			chunk = chunk[:maxBurst]
+		}
+		lc.upload.wait(len(chunk))
+		n, err := lc.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+// An rpcCounter counts the RPCs called by an IP address during the current
+// rate limit window.
+type rpcCounter struct {
+	windowStart time.Time
+	count       uint64
+}
+
+// acceptConn checks that a new connection is within the host's limits. If it
+// is, the connection is counted, given a deadline for the whole RPC, and
+// wrapped so that it is subject to the bandwidth limits. RPCs that transfer
+// files extend the deadline with setTransferDeadline. releaseConn must be
+// called when a connection that was accepted is closed.
+func (h *Host) acceptConn(conn net.Conn) (net.Conn, error) {
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return nil, err
+	}
+
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	if h.limits.MaxConnections != 0 && h.activeConns >= h.limits.MaxConnections {
+		return nil, errTooManyConnections
+	}
+
+	// Forget about addresses whose windows have expired, so that the set of
+	// counters does not grow without bound.
+	now := time.Now()
+	for addr, counter := range h.rpcCounters {
+		if now.Sub(counter.windowStart) > rateLimitWindow {
+			delete(h.rpcCounters, addr)
+		}
+	}
+	counter, exists := h.rpcCounters[ip]
+	if !exists {
+		counter = &rpcCounter{windowStart: now}
+		h.rpcCounters[ip] = counter
+	}
+	if h.limits.MaxRPCsPerIP != 0 && counter.count >= h.limits.MaxRPCsPerIP {
+		return nil, errRateLimited
+	}
+	counter.count++
+	h.activeConns++
+
+	if h.limits.Timeout != 0 {
+		conn.SetDeadline(now.Add(time.Duration(h.limits.Timeout) * time.Second))
+	}
+	return &limitedConn{
+		Conn:     conn,
+		upload:   &h.uploadLimiter,
+		download: &h.downloadLimiter,
+	}, nil
+}
+
+// setTransferDeadline replaces the deadline of an RPC that is about to
+// transfer 'size' bytes of file data. The RPC is given the host's timeout plus
+// the time needed to transfer the data at minTransferRate, or at the host's
+// bandwidth limit in that direction if the limit is lower. 'upload' is true
+// when the host sends the data.
+func (h *Host) setTransferDeadline(conn net.Conn, size uint64, upload bool) {
+	lockID := h.mu.RLock()
+	limits := h.limits
+	h.mu.RUnlock(lockID)
+	if limits.Timeout == 0 {
+		return
+	}
+
+	rate := uint64(minTransferRate)
+	limit := limits.DownloadLimit
+	if upload {
+		limit = limits.UploadLimit
+	}
+	if limit != 0 && limit < rate {
+		rate = limit
+	}
+	timeout := time.Duration(limits.Timeout)*time.Second + time.Duration(size/rate+1)*time.Second
+	conn.SetDeadline(time.Now().Add(timeout))
+}
+
+// releaseConn is called when a connection accepted by acceptConn is closed.
+func (h *Host) releaseConn() {
+	lockID := h.mu.Lock()
+	h.activeConns--
+	h.mu.Unlock(lockID)
+}
+
+// Limits returns the limits that the host places on its connections.
+func (h *Host) Limits() modules.HostLimits {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.limits
+}
+
+// SetLimits sets the limits that the host places on its connections. New
+// limits apply to connections that are already open, except for the timeout,
+// which only applies to new RPCs.
+func (h *Host) SetLimits(limits modules.HostLimits) {
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	h.limits = limits
+	h.uploadLimiter.setRate(limits.UploadLimit)
+	h.downloadLimiter.setRate(limits.DownloadLimit)
+	h.save()
+}
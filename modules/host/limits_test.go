@@ -0,0 +1,131 @@
+package host
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestConnectionLimits checks that the host rejects connections beyond its
+// connection limit and its per-IP rate limit.
+func TestConnectionLimits(t *testing.T) {
+	ht := CreateHostTester("TestConnectionLimits", t)
+	ht.host.SetLimits(modules.HostLimits{MaxConnections: 2, MaxRPCsPerIP: 3})
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", string(ht.host.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	fakeConn := func() net.Conn {
+		c1, c2 := net.Pipe()
+		c2.Close()
+		return &addrConn{c1}
+	}
+
+	// Two connections are accepted, and the third is rejected.
+	c1, err := ht.host.acceptConn(fakeConn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ht.host.acceptConn(fakeConn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ht.host.acceptConn(fakeConn()); err != errTooManyConnections {
+		t.Error("expected errTooManyConnections, got", err)
+	}
+
+	// After a connection is released, the IP address has reached its rate
+	// limit.
+	c1.Close()
+	ht.host.releaseConn()
+	_, err = ht.host.acceptConn(fakeConn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht.host.releaseConn()
+	if _, err = ht.host.acceptConn(fakeConn()); err != errRateLimited {
+		t.Error("expected errRateLimited, got", err)
+	}
+
+	// Real connections from the rate limited address are closed by the host.
+	conn := dial()
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("rate limited connection was not closed")
+	}
+}
+
+// addrConn is a net.Conn with a fixed loopback remote address.
+type addrConn struct {
+	net.Conn
+}
+
+func (addrConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv6loopback, Port: 1}
+}
+
+// TestBandwidthLimiter checks that the bandwidth limiter slows transfers to
+// the configured rate.
+func TestBandwidthLimiter(t *testing.T) {
+	var bl bandwidthLimiter
+	bl.setRate(maxBurst * 10)
+
+	start := time.Now()
+	for i := 0; i < 15; i++ {
+		bl.wait(maxBurst)
+	}
+	elapsed := time.Since(start)
+	if elapsed < time.Second || elapsed > 3*time.Second {
+		t.Error("transferring 1.5 seconds of data took", elapsed)
+	}
+
+	// An unlimited limiter does not wait.
+	bl.setRate(0)
+	start = time.Now()
+	bl.wait(1 << 30)
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("unlimited limiter waited")
+	}
+}
+
+// TestRPCDeadline checks that a connection is closed when its RPC runs past
+// the timeout, even if the connection is never idle.
+func TestRPCDeadline(t *testing.T) {
+	ht := CreateHostTester("TestRPCDeadline", t)
+	ht.host.SetLimits(modules.HostLimits{Timeout: 1})
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	conn, err := ht.host.acceptConn(&addrConn{c1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Send a byte every 100 milliseconds until the host's reads fail.
+	go func() {
+		for {
+			time.Sleep(100 * time.Millisecond)
+			if _, err := c2.Write([]byte{0}); err != nil {
+				return
+			}
+		}
+	}()
+	start := time.Now()
+	buf := make([]byte, 1)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("active connection was not closed after the timeout")
+		}
+	}
+}
@@ -74,15 +74,18 @@ func (h *Host) considerTerms(terms modules.ContractTerms) error {
 
 	case terms.MissedProofOutputs[0].UnlockHash != types.ZeroUnlockHash:
 		return errors.New("coins are not paying out to correct address")
+
+	case terms.RenterKey.Algorithm != types.SignatureEd25519:
+		return errors.New("renter key is not an ed25519 key")
 	}
 
 	return nil
 }
 
 // verifyTransaction checks that the provided transaction matches the provided
-// contract terms, and that the Merkle root provided is equal to the merkle
-// root of the transaction file contract.
-func verifyTransaction(txn types.Transaction, terms modules.ContractTerms, merkleRoot crypto.Hash) error {
+// contract terms and host key, and that the Merkle root provided is equal to
+// the merkle root of the transaction file contract.
+func verifyTransaction(txn types.Transaction, terms modules.ContractTerms, hostKey types.SiaPublicKey, merkleRoot crypto.Hash) error {
 	// Check that there is only one file contract.
 	if len(txn.FileContracts) != 1 {
 		return errors.New("transaction should have only one file contract.")
@@ -124,7 +127,7 @@ func verifyTransaction(txn types.Transaction, terms modules.ContractTerms, merkl
 	case fc.MissedProofOutputs[0].UnlockHash != terms.MissedProofOutputs[0].UnlockHash:
 		return errors.New("bad file contract missed proof outputs")
 
-	case fc.UnlockHash != types.ZeroUnlockHash:
+	case fc.UnlockHash != modules.RetrievalUnlockConditions(terms.RenterKey, hostKey).UnlockHash():
 		return errors.New("bad file contract termination hash")
 	}
 	return nil
@@ -167,6 +170,7 @@ func (h *Host) rpcContract(conn net.Conn) (err error) {
 	// describing why.
 	lockID := h.mu.RLock()
 	err = h.considerTerms(terms)
+	hostKey := h.PublicKey
 	h.mu.RUnlock(lockID)
 	if err != nil {
 		err = encoding.WriteObject(conn, err.Error())
@@ -182,16 +186,26 @@ func (h *Host) rpcContract(conn net.Conn) (err error) {
 	}
 	defer file.Close()
 
-	// rollback everything if something goes wrong
+	// rollback everything if something goes wrong. Once the obligation has
+	// been added, removing it also deallocates the file.
+	var co *contractObligation
 	defer func() {
 		lockID := h.mu.Lock()
 		defer h.mu.Unlock(lockID)
-		if err != nil {
+		if err == nil {
+			return
+		}
+		if co != nil {
+			h.removeObligation(co)
+			h.save()
+		} else {
 			h.deallocate(terms.FileSize, path)
 		}
 	}()
 
-	// signal that we are ready to download file
+	// signal that we are ready to download file, allowing enough time for
+	// the file to be uploaded.
+	h.setTransferDeadline(conn, terms.FileSize, false)
 	err = encoding.WriteObject(conn, modules.AcceptTermsResponse)
 	if err != nil {
 		return
@@ -220,7 +234,7 @@ func (h *Host) rpcContract(conn net.Conn) (err error) {
 	// Verify that the transaction matches the agreed upon terms, and that the
 	// Merkle root in the file contract matches our independently calculated
 	// Merkle root.
-	err = verifyTransaction(unsignedTxn, terms, merkleRoot)
+	err = verifyTransaction(unsignedTxn, terms, hostKey, merkleRoot)
 	if err != nil {
 		err = errors.New("transaction does not satisfy terms: " + err.Error())
 		return
@@ -260,34 +274,32 @@ func (h *Host) rpcContract(conn net.Conn) (err error) {
 	if err != nil {
 		return
 	}
-	err = h.tpool.AcceptTransaction(fullTxn)
-	if err != nil {
-		return
-	}
 
-	// Add this contract to the host's list of obligations.
-	fcid := signedTxn.FileContractID(0)
-	fc := signedTxn.FileContracts[0]
-	proofHeight := fc.WindowStart + StorageProofReorgDepth
-	co := contractObligation{
-		ID:           fcid,
-		FileContract: fc,
+	// Add this contract to the host's list of obligations. The obligation is
+	// unconfirmed until the file contract appears in the blockchain. It is
+	// added before the transaction is submitted, so that a block containing
+	// the contract cannot arrive before the host is watching for it.
+	lockID = h.mu.Lock()
+	co = &contractObligation{
+		ID:           signedTxn.FileContractID(0),
+		FileContract: signedTxn.FileContracts[0],
 		Path:         path,
+		Collateral:   terms.Collateral.Mul(types.NewCurrency64(terms.FileSize)).Mul(types.NewCurrency64(uint64(terms.Duration))),
 	}
-	lockID = h.mu.Lock()
-	h.obligationsByHeight[proofHeight] = append(h.obligationsByHeight[proofHeight], co)
-	h.obligationsByID[fcid] = co
+	h.addObligation(co)
 	h.save()
 	h.mu.Unlock(lockID)
 
+	err = h.tpool.AcceptTransaction(fullTxn)
+	if err != nil {
+		return
+	}
+
 	// Send an ack to the renter that all is well.
 	err = encoding.WriteObject(conn, true)
 	if err != nil {
 		return
 	}
 
-	// TODO: we don't currently watch the blockchain to make sure that the
-	// transaction actually gets into the blockchain.
-
 	return
 }
@@ -65,6 +65,7 @@ func (ht *hostTester) testConsiderTerms() {
 				UnlockHash: types.ZeroUnlockHash,
 			},
 		},
+		RenterKey: types.SiaPublicKey{Algorithm: types.SignatureEd25519},
 	}
 
 	err := ht.host.considerTerms(saneTerms)
@@ -4,6 +4,7 @@ import (
 	"net"
 
 	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
 )
 
 type rpcID [8]byte
@@ -15,18 +16,33 @@ var (
 )
 
 // listen listens for incoming RPCs and spawns an appropriate handler for each.
+// Connections that exceed the host's limits are closed immediately.
 func (h *Host) listen() {
 	for {
 		conn, err := h.listener.Accept()
 		if err != nil {
 			return
 		}
-		go h.handleConn(conn)
+		limitedConn, err := h.acceptConn(conn)
+		if err != nil {
+			h.log.Println("WARN: rejected connection from", conn.RemoteAddr(), ":", err)
+			conn.Close()
+			continue
+		}
+		go h.handleConn(limitedConn)
 	}
 }
 
+// handleConn performs the session handshake on an incoming connection and
+// then reads the ID of the RPC being called. All communication after the
+// handshake is encrypted.
 func (h *Host) handleConn(conn net.Conn) {
+	defer h.releaseConn()
 	defer conn.Close()
+	conn, err := modules.NewHostSession(conn, h.secretKey)
+	if err != nil {
+		return
+	}
 	var id rpcID
 	if err := encoding.ReadObject(conn, &id, 8); err != nil {
 		// log
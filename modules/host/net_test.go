@@ -0,0 +1,59 @@
+package host
+
+import (
+	"net"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestSettingsSession requests the host's settings over an encrypted session,
+// and checks that a renter expecting a different host key rejects the host.
+func TestSettingsSession(t *testing.T) {
+	ht := CreateHostTester("TestSettingsSession", t)
+	hostKey := ht.host.Settings().PublicKey
+
+	conn, err := net.Dial("tcp", string(ht.host.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	session, err := modules.NewRenterSession(conn, hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = encoding.WriteObject(session, idSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings modules.HostSettings
+	err = encoding.ReadObject(session, &settings, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.PublicKey != hostKey || settings.Price.Cmp(ht.host.Settings().Price) != 0 {
+		t.Error("settings read over the session do not match the host's settings")
+	}
+
+	// Use the wrong host key.
+	_, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       string(encoding.Marshal(pk)),
+	}
+	conn2, err := net.Dial("tcp", string(ht.host.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	_, err = modules.NewRenterSession(conn2, wrongKey)
+	if err != crypto.ErrInvalidSignature {
+		t.Error("expected ErrInvalidSignature, got", err)
+	}
+}
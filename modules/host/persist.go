@@ -1,49 +1,227 @@
 package host
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
 	"path/filepath"
 
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	persistHeader  = "Host Settings"
+	persistVersion = "0.4"
+)
+
+var (
+	errUnrecognizedVersion = errors.New("host settings file has unrecognized version")
 )
 
 type savedHost struct {
-	SpaceRemaining int64
-	FileCounter    int
-	Obligations    []contractObligation
-	HostSettings   modules.HostSettings
+	Header          string
+	Version         string
+	SpaceRemaining  int64
+	FileCounter     int
+	Obligations     []contractObligation
+	HostSettings    modules.HostSettings
+	PricingPolicy   modules.HostPricingPolicy
+	RevenueRealized types.Currency
+	CollateralLost  types.Currency
+	DownloadRevenue types.Currency
+	SecretKey       crypto.SecretKey
+	Limits          modules.HostLimits
+	UserAddress     modules.NetAddress
+	AnnouncedAddr   modules.NetAddress
+	BlockHeight     types.BlockHeight
+	LastChange      modules.ConsensusChangeID
 }
 
 func (h *Host) save() (err error) {
 	sHost := savedHost{
+		Header:         persistHeader,
+		Version:        persistVersion,
 		SpaceRemaining: h.spaceRemaining,
 		FileCounter:    h.fileCounter,
 		Obligations:    make([]contractObligation, 0, len(h.obligationsByID)),
 		HostSettings:   h.HostSettings,
+		PricingPolicy:  h.pricingPolicy,
+
+		RevenueRealized: h.revenueRealized,
+		CollateralLost:  h.collateralLost,
+		DownloadRevenue: h.downloadRevenue,
+		SecretKey:       h.secretKey,
+		Limits:          h.limits,
+		UserAddress:     h.userAddr,
+		AnnouncedAddr:   h.announcedAddr,
+		BlockHeight:     h.blockHeight,
+		LastChange:      h.lastChange,
 	}
 	for _, obligation := range h.obligationsByID {
-		sHost.Obligations = append(sHost.Obligations, obligation)
+		sHost.Obligations = append(sHost.Obligations, *obligation)
 	}
 
 	return encoding.WriteFile(filepath.Join(h.saveDir, "settings.dat"), sHost)
 }
 
+// oldHostSettings, oldContractObligation, and oldSavedHost are the format of
+// the settings file before it had a header. Those files contain only the
+// storage, settings, and obligations of the host.
+type oldHostSettings struct {
+	IPAddress    modules.NetAddress
+	TotalStorage int64
+	MinFilesize  uint64
+	MaxFilesize  uint64
+	MinDuration  types.BlockHeight
+	MaxDuration  types.BlockHeight
+	WindowSize   types.BlockHeight
+	Price        types.Currency
+	Collateral   types.Currency
+	UnlockHash   types.UnlockHash
+}
+
+type oldContractObligation struct {
+	ID           types.FileContractID
+	FileContract types.FileContract
+	Path         string
+}
+
+type oldSavedHost struct {
+	SpaceRemaining int64
+	FileCounter    int
+	Obligations    []oldContractObligation
+	HostSettings   oldHostSettings
+}
+
+// readSavedHost reads the settings file, converting files in the old format,
+// which do not start with the header.
+func readSavedHost(filename string) (sHost savedHost, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	if bytes.HasPrefix(data, encoding.Marshal(persistHeader)) {
+		err = encoding.Unmarshal(data, &sHost)
+		if err == nil && sHost.Version != persistVersion {
+			err = errUnrecognizedVersion
+		}
+		return
+	}
+
+	var oldHost oldSavedHost
+	err = encoding.Unmarshal(data, &oldHost)
+	if err != nil {
+		return
+	}
+	sHost = savedHost{
+		Header:         persistHeader,
+		Version:        persistVersion,
+		SpaceRemaining: oldHost.SpaceRemaining,
+		FileCounter:    oldHost.FileCounter,
+		Obligations:    make([]contractObligation, 0, len(oldHost.Obligations)),
+		HostSettings: modules.HostSettings{
+			IPAddress:    oldHost.HostSettings.IPAddress,
+			TotalStorage: oldHost.HostSettings.TotalStorage,
+			MinFilesize:  oldHost.HostSettings.MinFilesize,
+			MaxFilesize:  oldHost.HostSettings.MaxFilesize,
+			MinDuration:  oldHost.HostSettings.MinDuration,
+			MaxDuration:  oldHost.HostSettings.MaxDuration,
+			WindowSize:   oldHost.HostSettings.WindowSize,
+			Price:        oldHost.HostSettings.Price,
+			Collateral:   oldHost.HostSettings.Collateral,
+			UnlockHash:   oldHost.HostSettings.UnlockHash,
+		},
+	}
+	// Old obligations are rediscovered by replaying the blockchain from the
+	// beginning. Their contracts must appear before their proof windows
+	// start.
+	for _, obligation := range oldHost.Obligations {
+		sHost.Obligations = append(sHost.Obligations, contractObligation{
+			ID:                   obligation.ID,
+			FileContract:         obligation.FileContract,
+			Path:                 obligation.Path,
+			ConfirmationDeadline: obligation.FileContract.WindowStart,
+		})
+	}
+	return sHost, nil
+}
+
 func (h *Host) load() error {
-	var sHost savedHost
-	err := encoding.ReadFile(filepath.Join(h.saveDir, "settings.dat"), &sHost)
+	sHost, err := readSavedHost(filepath.Join(h.saveDir, "settings.dat"))
 	if err != nil {
 		return err
 	}
 
 	h.spaceRemaining = sHost.SpaceRemaining
 	h.fileCounter = sHost.FileCounter
+	// Hosts saved before keys were added keep the newly generated key.
+	if sHost.SecretKey != (crypto.SecretKey{}) {
+		h.secretKey = sHost.SecretKey
+	} else {
+		sHost.HostSettings.PublicKey = h.PublicKey
+	}
 	h.HostSettings = sHost.HostSettings
-	// recreate maps
-	for _, obligation := range sHost.Obligations {
-		height := obligation.FileContract.WindowStart + StorageProofReorgDepth
-		h.obligationsByHeight[height] = append(h.obligationsByHeight[height], obligation)
+	// Hosts saved before limits were added keep the default limits.
+	if sHost.Limits != (modules.HostLimits{}) {
+		h.limits = sHost.Limits
+	}
+	h.userAddr = sHost.UserAddress
+	if h.userAddr != "" {
+		h.myAddr = h.userAddr
+	}
+	h.announcedAddr = sHost.AnnouncedAddr
+	h.pricingPolicy = sHost.PricingPolicy
+	h.revenueRealized = sHost.RevenueRealized
+	h.collateralLost = sHost.CollateralLost
+	h.downloadRevenue = sHost.DownloadRevenue
+	h.blockHeight = sHost.BlockHeight
+	h.lastChange = sHost.LastChange
+	for i := range sHost.Obligations {
+		obligation := &sHost.Obligations[i]
 		h.obligationsByID[obligation.ID] = obligation
 	}
 
+	// If the host has not recorded the last consensus change it processed,
+	// the blockchain is replayed from the beginning. Otherwise, each
+	// obligation is processed at the next block, which reschedules it as
+	// needed.
+	if h.lastChange == modules.ConsensusChangeBeginning {
+		h.resetConsensusState()
+	} else {
+		for _, obligation := range h.obligationsByID {
+			h.scheduleObligation(obligation, h.blockHeight+1)
+		}
+	}
+
 	return nil
 }
+
+// resetConsensusState prepares the host for the blockchain to be replayed from
+// the beginning. The contract and proof status of each obligation is
+// rediscovered from the blocks instead of being trusted from disk.
+func (h *Host) resetConsensusState() {
+	h.blockHeight = 0
+	h.lastChange = modules.ConsensusChangeBeginning
+	h.obligationsByHeight = make(map[types.BlockHeight][]*contractObligation)
+	for _, obligation := range h.obligationsByID {
+		obligation.ContractConfirmed = false
+		obligation.ProofConfirmed = false
+		obligation.ProofHeight = 0
+		h.scheduleObligation(obligation, obligation.ConfirmationDeadline)
+		h.scheduleObligation(obligation, obligation.FileContract.WindowStart+StorageProofReorgDepth)
+	}
+}
+
+// makeLogger creates a logger that writes to the host's log file.
+func makeLogger(saveDir string) (*log.Logger, error) {
+	logFile, err := os.OpenFile(filepath.Join(saveDir, "host.log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0660)
+	if err != nil {
+		return nil, err
+	}
+	return log.New(logFile, "", log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile), nil
+}
@@ -1,9 +1,109 @@
 package host
 
 import (
-// "testing"
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/modules/tester"
+	"github.com/NebulousLabs/Sia/types"
 )
 
+// oldSettingsFile is a settings file saved by a host before the file had a
+// header. It holds one obligation, for the contract with ID {1}.
+var oldSettingsFile = "9c93357700000000030000000000000001000000000000000100000000000000" +
+	"0000000000000000000000000000000000000000000000006400000000000000" +
+	"0000000000000000000000000000000000000000000000000000000000000000" +
+	"32000000000000003c00000000000000020000000000000003e8000000000000" +
+	"0000000000000000000000000000000000000000000000000000000000000000" +
+	"0000000000000000000000000000000000000100000000000000330c00000000" +
+	"000000666f6f2e636f6d3a393938320094357700000000000000000000000000" +
+	"a3e1110000000000000000000000008813000000000000200100000000000001" +
+	"00000000000000070000000000000000bf559f8a87c4e9dd9d46c5eaf57de8b9" +
+	"956f4b614362148f0068bdff5d628927"
+
+// TestLoadCorruptSettings checks that a host whose saved settings cannot be
+// loaded is not created, and that the saved settings are left untouched.
+func TestLoadCorruptSettings(t *testing.T) {
+	ht := CreateHostTester("TestLoadCorruptSettings", t)
+	saveDir := tester.TempDir(modules.HostDir, "TestLoadCorruptSettings", "corrupt")
+	err := os.MkdirAll(saveDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := []byte("not a saved host")
+	settingsFile := filepath.Join(saveDir, "settings.dat")
+	err = ioutil.WriteFile(settingsFile, corrupt, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = New(ht.cs, ht.gateway, ht.tpool, ht.wallet, ":0", saveDir)
+	if err == nil {
+		t.Fatal("host was created from corrupt settings")
+	}
+	saved, err := ioutil.ReadFile(settingsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved, corrupt) {
+		t.Error("corrupt settings were overwritten")
+	}
+}
+
+// TestLoadOldSettings checks that a host loads a settings file saved before
+// the file had a header, and rewrites it in the current format.
+func TestLoadOldSettings(t *testing.T) {
+	ht := CreateHostTester("TestLoadOldSettings", t)
+	saveDir := tester.TempDir(modules.HostDir, "TestLoadOldSettings", "old")
+	err := os.MkdirAll(saveDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := hex.DecodeString(oldSettingsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(saveDir, "settings.dat"), old, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := New(ht.cs, ht.gateway, ht.tpool, ht.wallet, ":0", saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID := h.mu.RLock()
+	if h.IPAddress != "foo.com:9982" || h.Price.Cmp(types.NewCurrency64(7)) != 0 || h.fileCounter != 3 {
+		t.Error("old settings were not loaded:", h.HostSettings, h.fileCounter)
+	}
+	if h.PublicKey.Key == "" || h.limits != defaultLimits {
+		t.Error("host from old settings did not get a key and the default limits")
+	}
+	co, exists := h.obligationsByID[types.FileContractID{1}]
+	if !exists {
+		t.Fatal("old obligation was not loaded")
+	}
+	if co.FileContract.FileSize != 100 || co.Path != "3" || co.ConfirmationDeadline != co.FileContract.WindowStart {
+		t.Error("old obligation was not converted:", co)
+	}
+	h.mu.RUnlock(lockID)
+
+	// The host saves its settings in the current format.
+	sHost, err := readSavedHost(filepath.Join(saveDir, "settings.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sHost.Header != persistHeader || sHost.Version != persistVersion || len(sHost.Obligations) != 1 {
+		t.Error("settings were not saved in the current format")
+	}
+}
+
 /*
 // TestSaveLoad tests that saving and loading a Host restores its data.
 func TestSaveLoad(t *testing.T) {
@@ -19,3 +119,47 @@ func TestSaveLoad(t *testing.T) {
 	}
 }
 */
+
+// TestResumeConsensus checks that a restarted host resumes from the last
+// consensus change that it processed, and that it replays the blockchain if
+// the consensus set does not know that change.
+func TestResumeConsensus(t *testing.T) {
+	ht := CreateHostTester("TestResumeConsensus", t)
+	lockID := ht.host.mu.RLock()
+	height, lastChange := ht.host.blockHeight, ht.host.lastChange
+	ht.host.mu.RUnlock(lockID)
+	if lastChange == modules.ConsensusChangeBeginning {
+		t.Fatal("host did not record the last consensus change")
+	}
+
+	// The restarted host loads its height and does not replay any blocks.
+	h, err := New(ht.cs, ht.gateway, ht.tpool, ht.wallet, ":0", ht.host.saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockID = h.mu.Lock()
+	if h.blockHeight != height || h.lastChange != lastChange {
+		t.Error("restarted host did not resume from its last change")
+	}
+	h.lastChange = modules.ConsensusChangeID{1}
+	h.save()
+	h.mu.Unlock(lockID)
+
+	// A host whose last change is unknown starts over from the beginning.
+	h, err = New(ht.cs, ht.gateway, ht.tpool, ht.wallet, ":0", ht.host.saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		lockID = h.mu.RLock()
+		caughtUp := h.blockHeight == height && h.lastChange == lastChange
+		h.mu.RUnlock(lockID)
+		if caughtUp {
+			break
+		}
+		if i == 100 {
+			t.Fatal("host did not replay the blockchain")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,105 @@
+package host
+
+import (
+	"errors"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// bytesPerTerabyte and secondsPerMonth are used to convert a target price
+	// per terabyte per month into a price per byte per block.
+	bytesPerTerabyte = 1e12
+	secondsPerMonth  = 30 * 24 * 60 * 60
+)
+
+var (
+	errNoStartingPrice = errors.New("pricing policy needs either a base price or a target price and reference rate")
+	errBadPriceBounds  = errors.New("minimum price of pricing policy is greater than maximum price")
+)
+
+// utilization returns the percentage of the host's total storage that is in
+// use, between 0 and 100.
+func (h *Host) utilization() uint64 {
+	if h.TotalStorage <= 0 {
+		return 100
+	}
+	used := h.TotalStorage - h.spaceRemaining
+	if used <= 0 {
+		return 0
+	}
+	if used >= h.TotalStorage {
+		return 100
+	}
+	return uint64(used * 100 / h.TotalStorage)
+}
+
+// computePrice uses the pricing policy to determine the price that the host
+// should be charging, given its current utilization.
+func (h *Host) computePrice() types.Currency {
+	policy := h.pricingPolicy
+
+	// Determine the starting price, converting the target price from
+	// reference units per terabyte per month to hastings per byte per block
+	// if possible.
+	price := policy.BasePrice
+	if !policy.TargetPrice.IsZero() && !policy.ReferenceRate.IsZero() {
+		blocksPerMonth := uint64(secondsPerMonth / types.BlockFrequency)
+		price = policy.TargetPrice.Mul(policy.ReferenceRate).Div(types.NewCurrency64(bytesPerTerabyte * blocksPerMonth))
+	}
+
+	// Increase the price according to utilization.
+	premium := types.NewCurrency64(10000 + policy.UtilizationPremium*h.utilization())
+	price = price.Mul(premium).Div(types.NewCurrency64(10000))
+
+	// Enforce the price bounds.
+	if price.Cmp(policy.MinPrice) < 0 {
+		price = policy.MinPrice
+	}
+	if !policy.MaxPrice.IsZero() && price.Cmp(policy.MaxPrice) > 0 {
+		price = policy.MaxPrice
+	}
+	return price
+}
+
+// updatePrice recomputes the host's price if the pricing policy is enabled,
+// and updates the settings of the host if the price has changed. Renters
+// learn about the new price the next time they request the host's settings.
+func (h *Host) updatePrice() {
+	if !h.pricingPolicy.Enabled {
+		return
+	}
+	price := h.computePrice()
+	if price.Cmp(h.Price) == 0 {
+		return
+	}
+	h.log.Println("INFO: pricing policy changed price from", h.Price, "to", price)
+	h.Price = price
+	h.save()
+}
+
+// PricingPolicy returns the host's pricing policy.
+func (h *Host) PricingPolicy() modules.HostPricingPolicy {
+	lockID := h.mu.RLock()
+	defer h.mu.RUnlock(lockID)
+	return h.pricingPolicy
+}
+
+// SetPricingPolicy sets the policy used by the host to set its price. If the
+// policy is enabled, the price is updated immediately.
+func (h *Host) SetPricingPolicy(policy modules.HostPricingPolicy) error {
+	if policy.Enabled && policy.BasePrice.IsZero() && (policy.TargetPrice.IsZero() || policy.ReferenceRate.IsZero()) {
+		return errNoStartingPrice
+	}
+	if !policy.MaxPrice.IsZero() && policy.MinPrice.Cmp(policy.MaxPrice) > 0 {
+		return errBadPriceBounds
+	}
+
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+	h.pricingPolicy = policy
+	h.updatePrice()
+	h.save()
+	return nil
+}
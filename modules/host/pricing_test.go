@@ -0,0 +1,104 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestComputePrice checks that the computed price follows the utilization of
+// the host and respects the price bounds.
+func TestComputePrice(t *testing.T) {
+	ht := CreateHostTester("TestComputePrice", t)
+	h := ht.host
+	lockID := h.mu.Lock()
+	defer h.mu.Unlock(lockID)
+
+	h.TotalStorage = 1000
+	h.spaceRemaining = 1000
+	h.pricingPolicy = modules.HostPricingPolicy{
+		Enabled:            true,
+		BasePrice:          types.NewCurrency64(100),
+		UtilizationPremium: 50,
+	}
+
+	// No storage is in use.
+	if h.computePrice().Cmp(types.NewCurrency64(100)) != 0 {
+		t.Error("price with no utilization should equal the base price, got", h.computePrice())
+	}
+
+	// Half of the storage is in use.
+	h.spaceRemaining = 500
+	if h.computePrice().Cmp(types.NewCurrency64(125)) != 0 {
+		t.Error("price with half utilization should be 125, got", h.computePrice())
+	}
+
+	// All of the storage is in use.
+	h.spaceRemaining = 0
+	if h.computePrice().Cmp(types.NewCurrency64(150)) != 0 {
+		t.Error("price with full utilization should be 150, got", h.computePrice())
+	}
+
+	// Check the bounds.
+	h.pricingPolicy.MaxPrice = types.NewCurrency64(120)
+	if h.computePrice().Cmp(types.NewCurrency64(120)) != 0 {
+		t.Error("price was not clamped to the maximum price, got", h.computePrice())
+	}
+	h.spaceRemaining = 1000
+	h.pricingPolicy.MinPrice = types.NewCurrency64(110)
+	if h.computePrice().Cmp(types.NewCurrency64(110)) != 0 {
+		t.Error("price was not clamped to the minimum price, got", h.computePrice())
+	}
+
+	// Use a target price in a reference unit instead of the base price.
+	h.pricingPolicy = modules.HostPricingPolicy{
+		Enabled:       true,
+		BasePrice:     types.NewCurrency64(100),
+		TargetPrice:   types.NewCurrency64(2),
+		ReferenceRate: types.NewCurrency64(bytesPerTerabyte * uint64(secondsPerMonth/types.BlockFrequency)),
+	}
+	if h.computePrice().Cmp(types.NewCurrency64(2)) != 0 {
+		t.Error("target price was not converted correctly, got", h.computePrice())
+	}
+}
+
+// TestSetPricingPolicy checks that setting an enabled pricing policy updates
+// the price of the host, and that invalid policies are rejected.
+func TestSetPricingPolicy(t *testing.T) {
+	ht := CreateHostTester("TestSetPricingPolicy", t)
+
+	err := ht.host.SetPricingPolicy(modules.HostPricingPolicy{Enabled: true})
+	if err != errNoStartingPrice {
+		t.Error("expected errNoStartingPrice, got", err)
+	}
+	err = ht.host.SetPricingPolicy(modules.HostPricingPolicy{
+		BasePrice: types.NewCurrency64(100),
+		MinPrice:  types.NewCurrency64(10),
+		MaxPrice:  types.NewCurrency64(5),
+	})
+	if err != errBadPriceBounds {
+		t.Error("expected errBadPriceBounds, got", err)
+	}
+
+	policy := modules.HostPricingPolicy{
+		Enabled:   true,
+		BasePrice: types.NewCurrency64(12345),
+	}
+	err = ht.host.SetPricingPolicy(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ht.host.Settings().Price.Cmp(ht.host.computePrice()) != 0 {
+		t.Error("price was not updated after setting the pricing policy")
+	}
+
+	// Settings should not be able to override the price while the policy is
+	// enabled.
+	settings := ht.host.Settings()
+	settings.Price = types.NewCurrency64(1)
+	ht.host.SetSettings(settings)
+	if ht.host.Settings().Price.Cmp(types.NewCurrency64(1)) == 0 {
+		t.Error("settings overrode the price computed by the pricing policy")
+	}
+}
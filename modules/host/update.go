@@ -1,18 +1,81 @@
 package host
 
 import (
-	"fmt"
+	"errors"
 	"os"
 	"path/filepath"
 
-	"github.com/NebulousLabs/Sia/build"
 	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
-// Create a proof of storage for a contract, using the state height to
-// determine the random seed. Create proof must be under a host and state lock.
-func (h *Host) createStorageProof(obligation contractObligation, heightForProof types.BlockHeight) (err error) {
+var (
+	errProofVerification = errors.New("storage proof failed local verification")
+)
+
+// scheduleObligation adds an obligation to the list of obligations that will
+// be processed when the host reaches the given height. An obligation is only
+// added once per height.
+func (h *Host) scheduleObligation(obligation *contractObligation, height types.BlockHeight) {
+	for _, co := range h.obligationsByHeight[height] {
+		if co == obligation {
+			return
+		}
+	}
+	h.obligationsByHeight[height] = append(h.obligationsByHeight[height], obligation)
+}
+
+// revenue returns the amount of money that the host will earn from the
+// obligation if it submits a valid storage proof, which is the host's portion
+// of the valid proof outputs minus the collateral it put into the contract.
+func (co *contractObligation) revenue() types.Currency {
+	var payout types.Currency
+	if len(co.FileContract.ValidProofOutputs) > 0 {
+		payout = co.FileContract.ValidProofOutputs[0].Value
+	}
+	if payout.Cmp(co.Collateral) < 0 {
+		return types.ZeroCurrency
+	}
+	return payout.Sub(co.Collateral)
+}
+
+// addObligation adds a new, unconfirmed obligation to the host. The
+// obligation is scheduled to be checked for confirmation and to have its
+// storage proof submitted.
+func (h *Host) addObligation(obligation *contractObligation) {
+	obligation.ContractConfirmed = false
+	obligation.ConfirmationDeadline = h.blockHeight + ContractConfirmationTimeout
+	h.obligationsByID[obligation.ID] = obligation
+	h.scheduleObligation(obligation, obligation.ConfirmationDeadline)
+	h.scheduleObligation(obligation, obligation.FileContract.WindowStart+StorageProofReorgDepth)
+}
+
+// removeObligation deletes an obligation from the host and deallocates the
+// file associated with the obligation.
+func (h *Host) removeObligation(obligation *contractObligation) {
+	fullpath := filepath.Join(h.saveDir, obligation.Path)
+	filesize := obligation.FileContract.FileSize
+	stat, err := os.Stat(fullpath)
+	if err == nil {
+		// Space for the whole file is allocated when the contract is
+		// negotiated, so the file of an obligation whose contract never
+		// confirmed can be shorter than the space it holds.
+		if uint64(stat.Size()) > filesize {
+			filesize = uint64(stat.Size())
+		}
+	} else {
+		h.log.Println("WARN: could not stat file for obligation", obligation.ID, ":", err)
+	}
+	h.deallocate(filesize, obligation.Path)
+	delete(h.obligationsByID, obligation.ID)
+}
+
+// createStorageProof builds a proof of storage for a contract, using the
+// consensus set to determine the segment that needs to be proven. The proof
+// is verified against the file contract before it is returned, so that an
+// invalid proof is never submitted to the network.
+func (h *Host) createStorageProof(obligation *contractObligation) (sp types.StorageProof, err error) {
 	fullpath := filepath.Join(h.saveDir, obligation.Path)
 	file, err := os.Open(fullpath)
 	if err != nil {
@@ -29,7 +92,29 @@ func (h *Host) createStorageProof(obligation contractObligation, heightForProof
 		return
 	}
 
-	sp := types.StorageProof{obligation.ID, base, hashSet}
+	// Verify the proof before handing it off.
+	fc := obligation.FileContract
+	numSegments := crypto.CalculateSegments(fc.FileSize)
+	if !crypto.VerifySegment(base, hashSet, numSegments, segmentIndex, fc.FileMerkleRoot) {
+		err = errProofVerification
+		return
+	}
+
+	sp = types.StorageProof{
+		ParentID: obligation.ID,
+		Segment:  base,
+		HashSet:  hashSet,
+	}
+	return
+}
+
+// submitStorageProof creates a storage proof for an obligation and submits it
+// to the transaction pool.
+func (h *Host) submitStorageProof(obligation *contractObligation) (err error) {
+	sp, err := h.createStorageProof(obligation)
+	if err != nil {
+		return
+	}
 
 	// Create and send the transaction.
 	id, err := h.wallet.RegisterTransaction(types.Transaction{})
@@ -44,50 +129,179 @@ func (h *Host) createStorageProof(obligation contractObligation, heightForProof
 	if err != nil {
 		return
 	}
-	err = h.tpool.AcceptTransaction(t)
+	return h.tpool.AcceptTransaction(t)
+}
+
+// processObligation is called when the host reaches a height at which an
+// obligation was scheduled. Obligations whose contracts never confirmed, or
+// that have a buried storage proof or an expired window, are removed.
+// Otherwise, a storage proof is submitted and the obligation is rescheduled so
+// that the proof can be resubmitted if it does not make it into the
+// blockchain.
+func (h *Host) processObligation(obligation *contractObligation) {
+	fc := obligation.FileContract
+
+	// The file contract must make it into the blockchain before the
+	// confirmation deadline.
+	if !obligation.ContractConfirmed {
+		if h.blockHeight >= obligation.ConfirmationDeadline {
+			h.log.Println("WARN: file contract", obligation.ID, "was not confirmed in time, dropping obligation")
+			h.removeObligation(obligation)
+		} else {
+			h.scheduleObligation(obligation, obligation.ConfirmationDeadline)
+		}
+		return
+	}
+
+	// If the storage proof has been confirmed, the file is kept until the
+	// proof is deep enough that a reorg is unlikely to remove it.
+	if obligation.ProofConfirmed {
+		buriedHeight := obligation.ProofHeight + StorageProofReorgDepth
+		if h.blockHeight >= buriedHeight {
+			h.revenueRealized = h.revenueRealized.Add(obligation.revenue())
+			h.removeObligation(obligation)
+		} else {
+			h.scheduleObligation(obligation, buriedHeight)
+		}
+		return
+	}
+
+	// A storage proof can no longer be submitted once the window has closed.
+	if h.blockHeight >= fc.WindowEnd {
+		h.log.Println("WARN: storage proof window closed without a confirmed proof for", obligation.ID)
+		h.collateralLost = h.collateralLost.Add(obligation.Collateral)
+		h.removeObligation(obligation)
+		return
+	}
+
+	// Wait until the proof window has been open for long enough that the
+	// proof is unlikely to be invalidated by a reorg.
+	proofHeight := fc.WindowStart + StorageProofReorgDepth
+	if h.blockHeight < proofHeight {
+		h.scheduleObligation(obligation, proofHeight)
+		return
+	}
+
+	// Only submit proofs once the host has caught up with the consensus set;
+	// the proof is built using the current state of consensus.
+	if h.blockHeight < h.cs.Height() {
+		h.scheduleObligation(obligation, h.blockHeight+1)
+		return
+	}
+
+	err := h.submitStorageProof(obligation)
 	if err != nil {
-		if build.DEBUG {
-			panic(err)
+		h.log.Println("WARN: failed to submit storage proof for", obligation.ID, ":", err)
+		h.scheduleObligation(obligation, h.blockHeight+1)
+		return
+	}
+	nextAttempt := h.blockHeight + StorageProofResubmitInterval
+	if nextAttempt > fc.WindowEnd {
+		nextAttempt = fc.WindowEnd
+	}
+	h.scheduleObligation(obligation, nextAttempt)
+}
+
+// findFileContracts returns the ids of the file contracts created in the
+// given block.
+func findFileContracts(b types.Block) (fcids []types.FileContractID) {
+	for _, t := range b.Transactions {
+		for i := range t.FileContracts {
+			fcids = append(fcids, t.FileContractID(i))
 		}
 	}
+	return
+}
 
+// findStorageProofs returns the ids of the file contracts that have storage
+// proofs in the given block.
+func findStorageProofs(b types.Block) (fcids []types.FileContractID) {
+	for _, t := range b.Transactions {
+		for _, sp := range t.StorageProofs {
+			fcids = append(fcids, sp.ParentID)
+		}
+	}
 	return
 }
 
-// RecieveConsensusSetUpdate will be called by the consensus set every time
+// ReceiveConsensusSetUpdate will be called by the consensus set every time
 // there is a new block or a fork of some kind.
-func (h *Host) ReceiveConsensusSetUpdate(revertedBlocks []types.Block, appliedBlocks []types.Block) {
+func (h *Host) ReceiveConsensusSetUpdate(cc modules.ConsensusChange) {
 	lockID := h.mu.Lock()
 	defer h.mu.Unlock(lockID)
 
-	h.blockHeight -= types.BlockHeight(len(revertedBlocks))
+	// File contracts and storage proofs in reverted blocks are no longer in
+	// the blockchain. Obligations with reverted contracts must be confirmed
+	// again, and obligations with reverted proofs need to submit their proofs
+	// again.
+	var revertedContracts, unconfirmed []*contractObligation
+	for _, b := range cc.RevertedBlocks {
+		for _, fcid := range findFileContracts(b) {
+			obligation, exists := h.obligationsByID[fcid]
+			if !exists || !obligation.ContractConfirmed {
+				continue
+			}
+			obligation.ContractConfirmed = false
+			revertedContracts = append(revertedContracts, obligation)
+		}
+		for _, fcid := range findStorageProofs(b) {
+			obligation, exists := h.obligationsByID[fcid]
+			if !exists || !obligation.ProofConfirmed {
+				continue
+			}
+			obligation.ProofConfirmed = false
+			obligation.ProofHeight = 0
+			unconfirmed = append(unconfirmed, obligation)
+		}
+	}
+	h.blockHeight -= types.BlockHeight(len(cc.RevertedBlocks))
+	for _, obligation := range revertedContracts {
+		h.log.Println("INFO: file contract", obligation.ID, "was removed by a reorg")
+		obligation.ConfirmationDeadline = h.blockHeight + ContractConfirmationTimeout
+		h.scheduleObligation(obligation, obligation.ConfirmationDeadline)
+	}
+	for _, obligation := range unconfirmed {
+		h.log.Println("INFO: storage proof for", obligation.ID, "was removed by a reorg")
+		h.scheduleObligation(obligation, h.blockHeight+1)
+	}
 
-	// Check the applied blocks and see if any of the contracts we have are
+	// Check the applied blocks for file contracts and storage proofs that
+	// belong to our obligations, and see if any of the contracts we have are
 	// ready for storage proofs.
-	for _ = range appliedBlocks {
+	for _, b := range cc.AppliedBlocks {
 		h.blockHeight++
 
-		for _, obligation := range h.obligationsByHeight[h.blockHeight] {
-			// Submit a storage proof for the obligation.
-			err := h.createStorageProof(obligation, h.cs.Height())
-			if err != nil {
-				fmt.Println(err)
-				return
+		for _, fcid := range findFileContracts(b) {
+			obligation, exists := h.obligationsByID[fcid]
+			if !exists {
+				continue
 			}
-
-			// Delete the obligation.
-			fullpath := filepath.Join(h.saveDir, obligation.Path)
-			stat, err := os.Stat(fullpath)
-			if err != nil {
-				fmt.Println(err)
-				return
+			obligation.ContractConfirmed = true
+		}
+		for _, fcid := range findStorageProofs(b) {
+			obligation, exists := h.obligationsByID[fcid]
+			if !exists {
+				continue
 			}
-			h.deallocate(uint64(stat.Size()), obligation.Path) // TODO: file might actually be the wrong size.
+			obligation.ProofConfirmed = true
+			obligation.ProofHeight = h.blockHeight
+			h.scheduleObligation(obligation, h.blockHeight+StorageProofReorgDepth)
+		}
 
-			delete(h.obligationsByID, obligation.ID)
+		for _, obligation := range h.obligationsByHeight[h.blockHeight] {
+			// The obligation may have already been removed.
+			if _, exists := h.obligationsByID[obligation.ID]; !exists {
+				continue
+			}
+			h.processObligation(obligation)
 		}
 		delete(h.obligationsByHeight, h.blockHeight)
 	}
+	// The host is saved after every change, so that it resumes from the
+	// latest change when it is restarted.
+	h.lastChange = cc.ID
+	h.save()
+	h.updatePrice()
 
 	h.updateSubscribers()
 }
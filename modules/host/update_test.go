@@ -0,0 +1,293 @@
+package host
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// createObligation creates a file and a file contract for the file, submits
+// the contract to the blockchain, and gives the host an obligation for the
+// contract, returning the obligation.
+func (ht *hostTester) createObligation(filesize uint64, windowStart, windowEnd types.BlockHeight) *contractObligation {
+	// Create the file on the host.
+	data := make([]byte, filesize)
+	rand.Read(data)
+	merkleRoot, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	lockID := ht.host.mu.Lock()
+	file, path, err := ht.host.allocate(filesize)
+	ht.host.mu.Unlock(lockID)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	_, err = file.Write(data)
+	file.Close()
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+
+	// Create and submit the file contract.
+	payout := types.NewCurrency64(10e3)
+	fc := types.FileContract{
+		FileSize:           filesize,
+		FileMerkleRoot:     merkleRoot,
+		WindowStart:        windowStart,
+		WindowEnd:          windowEnd,
+		Payout:             payout,
+		ValidProofOutputs:  []types.SiacoinOutput{{Value: payout, UnlockHash: ht.host.UnlockHash}},
+		MissedProofOutputs: []types.SiacoinOutput{{Value: payout, UnlockHash: types.ZeroUnlockHash}},
+	}
+	id, err := ht.wallet.RegisterTransaction(types.Transaction{})
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	_, err = ht.wallet.FundTransaction(id, payout)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	_, _, err = ht.wallet.AddFileContract(id, fc)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	txn, err := ht.wallet.SignTransaction(id, true)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	err = ht.tpool.AcceptTransaction(txn)
+	if err != nil {
+		ht.t.Fatal(err)
+	}
+	ht.tpUpdateWait()
+
+	// Give the host an obligation for the contract.
+	co := &contractObligation{
+		ID:           txn.FileContractID(0),
+		FileContract: fc,
+		Path:         path,
+	}
+	lockID = ht.host.mu.Lock()
+	ht.host.addObligation(co)
+	ht.host.mu.Unlock(lockID)
+	return co
+}
+
+// mineBlock mines a block and waits for the update to reach all modules.
+// FindBlock only tries a limited number of nonces, so it is called until a
+// block is found. The miner may not have seen the latest block yet if the host
+// submitted a transaction in the meantime, in which case the block it finds
+// does not extend the chain and is mined again.
+func (ht *hostTester) mineBlock() {
+	for {
+		b, solved, err := ht.miner.FindBlock()
+		if err != nil {
+			ht.t.Fatal(err)
+		}
+		if solved && ht.cs.CurrentBlock().ID() == b.ID() {
+			break
+		}
+	}
+	ht.csUpdateWait()
+}
+
+// TestStorageProofSubmission checks that the host submits a storage proof for
+// an obligation, keeps the file until the proof is buried in the blockchain,
+// and then deallocates the file.
+func TestStorageProofSubmission(t *testing.T) {
+	ht := CreateHostTester("TestStorageProofSubmission", t)
+	initialSpace := ht.host.spaceRemaining
+
+	windowStart := ht.cs.Height() + 2
+	windowEnd := windowStart + StorageProofReorgDepth + 10
+	co := ht.createObligation(4e3, windowStart, windowEnd)
+
+	// Mine blocks until the proof has been confirmed.
+	for {
+		lockID := ht.host.mu.RLock()
+		confirmed := co.ProofConfirmed
+		ht.host.mu.RUnlock(lockID)
+		if confirmed {
+			break
+		}
+		if ht.cs.Height() >= windowEnd {
+			t.Fatal("storage proof was not confirmed before the end of the window")
+		}
+		ht.mineBlock()
+	}
+
+	// The file should be kept until the proof is buried.
+	lockID := ht.host.mu.RLock()
+	_, exists := ht.host.obligationsByID[co.ID]
+	ht.host.mu.RUnlock(lockID)
+	if !exists {
+		t.Fatal("obligation was removed before the storage proof was buried")
+	}
+	for i := 0; i < StorageProofReorgDepth; i++ {
+		ht.mineBlock()
+	}
+	lockID = ht.host.mu.RLock()
+	_, exists = ht.host.obligationsByID[co.ID]
+	spaceRemaining := ht.host.spaceRemaining
+	ht.host.mu.RUnlock(lockID)
+	if exists {
+		t.Error("obligation was not removed after the storage proof was buried")
+	}
+	if spaceRemaining != initialSpace {
+		t.Error("space was not returned after the obligation was removed")
+	}
+	if ht.host.Info().RevenueRealized.Cmp(co.revenue()) != 0 {
+		t.Error("revenue from the storage proof was not realized")
+	}
+}
+
+// TestMissedStorageProof checks that the host gives up on an obligation whose
+// file has been corrupted, and records the lost collateral.
+func TestMissedStorageProof(t *testing.T) {
+	ht := CreateHostTester("TestMissedStorageProof", t)
+	windowStart := ht.cs.Height() + 2
+	windowEnd := windowStart + StorageProofReorgDepth + 5
+	co := ht.createObligation(4e3, windowStart, windowEnd)
+	lockID := ht.host.mu.Lock()
+	co.Collateral = types.NewCurrency64(1e3)
+	ht.host.mu.Unlock(lockID)
+
+	// Corrupt the file so that the storage proof fails verification.
+	err := ioutil.WriteFile(filepath.Join(ht.host.saveDir, co.Path), make([]byte, 4e3), 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Confirm the contract and check that the collateral is reported as
+	// locked.
+	ht.mineBlock()
+	info := ht.host.Info()
+	if info.LockedCollateral.Cmp(co.Collateral) != 0 {
+		t.Error("collateral of the confirmed contract is not reported as locked")
+	}
+	if len(info.Contracts) != 1 || info.Contracts[0].ID != co.ID {
+		t.Fatal("contract is not reported in the host info")
+	}
+
+	for ht.cs.Height() <= windowEnd {
+		ht.mineBlock()
+	}
+	info = ht.host.Info()
+	if info.NumContracts != 0 {
+		t.Error("obligation was not removed after the window closed")
+	}
+	if info.CollateralLost.Cmp(co.Collateral) != 0 {
+		t.Error("collateral from the missed proof was not recorded as lost")
+	}
+	if !info.LockedCollateral.IsZero() || !info.RevenueRealized.IsZero() {
+		t.Error("missed proof should not leave locked collateral or realized revenue")
+	}
+}
+
+// TestStorageProofReorg checks that an obligation whose storage proof is
+// reverted has its proof marked as unconfirmed.
+func TestStorageProofReorg(t *testing.T) {
+	ht := CreateHostTester("TestStorageProofReorg", t)
+	co := ht.createObligation(4e3, ht.cs.Height()+2, ht.cs.Height()+100)
+
+	// Simulate a block containing the proof being applied and then reverted.
+	b := types.Block{Transactions: []types.Transaction{{
+		StorageProofs: []types.StorageProof{{ParentID: co.ID}},
+	}}}
+	ht.mineBlock()
+	ht.host.ReceiveConsensusSetUpdate(modules.ConsensusChange{AppliedBlocks: []types.Block{b}})
+	if !co.ProofConfirmed {
+		t.Fatal("proof was not confirmed by an applied block")
+	}
+	ht.host.ReceiveConsensusSetUpdate(modules.ConsensusChange{RevertedBlocks: []types.Block{b}})
+	if co.ProofConfirmed {
+		t.Error("proof is still confirmed after being reverted")
+	}
+	if _, exists := ht.host.obligationsByID[co.ID]; !exists {
+		t.Error("obligation was removed after the proof was reverted")
+	}
+}
+
+// TestContractConfirmation checks that an obligation is confirmed when its
+// file contract appears in the blockchain, and that an obligation whose
+// contract never appears is dropped after the confirmation timeout.
+func TestContractConfirmation(t *testing.T) {
+	ht := CreateHostTester("TestContractConfirmation", t)
+	initialSpace := ht.host.spaceRemaining
+
+	// Create an obligation whose contract makes it into the blockchain.
+	co := ht.createObligation(4e3, ht.cs.Height()+200, ht.cs.Height()+300)
+	ht.mineBlock()
+	lockID := ht.host.mu.RLock()
+	confirmed := co.ContractConfirmed
+	ht.host.mu.RUnlock(lockID)
+	if !confirmed {
+		t.Fatal("contract was not confirmed after being mined")
+	}
+
+	// Create an obligation for a contract that never makes it into the
+	// blockchain.
+	lockID = ht.host.mu.Lock()
+	file, path, err := ht.host.allocate(4e3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	orphan := &contractObligation{
+		ID:           types.FileContractID{1},
+		FileContract: types.FileContract{FileSize: 4e3, WindowStart: ht.host.blockHeight + 200},
+		Path:         path,
+	}
+	ht.host.addObligation(orphan)
+	ht.host.mu.Unlock(lockID)
+
+	// Mine blocks until the confirmation deadline has passed.
+	for i := 0; i < ContractConfirmationTimeout; i++ {
+		ht.mineBlock()
+	}
+	lockID = ht.host.mu.RLock()
+	_, orphanExists := ht.host.obligationsByID[orphan.ID]
+	_, coExists := ht.host.obligationsByID[co.ID]
+	spaceRemaining := ht.host.spaceRemaining
+	ht.host.mu.RUnlock(lockID)
+	if orphanExists {
+		t.Error("unconfirmed obligation was not dropped after the timeout")
+	}
+	if !coExists {
+		t.Error("confirmed obligation was dropped")
+	}
+	if spaceRemaining != initialSpace-4e3 {
+		t.Error("space was not returned after dropping the unconfirmed obligation")
+	}
+}
+
+// TestContractReorg checks that an obligation whose file contract is reverted
+// becomes unconfirmed and receives a new confirmation deadline.
+func TestContractReorg(t *testing.T) {
+	ht := CreateHostTester("TestContractReorg", t)
+	co := ht.createObligation(4e3, ht.cs.Height()+200, ht.cs.Height()+300)
+	ht.mineBlock()
+
+	// Revert the block containing the contract.
+	b := ht.cs.CurrentBlock()
+	ht.host.ReceiveConsensusSetUpdate(modules.ConsensusChange{RevertedBlocks: []types.Block{b}})
+	if co.ContractConfirmed {
+		t.Fatal("contract is still confirmed after being reverted")
+	}
+	if co.ConfirmationDeadline != ht.host.blockHeight+ContractConfirmationTimeout {
+		t.Error("reverted contract did not receive a new confirmation deadline")
+	}
+
+	// Reapply the block.
+	ht.host.ReceiveConsensusSetUpdate(modules.ConsensusChange{AppliedBlocks: []types.Block{b}})
+	if !co.ContractConfirmed {
+		t.Error("contract was not confirmed after being reapplied")
+	}
+}
@@ -1,6 +1,7 @@
 package host
 
 import (
+	"crypto/rand"
 	"errors"
 	"io"
 	"net"
@@ -9,41 +10,184 @@ import (
 
 	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
 
-// rpcRetrieve is an RPC that uploads a specified file to a client.
+const (
+	maxPaymentLen         = 1 << 14 // The maximum allowed size of a download payment coming in over the wire.
+	maxRetrieveRequestLen = 1 << 10 // The maximum allowed size of a retrieve request coming in over the wire.
+)
+
+var (
+	errBadRetrieveRange    = errors.New("requested range is not within the file")
+	errInsufficientPayment = errors.New("payment does not cover the cost of the download")
+	errUnauthorizedRequest = errors.New("request was not signed by the key in the file contract")
+)
+
+// verifyPayment checks that a payment transaction sends at least 'cost' coins
+// to the host's address. The transaction is added to the transaction pool so
+// that it makes it into the blockchain.
+func (h *Host) verifyPayment(payment types.Transaction, cost types.Currency, unlockHash types.UnlockHash) error {
+	if cost.IsZero() {
+		return nil
+	}
+	var paid types.Currency
+	for _, sco := range payment.SiacoinOutputs {
+		if sco.UnlockHash == unlockHash {
+			paid = paid.Add(sco.Value)
+		}
+	}
+	if paid.Cmp(cost) < 0 {
+		return errInsufficientPayment
+	}
+	return h.tpool.AcceptTransaction(payment)
+}
+
+// verifyRetrieveRequest checks that a retrieve request was signed by the key
+// that the file contract commits to, and that the requested range is within
+// the file. Contracts formed before retrieval was authenticated have the
+// ZeroUnlockHash and do not commit to a key, so their requests are not
+// signed.
+func verifyRetrieveRequest(req modules.RetrieveRequest, challenge crypto.Hash, fc types.FileContract, hostKey types.SiaPublicKey) error {
+	if fc.UnlockHash == types.ZeroUnlockHash {
+		if req.Length == 0 || req.Offset > fc.FileSize || req.Length > fc.FileSize-req.Offset {
+			return errBadRetrieveRange
+		}
+		return nil
+	}
+	if modules.RetrievalUnlockConditions(req.RenterKey, hostKey).UnlockHash() != fc.UnlockHash {
+		return errUnauthorizedRequest
+	}
+	if req.RenterKey.Algorithm != types.SignatureEd25519 {
+		return errUnauthorizedRequest
+	}
+	var pk crypto.PublicKey
+	err := encoding.Unmarshal([]byte(req.RenterKey.Key), &pk)
+	if err != nil {
+		return err
+	}
+	err = crypto.VerifyHash(req.SigHash(challenge), pk, req.Signature)
+	if err != nil {
+		return err
+	}
+	if req.Length == 0 || req.Offset > fc.FileSize || req.Length > fc.FileSize-req.Offset {
+		return errBadRetrieveRange
+	}
+	return nil
+}
+
+// rpcRetrieve is an RPC that uploads part of a file to a client. The client
+// signs a request for a range of the file using the key committed to in the
+// file contract, and pays for the download according to the host's download
+// price. The host responds with the segments containing the range and a
+// Merkle proof that the segments are part of the file.
 //
 // Mutexes are applied carefully to avoid locking during I/O. All necessary
 // interaction with the host involves looking up the filepath of the file being
 // requested. This is done all at once.
 func (h *Host) rpcRetrieve(conn net.Conn) error {
-	// Get the filename.
-	var contractID types.FileContractID
-	err := encoding.ReadObject(conn, &contractID, crypto.HashSize)
+	// Send a random challenge for the client to sign, then read the request.
+	var challenge crypto.Hash
+	_, err := rand.Read(challenge[:])
+	if err != nil {
+		return err
+	}
+	err = encoding.WriteObject(conn, challenge)
+	if err != nil {
+		return err
+	}
+	var req modules.RetrieveRequest
+	err = encoding.ReadObject(conn, &req, maxRetrieveRequestLen)
 	if err != nil {
 		return err
 	}
 
-	// Verify the file exists, using a mutex while reading the host.
+	// Verify the file exists and that the request is valid, using a mutex
+	// while reading the host.
 	lockID := h.mu.RLock()
-	contractObligation, exists := h.obligationsByID[contractID]
+	contractObligation, exists := h.obligationsByID[req.ContractID]
 	if !exists {
 		h.mu.RUnlock(lockID)
-		return errors.New("no record of that file")
+		err = errors.New("no record of that file")
+		encoding.WriteObject(conn, err.Error())
+		return err
 	}
 	path := filepath.Join(h.saveDir, contractObligation.Path)
+	fc := contractObligation.FileContract
+	downloadPrice := h.DownloadPrice
+	hostKey := h.PublicKey
 	h.mu.RUnlock(lockID)
+	err = verifyRetrieveRequest(req, challenge, fc, hostKey)
+	if err != nil {
+		encoding.WriteObject(conn, err.Error())
+		return err
+	}
+	err = encoding.WriteObject(conn, modules.AcceptTermsResponse)
+	if err != nil {
+		return err
+	}
+
+	// Only whole segments can be proven, so the host sends every segment that
+	// contains part of the requested range.
+	numSegments := crypto.CalculateSegments(fc.FileSize)
+	start, end := req.SegmentRange()
+	dataOffset := start * crypto.SegmentSize
+	dataEnd := end * crypto.SegmentSize
+	if dataEnd > fc.FileSize {
+		dataEnd = fc.FileSize
+	}
+	h.setTransferDeadline(conn, dataEnd-dataOffset, true)
+	terms := modules.DownloadTerms{
+		Cost:       downloadPrice.Mul(types.NewCurrency64(dataEnd - dataOffset)),
+		UnlockHash: h.UnlockHash,
+	}
+
+	// Send the terms of the download and read the payment.
+	err = encoding.WriteObject(conn, terms)
+	if err != nil {
+		return err
+	}
+	var payment types.Transaction
+	err = encoding.ReadObject(conn, &payment, maxPaymentLen)
+	if err != nil {
+		return err
+	}
+	err = h.verifyPayment(payment, terms.Cost, terms.UnlockHash)
+	if err != nil {
+		encoding.WriteObject(conn, err.Error())
+		return err
+	}
+	lockID = h.mu.Lock()
+	h.downloadRevenue = h.downloadRevenue.Add(terms.Cost)
+	h.save()
+	h.mu.Unlock(lockID)
+	err = encoding.WriteObject(conn, modules.AcceptTermsResponse)
+	if err != nil {
+		return err
+	}
 
-	// Open the file.
+	// Open the file and build the proof for the requested segments.
 	file, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
+	proof, err := crypto.BuildReaderRangeProof(file, numSegments, start, end)
+	if err != nil {
+		return err
+	}
 
-	// Transmit the file.
-	_, err = io.CopyN(conn, file, int64(contractObligation.FileContract.FileSize))
+	// Transmit the proof, followed by the segments.
+	err = encoding.WriteObject(conn, proof)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(int64(dataOffset), 0)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(conn, file, int64(dataEnd-dataOffset))
 	if err != nil {
 		return err
 	}
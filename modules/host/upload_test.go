@@ -0,0 +1,133 @@
+package host
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestVerifyPayment checks that download payments are only accepted if they
+// send enough coins to the host.
+func TestVerifyPayment(t *testing.T) {
+	ht := CreateHostTester("TestVerifyPayment", t)
+	cost := types.NewCurrency64(100)
+
+	// A free download does not need a payment.
+	err := ht.host.verifyPayment(types.Transaction{}, types.ZeroCurrency, ht.host.UnlockHash)
+	if err != nil {
+		t.Error("free download was rejected:", err)
+	}
+
+	// A payment to the wrong address, or of too few coins, is rejected.
+	payment := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Value: cost, UnlockHash: types.ZeroUnlockHash}},
+	}
+	if ht.host.verifyPayment(payment, cost, ht.host.UnlockHash) != errInsufficientPayment {
+		t.Error("payment to the wrong address was accepted")
+	}
+	payment.SiacoinOutputs[0] = types.SiacoinOutput{Value: types.NewCurrency64(99), UnlockHash: ht.host.UnlockHash}
+	if ht.host.verifyPayment(payment, cost, ht.host.UnlockHash) != errInsufficientPayment {
+		t.Error("insufficient payment was accepted")
+	}
+
+	// A funded payment of the full cost is accepted.
+	id, err := ht.wallet.RegisterTransaction(types.Transaction{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ht.wallet.FundTransaction(id, cost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ht.wallet.AddOutput(id, types.SiacoinOutput{Value: cost, UnlockHash: ht.host.UnlockHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment, err = ht.wallet.SignTransaction(id, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ht.host.verifyPayment(payment, cost, ht.host.UnlockHash)
+	if err != nil {
+		t.Error("valid payment was rejected:", err)
+	}
+}
+
+// TestVerifyRetrieveRequest checks that retrieve requests must be signed by
+// the key committed to in the file contract and must ask for a range that is
+// within the file.
+func TestVerifyRetrieveRequest(t *testing.T) {
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	renterKey := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       string(encoding.Marshal(pk)),
+	}
+	hostKey := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: "host"}
+	fc := types.FileContract{
+		FileSize:   1000,
+		UnlockHash: modules.RetrievalUnlockConditions(renterKey, hostKey).UnlockHash(),
+	}
+	challenge := crypto.HashObject("challenge")
+	signedRequest := func(offset, length uint64) modules.RetrieveRequest {
+		req := modules.RetrieveRequest{Offset: offset, Length: length, RenterKey: renterKey}
+		req.Signature, err = crypto.SignHash(req.SigHash(challenge), sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	// A signed request for a valid range is accepted.
+	err = verifyRetrieveRequest(signedRequest(100, 900), challenge, fc, hostKey)
+	if err != nil {
+		t.Error("valid request was rejected:", err)
+	}
+
+	// A request signed for a different challenge is rejected.
+	err = verifyRetrieveRequest(signedRequest(100, 900), crypto.Hash{}, fc, hostKey)
+	if err != crypto.ErrInvalidSignature {
+		t.Error("expected ErrInvalidSignature, got", err)
+	}
+
+	// A request using a key that is not in the contract is rejected.
+	req := signedRequest(100, 900)
+	req.RenterKey.Key = string(encoding.Marshal(crypto.PublicKey{}))
+	err = verifyRetrieveRequest(req, challenge, fc, hostKey)
+	if err != errUnauthorizedRequest {
+		t.Error("expected errUnauthorizedRequest, got", err)
+	}
+
+	// Requests outside of the file are rejected.
+	for _, r := range [][2]uint64{{0, 0}, {0, 1001}, {1001, 1}, {500, ^uint64(0)}} {
+		err = verifyRetrieveRequest(signedRequest(r[0], r[1]), challenge, fc, hostKey)
+		if err != errBadRetrieveRange {
+			t.Error("expected errBadRetrieveRange for", r, "got", err)
+		}
+	}
+
+	// A request signed by the renter is rejected if the contract commits to
+	// a different host.
+	otherHost := types.SiaPublicKey{Algorithm: types.SignatureEd25519, Key: "other"}
+	err = verifyRetrieveRequest(signedRequest(100, 900), challenge, fc, otherHost)
+	if err != errUnauthorizedRequest {
+		t.Error("expected errUnauthorizedRequest, got", err)
+	}
+
+	// Contracts formed before retrieval was authenticated accept unsigned
+	// requests, but still check the range.
+	fc.UnlockHash = types.ZeroUnlockHash
+	err = verifyRetrieveRequest(modules.RetrieveRequest{Offset: 100, Length: 900}, challenge, fc, hostKey)
+	if err != nil {
+		t.Error("request for an old contract was rejected:", err)
+	}
+	err = verifyRetrieveRequest(modules.RetrieveRequest{Offset: 100, Length: 901}, challenge, fc, hostKey)
+	if err != errBadRetrieveRange {
+		t.Error("expected errBadRetrieveRange, got", err)
+	}
+}
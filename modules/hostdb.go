@@ -5,6 +5,8 @@ import (
 )
 
 const (
+	HostDBDir = "hostdb"
+
 	// Denotes a host announcement in the Arbitrary Data section.
 	PrefixHostAnnouncement = "HostAnnouncement"
 )
@@ -18,6 +20,7 @@ const (
 // SpendConditions indicate the number of blocks the coins are frozen for.
 type HostAnnouncement struct {
 	IPAddress NetAddress
+	PublicKey types.SiaPublicKey
 }
 
 // HostSettings are the parameters advertised by the host. These are the
@@ -34,6 +37,15 @@ type HostSettings struct {
 	Price        types.Currency
 	Collateral   types.Currency
 	UnlockHash   types.UnlockHash
+
+	// DownloadPrice is the price, in hastings per byte, that the host charges
+	// for downloading data.
+	DownloadPrice types.Currency
+
+	// PublicKey is the key that the host uses to sign session handshakes.
+	// Renters use the key from the host's announcement, so a host cannot
+	// change its key without announcing again.
+	PublicKey types.SiaPublicKey
 }
 
 // A HostDB is a database of hosts that the renter can use for figuring out who
@@ -8,6 +8,7 @@ package hostdb
 
 import (
 	"errors"
+	"os"
 
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
@@ -45,13 +46,19 @@ type HostDB struct {
 	//  address, including hosts that are currently offline.
 	allHosts map[modules.NetAddress]*hostEntry
 
+	// lastChange is the ID of the last consensus change that the hostdb has
+	// processed, so that a restarted hostdb only receives the changes that
+	// came after it.
+	lastChange modules.ConsensusChangeID
+	saveDir    string
+
 	subscribers []chan struct{}
 
 	mu *sync.RWMutex
 }
 
-// New returns an empty HostDatabase.
-func New(cs *consensus.State, g modules.Gateway) (hdb *HostDB, err error) {
+// New returns a HostDatabase, loading the hosts saved in saveDir.
+func New(cs *consensus.State, g modules.Gateway, saveDir string) (hdb *HostDB, err error) {
 	if cs == nil {
 		err = ErrNilConsensusSet
 		return
@@ -68,10 +75,34 @@ func New(cs *consensus.State, g modules.Gateway) (hdb *HostDB, err error) {
 		activeHosts: make(map[modules.NetAddress]*hostNode),
 		allHosts:    make(map[modules.NetAddress]*hostEntry),
 
+		saveDir: saveDir,
+
 		mu: sync.New(modules.SafeMutexDelay, 1),
 	}
 
-	cs.ConsensusSetSubscribe(hdb)
+	err = os.MkdirAll(saveDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	id := hdb.mu.Lock()
+	err = hdb.load()
+	hdb.mu.Unlock(id)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	err = cs.ConsensusSetSubscribe(hdb, hdb.lastChange)
+	if err == modules.ErrInvalidConsensusChangeID {
+		// The consensus set does not know the last change that the hostdb
+		// processed, so the blockchain is scanned from the beginning.
+		id = hdb.mu.Lock()
+		hdb.lastChange = modules.ConsensusChangeBeginning
+		hdb.mu.Unlock(id)
+		err = cs.ConsensusSetSubscribe(hdb, modules.ConsensusChangeBeginning)
+	}
+	if err != nil {
+		return nil, err
+	}
 	go hdb.threadedScan()
 
 	return
@@ -70,7 +70,7 @@ func newHDBTester(name string, t *testing.T) *hdbTester {
 	testdir := tester.TempDir("hostdb", name)
 
 	// Create the gateway.
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", "", filepath.Join(testdir, modules.GatewayDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -82,7 +82,7 @@ func newHDBTester(name string, t *testing.T) *hdbTester {
 	}
 
 	// Create the hostdb.
-	hdb, err := New(cs, g)
+	hdb, err := New(cs, g, filepath.Join(testdir, modules.HostDBDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -100,7 +100,7 @@ func newHDBTester(name string, t *testing.T) *hdbTester {
 	}
 
 	// Create the host.
-	h, err := host.New(cs, tp, w, ":0", filepath.Join(testdir, modules.HostDir))
+	h, err := host.New(cs, g, tp, w, ":0", filepath.Join(testdir, modules.HostDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -151,15 +151,15 @@ func newHDBTester(name string, t *testing.T) *hdbTester {
 // correct rejection.
 func TestNilInputs(t *testing.T) {
 	hdbt := newHDBTester("TestNilInputs", t)
-	_, err := New(nil, nil)
+	_, err := New(nil, nil, "")
 	if err == nil {
 		t.Error("Should get an error when using nil inputs")
 	}
-	_, err = New(nil, hdbt.gateway)
+	_, err = New(nil, hdbt.gateway, "")
 	if err != ErrNilConsensusSet {
 		t.Error("expecting ErrNilConsensusSet:", err)
 	}
-	_, err = New(hdbt.cs, nil)
+	_, err = New(hdbt.cs, nil, "")
 	if err != ErrNilGateway {
 		t.Error("expecting ErrNilGateway:", err)
 	}
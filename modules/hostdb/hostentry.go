@@ -35,8 +35,17 @@ func (hdb *HostDB) hostWeight(entry hostEntry) (weight types.Currency) {
 
 // insert adds a host entry to the state. The host will be inserted into the
 // set of all hosts, and if it is online and responding to requests it will be
-// put into the list of active hosts.
+// put into the list of active hosts. A host that re-announces itself at a new
+// address replaces its entry at the old address.
 func (hdb *HostDB) insertHost(host modules.HostSettings) {
+	if host.PublicKey.Key != "" {
+		for addr, entry := range hdb.allHosts {
+			if addr != host.IPAddress && entry.PublicKey == host.PublicKey {
+				hdb.removeHost(addr)
+			}
+		}
+	}
+
 	// Add the host to allHosts.
 	entry := &hostEntry{
 		HostSettings: host,
@@ -91,12 +100,16 @@ func (hdb *HostDB) InsertHost(host modules.HostSettings) error {
 	id := hdb.mu.Lock()
 	defer hdb.mu.Unlock(id)
 	hdb.insertHost(host)
-	return nil
+	return hdb.save()
 }
 
 // RemoveHost removes a host from the database.
 func (hdb *HostDB) RemoveHost(addr modules.NetAddress) error {
 	id := hdb.mu.Lock()
 	defer hdb.mu.Unlock(id)
-	return hdb.removeHost(addr)
+	err := hdb.removeHost(addr)
+	if err != nil {
+		return err
+	}
+	return hdb.save()
 }
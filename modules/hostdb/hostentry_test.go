@@ -63,7 +63,7 @@ func TestInsertHost(t *testing.T) {
 		t.Error("not expecting an active host")
 	}
 
-	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: hdbt.host.Address()})
+	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: hdbt.host.Address(), PublicKey: hdbt.host.Settings().PublicKey})
 	if len(hdbt.hostdb.allHosts) != 2 {
 		t.Error("host was not inserted")
 	}
@@ -72,3 +72,24 @@ func TestInsertHost(t *testing.T) {
 		t.Error("expecting an active host")
 	}
 }
+
+// TestInsertMovedHost checks that a host announced at a new address replaces
+// the entry at its old address.
+func TestInsertMovedHost(t *testing.T) {
+	hdbt := newHDBTester("TestInsertMovedHost", t)
+	key := hdbt.host.Settings().PublicKey
+
+	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: "1.2.3.4:9982", PublicKey: key})
+	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: "foo.com:9982"})
+	hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: hdbt.host.Address(), PublicKey: key})
+	<-hdbt.hostdbUpdateChan
+
+	id := hdbt.hostdb.mu.RLock()
+	defer hdbt.hostdb.mu.RUnlock(id)
+	if len(hdbt.hostdb.allHosts) != 2 {
+		t.Error("expecting 2 hosts, got", len(hdbt.hostdb.allHosts))
+	}
+	if _, exists := hdbt.hostdb.allHosts["1.2.3.4:9982"]; exists {
+		t.Error("entry at the host's old address was not removed")
+	}
+}
@@ -0,0 +1,48 @@
+package hostdb
+
+import (
+	"path/filepath"
+
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+const (
+	// persistFilename is the name of the file that the hostdb is saved to.
+	persistFilename = "hostdb.dat"
+)
+
+// savedHostDB is the hostdb as it is saved to disk. Only the settings of each
+// host are saved; whether a host is online is rediscovered by probing it.
+// LastChange is the ID of the last consensus change that the hostdb
+// processed.
+type savedHostDB struct {
+	Hosts      []modules.HostSettings
+	LastChange modules.ConsensusChangeID
+}
+
+// save stores the hostdb to disk.
+func (hdb *HostDB) save() error {
+	sHostDB := savedHostDB{
+		Hosts:      make([]modules.HostSettings, 0, len(hdb.allHosts)),
+		LastChange: hdb.lastChange,
+	}
+	for _, entry := range hdb.allHosts {
+		sHostDB.Hosts = append(sHostDB.Hosts, entry.HostSettings)
+	}
+	return encoding.WriteFile(filepath.Join(hdb.saveDir, persistFilename), sHostDB)
+}
+
+// load restores the hostdb from disk. Each loaded host is probed again.
+func (hdb *HostDB) load() error {
+	var sHostDB savedHostDB
+	err := encoding.ReadFile(filepath.Join(hdb.saveDir, persistFilename), &sHostDB)
+	if err != nil {
+		return err
+	}
+	for _, host := range sHostDB.Hosts {
+		hdb.insertHost(host)
+	}
+	hdb.lastChange = sHostDB.LastChange
+	return nil
+}
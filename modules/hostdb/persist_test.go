@@ -0,0 +1,59 @@
+package hostdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NebulousLabs/Sia/modules"
+)
+
+// TestResumeConsensus checks that a restarted hostdb keeps its hosts and
+// resumes from the last consensus change that it processed, and that it scans
+// the blockchain again if the consensus set does not know that change.
+func TestResumeConsensus(t *testing.T) {
+	hdbt := newHDBTester("TestResumeConsensus", t)
+	err := hdbt.hostdb.InsertHost(modules.HostSettings{IPAddress: "foo:9982"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := hdbt.hostdb.mu.RLock()
+	lastChange := hdbt.hostdb.lastChange
+	saveDir := hdbt.hostdb.saveDir
+	hdbt.hostdb.mu.RUnlock(id)
+	if lastChange == modules.ConsensusChangeBeginning {
+		t.Fatal("hostdb did not record the last consensus change")
+	}
+
+	hdb, err := New(hdbt.cs, hdbt.gateway, saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = hdb.mu.Lock()
+	if _, exists := hdb.allHosts["foo:9982"]; !exists {
+		t.Error("restarted hostdb did not load its hosts")
+	}
+	if hdb.lastChange != lastChange {
+		t.Error("restarted hostdb did not resume from its last change")
+	}
+	hdb.lastChange = modules.ConsensusChangeID{1}
+	hdb.save()
+	hdb.mu.Unlock(id)
+
+	// A hostdb whose last change is unknown starts over from the beginning.
+	hdb, err = New(hdbt.cs, hdbt.gateway, saveDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		id = hdb.mu.RLock()
+		caughtUp := hdb.lastChange == lastChange
+		hdb.mu.RUnlock(id)
+		if caughtUp {
+			break
+		}
+		if i == 100 {
+			t.Fatal("hostdb did not scan the blockchain again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
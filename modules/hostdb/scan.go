@@ -71,6 +71,10 @@ func (hdb *HostDB) threadedProbeHost(entry *hostEntry) {
 			return err
 		}
 		defer conn.Close()
+		conn, err = modules.NewRenterSession(conn, entry.PublicKey)
+		if err != nil {
+			return err
+		}
 		err = encoding.WriteObject(conn, [8]byte{'S', 'e', 't', 't', 'i', 'n', 'g', 's'})
 		if err != nil {
 			return err
@@ -89,8 +93,9 @@ func (hdb *HostDB) threadedProbeHost(entry *hostEntry) {
 	}
 
 	// Update the host settings, reliability, and weight. The old IPAddress
-	// must be preserved.
+	// and PublicKey must be preserved.
 	settings.IPAddress = entry.HostSettings.IPAddress
+	settings.PublicKey = entry.HostSettings.PublicKey
 	entry.HostSettings = settings
 	entry.reliability = ActiveReliability
 	entry.weight = hdb.hostWeight(*entry)
@@ -18,6 +18,12 @@ import (
 	"github.com/NebulousLabs/Sia/types"
 )
 
+// oldHostAnnouncement is the encoding of a HostAnnouncement before hosts
+// announced their public keys.
+type oldHostAnnouncement struct {
+	IPAddress modules.NetAddress
+}
+
 // findHostAnnouncements returns a list of the host announcements found within
 // a given block. No check is made to see that the ip address found in the
 // announcement is actually a valid ip address.
@@ -29,17 +35,25 @@ func findHostAnnouncements(b types.Block) (announcements []modules.HostSettings)
 				continue
 			}
 
-			// decode the HostAnnouncement
+			// decode the HostAnnouncement. Announcements made before hosts
+			// had keys contain only the address; those hosts are added
+			// without a key, and replaced when they announce again.
 			var ha modules.HostAnnouncement
 			encAnnouncement := []byte(strings.TrimPrefix(data, modules.PrefixHostAnnouncement))
 			err := encoding.Unmarshal(encAnnouncement, &ha)
 			if err != nil {
-				continue
+				var oldHA oldHostAnnouncement
+				err = encoding.Unmarshal(encAnnouncement, &oldHA)
+				if err != nil {
+					continue
+				}
+				ha = modules.HostAnnouncement{IPAddress: oldHA.IPAddress}
 			}
 
 			// Add the announcement to the slice being returned.
 			announcements = append(announcements, modules.HostSettings{
 				IPAddress: ha.IPAddress,
+				PublicKey: ha.PublicKey,
 			})
 		}
 	}
@@ -49,17 +63,20 @@ func findHostAnnouncements(b types.Block) (announcements []modules.HostSettings)
 
 // ReceiveConsensusSetUpdate accepts an update from the consensus set which
 // contains new blocks.
-func (hdb *HostDB) ReceiveConsensusSetUpdate(_, appliedBlocks []types.Block) {
+func (hdb *HostDB) ReceiveConsensusSetUpdate(cc modules.ConsensusChange) {
 	id := hdb.mu.Lock()
 	defer hdb.mu.Unlock(id)
 
 	// Add hosts announced in blocks that were applied.
-	for _, block := range appliedBlocks {
+	for _, block := range cc.AppliedBlocks {
 		for _, host := range findHostAnnouncements(block) {
 			hdb.insertHost(host)
 		}
 	}
 
+	hdb.lastChange = cc.ID
+	hdb.save()
+
 	hdb.notifySubscribers()
 
 	return
@@ -24,6 +24,13 @@ func TestFindHostAnnouncements(t *testing.T) {
 		t.Error("host announcement not found in block")
 	}
 
+	// Try with an announcement made before hosts had keys.
+	b.Transactions[0].ArbitraryData[0] = modules.PrefixHostAnnouncement + string(encoding.Marshal(oldHostAnnouncement{IPAddress: "foo:1"}))
+	announcements = findHostAnnouncements(b)
+	if len(announcements) != 1 || announcements[0].IPAddress != "foo:1" {
+		t.Error("old host announcement not found in block")
+	}
+
 	// Try with an altered prefix
 	b.Transactions[0].ArbitraryData[0] = "bad" + b.Transactions[0].ArbitraryData[0]
 	announcements = findHostAnnouncements(b)
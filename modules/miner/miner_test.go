@@ -21,7 +21,7 @@ func TestMiner(t *testing.T) {
 	testdir := tester.TempDir("miner", "TestMiner")
 
 	// Create the miner and all of its dependencies.
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", "", filepath.Join(testdir, modules.GatewayDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -74,7 +74,7 @@ func TestManyBlocks(t *testing.T) {
 	testdir := tester.TempDir("miner", "TestMiner")
 
 	// Create the miner and all of it's dependencies.
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", "", filepath.Join(testdir, modules.GatewayDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -71,6 +71,10 @@ type Renter interface {
 	// Download downloads a file to the given filepath.
 	Download(nickname, filepath string) error
 
+	// DownloadRange downloads 'length' bytes of a file, starting 'offset'
+	// bytes into the file, to the given filepath.
+	DownloadRange(nickname, filepath string, offset, length uint64) error
+
 	// DownloadQueue lists all the files that have been scheduled for download.
 	DownloadQueue() []DownloadInfo
 
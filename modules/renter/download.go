@@ -1,22 +1,22 @@
 package renter
 
 import (
+	"bytes"
 	"crypto/rand"
 	"errors"
-	"io"
 	"io/ioutil"
-	"net"
 	"os"
 	"sync/atomic"
 	"time"
 
 	"github.com/NebulousLabs/Sia/crypto"
-	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 )
 
 var (
 	downloadAttempts = 5
+
+	errBadRange = errors.New("requested range is not within the file")
 )
 
 // A Download is a file download that has been queued by the renter.
@@ -31,8 +31,15 @@ type Download struct {
 	destination string
 	nickname    string
 
+	// A partial download retrieves only the plaintext bytes in [offset,
+	// offset+length) of the file.
+	partial bool
+	offset  uint64
+	length  uint64
+
 	pieces []filePiece
 	file   *os.File
+	wallet modules.Wallet
 }
 
 // Complete returns whether the file is ready to be used.
@@ -71,38 +78,31 @@ func (d *Download) Write(b []byte) (int, error) {
 
 // downloadPiece attempts to retrieve a file piece from a host.
 func (d *Download) downloadPiece(piece filePiece) error {
-	conn, err := net.DialTimeout("tcp", string(piece.HostIP), 10e9)
+	return retrieve(piece, 0, piece.Contract.FileSize, d, d.wallet)
+}
+
+// downloadRange attempts to retrieve the requested range of a file piece from
+// a host and writes the decrypted range to the download's file. The
+// ciphertext is proven against the contract's Merkle root as it is retrieved,
+// so it does not need to be authenticated again when it is decrypted.
+func (d *Download) downloadRange(piece filePiece) error {
+	// The nonce at the start of the ciphertext is needed to decrypt the
+	// range.
+	var nonce, ct bytes.Buffer
+	err := retrieve(piece, 0, crypto.TwofishNonceSize, &nonce, d.wallet)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
-	err = encoding.WriteObject(conn, [8]byte{'R', 'e', 't', 'r', 'i', 'e', 'v', 'e'})
+	err = retrieve(piece, crypto.TwofishNonceSize+d.offset, d.length, &ct, d.wallet)
 	if err != nil {
 		return err
 	}
-
-	// Send the ID of the contract for the file piece we're requesting.
-	if err := encoding.WriteObject(conn, piece.ContractID); err != nil {
-		return err
-	}
-
-	// Simultaneously download the file and calculate its Merkle root.
-	tee := io.TeeReader(
-		// Use a LimitedReader to ensure we don't read indefinitely.
-		io.LimitReader(conn, int64(piece.Contract.FileSize)),
-		// Each byte we read from tee will also be written to file.
-		d,
-	)
-	merkleRoot, err := crypto.ReaderMerkleRoot(tee)
+	plaintext, err := piece.EncryptionKey.DecryptRange(nonce.Bytes(), ct.Bytes(), d.offset)
 	if err != nil {
 		return err
 	}
-
-	if merkleRoot != piece.Contract.FileMerkleRoot {
-		return errors.New("host provided a file that's invalid")
-	}
-
-	return nil
+	_, err = d.Write(plaintext)
+	return err
 }
 
 // start initiates the download of a File.
@@ -111,6 +111,16 @@ func (d *Download) start() {
 	// succeeds.
 	for i := 0; i < downloadAttempts; i++ {
 		for _, piece := range d.pieces {
+			if d.partial {
+				if d.downloadRange(piece) == nil {
+					d.complete = true
+					d.file.Close()
+					return
+				}
+				d.file.Seek(0, 0)
+				continue
+			}
+
 			downloadErr := d.downloadPiece(piece)
 			if downloadErr == nil {
 				// Decrypt the file.
@@ -143,8 +153,26 @@ func (d *Download) start() {
 	os.Remove(d.destination)
 }
 
+// fillDownloadPrices sets the download price of each piece that was uploaded
+// before hosts advertised one to the price that its host currently
+// advertises. Without a price, any host that charges for downloads would be
+// refused.
+func fillDownloadPrices(pieces []filePiece, hosts []modules.HostSettings) {
+	for i := range pieces {
+		if !pieces[i].DownloadPrice.IsZero() {
+			continue
+		}
+		for _, host := range hosts {
+			if host.IPAddress == pieces[i].HostIP {
+				pieces[i].DownloadPrice = host.DownloadPrice
+				break
+			}
+		}
+	}
+}
+
 // newDownload initializes a new Download object.
-func newDownload(file *file, destination string) (*Download, error) {
+func newDownload(file *file, destination string, wallet modules.Wallet) (*Download, error) {
 	// Create the download destination file.
 	handle, err := os.Create(destination)
 	if err != nil {
@@ -172,6 +200,7 @@ func newDownload(file *file, destination string) (*Download, error) {
 
 		pieces: activePieces,
 		file:   handle,
+		wallet: wallet,
 	}, nil
 }
 
@@ -188,10 +217,48 @@ func (r *Renter) Download(nickname, destination string) error {
 	}
 
 	// Create the download object and spawn the download process.
-	d, err := newDownload(file, destination)
+	d, err := newDownload(file, destination, r.wallet)
+	if err != nil {
+		return err
+	}
+	fillDownloadPrices(d.pieces, r.hostDB.AllHosts())
+	go d.start()
+
+	// Add the download to the download queue.
+	r.downloadQueue = append(r.downloadQueue, d)
+	return nil
+}
+
+// DownloadRange downloads 'length' bytes of a file, starting 'offset' bytes
+// into the file, to the destination specified. Only the segments that contain
+// the range are retrieved from the host.
+func (r *Renter) DownloadRange(nickname, destination string, offset, length uint64) error {
+	lockID := r.mu.Lock()
+	defer r.mu.Unlock(lockID)
+
+	// Lookup the File associated with the nickname.
+	file, exists := r.files[nickname]
+	if !exists {
+		return errors.New("no file of that nickname")
+	}
+	if len(file.Pieces) == 0 || file.Pieces[0].Contract.FileSize < crypto.TwofishOverhead {
+		return errBadRange
+	}
+	size := file.Pieces[0].Contract.FileSize - crypto.TwofishOverhead
+	if length == 0 || offset > size || length > size-offset {
+		return errBadRange
+	}
+
+	// Create the download object and spawn the download process.
+	d, err := newDownload(file, destination, r.wallet)
 	if err != nil {
 		return err
 	}
+	fillDownloadPrices(d.pieces, r.hostDB.AllHosts())
+	d.partial = true
+	d.offset = offset
+	d.length = length
+	d.filesize = length
 	go d.start()
 
 	// Add the download to the download queue.
@@ -0,0 +1,32 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestFillDownloadPrices checks that pieces uploaded before hosts advertised
+// a download price use the price that their host currently advertises.
+func TestFillDownloadPrices(t *testing.T) {
+	pieces := []filePiece{
+		{HostIP: "foo:1"},
+		{HostIP: "bar:1", DownloadPrice: types.NewCurrency64(3)},
+		{HostIP: "baz:1"},
+	}
+	hosts := []modules.HostSettings{
+		{IPAddress: "foo:1", DownloadPrice: types.NewCurrency64(5)},
+		{IPAddress: "bar:1", DownloadPrice: types.NewCurrency64(7)},
+	}
+	fillDownloadPrices(pieces, hosts)
+	if pieces[0].DownloadPrice.Cmp(types.NewCurrency64(5)) != 0 {
+		t.Error("missing price was not filled in:", pieces[0].DownloadPrice)
+	}
+	if pieces[1].DownloadPrice.Cmp(types.NewCurrency64(3)) != 0 {
+		t.Error("stored price was replaced:", pieces[1].DownloadPrice)
+	}
+	if !pieces[2].DownloadPrice.IsZero() {
+		t.Error("price of an unknown host was set:", pieces[2].DownloadPrice)
+	}
+}
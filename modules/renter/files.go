@@ -39,18 +39,23 @@ type file struct {
 // been uploaded to a host, including information about the host and the health
 // of the file piece.
 type filePiece struct {
-	Active     bool                 // True if the host has the file and has been online somewhat recently.
-	Repairing  bool                 // True if the piece is currently being uploaded.
-	Contract   types.FileContract   // The contract being enforced.
-	ContractID types.FileContractID // The ID of the contract.
+	Active        bool                 // True if the host has the file and has been online somewhat recently.
+	Repairing     bool                 // True if the piece is currently being uploaded.
+	Contract      types.FileContract   // The contract being enforced.
+	ContractID    types.FileContractID // The ID of the contract.
+	DownloadPrice types.Currency       // The download price advertised by the host when the contract was formed.
 
 	HostIP     modules.NetAddress // Where to find the file piece.
+	HostKey    types.SiaPublicKey // The key used to authenticate the host.
 	StartIndex uint64
 	EndIndex   uint64
 
 	PieceIndex    int // Indicates the erasure coding index of this piece.
 	EncryptionKey crypto.TwofishKey
 	Checksum      crypto.Hash
+
+	RenterKey   types.SiaPublicKey // The key committed to in the contract.
+	RetrieveKey crypto.SecretKey   // Used to sign download requests.
 }
 
 // Available indicates whether the file is ready to be downloaded.
@@ -19,11 +19,11 @@ const (
 	defaultWindowSize = 288 // 48 Hours
 )
 
-// createContractTransaction takes contract terms and a merkle root and uses
-// them to build a transaction containing a file contract that satisfies the
-// terms, including providing an input balance. The transaction does not get
-// signed.
-func (r *Renter) createContractTransaction(terms modules.ContractTerms, merkleRoot crypto.Hash) (txn types.Transaction, id string, err error) {
+// createContractTransaction takes contract terms, the host's key, and a merkle
+// root and uses them to build a transaction containing a file contract that
+// satisfies the terms, including providing an input balance. The transaction
+// does not get signed.
+func (r *Renter) createContractTransaction(terms modules.ContractTerms, hostKey types.SiaPublicKey, merkleRoot crypto.Hash) (txn types.Transaction, id string, err error) {
 	// Get the payout as set by the missed proofs, and the client fund as determined by the terms.
 	var payout types.Currency
 	for _, output := range terms.MissedProofOutputs {
@@ -44,6 +44,7 @@ func (r *Renter) createContractTransaction(terms modules.ContractTerms, merkleRo
 		Payout:             payout,
 		ValidProofOutputs:  terms.ValidProofOutputs,
 		MissedProofOutputs: terms.MissedProofOutputs,
+		UnlockHash:         modules.RetrievalUnlockConditions(terms.RenterKey, hostKey).UnlockHash(),
 	}
 
 	// Create the transaction.
@@ -65,8 +66,9 @@ func (r *Renter) createContractTransaction(terms modules.ContractTerms, merkleRo
 
 // negotiateContract creates a file contract for a host according to the
 // requests of the host. There is an assumption that only hosts with acceptable
-// terms will be put into the hostdb.
-func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUploadParams) (contract types.FileContract, fcid types.FileContractID, key crypto.TwofishKey, err error) {
+// terms will be put into the hostdb. The contract commits to 'renterKey', which
+// must be used to sign download requests.
+func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUploadParams, renterKey types.SiaPublicKey) (contract types.FileContract, fcid types.FileContractID, key crypto.TwofishKey, err error) {
 	height := r.blockHeight
 
 	key, err = crypto.GenerateTwofishKey()
@@ -107,6 +109,7 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 		WindowSize:    defaultWindowSize,
 		Price:         host.Price,
 		Collateral:    host.Collateral,
+		RenterKey:     renterKey,
 	}
 	terms.ValidProofOutputs = []types.SiacoinOutput{
 		types.SiacoinOutput{
@@ -130,7 +133,7 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 		return
 	}
 	file.Seek(0, 0) // reset read position
-	unsignedTxn, txnRef, err := r.createContractTransaction(terms, merkleRoot)
+	unsignedTxn, txnRef, err := r.createContractTransaction(terms, host.PublicKey, merkleRoot)
 	if err != nil {
 		return
 	}
@@ -147,6 +150,10 @@ func (r *Renter) negotiateContract(host modules.HostSettings, up modules.FileUpl
 		return
 	}
 	defer conn.Close()
+	conn, err = modules.NewRenterSession(conn, host.PublicKey)
+	if err != nil {
+		return
+	}
 	err = encoding.WriteObject(conn, [8]byte{'C', 'o', 'n', 't', 'r', 'a', 'c', 't'})
 	if err != nil {
 		return
@@ -70,7 +70,10 @@ func New(cs *consensus.State, hdb modules.HostDB, wallet modules.Wallet, saveDir
 	// This also won't be a problem once we're also saving the addresses.
 	r.scanAllFiles()
 
-	r.cs.ConsensusSetSubscribe(r)
+	err = r.cs.ConsensusSetSubscribe(r, modules.ConsensusChangeBeginning)
+	if err != nil {
+		return nil, err
+	}
 
 	return r, nil
 }
@@ -58,7 +58,7 @@ func newRenterTester(name string, t *testing.T) *renterTester {
 	testdir := tester.TempDir("renter", name)
 
 	// Create the gateway.
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", "", filepath.Join(testdir, modules.GatewayDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -70,7 +70,7 @@ func newRenterTester(name string, t *testing.T) *renterTester {
 	}
 
 	// Create the hostdb.
-	hdb, err := hostdb.New(cs, g)
+	hdb, err := hostdb.New(cs, g, filepath.Join(testdir, modules.HostDBDir))
 	if err != nil {
 		t.Fatal(err)
 	}
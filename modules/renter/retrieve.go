@@ -0,0 +1,180 @@
+package renter
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// downloadCostTolerance is the percentage by which the cost of a download
+	// may exceed the download price that the host advertised when the file
+	// was uploaded.
+	downloadCostTolerance = 5
+)
+
+var (
+	errHighDownloadCost = errors.New("host is charging more than its advertised download price")
+)
+
+// A rangeWriter passes on the bytes of a stream that fall within a range,
+// discarding the rest.
+type rangeWriter struct {
+	w         io.Writer
+	skip      uint64
+	remaining uint64
+}
+
+// Write implements the io.Writer interface.
+func (rw *rangeWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	if rw.skip >= uint64(len(b)) {
+		rw.skip -= uint64(len(b))
+		return n, nil
+	}
+	b = b[rw.skip:]
+	rw.skip = 0
+	if uint64(len(b)) > rw.remaining {
+		b = b[:rw.remaining]
+	}
+	rw.remaining -= uint64(len(b))
+	_, err := rw.w.Write(b)
+	return n, err
+}
+
+// createPayment creates a transaction that pays a host for downloading 'size'
+// bytes of a file piece. Hosts asking for more than their advertised download
+// price, plus a tolerance of 'downloadCostTolerance' percent, are refused.
+func createPayment(wallet modules.Wallet, piece filePiece, terms modules.DownloadTerms, size uint64) (txn types.Transaction, err error) {
+	if terms.Cost.IsZero() {
+		return
+	}
+	maxCost := piece.DownloadPrice.Mul(types.NewCurrency64(size)).Mul(types.NewCurrency64(100 + downloadCostTolerance)).Div(types.NewCurrency64(100))
+	if terms.Cost.Cmp(maxCost) > 0 {
+		err = errHighDownloadCost
+		return
+	}
+
+	id, err := wallet.RegisterTransaction(txn)
+	if err != nil {
+		return
+	}
+	_, err = wallet.FundTransaction(id, terms.Cost)
+	if err != nil {
+		return
+	}
+	_, _, err = wallet.AddOutput(id, types.SiacoinOutput{Value: terms.Cost, UnlockHash: terms.UnlockHash})
+	if err != nil {
+		return
+	}
+	return wallet.SignTransaction(id, true)
+}
+
+// readResponse reads a response from the host, returning an error if the host
+// did not accept.
+func readResponse(conn net.Conn) error {
+	var response string
+	if err := encoding.ReadObject(conn, &response, 128); err != nil {
+		return err
+	}
+	if response != modules.AcceptTermsResponse {
+		return errors.New(response)
+	}
+	return nil
+}
+
+// retrieve downloads 'length' bytes of a file piece, starting at 'offset', and
+// writes them to w. The request is signed with the piece's retrieval key, and
+// the host's response is checked against the Merkle root of the file contract.
+func retrieve(piece filePiece, offset, length uint64, w io.Writer, wallet modules.Wallet) error {
+	conn, err := net.DialTimeout("tcp", string(piece.HostIP), 10e9)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn, err = modules.NewRenterSession(conn, piece.HostKey)
+	if err != nil {
+		return err
+	}
+	err = encoding.WriteObject(conn, [8]byte{'R', 'e', 't', 'r', 'i', 'e', 'v', 'e'})
+	if err != nil {
+		return err
+	}
+
+	// Read the challenge from the host and send a signed request for the
+	// range.
+	var challenge crypto.Hash
+	if err := encoding.ReadObject(conn, &challenge, crypto.HashSize); err != nil {
+		return err
+	}
+	req := modules.RetrieveRequest{
+		ContractID: piece.ContractID,
+		Offset:     offset,
+		Length:     length,
+		RenterKey:  piece.RenterKey,
+	}
+	// Pieces uploaded before retrieval was authenticated have no key, and
+	// the host does not check their requests.
+	if piece.RenterKey.Key != "" {
+		req.Signature, err = crypto.SignHash(req.SigHash(challenge), piece.RetrieveKey)
+		if err != nil {
+			return err
+		}
+	}
+	if err := encoding.WriteObject(conn, req); err != nil {
+		return err
+	}
+	if err := readResponse(conn); err != nil {
+		return err
+	}
+
+	// Only whole segments can be proven, so the host sends, and charges for,
+	// every segment that contains part of the requested range.
+	fc := piece.Contract
+	numSegments := crypto.CalculateSegments(fc.FileSize)
+	start, end := req.SegmentRange()
+	dataOffset := start * crypto.SegmentSize
+	dataEnd := end * crypto.SegmentSize
+	if dataEnd > fc.FileSize {
+		dataEnd = fc.FileSize
+	}
+
+	// Read the terms of the download and pay the host.
+	var terms modules.DownloadTerms
+	if err := encoding.ReadObject(conn, &terms, 256); err != nil {
+		return err
+	}
+	payment, err := createPayment(wallet, piece, terms, dataEnd-dataOffset)
+	if err != nil {
+		return err
+	}
+	if err := encoding.WriteObject(conn, payment); err != nil {
+		return err
+	}
+	if err := readResponse(conn); err != nil {
+		return err
+	}
+
+	// Read the proof, then simultaneously download the segments and verify
+	// them against the Merkle root of the file.
+	var proof []crypto.Hash
+	if err := encoding.ReadObject(conn, &proof, 128*crypto.HashSize); err != nil {
+		return err
+	}
+	tee := io.TeeReader(
+		// Use a LimitedReader to ensure we don't read indefinitely.
+		io.LimitReader(conn, int64(dataEnd-dataOffset)),
+		// Each byte of the requested range will also be written to w.
+		&rangeWriter{w: w, skip: offset - dataOffset, remaining: length},
+	)
+	if !crypto.VerifyReaderRangeProof(tee, proof, numSegments, start, end, fc.FileMerkleRoot) {
+		return errors.New("host provided a file that's invalid")
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package renter
+
+import (
+	"testing"
+
+	"github.com/NebulousLabs/Sia/modules"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+// TestCreatePaymentBound checks that createPayment refuses hosts that charge
+// more than their advertised download price.
+func TestCreatePaymentBound(t *testing.T) {
+	rt := newRenterTester("TestCreatePaymentBound", t)
+	piece := filePiece{DownloadPrice: types.NewCurrency64(10)}
+
+	// 100 bytes at the advertised price, plus the tolerance.
+	terms := modules.DownloadTerms{Cost: types.NewCurrency64(10 * 100 * (100 + downloadCostTolerance) / 100)}
+	_, err := createPayment(rt.wallet, piece, terms, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	terms.Cost = terms.Cost.Add(types.NewCurrency64(1))
+	_, err = createPayment(rt.wallet, piece, terms, 100)
+	if err != errHighDownloadCost {
+		t.Error("expected errHighDownloadCost, got", err)
+	}
+}
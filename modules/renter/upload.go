@@ -6,6 +6,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/types"
 )
@@ -56,6 +58,17 @@ func (r *Renter) threadedUploadPiece(up modules.FileUploadParams, piece *filePie
 	piece.Repairing = true
 	r.mu.Unlock(lockID)
 
+	// Generate the key that will be committed to in the file contract and
+	// used to sign download requests.
+	retrieveKey, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		return
+	}
+	renterKey := types.SiaPublicKey{
+		Algorithm: types.SignatureEd25519,
+		Key:       string(encoding.Marshal(pk)),
+	}
+
 	// Try 'maxUploadAttempts' hosts before giving up.
 	for attempts := 0; attempts < maxUploadAttempts; attempts++ {
 		// Select a host. An error here is unrecoverable.
@@ -67,7 +80,7 @@ func (r *Renter) threadedUploadPiece(up modules.FileUploadParams, piece *filePie
 		// Negotiate the contract with the host. If the negotiation is
 		// unsuccessful, we need to try again with a new host. Otherwise, the
 		// file will be uploaded and we'll be done.
-		contract, contractID, key, err := r.negotiateContract(host, up)
+		contract, contractID, key, err := r.negotiateContract(host, up, renterKey)
 		if err != nil {
 			// The previous attempt didn't work. We will try again after
 			// sleeping for a randomized amount of time to increase our chances
@@ -86,9 +99,14 @@ func (r *Renter) threadedUploadPiece(up modules.FileUploadParams, piece *filePie
 			Contract:   contract,
 			ContractID: contractID,
 
-			HostIP: host.IPAddress,
+			HostIP:        host.IPAddress,
+			HostKey:       host.PublicKey,
+			DownloadPrice: host.DownloadPrice,
 
 			EncryptionKey: key,
+
+			RenterKey:   renterKey,
+			RetrieveKey: retrieveKey,
 		}
 		r.save()
 		r.mu.Unlock(lockID)
@@ -0,0 +1,178 @@
+package modules
+
+// session.go implements the encrypted connections used for communication
+// between renters and hosts. The renter sends an ephemeral key, and the host
+// responds with its own ephemeral key, signed by the key that it published in
+// its announcement. Both parties derive a shared secret from the ephemeral
+// keys, and all further traffic is encrypted and authenticated using keys
+// derived from the secret. Because the host signs the handshake, a man in the
+// middle cannot impersonate the host or tamper with the traffic.
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+const (
+	// maxFrameSize is the largest amount of plaintext that is sent in a single
+	// encrypted frame.
+	maxFrameSize = 1 << 16
+)
+
+var (
+	ErrBadHostKey = errors.New("host key is not a valid ed25519 key")
+)
+
+// A sessionResponse is sent by the host during the handshake.
+type sessionResponse struct {
+	ExchangeKey crypto.ExchangePublicKey
+	Signature   crypto.Signature
+}
+
+// sessionSigHash returns the hash that the host signs during the handshake.
+func sessionSigHash(renterExchangeKey, hostExchangeKey crypto.ExchangePublicKey) crypto.Hash {
+	return crypto.HashAll("session", renterExchangeKey, hostExchangeKey)
+}
+
+// A sessionConn is a net.Conn that encrypts everything that is written to it
+// and decrypts everything that is read from it. Data is sent in frames, each
+// of which is authenticated. The nonce of each frame is a counter, so frames
+// cannot be replayed, dropped, or reordered without detection.
+type sessionConn struct {
+	net.Conn
+	sendAEAD  cipher.AEAD
+	recvAEAD  cipher.AEAD
+	sendCount uint64
+	recvCount uint64
+
+	// buf holds decrypted data that has not yet been read.
+	buf []byte
+}
+
+// newSessionConn creates a sessionConn from the secret shared by the renter
+// and the host. Each direction uses a different key.
+func newSessionConn(conn net.Conn, secret crypto.Hash, isHost bool) (*sessionConn, error) {
+	renterAEAD, err := crypto.TwofishKey(crypto.HashAll(secret, "renter")).NewAEAD()
+	if err != nil {
+		return nil, err
+	}
+	hostAEAD, err := crypto.TwofishKey(crypto.HashAll(secret, "host")).NewAEAD()
+	if err != nil {
+		return nil, err
+	}
+	if isHost {
+		return &sessionConn{Conn: conn, sendAEAD: hostAEAD, recvAEAD: renterAEAD}, nil
+	}
+	return &sessionConn{Conn: conn, sendAEAD: renterAEAD, recvAEAD: hostAEAD}, nil
+}
+
+// nonce returns the nonce for the frame with the given count.
+func nonce(aead cipher.AEAD, count uint64) []byte {
+	n := make([]byte, aead.NonceSize())
+	binary.LittleEndian.PutUint64(n, count)
+	return n
+}
+
+// Write implements the io.Writer interface.
+func (sc *sessionConn) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		frame := b
+		if len(frame) > maxFrameSize {
+			frame = frame[:maxFrameSize]
+		}
+		ct := sc.sendAEAD.Seal(nil, nonce(sc.sendAEAD, sc.sendCount), frame, nil)
+		sc.sendCount++
+		err := encoding.WritePrefix(sc.Conn, ct)
+		if err != nil {
+			return written, err
+		}
+		written += len(frame)
+		b = b[len(frame):]
+	}
+	return written, nil
+}
+
+// Read implements the io.Reader interface.
+func (sc *sessionConn) Read(b []byte) (int, error) {
+	if len(sc.buf) == 0 {
+		ct, err := encoding.ReadPrefix(sc.Conn, uint64(maxFrameSize+sc.recvAEAD.Overhead()))
+		if err != nil {
+			return 0, err
+		}
+		sc.buf, err = sc.recvAEAD.Open(nil, nonce(sc.recvAEAD, sc.recvCount), ct, nil)
+		if err != nil {
+			return 0, err
+		}
+		sc.recvCount++
+	}
+	n := copy(b, sc.buf)
+	sc.buf = sc.buf[n:]
+	return n, nil
+}
+
+// NewRenterSession performs the renter's half of the session handshake,
+// checking that the host holds the secret key for 'hostKey'. The returned
+// connection encrypts all traffic.
+func NewRenterSession(conn net.Conn, hostKey types.SiaPublicKey) (net.Conn, error) {
+	if hostKey.Algorithm != types.SignatureEd25519 {
+		return nil, ErrBadHostKey
+	}
+	var pk crypto.PublicKey
+	err := encoding.Unmarshal([]byte(hostKey.Key), &pk)
+	if err != nil {
+		return nil, ErrBadHostKey
+	}
+
+	// Exchange ephemeral keys and verify the host's signature.
+	sk, renterExchangeKey, err := crypto.GenerateExchangeKeys()
+	if err != nil {
+		return nil, err
+	}
+	err = encoding.WriteObject(conn, renterExchangeKey)
+	if err != nil {
+		return nil, err
+	}
+	var resp sessionResponse
+	err = encoding.ReadObject(conn, &resp, 256)
+	if err != nil {
+		return nil, err
+	}
+	err = crypto.VerifyHash(sessionSigHash(renterExchangeKey, resp.ExchangeKey), pk, resp.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSessionConn(conn, sk.SharedSecret(resp.ExchangeKey), false)
+}
+
+// NewHostSession performs the host's half of the session handshake, proving
+// to the renter that the host holds 'hostKey'. The returned connection
+// encrypts all traffic.
+func NewHostSession(conn net.Conn, hostKey crypto.SecretKey) (net.Conn, error) {
+	var renterExchangeKey crypto.ExchangePublicKey
+	err := encoding.ReadObject(conn, &renterExchangeKey, 256)
+	if err != nil {
+		return nil, err
+	}
+	sk, hostExchangeKey, err := crypto.GenerateExchangeKeys()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.SignHash(sessionSigHash(renterExchangeKey, hostExchangeKey), hostKey)
+	if err != nil {
+		return nil, err
+	}
+	err = encoding.WriteObject(conn, sessionResponse{hostExchangeKey, sig})
+	if err != nil {
+		return nil, err
+	}
+
+	return newSessionConn(conn, sk.SharedSecret(renterExchangeKey), true)
+}
@@ -82,8 +82,7 @@ type TransactionPool struct {
 	// up. To prevent deadlocks in the transaction pool, subscribers are
 	// updated in a separate thread which does not guarantee that a subscriber
 	// is always fully synchronized to the transaction pool.
-	revertBlocksUpdates     [][]types.Block
-	applyBlocksUpdates      [][]types.Block
+	consensusChanges        []modules.ConsensusChange
 	unconfirmedTransactions [][]types.Transaction
 	unconfirmedSiacoinDiffs [][]modules.SiacoinOutputDiff
 	subscribers             []chan struct{}
@@ -124,7 +123,10 @@ func New(cs *consensus.State, g modules.Gateway) (tp *TransactionPool, err error
 	g.RegisterRPC("RelayTransaction", tp.RelayTransaction)
 
 	// Subscribe the transaction pool to the consensus set.
-	cs.ConsensusSetSubscribe(tp)
+	err = cs.ConsensusSetSubscribe(tp, modules.ConsensusChangeBeginning)
+	if err != nil {
+		return nil, err
+	}
 
 	return
 }
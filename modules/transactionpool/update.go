@@ -307,17 +307,17 @@ func (tp *TransactionPool) applyDiffs(scods []modules.SiacoinOutputDiff, fcds []
 
 // ReceiveConsensusSetUpdate gets called to inform the transaction pool of
 // changes to the consensus set.
-func (tp *TransactionPool) ReceiveConsensusSetUpdate(revertedBlocks, appliedBlocks []types.Block) {
+func (tp *TransactionPool) ReceiveConsensusSetUpdate(cc modules.ConsensusChange) {
 	id := tp.mu.Lock()
 	defer tp.mu.Unlock(id)
 
 	// Save all of the reverted transactions. Transactions need to appear in
 	// 'unconfirmedTxns' in the same order that they would appear in the
-	// blockchain. 'revertedBlocks' is backwards (first element has highest
+	// blockchain. 'cc.RevertedBlocks' is backwards (first element has highest
 	// height), so each time a new block processed, the transactions need to be
 	// prepended to the list of unconfirmed transactions.
 	var unconfirmedTxns []types.Transaction
-	for _, block := range revertedBlocks {
+	for _, block := range cc.RevertedBlocks {
 		unconfirmedTxns = append(block.Transactions, unconfirmedTxns...)
 	}
 
@@ -344,40 +344,18 @@ func (tp *TransactionPool) ReceiveConsensusSetUpdate(revertedBlocks, appliedBloc
 	// blockchain.
 	tp.purge()
 
-	// Apply all of the reverted diffs to the unconfirmed set. revertedBlocks
-	// is already in reverse order; the first block has the highest height.
-	for _, block := range revertedBlocks {
-		scods, fcds, sfods, _, err := tp.consensusSet.BlockDiffs(block.ID())
-		if err != nil {
-			if build.DEBUG {
-				panic(err)
-			}
-		}
-		tp.applyDiffs(scods, fcds, sfods, modules.DiffRevert)
-
-		tp.consensusSetHeight--
-	}
+	// Apply the diffs of the change to the unconfirmed set. The diffs of the
+	// reverted blocks have already been inverted by the consensus set, so all
+	// of the diffs are applied in order.
+	tp.applyDiffs(cc.SiacoinOutputDiffs, cc.FileContractDiffs, cc.SiafundOutputDiffs, modules.DiffApply)
+	tp.consensusSetHeight -= types.BlockHeight(len(cc.RevertedBlocks))
+	tp.consensusSetHeight += types.BlockHeight(len(cc.AppliedBlocks))
 
-	// Handle applied blocks. The consensus set height needs to be incremented
-	// at the beginning so that all of the invalidations are looking at the
-	// correct height. The diffs need to be applied at the end so that removing
-	// unconfirmed transactions don't result in diff conflicts.
-	for _, block := range appliedBlocks {
-		// Add all of the diffs to the unconfirmed set.
-		scods, fcds, sfods, _, err := tp.consensusSet.BlockDiffs(block.ID())
-		if err != nil {
-			if build.DEBUG {
-				panic(err)
-			}
-		}
-		tp.applyDiffs(scods, fcds, sfods, modules.DiffApply)
-
-		// Mark all of the applied transactions as 'already seen'.
+	// Mark all of the applied transactions as 'already seen'.
+	for _, block := range cc.AppliedBlocks {
 		for _, txn := range block.Transactions {
 			tp.transactions[crypto.HashObject(txn)] = struct{}{}
 		}
-
-		tp.consensusSetHeight++
 	}
 
 	// Add all potential unconfirmed transactions back into the pool after
@@ -391,5 +369,5 @@ func (tp *TransactionPool) ReceiveConsensusSetUpdate(revertedBlocks, appliedBloc
 	}
 
 	// Inform the subscribers that an update has executed.
-	tp.updateSubscribers(revertedBlocks, appliedBlocks, tp.transactionList, tp.unconfirmedSiacoinOutputDiffs())
+	tp.updateSubscribers(cc, tp.transactionList, tp.unconfirmedSiacoinOutputDiffs())
 }
@@ -55,7 +55,7 @@ func (w *Wallet) applyDiff(scod modules.SiacoinOutputDiff, dir modules.DiffDirec
 // ReceiveTransactionPoolUpdate gets all of the changes in the confirmed and
 // unconfirmed set and uses them to update the balance and transaction history
 // of the wallet.
-func (w *Wallet) ReceiveTransactionPoolUpdate(revertedBlocks, appliedBlocks []types.Block, _ []types.Transaction, unconfirmedSiacoinDiffs []modules.SiacoinOutputDiff) {
+func (w *Wallet) ReceiveTransactionPoolUpdate(cc modules.ConsensusChange, _ []types.Transaction, unconfirmedSiacoinDiffs []modules.SiacoinOutputDiff) {
 	id := w.mu.Lock()
 	defer w.mu.Unlock(id)
 
@@ -63,33 +63,12 @@ func (w *Wallet) ReceiveTransactionPoolUpdate(revertedBlocks, appliedBlocks []ty
 		w.applyDiff(diff, modules.DiffRevert)
 	}
 
-	for _, block := range revertedBlocks {
-		w.age--
-
-		scods, err := w.state.BlockOutputDiffs(block.ID())
-		if err != nil {
-			if build.DEBUG {
-				panic(err)
-			}
-			continue
-		}
-		for _, scod := range scods {
-			w.applyDiff(scod, modules.DiffRevert)
-		}
-	}
-	for _, block := range appliedBlocks {
-		w.age++
-
-		scods, err := w.state.BlockOutputDiffs(block.ID())
-		if err != nil {
-			if build.DEBUG {
-				panic(err)
-			}
-			continue
-		}
-		for _, scod := range scods {
-			w.applyDiff(scod, modules.DiffApply)
-		}
+	// The diffs of reverted blocks have already been inverted by the
+	// consensus set, so every diff in the change is applied in order.
+	w.age -= len(cc.RevertedBlocks)
+	w.age += len(cc.AppliedBlocks)
+	for _, scod := range cc.SiacoinOutputDiffs {
+		w.applyDiff(scod, modules.DiffApply)
 	}
 
 	w.unconfirmedDiffs = unconfirmedSiacoinDiffs
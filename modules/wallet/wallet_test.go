@@ -77,7 +77,7 @@ func NewWalletTester(name string, t *testing.T) (wt *walletTester) {
 	testdir := tester.TempDir("wallet", name)
 
 	// Create the gateway.
-	g, err := gateway.New(":0", filepath.Join(testdir, modules.GatewayDir))
+	g, err := gateway.New(":0", "", filepath.Join(testdir, modules.GatewayDir))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,53 @@
+// Package persist contains helpers for reading and writing the Bolt databases
+// of the modules.
+package persist
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/NebulousLabs/Sia/build"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var (
+	ErrDatabaseCorrupt = errors.New("database is corrupt")
+)
+
+// HeightKey returns the database key of a height. Heights are encoded in big
+// endian so that the keys are sorted by height.
+func HeightKey(height types.BlockHeight) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(height))
+	return key
+}
+
+// MustPut stores a value in a bucket. Puts only fail if the transaction is
+// read-only or the key is invalid, both of which are developer errors.
+func MustPut(b *bolt.Bucket, key, value []byte) {
+	err := b.Put(key, value)
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+}
+
+// MustDelete removes a key from a bucket.
+func MustDelete(b *bolt.Bucket, key []byte) {
+	err := b.Delete(key)
+	if build.DEBUG && err != nil {
+		panic(err)
+	}
+}
+
+// MustUnmarshal decodes a value read from a database. Modules only read
+// values that they wrote themselves, so decoding can only fail if the
+// database is corrupt.
+func MustUnmarshal(value []byte, v interface{}) {
+	err := encoding.Unmarshal(value, v)
+	if err != nil {
+		panic(ErrDatabaseCorrupt)
+	}
+}
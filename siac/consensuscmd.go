@@ -40,8 +40,18 @@ func consensusstatuscmd() {
 		fmt.Println("Could not get daemon status:", err)
 		return
 	}
-	fmt.Printf(`Block:  %v
-Height: %v
-Target: %v
-`, info.CurrentBlock, info.Height, info.Target)
+	fmt.Printf(`Block:              %v
+Height:             %v
+Target:             %v
+Hashrate:           %v H/s
+Median timestamp:   %v
+Recent block times: %v
+Siafund pool:       %v
+Active contracts:   %v (%v bytes)
+`, info.CurrentBlock, info.Height, info.Target, info.EstimatedHashrate, info.MedianTimestamp,
+		info.RecentBlockTimes, info.SiafundPool, info.ActiveContractCount, info.ActiveContractSize)
+
+	if info.Sync.Synchronizing {
+		fmt.Printf("Synchronizing with %v: height %v of %v, %v blocks downloaded\n", info.Sync.Peer, info.Height, info.Sync.TargetHeight, info.Sync.BlocksDownloaded)
+	}
 }
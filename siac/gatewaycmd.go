@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/NebulousLabs/Sia/api"
+	"github.com/NebulousLabs/Sia/modules"
 )
 
 var (
@@ -30,6 +32,27 @@ var (
 		Run:   wrap(gatewayremovecmd),
 	}
 
+	gatewayBanCmd = &cobra.Command{
+		Use:   "ban",
+		Short: "View banned peers",
+		Long:  "View the hosts that the gateway will not connect to.",
+		Run:   wrap(gatewaybancmd),
+	}
+
+	gatewayBanAddCmd = &cobra.Command{
+		Use:   "add [address]",
+		Short: "Ban a peer",
+		Long:  "Ban a host, disconnecting from it and refusing future connections. The ban applies to every port of the host.",
+		Run:   wrap(gatewaybanaddcmd),
+	}
+
+	gatewayBanRemoveCmd = &cobra.Command{
+		Use:   "remove [address]",
+		Short: "Unban a peer",
+		Long:  "Remove the ban on a host.",
+		Run:   wrap(gatewaybanremovecmd),
+	}
+
 	gatewayStatusCmd = &cobra.Command{
 		Use:   "status",
 		Short: "View a list of peers",
@@ -69,7 +92,50 @@ func gatewaystatuscmd() {
 		return
 	}
 	fmt.Println(len(info.Peers), "active peers:")
-	for _, peer := range info.Peers {
-		fmt.Println("\t", peer)
+	for _, peer := range info.PeerInfo {
+		direction := "outbound"
+		if peer.Inbound {
+			direction = "inbound"
+		}
+		fmt.Printf("\t%v\tv%v\t%v\tconnected %v\n", peer.Address, peer.Version, direction, peer.ConnectTime.Format(time.Stamp))
+	}
+}
+
+func gatewaybancmd() {
+	var bans []modules.PeerBan
+	err := getAPI("/gateway/bans", &bans)
+	if err != nil {
+		fmt.Println("Could not get ban list:", err)
+		return
+	}
+	if len(bans) == 0 {
+		fmt.Println("No banned peers.")
+		return
+	}
+	fmt.Println(len(bans), "banned peers:")
+	for _, ban := range bans {
+		expiration := "never"
+		if ban.Expiration != 0 {
+			expiration = time.Unix(int64(ban.Expiration), 0).Format(time.Stamp)
+		}
+		fmt.Printf("\t%v\t%v\texpires %v\n", ban.Host, ban.Reason, expiration)
+	}
+}
+
+func gatewaybanaddcmd(addr string) {
+	err := callAPI("/gateway/bans/add?address=" + addr)
+	if err != nil {
+		fmt.Println("Could not ban peer:", err)
+		return
+	}
+	fmt.Println("Banned", addr)
+}
+
+func gatewaybanremovecmd(addr string) {
+	err := callAPI("/gateway/bans/remove?address=" + addr)
+	if err != nil {
+		fmt.Println("Could not unban peer:", err)
+		return
 	}
+	fmt.Println("Unbanned", addr)
 }
@@ -28,15 +28,18 @@ Available settings:
 	maxDuration
 	windowSize
 	price
-	collateral`,
+	collateral
+	downloadPrice`,
 		Run: wrap(hostconfigcmd),
 	}
 
 	hostAnnounceCmd = &cobra.Command{
 		Use:   "announce",
 		Short: "Announce yourself as a host",
-		Long:  "Announce yourself as a host on the network.",
-		Run:   wrap(hostannouncecmd)}
+		Long: `Announce yourself as a host on the network.
+The --address flag announces the host at a specific address, such as a
+hostname, instead of the address that the host discovered.`,
+		Run: wrap(hostannouncecmd)}
 
 	hostStatusCmd = &cobra.Command{
 		Use:   "status",
@@ -44,6 +47,35 @@ Available settings:
 		Long:  "View host settings, including available storage, price, and more.",
 		Run:   wrap(hoststatuscmd),
 	}
+
+	hostPricingCmd = &cobra.Command{
+		Use:   "pricing",
+		Short: "View host pricing policy",
+		Long:  "View the policy the host uses to adjust its price.",
+		Run:   wrap(hostpricingcmd),
+	}
+
+	hostPricingConfigCmd = &cobra.Command{
+		Use:   "config [setting] [value]",
+		Short: "Modify host pricing policy",
+		Long: `Modify the host pricing policy.
+Available settings:
+	enabled
+	basePrice
+	targetPrice
+	referenceRate
+	utilizationPremium
+	minPrice
+	maxPrice`,
+		Run: wrap(hostpricingconfigcmd),
+	}
+
+	hostMetricsCmd = &cobra.Command{
+		Use:   "metrics",
+		Short: "View host finances",
+		Long:  "View the host's revenue and collateral, and the status of each contract.",
+		Run:   wrap(hostmetricscmd),
+	}
 )
 
 func hostconfigcmd(param, value string) {
@@ -55,8 +87,35 @@ func hostconfigcmd(param, value string) {
 	fmt.Println("Host settings updated.")
 }
 
+func hostpricingconfigcmd(param, value string) {
+	err := callAPI(fmt.Sprintf("/host/pricing/configure?%s=%s", param, value))
+	if err != nil {
+		fmt.Println("Could not update pricing policy:", err)
+		return
+	}
+	fmt.Println("Pricing policy updated.")
+}
+
+func hostpricingcmd() {
+	policy := new(modules.HostPricingPolicy)
+	err := getAPI("/host/pricing", policy)
+	if err != nil {
+		fmt.Println("Could not fetch pricing policy:", err)
+		return
+	}
+	fmt.Printf(`Pricing policy:
+Enabled:             %v
+Base Price:          %v
+Target Price:        %v
+Reference Rate:      %v
+Utilization Premium: %v%%
+Min Price:           %v
+Max Price:           %v
+`, policy.Enabled, policy.BasePrice, policy.TargetPrice, policy.ReferenceRate, policy.UtilizationPremium, policy.MinPrice, policy.MaxPrice)
+}
+
 func hostannouncecmd() {
-	err := callAPI("/host/announce")
+	err := callAPI("/host/announce?address=" + announceAddress)
 	if err != nil {
 		fmt.Println("Could not announce host:", err)
 		return
@@ -72,11 +131,38 @@ func hoststatuscmd() {
 		return
 	}
 	fmt.Printf(`Host settings:
-Storage:      %v bytes (%v remaining)
-Price:        %v coins
-Collateral:   %v
-Max Filesize: %v
-Max Duration: %v
-Contracts:    %v
-`, info.TotalStorage, info.StorageRemaining, info.Price, info.Collateral, info.MaxFilesize, info.MaxDuration, info.NumContracts)
+Storage:        %v bytes (%v remaining)
+Price:          %v coins
+Collateral:     %v
+Download Price: %v
+Max Filesize:   %v
+Max Duration:   %v
+Contracts:      %v
+`, info.TotalStorage, info.StorageRemaining, info.Price, info.Collateral, info.DownloadPrice, info.MaxFilesize, info.MaxDuration, info.NumContracts)
+}
+
+func hostmetricscmd() {
+	info := new(modules.HostInfo)
+	err := getAPI("/host/status", info)
+	if err != nil {
+		fmt.Println("Could not fetch host metrics:", err)
+		return
+	}
+	fmt.Printf(`Host metrics:
+Locked Collateral:   %v
+Anticipated Revenue: %v
+Realized Revenue:    %v
+Lost Collateral:     %v
+Download Revenue:    %v
+Contracts:           %v
+`, info.LockedCollateral, info.AnticipatedRevenue, info.RevenueRealized, info.CollateralLost, info.DownloadRevenue, info.NumContracts)
+	for _, c := range info.Contracts {
+		status := "unconfirmed"
+		if c.ProofConfirmed {
+			status = "proof confirmed"
+		} else if c.ContractConfirmed {
+			status = "active"
+		}
+		fmt.Printf("%x  %v bytes  window %v-%v  collateral %v  revenue %v  %v\n", c.ID, c.FileSize, c.WindowStart, c.WindowEnd, c.Collateral, c.Revenue, status)
+	}
 }
@@ -17,7 +17,10 @@ const (
 )
 
 var (
-	port string
+	port            string
+	announceAddress string
+	downloadOffset  string
+	downloadLength  string
 )
 
 // get wraps a GET request with a status code check, such that if the GET does
@@ -110,7 +113,8 @@ func main() {
 	})
 
 	root.AddCommand(hostCmd)
-	hostCmd.AddCommand(hostConfigCmd, hostAnnounceCmd, hostStatusCmd)
+	hostCmd.AddCommand(hostConfigCmd, hostAnnounceCmd, hostStatusCmd, hostMetricsCmd, hostPricingCmd)
+	hostPricingCmd.AddCommand(hostPricingConfigCmd)
 
 	root.AddCommand(minerCmd)
 	minerCmd.AddCommand(minerStartCmd, minerStopCmd, minerStatusCmd)
@@ -122,7 +126,8 @@ func main() {
 	renterCmd.AddCommand(renterUploadCmd, renterDownloadCmd, renterDownloadQueueCmd, renterStatusCmd)
 
 	root.AddCommand(gatewayCmd)
-	gatewayCmd.AddCommand(gatewayAddCmd, gatewayRemoveCmd, gatewayStatusCmd)
+	gatewayCmd.AddCommand(gatewayAddCmd, gatewayRemoveCmd, gatewayStatusCmd, gatewayBanCmd)
+	gatewayBanCmd.AddCommand(gatewayBanAddCmd, gatewayBanRemoveCmd)
 
 	root.AddCommand(updateCmd)
 	updateCmd.AddCommand(updateCheckCmd, updateApplyCmd)
@@ -133,6 +138,9 @@ func main() {
 
 	// parse flags
 	root.PersistentFlags().StringVarP(&port, "port", "p", "9980", "which port to communicate with (i.e. the port siad is listening on)")
+	hostAnnounceCmd.Flags().StringVarP(&announceAddress, "address", "a", "", "the address to announce the host at, e.g. host.example.com:9982")
+	renterDownloadCmd.Flags().StringVarP(&downloadOffset, "offset", "o", "", "the byte of the file to start downloading at")
+	renterDownloadCmd.Flags().StringVarP(&downloadLength, "length", "l", "", "the number of bytes of the file to download")
 
 	// run
 	root.Execute()
@@ -27,7 +27,7 @@ var (
 	renterDownloadCmd = &cobra.Command{
 		Use:   "download [nickname] [destination]",
 		Short: "Download a file",
-		Long:  "Download a previously-uploaded file to a specified destination.",
+		Long:  "Download a previously-uploaded file, or a range of the file, to a specified destination.",
 		Run:   wrap(renterdownloadcmd),
 	}
 
@@ -56,7 +56,11 @@ func renteruploadcmd(source, nickname string) {
 }
 
 func renterdownloadcmd(nickname, destination string) {
-	err := callAPI(fmt.Sprintf("/renter/download?nickname=%s&destination=%s", nickname, destination))
+	call := fmt.Sprintf("/renter/download?nickname=%s&destination=%s", nickname, destination)
+	if downloadOffset != "" || downloadLength != "" {
+		call += fmt.Sprintf("&offset=%s&length=%s", downloadOffset, downloadLength)
+	}
+	err := callAPI(call)
 	if err != nil {
 		fmt.Println("Could not download file:", err)
 		return
@@ -6,8 +6,10 @@ import (
 	"runtime"
 
 	"github.com/NebulousLabs/Sia/api"
+	"github.com/NebulousLabs/Sia/crypto"
 	"github.com/NebulousLabs/Sia/modules"
 	"github.com/NebulousLabs/Sia/modules/consensus"
+	"github.com/NebulousLabs/Sia/modules/explorer"
 	"github.com/NebulousLabs/Sia/modules/gateway"
 	"github.com/NebulousLabs/Sia/modules/host"
 	"github.com/NebulousLabs/Sia/modules/hostdb"
@@ -25,14 +27,33 @@ func startDaemon() error {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
 	// Create all of the modules.
-	gateway, err := gateway.New(config.Siad.RPCaddr, filepath.Join(config.Siad.SiaDir, "gateway"))
+	gateway, err := gateway.New(config.Siad.RPCaddr, config.Siad.ExternalIP, filepath.Join(config.Siad.SiaDir, "gateway"))
 	if err != nil {
 		return err
 	}
-	state, err := consensus.New(gateway, filepath.Join(config.Siad.SiaDir, "consensus"))
+	checkpoints, err := parseCheckpoints(config.Siad.Checkpoints)
 	if err != nil {
 		return err
 	}
+	var snap *consensus.Snapshot
+	var snapKey crypto.PublicKey
+	if config.Siad.BootstrapSnapshot != "" {
+		snap, snapKey, err = readSnapshot(config.Siad.BootstrapSnapshot, config.Siad.SnapshotKey)
+		if err != nil {
+			return err
+		}
+	}
+	state, err := consensus.NewBootstrapped(gateway, filepath.Join(config.Siad.SiaDir, "consensus"), checkpoints, snap, snapKey)
+	if err != nil {
+		return err
+	}
+	var exp modules.Explorer
+	if config.Siad.Explorer {
+		exp, err = explorer.New(state, filepath.Join(config.Siad.SiaDir, modules.ExplorerDir))
+		if err != nil {
+			return err
+		}
+	}
 	tpool, err := transactionpool.New(state, gateway)
 	if err != nil {
 		return err
@@ -45,11 +66,11 @@ func startDaemon() error {
 	if err != nil {
 		return err
 	}
-	host, err := host.New(state, tpool, wallet, config.Siad.HostAddr, filepath.Join(config.Siad.SiaDir, "host"))
+	host, err := host.New(state, gateway, tpool, wallet, config.Siad.HostAddr, filepath.Join(config.Siad.SiaDir, "host"))
 	if err != nil {
 		return err
 	}
-	hostdb, err := hostdb.New(state, gateway)
+	hostdb, err := hostdb.New(state, gateway, filepath.Join(config.Siad.SiaDir, "hostdb"))
 	if err != nil {
 		return err
 	}
@@ -57,7 +78,7 @@ func startDaemon() error {
 	if err != nil {
 		return err
 	}
-	srv, err := api.NewServer(config.Siad.APIaddr, state, gateway, host, hostdb, miner, renter, tpool, wallet)
+	srv, err := api.NewServer(config.Siad.APIaddr, state, exp, gateway, host, hostdb, miner, renter, tpool, wallet)
 	if err != nil {
 		return err
 	}
@@ -23,12 +23,18 @@ var (
 type Config struct {
 	Siad struct {
 		NoBootstrap bool
+		Explorer    bool
 
-		APIaddr  string
-		RPCaddr  string
-		HostAddr string
+		APIaddr    string
+		RPCaddr    string
+		HostAddr   string
+		ExternalIP string
 
 		SiaDir string
+
+		Checkpoints       string
+		BootstrapSnapshot string
+		SnapshotKey       string
 	}
 }
 
@@ -61,12 +67,24 @@ func main() {
 		Run:   versionCmd,
 	})
 
+	root.AddCommand(&cobra.Command{
+		Use:   "snapshot [height] [filename] [keyfile]",
+		Short: "Export a signed snapshot of the consensus set",
+		Long:  "Export a snapshot of the consensus set at a height, signed with the key in keyfile. A new key is created if keyfile does not exist. siad must not be running.",
+		Run:   snapshotCmd,
+	})
+
 	// Set default values, which have the lowest priority.
 	root.PersistentFlags().BoolVarP(&config.Siad.NoBootstrap, "no-bootstrap", "n", false, "disable bootstrapping on this run")
+	root.PersistentFlags().BoolVarP(&config.Siad.Explorer, "explorer", "", false, "index the blockchain so that it can be browsed through the explorer API")
 	root.PersistentFlags().StringVarP(&config.Siad.APIaddr, "api-addr", "a", "localhost:9980", "which host:port the API server listens on")
 	root.PersistentFlags().StringVarP(&config.Siad.RPCaddr, "rpc-addr", "r", ":9981", "which port the gateway listens on")
 	root.PersistentFlags().StringVarP(&config.Siad.HostAddr, "host-addr", "H", ":9982", "which port the host listens on")
+	root.PersistentFlags().StringVarP(&config.Siad.ExternalIP, "external-ip", "e", "", "the IP address or hostname that other nodes reach this node at (learned from peers if not set)")
 	root.PersistentFlags().StringVarP(&config.Siad.SiaDir, "sia-directory", "d", "", "location of the sia directory")
+	root.PersistentFlags().StringVarP(&config.Siad.Checkpoints, "checkpoints", "", "", "comma-separated checkpoints to enforce, each given as height:blockid")
+	root.PersistentFlags().StringVarP(&config.Siad.BootstrapSnapshot, "bootstrap-snapshot", "", "", "load a snapshot of the consensus set into a new node instead of validating the blockchain from genesis")
+	root.PersistentFlags().StringVarP(&config.Siad.SnapshotKey, "snapshot-key", "", "", "hex-encoded public key that the bootstrap snapshot must be signed by")
 
 	// Parse cmdline flags, overwriting both the default values and the config
 	// file values.
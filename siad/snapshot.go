@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+	"github.com/NebulousLabs/Sia/modules/consensus"
+	"github.com/NebulousLabs/Sia/types"
+)
+
+var errBadCheckpoint = errors.New("checkpoints must be given as height:blockid")
+
+// parseCheckpoints parses a comma-separated list of checkpoints, each given as
+// height:blockid.
+func parseCheckpoints(checkpoints string) (map[types.BlockHeight]types.BlockID, error) {
+	parsed := make(map[types.BlockHeight]types.BlockID)
+	if checkpoints == "" {
+		return parsed, nil
+	}
+	for _, checkpoint := range strings.Split(checkpoints, ",") {
+		var height types.BlockHeight
+		var idBytes []byte
+		_, err := fmt.Sscanf(checkpoint, "%d:%x", &height, &idBytes)
+		if err != nil || len(idBytes) != len(types.BlockID{}) {
+			return nil, errBadCheckpoint
+		}
+		var id types.BlockID
+		copy(id[:], idBytes)
+		parsed[height] = id
+	}
+	return parsed, nil
+}
+
+// readSnapshot reads the snapshot of the consensus set in filename, along
+// with the hex-encoded snapshot key that it must be signed by.
+func readSnapshot(filename string, key string) (*consensus.Snapshot, crypto.PublicKey, error) {
+	var pk crypto.PublicKey
+	var pkBytes []byte
+	_, err := fmt.Sscanf(key, "%x", &pkBytes)
+	if err != nil || len(pkBytes) != crypto.PublicKeySize {
+		return nil, pk, errors.New("a valid --snapshot-key is needed to bootstrap from a snapshot")
+	}
+	copy(pk[:], pkBytes)
+
+	var snap consensus.Snapshot
+	err = encoding.ReadFile(filename, &snap)
+	if err != nil {
+		return nil, pk, err
+	}
+	return &snap, pk, nil
+}
+
+// snapshotCmd exports a snapshot of the consensus set at a height, signed
+// with the secret key in keyfile. If keyfile does not exist, a new key is
+// generated and saved to it. siad must not be running.
+func snapshotCmd(_ *cobra.Command, args []string) {
+	if len(args) != 3 {
+		fmt.Println("Usage: siad snapshot [height] [filename] [keyfile]")
+		return
+	}
+	var height types.BlockHeight
+	_, err := fmt.Sscan(args[0], &height)
+	if err != nil {
+		fmt.Println("Could not parse height:", err)
+		return
+	}
+
+	var sk crypto.SecretKey
+	if _, err := os.Stat(args[2]); os.IsNotExist(err) {
+		sk, _, err = crypto.GenerateSignatureKeys()
+		if err == nil {
+			err = ioutil.WriteFile(args[2], encoding.Marshal(sk), 0600)
+		}
+		if err != nil {
+			fmt.Println("Could not create snapshot key:", err)
+			return
+		}
+	} else if err = encoding.ReadFile(args[2], &sk); err != nil {
+		fmt.Println("Could not read snapshot key:", err)
+		return
+	}
+
+	snap, err := consensus.ExportSnapshot(filepath.Join(config.Siad.SiaDir, "consensus"), height)
+	if err == nil {
+		err = snap.Sign(sk)
+	}
+	if err == nil {
+		err = encoding.WriteFile(args[1], snap)
+	}
+	if err != nil {
+		fmt.Println("Could not export snapshot:", err)
+		return
+	}
+	fmt.Printf("Exported snapshot at checkpoint %v:%x, signed by snapshot key %x\n", height, snap.Blocks[height-1].ID(), snap.PublicKey)
+}
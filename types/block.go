@@ -25,6 +25,16 @@ type (
 		Transactions []Transaction
 	}
 
+	// A BlockHeader contains the fields of a Block that are needed to compute
+	// its ID. A header is much smaller than its block, so a chain of headers
+	// can be checked for proof of work before any blocks are downloaded.
+	BlockHeader struct {
+		ParentID   BlockID
+		Nonce      uint64
+		Timestamp  Timestamp
+		MerkleRoot crypto.Hash
+	}
+
 	BlockHeight uint64
 	BlockID     crypto.Hash
 )
@@ -45,13 +55,34 @@ func CalculateCoinbase(height BlockHeight) (c Currency) {
 // concatenation of the block's parent's ID, nonce, and the result of the
 // b.MerkleRoot().
 func (b Block) ID() BlockID {
+	return b.Header().ID()
+}
+
+// Header returns the header of a Block.
+func (b Block) Header() BlockHeader {
+	return BlockHeader{
+		ParentID:   b.ParentID,
+		Nonce:      b.Nonce,
+		Timestamp:  b.Timestamp,
+		MerkleRoot: b.MerkleRoot(),
+	}
+}
+
+// ID returns the ID of the block that a BlockHeader belongs to.
+func (bh BlockHeader) ID() BlockID {
 	return BlockID(crypto.HashAll(
-		b.ParentID,
-		b.Nonce,
-		b.MerkleRoot(),
+		bh.ParentID,
+		bh.Nonce,
+		bh.MerkleRoot,
 	))
 }
 
+// CheckTarget returns true if the header's ID meets the given target.
+func (bh BlockHeader) CheckTarget(target Target) bool {
+	blockHash := bh.ID()
+	return bytes.Compare(target[:], blockHash[:]) >= 0
+}
+
 // CheckTarget returns true if the block's ID meets the given target.
 func (b Block) CheckTarget(target Target) bool {
 	blockHash := b.ID()
@@ -111,3 +111,25 @@ func TestBlockMinerPayoutID(t *testing.T) {
 		knownIDs[id] = struct{}{}
 	}
 }
+
+// TestBlockHeader probes the Header function of the block type.
+func TestBlockHeader(t *testing.T) {
+	// The header of a block should have the same ID as the block, and should
+	// change when the transactions of the block change.
+	b := Block{
+		Nonce:        12,
+		Timestamp:    CurrentTimestamp(),
+		MinerPayouts: []SiacoinOutput{SiacoinOutput{Value: CalculateCoinbase(0)}},
+	}
+	header := b.Header()
+	if header.ID() != b.ID() {
+		t.Error("header ID does not match block ID")
+	}
+	if !header.CheckTarget(Target(b.ID())) {
+		t.Error("CheckTarget failed for a same target")
+	}
+	b.Transactions = append(b.Transactions, Transaction{MinerFees: []Currency{CalculateCoinbase(1)}})
+	if b.Header().ID() == header.ID() {
+		t.Error("header ID did not change with the transactions")
+	}
+}
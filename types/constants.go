@@ -22,6 +22,11 @@ var (
 	SiafundCount          uint64
 	SiafundPortion        float64
 
+	// ExtremeFutureThreshold is the furthest into the future that a block
+	// timestamp can be for the block to be held until it is valid. Blocks
+	// further in the future are rejected.
+	ExtremeFutureThreshold Timestamp
+
 	InitialCoinbase uint64
 	MinimumCoinbase uint64
 
@@ -54,6 +59,8 @@ func init() {
 		SiafundCount = 10e3           // 10,000 total siafunds.
 		SiafundPortion = 0.039
 
+		ExtremeFutureThreshold = 5 * 60 * 60 // 5 hours.
+
 		InitialCoinbase = 300e3
 		MinimumCoinbase = 30e3
 
@@ -81,10 +88,12 @@ func init() {
 		BlockFrequency = 1  // As fast as possible
 		TargetWindow = 10e3 // Large to prevent the difficulty from increasing during testing.
 		MedianTimestampWindow = 11
-		FutureThreshold = 3 * 60 * 60
+		FutureThreshold = 3 // Small enough that held blocks can be tested.
 		SiafundCount = 10e3
 		SiafundPortion = 0.039
 
+		ExtremeFutureThreshold = 6
+
 		InitialCoinbase = 300e3
 		MinimumCoinbase = 299990 // Minimum coinbase is hit after 10 blocks to make testing minimum-coinbase code easier.
 
@@ -116,6 +125,8 @@ func init() {
 		SiafundCount = 10e3           // The total (static) number of siafunds.
 		SiafundPortion = 0.039        // Percent of all contract payouts that go to the siafund pool.
 
+		ExtremeFutureThreshold = 5 * 60 * 60 // Seconds into the future block timestamps are held until they are valid.
+
 		InitialCoinbase = 300e3
 		MinimumCoinbase = 30e3
 
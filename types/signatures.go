@@ -362,7 +362,7 @@ func (t *Transaction) validSignatures(currentHeight BlockHeight) error {
 			cryptoSig := crypto.Signature(edSig)
 
 			sigHash := t.SigHash(i)
-			err = crypto.VerifyHash(sigHash, edPK, cryptoSig)
+			err = verifySignature(sigHash, edPK, cryptoSig)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,138 @@
+package types
+
+// verifycache.go contains caches of verified signatures and storage proofs.
+// Verifying signatures and storage proofs is the most expensive part of
+// validating a transaction, and most transactions are validated twice: once
+// when they enter the transaction pool, and again when they appear in a block.
+// Only successful verifications are cached, and the cache key covers every
+// input of the verification, so a cached result is always correct. The caches
+// are shared by every user of the types package.
+
+import (
+	"sync"
+
+	"github.com/NebulousLabs/Sia/crypto"
+	"github.com/NebulousLabs/Sia/encoding"
+)
+
+const (
+	// maxVerifyCacheSize is the maximum number of entries in each
+	// verification cache. When a cache is full, a random entry is evicted.
+	maxVerifyCacheSize = 100e3
+)
+
+var (
+	signatureCache    = newVerifyCache()
+	storageProofCache = newVerifyCache()
+)
+
+// A verifyCache is a set of hashes of inputs that were successfully verified.
+type verifyCache struct {
+	entries map[crypto.Hash]struct{}
+	mu      sync.RWMutex
+}
+
+// newVerifyCache returns an empty verifyCache.
+func newVerifyCache() *verifyCache {
+	return &verifyCache{
+		entries: make(map[crypto.Hash]struct{}),
+	}
+}
+
+// contains returns true if the key is in the cache.
+func (vc *verifyCache) contains(key crypto.Hash) bool {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	_, exists := vc.entries[key]
+	return exists
+}
+
+// add adds a key to the cache, evicting a random entry if the cache is full.
+func (vc *verifyCache) add(key crypto.Hash) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if len(vc.entries) >= maxVerifyCacheSize {
+		for evict := range vc.entries {
+			delete(vc.entries, evict)
+			break
+		}
+	}
+	vc.entries[key] = struct{}{}
+}
+
+// verifySignature verifies an ed25519 signature of a hash, consulting and
+// updating the signature cache.
+func verifySignature(sigHash crypto.Hash, pk crypto.PublicKey, sig crypto.Signature) error {
+	key := crypto.HashAll(sigHash, pk, sig)
+	if signatureCache.contains(key) {
+		return nil
+	}
+	err := crypto.VerifyHash(sigHash, pk, sig)
+	if err != nil {
+		return err
+	}
+	signatureCache.add(key)
+	return nil
+}
+
+// VerifySignatures verifies the ed25519 signatures of a transaction, adding
+// them to the signature cache. Only the cryptography is checked; the rules
+// that depend on the rest of the transaction or the height are checked by
+// StandaloneValid, which finds the signatures in the cache. Signatures that
+// do not refer to an ed25519 key of the transaction are skipped.
+func (t Transaction) VerifySignatures() error {
+	keys := make(map[crypto.Hash][]SiaPublicKey)
+	for _, sci := range t.SiacoinInputs {
+		keys[crypto.Hash(sci.ParentID)] = sci.UnlockConditions.PublicKeys
+	}
+	for _, fcr := range t.FileContractRevisions {
+		keys[crypto.Hash(fcr.ParentID)] = fcr.UnlockConditions.PublicKeys
+	}
+	for _, sfi := range t.SiafundInputs {
+		keys[crypto.Hash(sfi.ParentID)] = sfi.UnlockConditions.PublicKeys
+	}
+
+	for i, sig := range t.TransactionSignatures {
+		pks := keys[crypto.Hash(sig.ParentID)]
+		if sig.PublicKeyIndex >= uint64(len(pks)) || pks[sig.PublicKeyIndex].Algorithm != SignatureEd25519 {
+			continue
+		}
+		var edPK crypto.PublicKey
+		err := encoding.Unmarshal([]byte(pks[sig.PublicKeyIndex].Key), &edPK)
+		if err != nil {
+			return err
+		}
+		var edSig crypto.Signature
+		err = encoding.Unmarshal([]byte(sig.Signature), &edSig)
+		if err != nil {
+			return err
+		}
+		err = verifySignature(t.SigHash(i), edPK, edSig)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyStorageProof checks that a storage proof proves the segment at
+// segmentIndex of the file in a file contract, consulting and updating the
+// storage proof cache.
+func VerifyStorageProof(sp StorageProof, fc FileContract, segmentIndex uint64) bool {
+	key := crypto.HashAll(sp, fc.FileMerkleRoot, fc.FileSize, segmentIndex)
+	if storageProofCache.contains(key) {
+		return true
+	}
+
+	verified := crypto.VerifySegment(
+		sp.Segment,
+		sp.HashSet,
+		crypto.CalculateSegments(fc.FileSize),
+		segmentIndex,
+		fc.FileMerkleRoot,
+	)
+	if verified {
+		storageProofCache.add(key)
+	}
+	return verified
+}
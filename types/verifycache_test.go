@@ -0,0 +1,91 @@
+package types
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NebulousLabs/Sia/crypto"
+)
+
+// TestVerifySignatures checks that VerifySignatures caches valid signatures
+// and rejects invalid ones.
+func TestVerifySignatures(t *testing.T) {
+	sk, pk, err := crypto.GenerateSignatureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := Transaction{
+		SiacoinInputs: []SiacoinInput{{
+			UnlockConditions: UnlockConditions{
+				PublicKeys: []SiaPublicKey{{
+					Algorithm: SignatureEd25519,
+					Key:       string(pk[:]),
+				}},
+				SignaturesRequired: 1,
+			},
+		}},
+		TransactionSignatures: []TransactionSignature{{
+			CoveredFields: CoveredFields{WholeTransaction: true},
+		}},
+	}
+	sigHash := txn.SigHash(0)
+	sig, err := crypto.SignHash(sigHash, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.TransactionSignatures[0].Signature = Signature(sig[:])
+
+	err = txn.VerifySignatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signatureCache.contains(crypto.HashAll(sigHash, pk, sig)) {
+		t.Error("verified signature was not cached")
+	}
+
+	// A corrupted signature is rejected and not cached.
+	sig[0]++
+	txn.TransactionSignatures[0].Signature = Signature(sig[:])
+	if txn.VerifySignatures() == nil {
+		t.Error("corrupted signature was verified")
+	}
+	if signatureCache.contains(crypto.HashAll(sigHash, pk, sig)) {
+		t.Error("corrupted signature was cached")
+	}
+	if txn.validSignatures(0) == nil {
+		t.Error("corrupted signature passed validSignatures")
+	}
+}
+
+// TestVerifyStorageProof checks that VerifyStorageProof caches valid storage
+// proofs and rejects invalid ones.
+func TestVerifyStorageProof(t *testing.T) {
+	data := make([]byte, 4*crypto.SegmentSize)
+	data[0] = 1
+	data[3*crypto.SegmentSize] = 2
+	root, err := crypto.ReaderMerkleRoot(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := FileContract{
+		FileSize:       uint64(len(data)),
+		FileMerkleRoot: root,
+	}
+	segment, hashSet, err := crypto.BuildReaderProof(bytes.NewReader(data), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := StorageProof{Segment: segment, HashSet: hashSet}
+
+	if !VerifyStorageProof(sp, fc, 3) {
+		t.Fatal("valid storage proof was not verified")
+	}
+	if !storageProofCache.contains(crypto.HashAll(sp, fc.FileMerkleRoot, fc.FileSize, uint64(3))) {
+		t.Error("verified storage proof was not cached")
+	}
+
+	// The proof does not prove a different segment.
+	if VerifyStorageProof(sp, fc, 2) {
+		t.Error("storage proof verified for the wrong segment")
+	}
+}